@@ -1,20 +1,31 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	paho "github.com/eclipse/paho.mqtt.golang"
 
 	"github.com/joho/godotenv"
 	"github.com/perm1ss10n/vexora/backend/internal/auth"
+	"github.com/perm1ss10n/vexora/backend/internal/codec"
 	"github.com/perm1ss10n/vexora/backend/internal/commands"
+	"github.com/perm1ss10n/vexora/backend/internal/compliance"
+	"github.com/perm1ss10n/vexora/backend/internal/configs"
+	"github.com/perm1ss10n/vexora/backend/internal/firmware"
 	"github.com/perm1ss10n/vexora/backend/internal/httpapi"
 	"github.com/perm1ss10n/vexora/backend/internal/influx"
 	"github.com/perm1ss10n/vexora/backend/internal/mqtt"
+	"github.com/perm1ss10n/vexora/backend/internal/oplock"
+	"github.com/perm1ss10n/vexora/backend/internal/ota"
 	"github.com/perm1ss10n/vexora/backend/internal/registry"
+	"github.com/perm1ss10n/vexora/backend/internal/scheduler"
+	"github.com/perm1ss10n/vexora/backend/internal/secrets"
 )
 
 type pahoPublisher struct {
@@ -29,6 +40,13 @@ func (p pahoPublisher) Publish(topic string, qos byte, retained bool, payload []
 
 func main() {
 	_ = godotenv.Load()
+	if len(os.Args) > 1 && os.Args[1] == "ota-sign" {
+		if err := runOTASign(os.Args[2:]); err != nil {
+			log.Fatalf("ota-sign: %v", err)
+		}
+		return
+	}
+
 	// Influx (опционально): если токена нет — просто логируем без записи
 	var influxClient *influx.Client
 	icfg := influx.LoadConfigFromEnv()
@@ -49,6 +67,19 @@ func main() {
 	defer reg.Close()
 	log.Printf("[REGISTRY] enabled db=%s", rcfg.Path)
 
+	// Секретные поля конфигураций: envelope-шифрование в SQLite, ключи — в локальном файле
+	keyring, err := secrets.LoadKeyringFromEnv()
+	if err != nil {
+		log.Fatalf("config secrets key init failed: %v", err)
+	}
+	secretCipher := secrets.NewCipher(keyring, secrets.LoadPathsFromEnv())
+	reg.SetDocCipher(secretCipher)
+	resealed, err := reg.ResealConfigDocs(context.Background())
+	if err != nil {
+		log.Fatalf("config secrets reseal failed: %v", err)
+	}
+	log.Printf("[CFG_SECRETS] enabled kid=%s paths=%d resealed=%d", keyring.Active(), len(secretCipher.Paths()), resealed)
+
 	tokenService, err := auth.NewTokenServiceFromEnv()
 	if err != nil {
 		log.Fatalf("auth token init failed: %v", err)
@@ -60,28 +91,136 @@ func main() {
 		Registry: reg,
 	}
 	d.InitRateLimitFromEnv()
-	handler := mqtt.MakeMessageHandler(d)
+	d.SetSeqConfig(mqtt.LoadSeqConfigFromEnv())
+	d.SetTelemetryLimits(mqtt.LoadTelemetryLimitsFromEnv())
+	d.SetRequestLimits(mqtt.LoadRequestLimitsFromEnv())
+
+	// Сжатые payload: лимиты распаковки и общие словари (v{N}.dict, N — версия протокола)
+	dicts, err := codec.LoadDictionaries(codec.DictDirFromEnv())
+	if err != nil {
+		log.Fatalf("compression dictionaries init failed: %v", err)
+	}
+	d.SetCompression(codec.LoadCompressionLimitsFromEnv(), dicts)
+	log.Printf("[CODEC] compression dictionaries=%d", len(dicts.List()))
+
+	// Очередь приёма: шарды по deviceId, воркеры, политика перегрузки
+	ingest := mqtt.NewIngest(d, mqtt.LoadIngestConfigFromEnv())
+	log.Printf("[INGEST] enabled workers=%d queue=%d policy=%s", ingest.Config().Workers, ingest.Config().QueueSize, ingest.Config().Policy)
 
 	cfg := mqtt.LoadConfigFromEnv()
 	mqtt.MustPrintConfig(cfg)
-	lost := make(chan error, 1)
 
-	c := mqtt.NewClient(cfg, handler, lost)
+	// MQTT_VERSION=5 — клиент MQTT 5 (response topic / correlation data / expiry у cmd), иначе paho v3.1.1
+	var mqttPub commands.Publisher
+	var mqttConnect func() error
+	var mqttStop func()
+	if cfg.Version == 5 {
+		c5 := mqtt.NewClient5(cfg, ingest)
+		mqttPub = c5
+		mqttConnect = func() error { return c5.Connect(context.Background()) }
+		mqttStop = func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := c5.Disconnect(ctx); err != nil {
+				log.Printf("[MQTT] disconnect_failed proto=5 err=%v", err)
+			}
+		}
+	} else {
+		lost := make(chan error, 1)
+		c := mqtt.NewClient(cfg, ingest.Handler(), lost)
+		mqttPub = pahoPublisher{c: c}
+		mqttConnect = func() error { return mqtt.Connect(c, cfg, lost) }
+		mqttStop = func() { c.Disconnect(250) }
+	}
 
 	// Commands + HTTP API (stage 2.4)
-	// `c` is already a paho.Client (same type), no assertion needed.
-	cmdMgr := commands.New(pahoPublisher{c: c})
+	// Блокировки устройств: команды, доставка cfg и OTA не выполняются параллельно
+	locks := oplock.New(reg, oplock.LoadConfigFromEnv())
+	d.Locks = locks
+
+	// Кодировка устройства (json/msgpack/cbor) — по входящим сообщениям; в ней же уходят cmd/cfg/resp/ota
+	encodings := codec.NewPreferences(reg)
+	d.Encodings = encodings
+	pub := codec.NewPublisher(mqttPub, encodings)
+
+	cmdMgr := commands.New(pub)
+	cmdMgr.SetRetryPolicy(commands.LoadRetryPolicyFromEnv())
+	cmdMgr.SetLateAckGrace(commands.LoadLateAckGraceFromEnv())
+	cmdMgr.SetHistory(reg)
+	cmdMgr.SetLocks(locks)
 	d.Commands = cmdMgr
+	d.Publisher = pub
+
+	// Desired-конфигурации (registry) + доставка по v1/dev/{id}/cfg
+	cfgSvc := configs.New(reg, pub)
+	cfgSvc.SetRolloutInterval(configs.LoadRolloutIntervalFromEnv())
+	cfgSvc.SetSecrets(secretCipher)
+	cfgSvc.SetLocks(locks)
+	d.Configs = cfgSvc
+
+	// Репозиторий прошивок: бинарники на диске, метаданные в SQLite
+	fwCfg := firmware.LoadConfigFromEnv()
+	fwRepo, err := firmware.New(reg, fwCfg)
+	if err != nil {
+		log.Fatalf("firmware repository init failed: %v", err)
+	}
+	log.Printf("[FW] repository dir=%s maxSize=%d", fwCfg.Dir, fwCfg.MaxSize)
+
+	// Ключ подписи манифестов OTA: публичная часть вшивается в прошивку (GET /api/v1/ota/signing-key)
+	signer, err := firmware.OpenSigner(firmware.SigningKeyPathFromEnv(), true)
+	if err != nil {
+		log.Fatalf("ota signing key init failed: %v", err)
+	}
+	fwRepo.SetSigner(signer)
+	log.Printf("[FW] manifest signing enabled kid=%s alg=%s", signer.KeyID(), firmware.ManifestAlg)
+
+	// OTA-кампании: волны раскатки, ход — по event/ack/state устройства
+	otaCfg := ota.LoadConfigFromEnv()
+	otaSvc := ota.New(reg, fwRepo, pub, otaCfg)
+	otaSvc.SetLocks(locks)
+	if influxClient != nil {
+		otaSvc.SetEvents(influxClient)
+	}
+	d.OTA = otaSvc
 
-	if err := mqtt.Connect(c, cfg, lost); err != nil {
+	// Политики прошивки: соответствие devices.fw, события и автозапись в OTA-кампании
+	fwCompliance := compliance.New(reg, compliance.LoadConfigFromEnv())
+	fwCompliance.SetEnroller(otaSvc)
+	if influxClient != nil {
+		fwCompliance.SetEvents(influxClient)
+	}
+	d.Compliance = fwCompliance
+	d.RegisterDefaultRequestHandlers()
+
+	if err := mqttConnect(); err != nil {
 		log.Fatalf("mqtt connect failed: %v", err)
 	}
 
+	// Scheduler: cron-расписания команд (runs в SQLite, отправка через cmdMgr)
+	scfg := scheduler.LoadConfigFromEnv()
+	scheduler.New(reg, cmdMgr, scfg).Start(context.Background())
+	log.Printf("[SCHED] enabled tick=%s parallel=%d", scfg.Tick, scfg.Parallel)
+
+	// Reconciler: desired vs reported active, повторная доставка cfg, cfg_stuck
+	var events configs.EventSink
+	if influxClient != nil {
+		events = influxClient
+	}
+	recCfg := configs.LoadReconcilerConfigFromEnv()
+	configs.NewReconciler(cfgSvc, events, recCfg).Start(context.Background())
+	log.Printf("[CFG_RECONCILE] enabled tick=%s backoff=%s maxRollbacks=%d", recCfg.Tick, recCfg.Backoff, recCfg.MaxRollbacks)
+
+	otaSvc.Start(context.Background())
+	log.Printf("[OTA] campaigns enabled tick=%s jobTimeout=%s failureThreshold=%.2f", otaCfg.Tick, otaCfg.JobTimeout, otaCfg.FailureThreshold)
+
+	fwCompliance.Start(context.Background())
+	log.Printf("[FW_COMPLIANCE] enabled tick=%s", fwCompliance.Tick())
+
 	addr := os.Getenv("HTTP_ADDR")
 	if addr == "" {
 		addr = ":8080"
 	}
-	api := httpapi.New(cmdMgr, authStore, tokenService, reg, influxClient)
+	api := httpapi.New(cmdMgr, authStore, tokenService, reg, influxClient).WithConfigs(cfgSvc).WithLocks(locks).WithFirmware(fwRepo).WithOTA(otaSvc).WithCompliance(fwCompliance).WithIngest(ingest).WithDelivery(d).WithCompression(dicts)
 	go func() {
 		log.Printf("[HTTP] listening addr=%s", addr)
 		if err := http.ListenAndServe(addr, api.Handler()); err != nil {
@@ -96,6 +235,13 @@ func main() {
 		return ",influx"
 	}())
 
-	// Блокируемся навсегда
-	select {}
+	// До сигнала остановки; затем сначала отключаемся от брокера, чтобы в очередь приёма
+	// больше ничего не приходило, и дорабатываем уже принятое (defer сбрасывает Influx и закрывает SQLite)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	log.Printf("[BOOT] shutting down")
+	mqttStop()
+	ingest.Close()
+	log.Printf("[INGEST] drained")
 }
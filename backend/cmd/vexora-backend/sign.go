@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/perm1ss10n/vexora/backend/internal/firmware"
+)
+
+// runOTASign — `vexora-backend ota-sign`: подписывает манифест образа, собранного вне backend
+// (CI, выпуск для офлайн-прошивки). Ключ тот же, что у backend: файл должен уже существовать.
+func runOTASign(args []string) error {
+	fs := flag.NewFlagSet("ota-sign", flag.ContinueOnError)
+	keyFile := fs.String("key", firmware.SigningKeyPathFromEnv(), "signing key file (OTA_SIGNING_KEY_FILE)")
+	file := fs.String("file", "", "firmware image (sha256 and size are computed from it)")
+	version := fs.String("version", "", "firmware version (semver)")
+	hwModel := fs.String("hw", "", "hardware model")
+	minHWRev := fs.Int("min-hw-rev", 0, "minimal board revision, 0 — any")
+	url := fs.String("url", "", "download url the device will use")
+	ttl := fs.Duration("ttl", 30*24*time.Hour, "manifest lifetime")
+	deviceID := fs.String("device", "", "bind manifest to a single device (optional)")
+	out := fs.String("out", "", "output file (default stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if *file == "" || *version == "" || *hwModel == "" || *url == "" {
+		return errors.New("-file, -version, -hw and -url are required")
+	}
+	ver, err := firmware.ParseVersion(*version)
+	if err != nil {
+		return err
+	}
+	if *minHWRev < 0 || *ttl <= 0 {
+		return errors.New("-min-hw-rev must be >= 0 and -ttl > 0")
+	}
+
+	signer, err := firmware.OpenSigner(*keyFile, false)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return fmt.Errorf("read %s: %w", *file, err)
+	}
+
+	signed, err := signer.Sign(firmware.Manifest{
+		V:         1,
+		Version:   ver.String(),
+		HWModel:   strings.TrimSpace(*hwModel),
+		MinHWRev:  *minHWRev,
+		URL:       *url,
+		SHA256:    hex.EncodeToString(h.Sum(nil)),
+		Size:      size,
+		ExpiresAt: time.Now().Add(*ttl).UnixMilli(),
+		DeviceID:  strings.TrimSpace(*deviceID),
+	})
+	if err != nil {
+		return err
+	}
+
+	b, err := json.MarshalIndent(signed, "", "  ")
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if *out == "" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	return os.WriteFile(*out, b, 0o644)
+}
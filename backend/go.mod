@@ -3,11 +3,13 @@ module github.com/perm1ss10n/vexora/backend
 go 1.22
 
 require (
+	github.com/eclipse/paho.golang v0.22.0
 	github.com/eclipse/paho.mqtt.golang v1.5.0
 	github.com/golang-jwt/jwt/v5 v5.2.1
 	github.com/google/uuid v1.3.1
 	github.com/influxdata/influxdb-client-go/v2 v2.14.0
 	github.com/joho/godotenv v1.5.1
+	github.com/klauspost/compress v1.16.7
 	golang.org/x/crypto v0.25.0
 	modernc.org/sqlite v1.29.2
 )
@@ -0,0 +1,274 @@
+package codec
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// decodeCBOR — RFC 8949 без тегов со смыслом: теги (в т.ч. self-describe 55799) пропускаются,
+// indefinite-length строки/массивы/map поддерживаются, ключи map — только строки.
+func decodeCBOR(b []byte) (any, error) {
+	r := &reader{b: b, enc: CBOR}
+	v, err := r.cborValue(0)
+	if err != nil {
+		return nil, err
+	}
+	return v, r.end()
+}
+
+func (r *reader) cborArg(ai byte) (uint64, error) {
+	switch {
+	case ai < 24:
+		return uint64(ai), nil
+	case ai <= 27:
+		return r.uint(1 << (ai - 24))
+	}
+	return 0, r.errorf("invalid additional info %d", ai)
+}
+
+func (r *reader) cborValue(depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, r.errorf("nesting deeper than %d", maxDepth)
+	}
+	c, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	major, ai := c>>5, c&0x1f
+
+	if ai == 31 {
+		return r.cborIndefinite(major, depth)
+	}
+	if major == 7 {
+		return r.cborSimple(ai)
+	}
+	arg, err := r.cborArg(ai)
+	if err != nil {
+		return nil, err
+	}
+	switch major {
+	case 0:
+		if arg > math.MaxInt64 {
+			return arg, nil
+		}
+		return int64(arg), nil
+	case 1:
+		if arg > math.MaxInt64 {
+			return -float64(arg) - 1, nil
+		}
+		return -int64(arg) - 1, nil
+	case 2:
+		return r.bytes(arg)
+	case 3:
+		s, err := r.bytes(arg)
+		return string(s), err
+	case 4:
+		n, err := r.count(arg)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]any, 0, n)
+		for i := 0; i < n; i++ {
+			v, err := r.cborValue(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	case 5:
+		n, err := r.count(arg)
+		if err != nil {
+			return nil, err
+		}
+		out := make(map[string]any, n)
+		for i := 0; i < n; i++ {
+			if err := r.cborEntry(out, depth); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case 6:
+		return r.cborValue(depth + 1)
+	}
+	return nil, r.errorf("unsupported major type %d", major)
+}
+
+func (r *reader) cborEntry(m map[string]any, depth int) error {
+	k, err := r.cborValue(depth + 1)
+	if err != nil {
+		return err
+	}
+	key, ok := k.(string)
+	if !ok {
+		return r.errorf("map key must be a string")
+	}
+	v, err := r.cborValue(depth + 1)
+	if err != nil {
+		return err
+	}
+	m[key] = v
+	return nil
+}
+
+// cborBreak — следующий байт 0xff (конец indefinite-length элемента); он съедается.
+func (r *reader) cborBreak() bool {
+	if r.pos < len(r.b) && r.b[r.pos] == 0xff {
+		r.pos++
+		return true
+	}
+	return false
+}
+
+func (r *reader) cborIndefinite(major byte, depth int) (any, error) {
+	switch major {
+	case 2, 3:
+		var chunks []byte
+		for !r.cborBreak() {
+			v, err := r.cborValue(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			switch x := v.(type) {
+			case []byte:
+				chunks = append(chunks, x...)
+			case string:
+				chunks = append(chunks, x...)
+			default:
+				return nil, r.errorf("invalid chunk in indefinite string")
+			}
+		}
+		if major == 3 {
+			return string(chunks), nil
+		}
+		return chunks, nil
+	case 4:
+		out := []any{}
+		for !r.cborBreak() {
+			v, err := r.cborValue(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, v)
+		}
+		return out, nil
+	case 5:
+		out := map[string]any{}
+		for !r.cborBreak() {
+			if err := r.cborEntry(out, depth); err != nil {
+				return nil, err
+			}
+		}
+		return out, nil
+	case 7:
+		// break вне indefinite-length элемента (в нём он снимается cborBreak до разбора значения)
+		return nil, r.errorf("unexpected break")
+	}
+	return nil, r.errorf("indefinite length for major type %d", major)
+}
+
+func (r *reader) cborSimple(ai byte) (any, error) {
+	switch ai {
+	case 20:
+		return false, nil
+	case 21:
+		return true, nil
+	case 22, 23: // null, undefined
+		return nil, nil
+	case 25:
+		v, err := r.uint(2)
+		return halfToFloat(uint16(v)), err
+	case 26:
+		v, err := r.uint(4)
+		return float32frombits(v), err
+	case 27:
+		v, err := r.uint(8)
+		return math.Float64frombits(v), err
+	}
+	return nil, r.errorf("unsupported simple value %d", ai)
+}
+
+func halfToFloat(h uint16) float64 {
+	exp := int(h>>10) & 0x1f
+	mant := float64(h & 0x3ff)
+	var v float64
+	switch exp {
+	case 0:
+		v = math.Ldexp(mant, -24)
+	case 31:
+		if mant == 0 {
+			v = math.Inf(1)
+		} else {
+			v = math.NaN()
+		}
+	default:
+		v = math.Ldexp(mant+1024, exp-25)
+	}
+	if h&0x8000 != 0 {
+		return -v
+	}
+	return v
+}
+
+// encodeCBOR кодирует значение из json.Decoder с UseNumber (canonical: ключи map отсортированы).
+func encodeCBOR(buf []byte, v any) ([]byte, error) {
+	switch x := v.(type) {
+	case nil:
+		return append(buf, 0xf6), nil
+	case bool:
+		if x {
+			return append(buf, 0xf5), nil
+		}
+		return append(buf, 0xf4), nil
+	case json.Number:
+		switch n := number(x).(type) {
+		case int64:
+			if n >= 0 {
+				return cborHead(buf, 0, uint64(n)), nil
+			}
+			return cborHead(buf, 1, uint64(-(n + 1))), nil
+		case float64:
+			buf = append(buf, 0xfb)
+			return binary.BigEndian.AppendUint64(buf, math.Float64bits(n)), nil
+		}
+	case string:
+		return append(cborHead(buf, 3, uint64(len(x))), x...), nil
+	case []any:
+		buf = cborHead(buf, 4, uint64(len(x)))
+		var err error
+		for _, e := range x {
+			if buf, err = encodeCBOR(buf, e); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case map[string]any:
+		buf = cborHead(buf, 5, uint64(len(x)))
+		var err error
+		for _, k := range sortedKeys(x) {
+			buf = append(cborHead(buf, 3, uint64(len(k))), k...)
+			if buf, err = encodeCBOR(buf, x[k]); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	}
+	return nil, fmt.Errorf("codec: cbor: unsupported value %T", v)
+}
+
+func cborHead(buf []byte, major byte, n uint64) []byte {
+	m := major << 5
+	switch {
+	case n < 24:
+		return append(buf, m|byte(n))
+	case n <= math.MaxUint8:
+		return append(buf, m|24, byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, m|25), uint16(n))
+	case n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buf, m|26), uint32(n))
+	}
+	return binary.BigEndian.AppendUint64(append(buf, m|27), n)
+}
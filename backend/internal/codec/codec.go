@@ -0,0 +1,169 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Кодировки payload устройства.
+const (
+	JSON    = "json"
+	MsgPack = "msgpack"
+	CBOR    = "cbor"
+)
+
+var ErrInvalid = errors.New("invalid payload encoding")
+
+// maxDepth — вложенность map/array в бинарном payload (защита от рекурсии на мусоре).
+const maxDepth = 32
+
+// Valid — поддерживаемая кодировка.
+func Valid(enc string) bool {
+	return enc == JSON || enc == MsgPack || enc == CBOR
+}
+
+// Detect определяет кодировку по первому байту. Payload устройства — всегда map:
+// JSON начинается с '{', map MessagePack — 0x80..0x8f/0xde/0xdf, map CBOR — 0xa0..0xbf
+// (или self-describe тег 0xd9d9f7). Диапазоны не пересекаются.
+func Detect(payload []byte) string {
+	b := bytes.TrimLeft(payload, " \t\r\n")
+	if len(b) == 0 {
+		return JSON
+	}
+	c := b[0]
+	switch {
+	case c >= 0x80 && c <= 0x8f, c == 0xde, c == 0xdf:
+		return MsgPack
+	case c >= 0xa0 && c <= 0xbf:
+		return CBOR
+	case len(b) >= 3 && c == 0xd9 && b[1] == 0xd9 && b[2] == 0xf7:
+		return CBOR
+	}
+	return JSON
+}
+
+// ToJSON переводит payload любой поддерживаемой кодировки в JSON: дальше он разбирается
+// в те же model-структуры, что и JSON от устройства. JSON возвращается как есть.
+func ToJSON(payload []byte) ([]byte, string, error) {
+	enc := Detect(payload)
+	var v any
+	var err error
+	switch enc {
+	case MsgPack:
+		v, err = decodeMsgPack(payload)
+	case CBOR:
+		v, err = decodeCBOR(payload)
+	default:
+		return payload, JSON, nil
+	}
+	if err != nil {
+		return nil, enc, err
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, enc, fmt.Errorf("%w: %s: %v", ErrInvalid, enc, err)
+	}
+	return b, enc, nil
+}
+
+// FromJSON кодирует JSON-сообщение в кодировку устройства.
+func FromJSON(b []byte, enc string) ([]byte, error) {
+	if enc == "" || enc == JSON {
+		return b, nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, fmt.Errorf("codec: decode json: %w", err)
+	}
+	switch enc {
+	case MsgPack:
+		return encodeMsgPack(nil, v)
+	case CBOR:
+		return encodeCBOR(nil, v)
+	}
+	return nil, fmt.Errorf("codec: unknown encoding %q", enc)
+}
+
+// number — число из JSON: целые остаются целыми (в бинарных форматах они компактнее).
+func number(n json.Number) any {
+	if i, err := n.Int64(); err == nil {
+		return i
+	}
+	f, _ := n.Float64()
+	return f
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// reader — общий курсор декодеров с проверкой границ.
+type reader struct {
+	b   []byte
+	pos int
+	enc string
+}
+
+func (r *reader) errorf(format string, args ...any) error {
+	return fmt.Errorf("%w: %s at %d: %s", ErrInvalid, r.enc, r.pos, fmt.Sprintf(format, args...))
+}
+
+func (r *reader) byte() (byte, error) {
+	if r.pos >= len(r.b) {
+		return 0, r.errorf("unexpected end")
+	}
+	c := r.b[r.pos]
+	r.pos++
+	return c, nil
+}
+
+func (r *reader) bytes(n uint64) ([]byte, error) {
+	if n > uint64(len(r.b)-r.pos) {
+		return nil, r.errorf("length %d exceeds payload", n)
+	}
+	out := r.b[r.pos : r.pos+int(n)]
+	r.pos += int(n)
+	return out, nil
+}
+
+func (r *reader) uint(n int) (uint64, error) {
+	b, err := r.bytes(uint64(n))
+	if err != nil {
+		return 0, err
+	}
+	var v uint64
+	for _, c := range b {
+		v = v<<8 | uint64(c)
+	}
+	return v, nil
+}
+
+// count — длина коллекции: каждый элемент занимает хотя бы байт, иначе это мусор.
+func (r *reader) count(n uint64) (int, error) {
+	if n > uint64(len(r.b)-r.pos) {
+		return 0, r.errorf("collection of %d items exceeds payload", n)
+	}
+	return int(n), nil
+}
+
+func (r *reader) end() error {
+	if r.pos != len(r.b) {
+		return r.errorf("%d trailing bytes", len(r.b)-r.pos)
+	}
+	return nil
+}
+
+func float32frombits(v uint64) float64 {
+	return float64(math.Float32frombits(uint32(v)))
+}
@@ -0,0 +1,272 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	cases := []struct {
+		name    string
+		payload []byte
+		want    string
+	}{
+		{"empty", nil, JSON},
+		{"json object", []byte(`{"v":1}`), JSON},
+		{"json with leading whitespace", []byte(" \r\n\t{}"), JSON},
+		{"msgpack fixmap empty", []byte{0x80}, MsgPack},
+		{"msgpack fixmap 15", []byte{0x8f}, MsgPack},
+		{"msgpack map16", []byte{0xde, 0x00, 0x01}, MsgPack},
+		{"msgpack map32", []byte{0xdf, 0, 0, 0, 1}, MsgPack},
+		{"msgpack fixarray is not a payload", []byte{0x90}, JSON},
+		{"cbor map 0", []byte{0xa0}, CBOR},
+		{"cbor map uint8 length", []byte{0xb8, 0x20}, CBOR},
+		{"cbor indefinite map", []byte{0xbf, 0xff}, CBOR},
+		{"cbor self-describe tag", []byte{0xd9, 0xd9, 0xf7, 0xa0}, CBOR},
+		{"short self-describe prefix", []byte{0xd9, 0xd9}, JSON},
+		{"msgpack str8 is not a map", []byte{0xd9, 0x01, 'a'}, JSON},
+		{"compression header", []byte{0x00, 'Z', 1, 0, 0}, JSON},
+	}
+	for _, tc := range cases {
+		if got := Detect(tc.payload); got != tc.want {
+			t.Errorf("%s: Detect(% x) = %s, want %s", tc.name, tc.payload, got, tc.want)
+		}
+	}
+
+	// диапазоны первых байтов не пересекаются
+	for c := 0; c < 256; c++ {
+		got := Detect([]byte{byte(c), 0, 0})
+		switch {
+		case c >= 0x80 && c <= 0x8f, c == 0xde, c == 0xdf:
+			if got != MsgPack {
+				t.Errorf("0x%02x: %s, want msgpack", c, got)
+			}
+		case c >= 0xa0 && c <= 0xbf:
+			if got != CBOR {
+				t.Errorf("0x%02x: %s, want cbor", c, got)
+			}
+		default:
+			if got != JSON {
+				t.Errorf("0x%02x: %s, want json", c, got)
+			}
+		}
+	}
+}
+
+// canonicalJSON — JSON с отсортированными ключами и числами без потери целых.
+func canonicalJSON(t *testing.T, b []byte) string {
+	t.Helper()
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		t.Fatalf("decode %s: %v", b, err)
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestRoundTrip(t *testing.T) {
+	long := strings.Repeat("x", 70000)
+	cases := []struct {
+		name string
+		in   string
+		want string // "" — совпадает с in
+	}{
+		{"empty map", `{}`, ""},
+		{"small ints", `{"a":0,"b":127,"c":-1,"d":-32}`, ""},
+		{"int boundaries", `{"a":128,"b":255,"c":256,"d":65535,"e":65536,"f":4294967295,"g":4294967296,"h":-33,"i":-128,"j":-129,"k":-32768,"l":-32769,"m":-2147483648,"n":-2147483649}`, ""},
+		{"int64 limits", `{"max":9223372036854775807,"min":-9223372036854775808}`, ""},
+		{"floats", `{"a":1.5,"b":-0.25,"c":3.4028234663852886e+38,"d":1e-300}`, ""},
+		// целое остаётся целым, float с нулевой дробной частью — числом с тем же значением
+		{"int vs float", `{"i":42,"f":42.0,"g":0.1}`, `{"f":42,"g":0.1,"i":42}`},
+		{"beyond int64", `{"u":18446744073709551615}`, `{"u":18446744073709552000}`},
+		{"bool and null", `{"t":true,"f":false,"n":null}`, ""},
+		{"strings", `{"empty":"","utf8":"привет","fix31":"` + strings.Repeat("s", 31) + `","str8":"` + strings.Repeat("s", 200) + `"}`, ""},
+		{"str16", `{"s":"` + long[:1000] + `"}`, ""},
+		{"str32", `{"s":"` + long + `"}`, ""},
+		{"nested", `{"v":1,"metrics":{"temp":21.5,"rssi":-70,"tags":["a","b"],"inner":{"x":[1,[2,[3,{}]],[]]}}}`, ""},
+		{"array16", `{"a":[` + strings.TrimSuffix(strings.Repeat("1,", 20), ",") + `]}`, ""},
+		{"map16", `{` + manyKeys(20) + `}`, ""},
+	}
+	for _, enc := range []string{MsgPack, CBOR} {
+		for _, tc := range cases {
+			t.Run(enc+"/"+tc.name, func(t *testing.T) {
+				bin, err := FromJSON([]byte(tc.in), enc)
+				if err != nil {
+					t.Fatalf("encode: %v", err)
+				}
+				if got := Detect(bin); got != enc {
+					t.Fatalf("Detect = %s, want %s", got, enc)
+				}
+				out, got, err := ToJSON(bin)
+				if err != nil {
+					t.Fatalf("decode: %v", err)
+				}
+				if got != enc {
+					t.Errorf("ToJSON encoding = %s, want %s", got, enc)
+				}
+				want := tc.want
+				if want == "" {
+					want = tc.in
+				}
+				if c, w := canonicalJSON(t, out), canonicalJSON(t, []byte(want)); c != w {
+					if len(c) > 200 {
+						c, w = c[:200]+"…", w[:200]+"…"
+					}
+					t.Errorf("round trip:\n got %s\nwant %s", c, w)
+				}
+			})
+		}
+	}
+}
+
+func manyKeys(n int) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(`"k`)
+		b.WriteByte(byte('a' + i))
+		b.WriteString(`":`)
+		b.WriteByte(byte('0' + i%10))
+	}
+	return b.String()
+}
+
+func TestJSONPassThrough(t *testing.T) {
+	in := []byte(`{"v":1,"x":1.0}`)
+	out, enc, err := ToJSON(in)
+	if err != nil || enc != JSON || !bytes.Equal(out, in) {
+		t.Fatalf("ToJSON(json) = %s, %s, %v", out, enc, err)
+	}
+	if out, err := FromJSON(in, JSON); err != nil || !bytes.Equal(out, in) {
+		t.Fatalf("FromJSON(json) = %s, %v", out, err)
+	}
+	if _, err := FromJSON(in, "xml"); err == nil {
+		t.Fatal("unknown encoding accepted")
+	}
+}
+
+// Значения, которые не даёт FromJSON, но может прислать устройство.
+func TestDecodeDeviceValues(t *testing.T) {
+	cases := []struct {
+		name string
+		in   []byte
+		want string
+	}{
+		{"msgpack float32", []byte{0x81, 0xa1, 'f', 0xca, 0x3f, 0xc0, 0x00, 0x00}, `{"f":1.5}`},
+		{"msgpack uint64 max", []byte{0x81, 0xa1, 'u', 0xcf, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}, `{"u":18446744073709551615}`},
+		{"msgpack int8", []byte{0x81, 0xa1, 'i', 0xd0, 0x80}, `{"i":-128}`},
+		{"msgpack bin8 as base64", []byte{0x81, 0xa1, 'b', 0xc4, 0x03, 1, 2, 3}, `{"b":"AQID"}`},
+		{"cbor half float", []byte{0xa1, 0x61, 'h', 0xf9, 0x3e, 0x00}, `{"h":1.5}`},
+		{"cbor float32", []byte{0xa1, 0x61, 'f', 0xfa, 0x3f, 0xc0, 0x00, 0x00}, `{"f":1.5}`},
+		{"cbor undefined", []byte{0xa1, 0x61, 'u', 0xf7}, `{"u":null}`},
+		{"cbor self-describe", []byte{0xd9, 0xd9, 0xf7, 0xa1, 0x61, 'a', 0x01}, `{"a":1}`},
+		{"cbor tagged value", []byte{0xa1, 0x61, 't', 0xc1, 0x1a, 0x65, 0x53, 0xf1, 0x00}, `{"t":1700000000}`},
+		{"cbor indefinite map and array", []byte{0xbf, 0x61, 'a', 0x9f, 0x01, 0x02, 0xff, 0xff}, `{"a":[1,2]}`},
+		{"cbor indefinite string", []byte{0xa1, 0x61, 's', 0x7f, 0x62, 'a', 'b', 0x61, 'c', 0xff}, `{"s":"abc"}`},
+		{"cbor byte string", []byte{0xa1, 0x61, 'b', 0x43, 1, 2, 3}, `{"b":"AQID"}`},
+		{"cbor negative", []byte{0xa1, 0x61, 'n', 0x38, 0x63}, `{"n":-100}`},
+	}
+	for _, tc := range cases {
+		out, _, err := ToJSON(tc.in)
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if got := canonicalJSON(t, out); got != canonicalJSON(t, []byte(tc.want)) {
+			t.Errorf("%s: got %s, want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func nested(open, leaf []byte, depth int) []byte {
+	b := bytes.Repeat(open, depth)
+	return append(b, leaf...)
+}
+
+func TestDecodeInvalid(t *testing.T) {
+	cases := []struct {
+		name string
+		in   []byte
+	}{
+		// обрезанные
+		{"msgpack map without entries", []byte{0x81}},
+		{"msgpack key without value", []byte{0x81, 0xa1, 'a'}},
+		{"msgpack short str", []byte{0x81, 0xa1, 'a', 0xa3, 'x'}},
+		{"msgpack short map16 header", []byte{0xde, 0x00}},
+		{"msgpack short float64", []byte{0x81, 0xa1, 'f', 0xcb, 0, 0, 0}},
+		{"cbor map without entries", []byte{0xa1}},
+		{"cbor short uint32", []byte{0xa1, 0x61, 'a', 0x1a, 0, 0}},
+		{"cbor unterminated indefinite map", []byte{0xbf, 0x61, 'a', 0x01}},
+		{"cbor unterminated indefinite string", []byte{0xa1, 0x61, 's', 0x7f, 0x61, 'a'}},
+		// длины больше payload
+		{"msgpack str32 4GiB", []byte{0x81, 0xa1, 'a', 0xdb, 0xff, 0xff, 0xff, 0xff, 'x'}},
+		{"msgpack bin32 4GiB", []byte{0x81, 0xa1, 'a', 0xc6, 0xff, 0xff, 0xff, 0xff}},
+		{"msgpack array32 4G items", []byte{0x81, 0xa1, 'a', 0xdd, 0xff, 0xff, 0xff, 0xff, 0x01}},
+		{"msgpack map32 4G entries", []byte{0xdf, 0xff, 0xff, 0xff, 0xff, 0xa1, 'a', 0x01}},
+		{"cbor text 2^64-1", []byte{0xa1, 0x61, 'a', 0x7b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 'x'}},
+		{"cbor array 2^64-1", []byte{0xa1, 0x61, 'a', 0x9b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{"cbor map 2^32", []byte{0xba, 0xff, 0xff, 0xff, 0xff, 0x61, 'a', 0x01}},
+		// глубина
+		{"msgpack too deep", nested([]byte{0x81, 0xa1, 'a'}, []byte{0x01}, maxDepth+1)},
+		{"msgpack arrays too deep", append([]byte{0x81, 0xa1, 'a'}, nested([]byte{0x91}, []byte{0x01}, maxDepth+1)...)},
+		{"cbor too deep", nested([]byte{0xa1, 0x61, 'a'}, []byte{0x01}, maxDepth+1)},
+		{"cbor tags too deep", append([]byte{0xa1, 0x61, 'a'}, nested([]byte{0xc1}, []byte{0x01}, maxDepth+1)...)},
+		// лишние байты
+		{"msgpack trailing", []byte{0x80, 0x00}},
+		{"cbor trailing", []byte{0xa0, 0x00}},
+		// ключи не строки
+		{"msgpack int key", []byte{0x81, 0x01, 0x02}},
+		{"msgpack nil key", []byte{0x81, 0xc0, 0x02}},
+		{"cbor int key", []byte{0xa1, 0x01, 0x02}},
+		{"cbor bytes key", []byte{0xa1, 0x41, 'a', 0x02}},
+		{"cbor array key in indefinite map", []byte{0xbf, 0x80, 0x01, 0xff}},
+		// прочий мусор
+		{"msgpack ext", []byte{0x81, 0xa1, 'e', 0xd4, 0x01, 0x02}},
+		{"msgpack never-used 0xc1", []byte{0x81, 0xa1, 'a', 0xc1}},
+		{"msgpack NaN", []byte{0x81, 0xa1, 'f', 0xcb, 0x7f, 0xf8, 0, 0, 0, 0, 0, 0}},
+		{"cbor half-float infinity", []byte{0xa1, 0x61, 'h', 0xf9, 0x7c, 0x00}},
+		{"cbor reserved additional info", []byte{0xa1, 0x61, 'a', 0x1c}},
+		{"cbor stray break in array", []byte{0xa1, 0x61, 'a', 0x81, 0xff}},
+		{"cbor stray break as value", []byte{0xa1, 0x61, 'a', 0xff}},
+		{"cbor break behind tag", []byte{0xa1, 0x61, 'a', 0xc1, 0xff}},
+		{"cbor indefinite int", []byte{0xa1, 0x61, 'a', 0x1f}},
+		{"cbor number in indefinite string", []byte{0xa1, 0x61, 's', 0x7f, 0x01, 0xff}},
+		{"cbor simple value", []byte{0xa1, 0x61, 's', 0xf0}},
+	}
+	for _, tc := range cases {
+		out, _, err := ToJSON(tc.in)
+		if err == nil {
+			t.Errorf("%s: accepted as %s", tc.name, out)
+			continue
+		}
+		if !errors.Is(err, ErrInvalid) {
+			t.Errorf("%s: err = %v, want ErrInvalid", tc.name, err)
+		}
+	}
+}
+
+// Любой обрезанный валидный payload отклоняется, а не читается за границей.
+func TestDecodeTruncated(t *testing.T) {
+	in := `{"v":1,"deviceId":"dev-1","ts":1730000000000,"metrics":{"temp":21.5,"hum":40,"arr":[1,-2,3.5,"x",null,true]}}`
+	for _, enc := range []string{MsgPack, CBOR} {
+		bin, err := FromJSON([]byte(in), enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for n := 1; n < len(bin); n++ {
+			if out, _, err := ToJSON(bin[:n]); err == nil {
+				t.Fatalf("%s truncated to %d/%d bytes accepted: %s", enc, n, len(bin), out)
+			}
+		}
+	}
+}
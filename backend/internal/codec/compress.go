@@ -0,0 +1,183 @@
+package codec
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Алгоритмы сжатия payload.
+const (
+	Deflate = "deflate"
+	Zstd    = "zstd"
+)
+
+// Заголовок сжатого payload: 0x00 'Z' | алгоритм | id словаря (uint16 BE, 0 — без словаря).
+// 0x00 не начинает ни JSON, ни map MessagePack/CBOR, поэтому сжатие не путается с кодировкой.
+const headerSize = 5
+
+var compressMagic = [2]byte{0x00, 'Z'}
+
+var algByID = map[byte]string{1: Deflate, 2: Zstd}
+
+var (
+	ErrUnsupportedCompression = errors.New("unsupported payload compression")
+	ErrInvalidCompression     = errors.New("invalid compressed payload")
+	ErrTooLarge               = errors.New("decompressed payload too large")
+)
+
+type CompressionLimits struct {
+	MaxSize  int     // байт после распаковки
+	MaxRatio float64 // распакованный / сжатый; больше — считаем zip-бомбой
+}
+
+func LoadCompressionLimitsFromEnv() CompressionLimits {
+	l := CompressionLimits{MaxSize: 256 << 10, MaxRatio: 100}
+	if n, err := strconv.Atoi(os.Getenv("PAYLOAD_MAX_DECOMPRESSED_BYTES")); err == nil && n > 0 {
+		l.MaxSize = n
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("PAYLOAD_MAX_COMPRESSION_RATIO"), 64); err == nil && v > 1 {
+		l.MaxRatio = v
+	}
+	return l
+}
+
+// Frame — как был упакован payload.
+type Frame struct {
+	Alg    string // "" — без сжатия
+	DictID uint16
+	Wire   int // байт на входе (с заголовком)
+	Size   int // байт после распаковки
+}
+
+// Compressed — payload начинается с заголовка сжатия.
+func Compressed(payload []byte) bool {
+	return len(payload) >= 2 && payload[0] == compressMagic[0] && payload[1] == compressMagic[1]
+}
+
+// Decompress снимает сжатие; payload без заголовка возвращается как есть.
+// Распаковка ограничена MaxSize и MaxRatio: на вход не доверяем ни длине, ни содержимому.
+func Decompress(payload []byte, lim CompressionLimits, dicts *Dictionaries) ([]byte, Frame, error) {
+	f := Frame{Wire: len(payload), Size: len(payload)}
+	if !Compressed(payload) {
+		return payload, f, nil
+	}
+	if len(payload) < headerSize {
+		return nil, f, fmt.Errorf("%w: short header", ErrInvalidCompression)
+	}
+	alg, ok := algByID[payload[2]]
+	if !ok {
+		return nil, f, fmt.Errorf("%w: algorithm 0x%02x", ErrUnsupportedCompression, payload[2])
+	}
+	f.Alg = alg
+	f.DictID = binary.BigEndian.Uint16(payload[3:5])
+
+	var dict Dictionary
+	if f.DictID != 0 {
+		d, ok := dicts.Get(f.DictID)
+		if !ok {
+			return nil, f, fmt.Errorf("%w: unknown dictionary %d", ErrInvalidCompression, f.DictID)
+		}
+		dict = d
+	}
+
+	maxSize := lim.MaxSize
+	if maxSize <= 0 {
+		maxSize = 256 << 10
+	}
+	if lim.MaxRatio > 0 {
+		if byRatio := int(float64(len(payload)) * lim.MaxRatio); byRatio < maxSize {
+			maxSize = byRatio
+		}
+	}
+
+	switch alg {
+	case Deflate:
+		zr := flate.NewReaderDict(bytes.NewReader(payload[headerSize:]), dict.Data)
+		defer zr.Close()
+		out, err := io.ReadAll(io.LimitReader(zr, int64(maxSize)+1))
+		if err != nil {
+			return nil, f, fmt.Errorf("%w: %v", ErrInvalidCompression, err)
+		}
+		if len(out) > maxSize {
+			return nil, f, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, maxSize)
+		}
+		f.Size = len(out)
+		return out, f, nil
+	case Zstd:
+		if len(payload) == headerSize {
+			return nil, f, fmt.Errorf("%w: empty zstd stream", ErrInvalidCompression)
+		}
+		dec, err := zstdDecoder(lim, dict)
+		if err != nil {
+			return nil, f, fmt.Errorf("%w: dictionary %d: %v", ErrInvalidCompression, f.DictID, err)
+		}
+		out, err := dec.DecodeAll(payload[headerSize:], nil)
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+			return nil, f, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, maxSize)
+		}
+		if err != nil {
+			return nil, f, fmt.Errorf("%w: %v", ErrInvalidCompression, err)
+		}
+		if len(out) > maxSize {
+			return nil, f, fmt.Errorf("%w: more than %d bytes", ErrTooLarge, maxSize)
+		}
+		f.Size = len(out)
+		return out, f, nil
+	}
+	return nil, f, fmt.Errorf("%w: %s", ErrUnsupportedCompression, alg)
+}
+
+// zstdDictMagic — начало словаря в формате `zstd --train`; иначе словарь — просто данные (raw content).
+var zstdDictMagic = []byte{0x37, 0xa4, 0x30, 0xec}
+
+type zstdKey struct {
+	dictID  uint16 // 0 — без словаря
+	sha256  string
+	maxSize int
+}
+
+// zstdDecoders — декодеры по словарю и лимиту: DecodeAll безопасен из нескольких горутин.
+var zstdDecoders sync.Map // zstdKey → *zstd.Decoder
+
+// zstdDecoder — декодер с лимитом MaxSize на распакованный размер и окно: буфер под заявленный
+// во фрейме размер не выделяется сверх лимита. Лимит по ratio проверяется после распаковки.
+// Raw-словарь регистрируется и под id из заголовка, и под 0: фрейм может не указывать dictID.
+func zstdDecoder(lim CompressionLimits, dict Dictionary) (*zstd.Decoder, error) {
+	maxSize := lim.MaxSize
+	if maxSize <= 0 {
+		maxSize = 256 << 10
+	}
+	key := zstdKey{dictID: dict.ID, sha256: dict.SHA256, maxSize: maxSize}
+	if dec, ok := zstdDecoders.Load(key); ok {
+		return dec.(*zstd.Decoder), nil
+	}
+	opts := []zstd.DOption{zstd.WithDecoderMaxMemory(uint64(maxSize))}
+	if maxSize >= zstd.MinWindowSize {
+		opts = append(opts, zstd.WithDecoderMaxWindow(uint64(maxSize)))
+	}
+	switch {
+	case len(dict.Data) == 0:
+	case bytes.HasPrefix(dict.Data, zstdDictMagic):
+		opts = append(opts, zstd.WithDecoderDicts(dict.Data))
+	default:
+		opts = append(opts, zstd.WithDecoderDictRaw(uint32(dict.ID), dict.Data), zstd.WithDecoderDictRaw(0, dict.Data))
+	}
+	dec, err := zstd.NewReader(nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if prev, loaded := zstdDecoders.LoadOrStore(key, dec); loaded {
+		dec.Close()
+		return prev.(*zstd.Decoder), nil
+	}
+	return dec, nil
+}
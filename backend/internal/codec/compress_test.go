@@ -0,0 +1,141 @@
+package codec
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func frame(alg byte, dictID uint16, body []byte) []byte {
+	return append([]byte{compressMagic[0], compressMagic[1], alg, byte(dictID >> 8), byte(dictID)}, body...)
+}
+
+func deflateBody(t *testing.T, data, dict []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw, err := flate.NewWriterDict(&buf, flate.BestCompression, dict)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func zstdBody(t *testing.T, data []byte, opts ...zstd.EOption) []byte {
+	t.Helper()
+	enc, err := zstd.NewWriter(nil, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer enc.Close()
+	return enc.EncodeAll(data, nil)
+}
+
+// zstdStream — потоковое сжатие: размер данных во фрейме не указан.
+func zstdStream(t *testing.T, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	enc, err := zstd.NewWriter(&buf, zstd.WithWindowSize(zstd.MinWindowSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	enc.Write(data)
+	enc.Close()
+	return buf.Bytes()
+}
+
+func testDicts(data []byte) *Dictionaries {
+	sum := sha256.Sum256(data)
+	return &Dictionaries{byID: map[uint16]Dictionary{
+		1: {ID: 1, Size: len(data), SHA256: hex.EncodeToString(sum[:]), Data: data},
+	}}
+}
+
+func TestDecompress(t *testing.T) {
+	lim := CompressionLimits{MaxSize: 64 << 10, MaxRatio: 100}
+	dictData := []byte(strings.Repeat(`{"v":1,"deviceId":"dev-1","metrics":{"temp":`, 20))
+	dicts := testDicts(dictData)
+	state := []byte(`{"v":1,"deviceId":"dev-1","metrics":{"temp":21.5,"hum":40,"rssi":-70}}`)
+
+	cases := []struct {
+		name    string
+		payload []byte
+		want    []byte
+		err     error
+	}{
+		{"plain json passes through", state, state, nil},
+		{"deflate", frame(1, 0, deflateBody(t, state, nil)), state, nil},
+		{"deflate with dictionary", frame(1, 1, deflateBody(t, state, dictData)), state, nil},
+		{"zstd", frame(2, 0, zstdBody(t, state)), state, nil},
+		{"zstd with raw dictionary", frame(2, 1, zstdBody(t, state, zstd.WithEncoderDictRaw(1, dictData))), state, nil},
+		{"zstd raw dictionary without dictID", frame(2, 1, zstdBody(t, state, zstd.WithEncoderDictRaw(0, dictData))), state, nil},
+		{"zstd two frames", frame(2, 0, append(zstdBody(t, state[:10]), zstdBody(t, state[10:])...)), state, nil},
+		{"short header", []byte{0x00, 'Z', 2}, nil, ErrInvalidCompression},
+		{"unknown algorithm", frame(9, 0, []byte{1}), nil, ErrUnsupportedCompression},
+		{"unknown dictionary", frame(2, 7, zstdBody(t, state)), nil, ErrInvalidCompression},
+		{"zstd frame needs missing dictionary", frame(2, 0, zstdBody(t, state, zstd.WithEncoderDictRaw(5, dictData))), nil, ErrInvalidCompression},
+		{"zstd empty stream", frame(2, 0, nil), nil, ErrInvalidCompression},
+		{"zstd garbage", frame(2, 0, []byte("not zstd at all")), nil, ErrInvalidCompression},
+		{"zstd truncated", frame(2, 0, zstdBody(t, state)[:12]), nil, ErrInvalidCompression},
+		{"zstd trailing garbage", frame(2, 0, append(zstdBody(t, state), 0x01, 0x02, 0x03, 0x04)), nil, ErrInvalidCompression},
+		{"deflate garbage", frame(1, 0, []byte{0xff, 0xff}), nil, ErrInvalidCompression},
+	}
+	for _, tc := range cases {
+		out, f, err := Decompress(tc.payload, lim, dicts)
+		if tc.err != nil {
+			if !errors.Is(err, tc.err) {
+				t.Errorf("%s: err = %v, want %v", tc.name, err, tc.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if !bytes.Equal(out, tc.want) {
+			t.Errorf("%s: got %q", tc.name, out)
+		}
+		if f.Size != len(out) || f.Wire != len(tc.payload) {
+			t.Errorf("%s: frame = %+v", tc.name, f)
+		}
+	}
+}
+
+// Zip-бомба: распаковка не выходит за MaxSize и MaxRatio ни для deflate, ни для zstd.
+func TestDecompressLimits(t *testing.T) {
+	zeros := make([]byte, 1<<20)
+	cases := []struct {
+		name string
+		lim  CompressionLimits
+		data []byte
+	}{
+		{"size", CompressionLimits{MaxSize: 64 << 10, MaxRatio: 1e9}, zeros},
+		{"ratio", CompressionLimits{MaxSize: 4 << 20, MaxRatio: 10}, zeros[:64<<10]},
+		{"size below zstd min window", CompressionLimits{MaxSize: 512, MaxRatio: 1e9}, zeros[:4096]},
+	}
+	for _, tc := range cases {
+		for _, p := range [][]byte{
+			frame(1, 0, deflateBody(t, tc.data, nil)),
+			frame(2, 0, zstdBody(t, tc.data)),
+			// заявленный размер не указан — проверяется по факту распаковки
+			frame(2, 0, zstdStream(t, tc.data)),
+		} {
+			if _, _, err := Decompress(p, tc.lim, nil); !errors.Is(err, ErrTooLarge) {
+				t.Errorf("%s, alg 0x%02x: err = %v, want ErrTooLarge", tc.name, p[2], err)
+			}
+		}
+	}
+
+	// в пределах лимитов те же данные распаковываются
+	lim := CompressionLimits{MaxSize: 2 << 20, MaxRatio: 1e9}
+	if out, _, err := Decompress(frame(2, 0, zstdBody(t, zeros)), lim, nil); err != nil || len(out) != len(zeros) {
+		t.Errorf("zstd within limits: %d bytes, %v", len(out), err)
+	}
+}
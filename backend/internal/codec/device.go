@@ -0,0 +1,144 @@
+package codec
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Store — где запоминается кодировка устройства (registry.SQLiteStore).
+type Store interface {
+	GetDeviceEncoding(ctx context.Context, deviceID string) (string, error)
+	SetDeviceEncoding(ctx context.Context, deviceID, enc string) error
+}
+
+// Preferences — предпочитаемая кодировка устройств: та, в которой оно последним прислало сообщение.
+// Кэш в памяти, в registry пишем только при смене.
+type Preferences struct {
+	store Store
+
+	mu    sync.RWMutex
+	cache map[string]string
+}
+
+func NewPreferences(store Store) *Preferences {
+	return &Preferences{store: store, cache: make(map[string]string)}
+}
+
+// Observe запоминает кодировку входящего сообщения устройства.
+func (p *Preferences) Observe(deviceID, enc string) {
+	if p == nil || deviceID == "" || !Valid(enc) {
+		return
+	}
+	p.mu.RLock()
+	cur, ok := p.cache[deviceID]
+	p.mu.RUnlock()
+	if ok && cur == enc {
+		return
+	}
+	if !ok && p.store != nil {
+		if stored, err := p.get(deviceID); err == nil && stored == enc {
+			p.remember(deviceID, enc)
+			return
+		}
+	}
+
+	p.remember(deviceID, enc)
+	if p.store == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := p.store.SetDeviceEncoding(ctx, deviceID, enc); err != nil {
+		log.Printf("[CODEC] save encoding failed deviceId=%s encoding=%s err=%v", deviceID, enc, err)
+		return
+	}
+	log.Printf("[CODEC] deviceId=%s encoding=%s", deviceID, enc)
+}
+
+// Encoding — кодировка для исходящих сообщений устройству; по умолчанию JSON.
+func (p *Preferences) Encoding(deviceID string) string {
+	if p == nil {
+		return JSON
+	}
+	p.mu.RLock()
+	enc, ok := p.cache[deviceID]
+	p.mu.RUnlock()
+	if ok {
+		return enc
+	}
+	if p.store == nil {
+		return JSON
+	}
+	enc, err := p.get(deviceID)
+	if err != nil {
+		return JSON
+	}
+	p.remember(deviceID, enc)
+	return enc
+}
+
+func (p *Preferences) get(deviceID string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	enc, err := p.store.GetDeviceEncoding(ctx, deviceID)
+	if err != nil {
+		return "", err
+	}
+	if !Valid(enc) {
+		enc = JSON
+	}
+	return enc, nil
+}
+
+func (p *Preferences) remember(deviceID, enc string) {
+	p.mu.Lock()
+	p.cache[deviceID] = enc
+	p.mu.Unlock()
+}
+
+// publisher — то же, что commands.Publisher (не импортируем, чтобы codec не зависел от commands).
+type publisher interface {
+	Publish(topic string, qos byte, retained bool, payload []byte) error
+}
+
+// Publisher перекодирует исходящие cmd/cfg/resp/ota в кодировку устройства; остальное публикует как есть.
+// Манифест OTA лежит в сообщении base64-строкой, поэтому подписанные байты перекодирование не меняет.
+type Publisher struct {
+	next  publisher
+	prefs *Preferences
+}
+
+func NewPublisher(next publisher, prefs *Preferences) Publisher {
+	return Publisher{next: next, prefs: prefs}
+}
+
+func (p Publisher) Publish(topic string, qos byte, retained bool, payload []byte) error {
+	if deviceID, ok := outboundDevice(topic); ok {
+		if enc := p.prefs.Encoding(deviceID); enc != JSON {
+			b, err := FromJSON(payload, enc)
+			if err != nil {
+				log.Printf("[CODEC] encode failed topic=%s encoding=%s err=%v (sending json)", topic, enc, err)
+			} else {
+				payload = b
+			}
+		}
+	}
+	return p.next.Publish(topic, qos, retained, payload)
+}
+
+// outboundDevice — deviceId из v1/dev/{id}/cmd, cfg, resp и ota.
+func outboundDevice(topic string) (string, bool) {
+	parts := strings.Split(topic, "/")
+	if len(parts) != 4 || parts[0] != "v1" || parts[1] != "dev" || parts[2] == "" {
+		return "", false
+	}
+	switch parts[3] {
+	case "cmd", "cfg", "resp", "ota":
+	default:
+		return "", false
+	}
+	return parts[2], true
+}
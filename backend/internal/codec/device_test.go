@@ -0,0 +1,56 @@
+package codec
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+type publishRecorder struct {
+	topics   []string
+	payloads [][]byte
+}
+
+func (r *publishRecorder) Publish(topic string, _ byte, _ bool, payload []byte) error {
+	r.topics = append(r.topics, topic)
+	r.payloads = append(r.payloads, payload)
+	return nil
+}
+
+func TestPublisherEncodesForDevice(t *testing.T) {
+	prefs := NewPreferences(nil)
+	prefs.Observe("dev-1", MsgPack)
+	rec := &publishRecorder{}
+	pub := NewPublisher(rec, prefs)
+
+	ota := []byte(`{"v":1,"id":"job-1","deviceId":"dev-1","ts":1,"manifest":"eyJ2IjoxfQ==","sig":"c2ln"}`)
+	cases := []struct {
+		topic string
+		enc   string
+	}{
+		{"v1/dev/dev-1/cmd", MsgPack},
+		{"v1/dev/dev-1/cfg", MsgPack},
+		{"v1/dev/dev-1/resp", MsgPack},
+		{"v1/dev/dev-1/ota", MsgPack},
+		{"v1/dev/dev-2/ota", JSON}, // от устройства ещё ничего не было
+		{"v1/dev/dev-1/telemetry", JSON},
+		{"v1/dev/dev-1/ota/extra", JSON},
+	}
+	for i, tc := range cases {
+		if err := pub.Publish(tc.topic, 1, false, ota); err != nil {
+			t.Fatal(err)
+		}
+		got := rec.payloads[i]
+		if enc := Detect(got); enc != tc.enc {
+			t.Errorf("%s: published %s, want %s", tc.topic, enc, tc.enc)
+		}
+		// манифест и подпись — те же строки, устройство проверяет подпись над теми же байтами
+		b, _, err := ToJSON(got)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.topic, err)
+		}
+		var m struct{ Manifest, Sig string }
+		if err := json.Unmarshal(b, &m); err != nil || m.Manifest != "eyJ2IjoxfQ==" || m.Sig != "c2ln" {
+			t.Errorf("%s: manifest=%q sig=%q err=%v", tc.topic, m.Manifest, m.Sig, err)
+		}
+	}
+}
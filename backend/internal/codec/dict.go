@@ -0,0 +1,86 @@
+package codec
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Dictionary — общий словарь сжатия. id = версия протокола payload (v1.dict → 1):
+// устройство берёт словарь своей версии и указывает его id в заголовке.
+type Dictionary struct {
+	ID     uint16
+	Size   int
+	SHA256 string
+	Data   []byte
+}
+
+// Dictionaries — словари из каталога, загружаются при старте.
+type Dictionaries struct {
+	byID map[uint16]Dictionary
+}
+
+// DictDirFromEnv — каталог словарей; пусто — словари не используются.
+func DictDirFromEnv() string {
+	return os.Getenv("COMPRESSION_DICT_DIR")
+}
+
+// LoadDictionaries читает файлы v{N}.dict из dir; отсутствующий каталог — пустой набор.
+func LoadDictionaries(dir string) (*Dictionaries, error) {
+	ds := &Dictionaries{byID: make(map[uint16]Dictionary)}
+	if dir == "" {
+		return ds, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return ds, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("codec: read dictionaries: %w", err)
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, "v") || !strings.HasSuffix(name, ".dict") {
+			continue
+		}
+		n, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, "v"), ".dict"), 10, 16)
+		if err != nil || n == 0 {
+			log.Printf("[CODEC] skip dictionary file=%s (expected v{N}.dict)", name)
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("codec: read dictionary %s: %w", name, err)
+		}
+		sum := sha256.Sum256(data)
+		ds.byID[uint16(n)] = Dictionary{ID: uint16(n), Size: len(data), SHA256: hex.EncodeToString(sum[:]), Data: data}
+	}
+	return ds, nil
+}
+
+func (ds *Dictionaries) Get(id uint16) (Dictionary, bool) {
+	if ds == nil {
+		return Dictionary{}, false
+	}
+	d, ok := ds.byID[id]
+	return d, ok
+}
+
+// List — словари по возрастанию id.
+func (ds *Dictionaries) List() []Dictionary {
+	if ds == nil {
+		return nil
+	}
+	out := make([]Dictionary, 0, len(ds.byID))
+	for _, d := range ds.byID {
+		out = append(out, d)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
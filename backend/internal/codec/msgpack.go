@@ -0,0 +1,232 @@
+package codec
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// decodeMsgPack — подмножество MessagePack, которое выдаёт ArduinoJson: nil, bool, int/uint,
+// float32/64, str, bin, array, map со строковыми ключами. ext не поддерживается.
+func decodeMsgPack(b []byte) (any, error) {
+	r := &reader{b: b, enc: MsgPack}
+	v, err := r.msgpackValue(0)
+	if err != nil {
+		return nil, err
+	}
+	return v, r.end()
+}
+
+func (r *reader) msgpackValue(depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, r.errorf("nesting deeper than %d", maxDepth)
+	}
+	c, err := r.byte()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c >= 0x80 && c <= 0x8f:
+		return r.msgpackMap(uint64(c&0x0f), depth)
+	case c >= 0x90 && c <= 0x9f:
+		return r.msgpackArray(uint64(c&0x0f), depth)
+	case c >= 0xa0 && c <= 0xbf:
+		s, err := r.bytes(uint64(c & 0x1f))
+		return string(s), err
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6: // bin 8/16/32 — в JSON станет base64
+		n, err := r.uint(1 << (c - 0xc4))
+		if err != nil {
+			return nil, err
+		}
+		return r.bytes(n)
+	case 0xca:
+		v, err := r.uint(4)
+		return float32frombits(v), err
+	case 0xcb:
+		v, err := r.uint(8)
+		return math.Float64frombits(v), err
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		v, err := r.uint(1 << (c - 0xcc))
+		if err != nil {
+			return nil, err
+		}
+		if v > math.MaxInt64 {
+			return v, nil
+		}
+		return int64(v), nil
+	case 0xd0:
+		v, err := r.uint(1)
+		return int64(int8(v)), err
+	case 0xd1:
+		v, err := r.uint(2)
+		return int64(int16(v)), err
+	case 0xd2:
+		v, err := r.uint(4)
+		return int64(int32(v)), err
+	case 0xd3:
+		v, err := r.uint(8)
+		return int64(v), err
+	case 0xd9, 0xda, 0xdb:
+		n, err := r.uint(1 << (c - 0xd9))
+		if err != nil {
+			return nil, err
+		}
+		s, err := r.bytes(n)
+		return string(s), err
+	case 0xdc, 0xdd:
+		n, err := r.uint(2 << (c - 0xdc))
+		if err != nil {
+			return nil, err
+		}
+		return r.msgpackArray(n, depth)
+	case 0xde, 0xdf:
+		n, err := r.uint(2 << (c - 0xde))
+		if err != nil {
+			return nil, err
+		}
+		return r.msgpackMap(n, depth)
+	}
+	return nil, r.errorf("unsupported type 0x%02x", c)
+}
+
+func (r *reader) msgpackArray(n uint64, depth int) (any, error) {
+	cnt, err := r.count(n)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]any, 0, cnt)
+	for i := 0; i < cnt; i++ {
+		v, err := r.msgpackValue(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, nil
+}
+
+func (r *reader) msgpackMap(n uint64, depth int) (any, error) {
+	cnt, err := r.count(n)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]any, cnt)
+	for i := 0; i < cnt; i++ {
+		k, err := r.msgpackValue(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(string)
+		if !ok {
+			return nil, r.errorf("map key must be a string")
+		}
+		v, err := r.msgpackValue(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		out[key] = v
+	}
+	return out, nil
+}
+
+// encodeMsgPack кодирует значение из json.Decoder с UseNumber.
+func encodeMsgPack(buf []byte, v any) ([]byte, error) {
+	switch x := v.(type) {
+	case nil:
+		return append(buf, 0xc0), nil
+	case bool:
+		if x {
+			return append(buf, 0xc3), nil
+		}
+		return append(buf, 0xc2), nil
+	case json.Number:
+		switch n := number(x).(type) {
+		case int64:
+			return msgpackInt(buf, n), nil
+		case float64:
+			buf = append(buf, 0xcb)
+			return binary.BigEndian.AppendUint64(buf, math.Float64bits(n)), nil
+		}
+	case string:
+		n := len(x)
+		switch {
+		case n < 32:
+			buf = append(buf, 0xa0|byte(n))
+		case n <= math.MaxUint8:
+			buf = append(buf, 0xd9, byte(n))
+		case n <= math.MaxUint16:
+			buf = binary.BigEndian.AppendUint16(append(buf, 0xda), uint16(n))
+		default:
+			buf = binary.BigEndian.AppendUint32(append(buf, 0xdb), uint32(n))
+		}
+		return append(buf, x...), nil
+	case []any:
+		buf = msgpackHeader(buf, len(x), 0x90, 0xdc)
+		var err error
+		for _, e := range x {
+			if buf, err = encodeMsgPack(buf, e); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	case map[string]any:
+		buf = msgpackHeader(buf, len(x), 0x80, 0xde)
+		var err error
+		for _, k := range sortedKeys(x) {
+			if buf, err = encodeMsgPack(buf, k); err != nil {
+				return nil, err
+			}
+			if buf, err = encodeMsgPack(buf, x[k]); err != nil {
+				return nil, err
+			}
+		}
+		return buf, nil
+	}
+	return nil, fmt.Errorf("codec: msgpack: unsupported value %T", v)
+}
+
+func msgpackHeader(buf []byte, n int, fix, code16 byte) []byte {
+	switch {
+	case n < 16:
+		return append(buf, fix|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, code16), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(buf, code16+1), uint32(n))
+}
+
+func msgpackInt(buf []byte, n int64) []byte {
+	switch {
+	case n >= 0 && n <= 0x7f:
+		return append(buf, byte(n))
+	case n < 0 && n >= -32:
+		return append(buf, byte(int8(n)))
+	case n >= 0 && n <= math.MaxUint8:
+		return append(buf, 0xcc, byte(n))
+	case n >= 0 && n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(buf, 0xcd), uint16(n))
+	case n >= 0 && n <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(buf, 0xce), uint32(n))
+	case n >= math.MinInt8 && n < 0:
+		return append(buf, 0xd0, byte(int8(n)))
+	case n >= math.MinInt16 && n < 0:
+		return binary.BigEndian.AppendUint16(append(buf, 0xd1), uint16(int16(n)))
+	case n >= math.MinInt32 && n < 0:
+		return binary.BigEndian.AppendUint32(append(buf, 0xd2), uint32(int32(n)))
+	}
+	return binary.BigEndian.AppendUint64(append(buf, 0xd3), uint64(n))
+}
@@ -5,11 +5,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/perm1ss10n/vexora/backend/internal/model"
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
 )
 
 var (
@@ -17,57 +22,275 @@ var (
 	ErrPublish      = errors.New("publish failed")
 	ErrInvalidAck   = errors.New("invalid ack")
 	ErrNotConnected = errors.New("mqtt not connected")
+	ErrCancelled    = errors.New("command cancelled")
+	ErrNotPending   = errors.New("command is not pending")
 )
 
+// CodeCancelled — code синтетического ACK для отменённой команды.
+const CodeCancelled = "CANCELLED"
+
+// CancelType — служебная команда устройству: params.id = id отменяемой команды.
+const CancelType = "cancel"
+
+// KnownTypes — команды, которые понимает прошивка.
+var KnownTypes = []string{"ping", "reboot", "get_state", "apply_cfg"}
+
+func IsKnownType(t string) bool {
+	for _, k := range KnownTypes {
+		if k == t {
+			return true
+		}
+	}
+	return false
+}
+
 // Publisher — абстракция публикации в MQTT (чтобы не тащить paho сюда напрямую).
 type Publisher interface {
 	Publish(topic string, qos byte, retained bool, payload []byte) error
 }
 
+// History — персистентная история команд (реализует registry.SQLiteStore).
+type History interface {
+	InsertCommand(ctx context.Context, rec registry.CommandRecord) error
+	UpdateCommandResult(ctx context.Context, id string, status string, attempts int, ack *model.AckPayload, tsMillis int64) error
+}
+
+// Locker — блокировка устройства на время команды (реализует oplock.Manager).
+type Locker interface {
+	Acquire(ctx context.Context, deviceID, kind, ref, holder string, lease time.Duration) error
+	Release(ctx context.Context, deviceID, kind, ref string)
+}
+
+// LockKinds — команды, которые держат блокировку устройства, и вид блокировки (см. oplock).
+// Остальные (ping, get_state, cancel) выполняются при любой блокировке.
+var LockKinds = map[string]string{
+	"apply_cfg": "cfg",
+	"reboot":    "cmd",
+}
+
+// Update — изменение статуса команды для live-подписчиков (UI/операторы).
+type Update struct {
+	ID       string            `json:"id"`
+	DeviceID string            `json:"deviceId"`
+	Type     string            `json:"type"`
+	Status   string            `json:"status"`
+	Attempts int               `json:"attempts,omitempty"`
+	Ack      *model.AckPayload `json:"ack,omitempty"`
+	Ts       int64             `json:"ts"`
+}
+
+// DefaultLateAckGrace — сколько помним id команд, завершившихся по TIMEOUT.
+const DefaultLateAckGrace = 10 * time.Minute
+
+// pendingCmd — команда, по которой Send ещё ждёт ACK.
+type pendingCmd struct {
+	ch         chan model.AckPayload
+	cancel     chan struct{} // закрывается Cancel()
+	deviceID   string
+	cmdType    string
+	params     map[string]any
+	createdAt  int64
+	publishing bool // попытка прямо сейчас публикуется
+	published  bool // хотя бы одна попытка ушла в брокер
+	cancelled  bool
+}
+
+// expiredCmd — команда, для которой Send уже вернул TIMEOUT, но ACK ещё ждём.
+type expiredCmd struct {
+	deviceID string
+	cmdType  string
+	attempts int
+	until    time.Time
+}
+
+// RetryPolicy — повторная публикация команды при отсутствии ACK.
+// Каждая попытка ждёт ACK не дольше timeout из Send; между попытками — backoff (x2, с капом).
+// id команды при повторе не меняется, растёт только attempt — устройство дедуплицирует по id.
+type RetryPolicy struct {
+	Attempts   int           // всего попыток (>=1)
+	Backoff    time.Duration // пауза перед второй попыткой
+	MaxBackoff time.Duration // верхняя граница паузы
+}
+
+// DefaultRetryPolicy — одна попытка, как было до ретраев.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{Attempts: 1, Backoff: time.Second, MaxBackoff: 30 * time.Second}
+}
+
+// LoadRetryPolicyFromEnv читает CMD_RETRY_ATTEMPTS / CMD_RETRY_BACKOFF_MS / CMD_RETRY_MAX_BACKOFF_MS.
+func LoadRetryPolicyFromEnv() RetryPolicy {
+	p := DefaultRetryPolicy()
+	if n := getenvInt("CMD_RETRY_ATTEMPTS", 0); n > 0 {
+		p.Attempts = n
+	}
+	if n := getenvInt("CMD_RETRY_BACKOFF_MS", 0); n > 0 {
+		p.Backoff = time.Duration(n) * time.Millisecond
+	}
+	if n := getenvInt("CMD_RETRY_MAX_BACKOFF_MS", 0); n > 0 {
+		p.MaxBackoff = time.Duration(n) * time.Millisecond
+	}
+	return p
+}
+
+// maxWait — сколько Send может ждать ACK со всеми повторами и паузами.
+func (p RetryPolicy) maxWait(timeout time.Duration) time.Duration {
+	return timeout*time.Duration(p.Attempts) + p.MaxBackoff*time.Duration(p.Attempts-1)
+}
+
+func (p RetryPolicy) normalized() RetryPolicy {
+	if p.Attempts < 1 {
+		p.Attempts = 1
+	}
+	if p.Backoff < 0 {
+		p.Backoff = 0
+	}
+	if p.MaxBackoff < p.Backoff {
+		p.MaxBackoff = p.Backoff
+	}
+	return p
+}
+
 type Manager struct {
-	pub Publisher
+	pub     Publisher
+	history History
+	locks   Locker
 
 	mu      sync.Mutex
-	pending map[string]chan model.AckPayload // key = cmdId
+	pending map[string]*pendingCmd // key = cmdId
+	retry   RetryPolicy
+	expired map[string]expiredCmd // key = cmdId, late ACK grace window
+	lateWin time.Duration
+	subs    map[int]chan Update
+	nextSub int
 }
 
 func New(pub Publisher) *Manager {
 	return &Manager{
 		pub:     pub,
-		pending: make(map[string]chan model.AckPayload),
+		pending: make(map[string]*pendingCmd),
+		retry:   DefaultRetryPolicy(),
+		expired: make(map[string]expiredCmd),
+		lateWin: DefaultLateAckGrace,
+		subs:    make(map[int]chan Update),
 	}
 }
 
+// SetHistory включает запись истории команд. nil — без истории.
+func (m *Manager) SetHistory(h History) {
+	m.mu.Lock()
+	m.history = h
+	m.mu.Unlock()
+}
+
+// SetLocks включает блокировку устройства для команд из LockKinds. nil — без блокировок.
+func (m *Manager) SetLocks(l Locker) {
+	m.mu.Lock()
+	m.locks = l
+	m.mu.Unlock()
+}
+
+// SetLateAckGrace задаёт окно, в течение которого ACK после TIMEOUT ещё учитывается.
+func (m *Manager) SetLateAckGrace(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	m.mu.Lock()
+	m.lateWin = d
+	m.mu.Unlock()
+}
+
+// LoadLateAckGraceFromEnv читает CMD_LATE_ACK_GRACE_MS (по умолчанию DefaultLateAckGrace).
+func LoadLateAckGraceFromEnv() time.Duration {
+	if n := getenvInt("CMD_LATE_ACK_GRACE_MS", -1); n >= 0 {
+		return time.Duration(n) * time.Millisecond
+	}
+	return DefaultLateAckGrace
+}
+
+// Subscribe — live-поток изменений статусов команд. Медленный подписчик теряет события,
+// но не тормозит обработку ACK. Возвращённую функцию нужно вызвать для отписки.
+func (m *Manager) Subscribe() (<-chan Update, func()) {
+	ch := make(chan Update, 32)
+
+	m.mu.Lock()
+	id := m.nextSub
+	m.nextSub++
+	m.subs[id] = ch
+	m.mu.Unlock()
+
+	return ch, func() {
+		m.mu.Lock()
+		if _, ok := m.subs[id]; ok {
+			delete(m.subs, id)
+			close(ch)
+		}
+		m.mu.Unlock()
+	}
+}
+
+// MaxWait — верхняя граница ожидания Send с этим timeout при текущей политике повторов.
+func (m *Manager) MaxWait(timeout time.Duration) time.Duration {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	m.mu.Lock()
+	policy := m.retry
+	m.mu.Unlock()
+	return policy.maxWait(timeout)
+}
+
+// SetRetryPolicy задаёт политику повторов для последующих Send.
+func (m *Manager) SetRetryPolicy(p RetryPolicy) {
+	m.mu.Lock()
+	m.retry = p.normalized()
+	m.mu.Unlock()
+}
+
+// Send публикует команду и ждёт ACK. timeout — ожидание ACK на одну попытку.
+// Итоговый ack (включая синтетический TIMEOUT) содержит Attempts — число публикаций.
 func (m *Manager) Send(ctx context.Context, deviceID string, cmdType string, params map[string]any, timeout time.Duration) (model.AckPayload, error) {
-	if deviceID == "" || cmdType == "" {
+	return m.SendWithID(ctx, uuid.NewString(), deviceID, cmdType, params, timeout)
+}
+
+// SendWithID — как Send, но id команды задаёт вызывающий (например, чтобы связать
+// его с Idempotency-Key до публикации).
+func (m *Manager) SendWithID(ctx context.Context, cmdID string, deviceID string, cmdType string, params map[string]any, timeout time.Duration) (model.AckPayload, error) {
+	if cmdID == "" || deviceID == "" || cmdType == "" {
 		return model.AckPayload{}, fmt.Errorf("deviceId/cmdType is empty")
 	}
 	if timeout <= 0 {
 		timeout = 10 * time.Second
 	}
 
-	cmdID := uuid.NewString()
-	now := time.Now().UnixMilli()
+	m.mu.Lock()
+	policy := m.retry
+	locks := m.locks
+	m.mu.Unlock()
 
-	cmd := model.CommandPayload{
-		V:        1,
-		ID:       cmdID,
-		DeviceID: deviceID,
-		Ts:       now,
-		Type:     cmdType,
-		Params:   params,
+	// блокировка держится, пока Send ждёт ACK (со всеми повторами); ACK/TIMEOUT/отмена её снимают
+	if kind, ok := LockKinds[cmdType]; ok && locks != nil {
+		if err := locks.Acquire(ctx, deviceID, kind, cmdID, "cmd:"+cmdType, policy.maxWait(timeout)); err != nil {
+			return model.AckPayload{}, err
+		}
+		defer locks.Release(context.Background(), deviceID, kind, cmdID)
 	}
 
-	b, err := json.Marshal(cmd)
-	if err != nil {
-		return model.AckPayload{}, fmt.Errorf("marshal cmd: %w", err)
+	pc := &pendingCmd{
+		ch:        make(chan model.AckPayload, 1),
+		cancel:    make(chan struct{}),
+		deviceID:  deviceID,
+		cmdType:   cmdType,
+		params:    params,
+		createdAt: time.Now().UnixMilli(),
 	}
 
-	ch := make(chan model.AckPayload, 1)
-
-	// register pending
+	// register pending (один канал на все попытки: ACK на любую из них завершает Send)
 	m.mu.Lock()
-	m.pending[cmdID] = ch
+	if _, dup := m.pending[cmdID]; dup {
+		m.mu.Unlock()
+		return model.AckPayload{}, fmt.Errorf("command id %s is already pending", cmdID)
+	}
+	m.pending[cmdID] = pc
 	m.mu.Unlock()
 
 	// cleanup on exit
@@ -77,53 +300,334 @@ func (m *Manager) Send(ctx context.Context, deviceID string, cmdType string, par
 		m.mu.Unlock()
 	}()
 
-	// publish
+	m.recordSent(cmdID, deviceID, cmdType, params)
+
 	topic := fmt.Sprintf("v1/dev/%s/cmd", deviceID)
+	backoff := policy.Backoff
+
+	for attempt := 1; ; attempt++ {
+		cmd := model.CommandPayload{
+			V:        1,
+			ID:       cmdID,
+			DeviceID: deviceID,
+			Ts:       time.Now().UnixMilli(),
+			Type:     cmdType,
+			Params:   params,
+			Attempt:  attempt,
+		}
+
+		b, err := json.Marshal(cmd)
+		if err != nil {
+			return model.AckPayload{}, fmt.Errorf("marshal cmd: %w", err)
+		}
+
+		// отменили до (повторной) публикации — в брокер больше не идём. Проверка и отметка
+		// publishing под одним локом: Cancel, пришедший во время Publish, отправит устройству cancel
+		m.mu.Lock()
+		if pc.cancelled {
+			m.mu.Unlock()
+			return m.finishCancelled(cmdID, deviceID, cmdType, attempt-1)
+		}
+		pc.publishing = true
+		m.mu.Unlock()
+
+		// publish
+		err = m.pub.Publish(topic, 1, false, b)
+		m.mu.Lock()
+		pc.publishing = false
+		if err == nil {
+			pc.published = true
+		}
+		m.mu.Unlock()
+		if err != nil {
+			m.recordResult(cmdID, deviceID, cmdType, registry.CommandStatusPublishFailed, attempt, nil)
+			return model.AckPayload{Attempts: attempt}, fmt.Errorf("%w: %v", ErrPublish, err)
+		}
+
+		// wait ack
+		ack, err := waitAck(ctx, pc, timeout)
+		if err == nil {
+			return m.finishAcked(cmdID, cmdType, attempt, ack), nil
+		}
+		if errors.Is(err, ErrCancelled) {
+			return m.finishCancelled(cmdID, deviceID, cmdType, attempt)
+		}
+		if !errors.Is(err, ErrTimeout) || attempt >= policy.Attempts {
+			return m.finishUnacked(cmdID, deviceID, cmdType, attempt, err)
+		}
+
+		// пауза перед следующей попыткой; ACK на предыдущую попытку тоже принимаем
+		if backoff > 0 {
+			ack, err := waitAck(ctx, pc, backoff)
+			if err == nil {
+				return m.finishAcked(cmdID, cmdType, attempt, ack), nil
+			}
+			if errors.Is(err, ErrCancelled) {
+				return m.finishCancelled(cmdID, deviceID, cmdType, attempt)
+			}
+			if !errors.Is(err, ErrTimeout) {
+				return m.finishUnacked(cmdID, deviceID, cmdType, attempt, err)
+			}
+		}
+		backoff = minDur(backoff*2, policy.MaxBackoff)
+	}
+}
+
+func (m *Manager) finishAcked(cmdID, cmdType string, attempt int, ack model.AckPayload) model.AckPayload {
+	ack.Attempts = attempt
+	status := registry.CommandStatusAcked
+	if !ack.Ok {
+		status = registry.CommandStatusFailed
+	}
+	m.recordResult(cmdID, ack.DeviceID, cmdType, status, attempt, &ack)
+	return ack
+}
+
+func (m *Manager) finishCancelled(cmdID, deviceID, cmdType string, attempts int) (model.AckPayload, error) {
+	ack := model.AckPayload{
+		V:        1,
+		ID:       cmdID,
+		DeviceID: deviceID,
+		Ts:       time.Now().UnixMilli(),
+		Ok:       false,
+		Code:     CodeCancelled,
+		Msg:      "cancelled by operator",
+		Attempts: attempts,
+	}
+	m.recordResult(cmdID, deviceID, cmdType, registry.CommandStatusCancelled, attempts, &ack)
+	return ack, ErrCancelled
+}
+
+// Cancel отменяет команду, по которой Send ещё ждёт ACK: Send возвращает CANCELLED.
+// Если команда уже ушла в брокер — устройству публикуется cmd "cancel" с params.id,
+// чтобы оно не выполняло её при (повторной) доставке.
+func (m *Manager) Cancel(cmdID string) error {
+	m.mu.Lock()
+	pc := m.pending[cmdID]
+	if pc == nil || pc.cancelled {
+		m.mu.Unlock()
+		return ErrNotPending
+	}
+	pc.cancelled = true
+	// публикация в процессе — команда может дойти до устройства, cancel нужен так же, как после неё
+	published := pc.published || pc.publishing
+	close(pc.cancel)
+	m.mu.Unlock()
+
+	log.Printf("[CMD] cancel id=%s deviceId=%s type=%s published=%v", cmdID, pc.deviceID, pc.cmdType, published)
+	if !published {
+		return nil
+	}
+
+	b, err := json.Marshal(model.CommandPayload{
+		V:        1,
+		ID:       uuid.NewString(),
+		DeviceID: pc.deviceID,
+		Ts:       time.Now().UnixMilli(),
+		Type:     CancelType,
+		Params:   map[string]any{"id": cmdID},
+	})
+	if err != nil {
+		return fmt.Errorf("marshal cancel: %w", err)
+	}
+	topic := fmt.Sprintf("v1/dev/%s/cmd", pc.deviceID)
 	if err := m.pub.Publish(topic, 1, false, b); err != nil {
-		return model.AckPayload{}, fmt.Errorf("%w: %v", ErrPublish, err)
+		// Send уже разбужен; устройство могло не узнать об отмене — только логируем
+		log.Printf("[CMD] cancel_publish_failed id=%s deviceId=%s err=%v", cmdID, pc.deviceID, err)
+		return fmt.Errorf("%w: %v", ErrPublish, err)
+	}
+	return nil
+}
+
+// finishUnacked — ACK не дождались. Запоминаем id на grace-окно, чтобы поймать поздний ACK.
+func (m *Manager) finishUnacked(cmdID, deviceID, cmdType string, attempt int, err error) (model.AckPayload, error) {
+	if errors.Is(err, ErrInvalidAck) {
+		m.recordResult(cmdID, deviceID, cmdType, registry.CommandStatusFailed, attempt, nil)
+		return model.AckPayload{Attempts: attempt}, err
+	}
+
+	m.mu.Lock()
+	if m.lateWin > 0 {
+		m.pruneExpiredLocked(time.Now())
+		m.expired[cmdID] = expiredCmd{
+			deviceID: deviceID,
+			cmdType:  cmdType,
+			attempts: attempt,
+			until:    time.Now().Add(m.lateWin),
+		}
+	}
+	m.mu.Unlock()
+
+	if !errors.Is(err, ErrTimeout) {
+		m.recordResult(cmdID, deviceID, cmdType, registry.CommandStatusAborted, attempt, nil)
+		return model.AckPayload{Attempts: attempt}, err
+	}
+
+	m.recordResult(cmdID, deviceID, cmdType, registry.CommandStatusTimeout, attempt, nil)
+	return model.AckPayload{
+		V:        1,
+		ID:       cmdID,
+		DeviceID: deviceID,
+		Ts:       time.Now().UnixMilli(),
+		Ok:       false,
+		Code:     "TIMEOUT",
+		Msg:      "ACK timeout",
+		Attempts: attempt,
+	}, ErrTimeout
+}
+
+func (m *Manager) pruneExpiredLocked(now time.Time) {
+	for id, e := range m.expired {
+		if now.After(e.until) {
+			delete(m.expired, id)
+		}
 	}
+}
 
-	// wait ack
-	timer := time.NewTimer(timeout)
+func (m *Manager) recordSent(cmdID, deviceID, cmdType string, params map[string]any) {
+	m.mu.Lock()
+	h := m.history
+	m.mu.Unlock()
+
+	now := time.Now().UnixMilli()
+	if h != nil {
+		err := h.InsertCommand(context.Background(), registry.CommandRecord{
+			ID:            cmdID,
+			DeviceID:      deviceID,
+			Type:          cmdType,
+			Params:        params,
+			Status:        registry.CommandStatusSent,
+			CreatedMillis: now,
+		})
+		if err != nil {
+			log.Printf("[CMD] history_insert_failed id=%s err=%v", cmdID, err)
+		}
+	}
+	m.broadcast(Update{ID: cmdID, DeviceID: deviceID, Type: cmdType, Status: registry.CommandStatusSent, Ts: now})
+}
+
+func (m *Manager) recordResult(cmdID, deviceID, cmdType, status string, attempts int, ack *model.AckPayload) {
+	m.mu.Lock()
+	h := m.history
+	m.mu.Unlock()
+
+	now := time.Now().UnixMilli()
+	if h != nil {
+		if err := h.UpdateCommandResult(context.Background(), cmdID, status, attempts, ack, now); err != nil {
+			log.Printf("[CMD] history_update_failed id=%s status=%s err=%v", cmdID, status, err)
+		}
+	}
+	m.broadcast(Update{ID: cmdID, DeviceID: deviceID, Type: cmdType, Status: status, Attempts: attempts, Ack: ack, Ts: now})
+}
+
+func (m *Manager) broadcast(u Update) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, ch := range m.subs {
+		select {
+		case ch <- u:
+		default:
+		}
+	}
+}
+
+// waitAck ждёт ACK не дольше d. По истечении — ErrTimeout.
+func waitAck(ctx context.Context, pc *pendingCmd, d time.Duration) (model.AckPayload, error) {
+	timer := time.NewTimer(d)
 	defer timer.Stop()
 
 	select {
-	case ack := <-ch:
+	case ack := <-pc.ch:
 		if ack.ID == "" || ack.DeviceID == "" {
 			return model.AckPayload{}, ErrInvalidAck
 		}
 		return ack, nil
+	case <-pc.cancel:
+		return model.AckPayload{}, ErrCancelled
 	case <-timer.C:
-		return model.AckPayload{
-			V:        1,
-			ID:       cmdID,
-			DeviceID: deviceID,
-			Ts:       time.Now().UnixMilli(),
-			Ok:       false,
-			Code:     "TIMEOUT",
-			Msg:      "ACK timeout",
-		}, ErrTimeout
+		return model.AckPayload{}, ErrTimeout
 	case <-ctx.Done():
 		return model.AckPayload{}, ctx.Err()
 	}
 }
 
+// PendingFor — команды устройства, по которым ещё ждём ACK (для запроса get_pending_cmds).
+func (m *Manager) PendingFor(deviceID string) []model.CommandPayload {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	out := []model.CommandPayload{}
+	for id, pc := range m.pending {
+		if pc.deviceID != deviceID || pc.cancelled {
+			continue
+		}
+		out = append(out, model.CommandPayload{
+			V:        1,
+			ID:       id,
+			DeviceID: pc.deviceID,
+			Ts:       pc.createdAt,
+			Type:     pc.cmdType,
+			Params:   pc.params,
+		})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Ts < out[j].Ts })
+	return out
+}
+
 // OnAck дергается из MQTT dispatcher при получении v1/dev/{deviceId}/ack
 func (m *Manager) OnAck(ack model.AckPayload) {
 	if ack.ID == "" {
 		return
 	}
 	m.mu.Lock()
-	ch := m.pending[ack.ID]
+	pc := m.pending[ack.ID]
+	late, isLate := m.expired[ack.ID]
+	// ACK засчитывается только от устройства, которому ушла команда: чужой id не завершает команду
+	owner := late.deviceID
+	if pc != nil {
+		owner = pc.deviceID
+	}
+	if (pc != nil || isLate) && ack.DeviceID != owner {
+		m.mu.Unlock()
+		log.Printf("[CMD] ack_device_mismatch id=%s deviceId=%s expected=%s", ack.ID, ack.DeviceID, owner)
+		return
+	}
+	if pc == nil && isLate {
+		delete(m.expired, ack.ID)
+	}
 	m.mu.Unlock()
 
-	if ch == nil {
+	if pc == nil {
+		if isLate && time.Now().Before(late.until) {
+			log.Printf("[CMD] late_ack id=%s deviceId=%s type=%s ok=%v code=%s", ack.ID, late.deviceID, late.cmdType, ack.Ok, ack.Code)
+			ack.Attempts = late.attempts
+			m.recordResult(ack.ID, late.deviceID, late.cmdType, registry.CommandStatusAckedLate, late.attempts, &ack)
+		}
 		return
 	}
 
 	// не блокируемся
 	select {
-	case ch <- ack:
+	case pc.ch <- ack:
 	default:
 	}
 }
+
+func minDur(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func getenvInt(k string, def int) int {
+	v := os.Getenv(k)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return def
+	}
+	return n
+}
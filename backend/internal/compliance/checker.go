@@ -0,0 +1,208 @@
+package compliance
+
+import (
+	"context"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/perm1ss10n/vexora/backend/internal/model"
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+)
+
+// Start запускает периодический пересчёт соответствия парка.
+func (s *Service) Start(ctx context.Context) {
+	go func() {
+		s.Sweep(ctx)
+
+		t := time.NewTicker(s.cfg.Tick)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				s.Sweep(ctx)
+			}
+		}
+	}()
+}
+
+// Sweep пересчитывает соответствие всех устройств, пишет события о смене статуса
+// и записывает несоответствующие устройства в OTA-кампании (autoEnroll).
+func (s *Service) Sweep(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	policies, err := s.store.ListFirmwarePolicies(ctx)
+	if err != nil {
+		log.Printf("[FW_COMPLIANCE] list_policies_failed err=%v", err)
+		return
+	}
+	devices, err := s.store.ListDevices(ctx)
+	if err != nil {
+		log.Printf("[FW_COMPLIANCE] list_devices_failed err=%v", err)
+		return
+	}
+	membership, err := s.membership(ctx, policies)
+	if err != nil {
+		log.Printf("[FW_COMPLIANCE] list_groups_failed err=%v", err)
+		return
+	}
+	stored, err := s.store.ListFWCompliance(ctx)
+	if err != nil {
+		log.Printf("[FW_COMPLIANCE] list_state_failed err=%v", err)
+		return
+	}
+
+	now := time.Now().UnixMilli()
+	enroll := map[string]map[string]string{}
+	for _, d := range devices {
+		fw := d.FW.String
+		ev := Evaluate(policies, membership[d.DeviceID], fw)
+		var prev *registry.FWComplianceRecord
+		if rec, ok := stored[d.DeviceID]; ok {
+			prev = &rec
+		}
+		s.record(ctx, d.DeviceID, fw, ev, prev, now)
+		if ev.Enroll {
+			if enroll[ev.Target] == nil {
+				enroll[ev.Target] = map[string]string{}
+			}
+			enroll[ev.Target][d.DeviceID] = fw
+		}
+	}
+	s.enroll(ctx, enroll)
+}
+
+// OnFirmware — state.fw устройства: пересчёт только если версия изменилась
+// (смену политик и групп подхватывает Sweep).
+func (s *Service) OnFirmware(deviceID, fw string) {
+	if deviceID == "" || fw == "" {
+		return
+	}
+	ctx := context.Background()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, err := s.store.GetFWCompliance(ctx, deviceID)
+	if err != nil {
+		log.Printf("[FW_COMPLIANCE] get_state_failed deviceId=%s err=%v", deviceID, err)
+		return
+	}
+	if prev != nil && prev.FW == fw {
+		return
+	}
+	policies, err := s.store.ListFirmwarePolicies(ctx)
+	if err != nil {
+		log.Printf("[FW_COMPLIANCE] list_policies_failed err=%v", err)
+		return
+	}
+	groups, err := s.store.ListDeviceGroups(ctx, deviceID)
+	if err != nil {
+		log.Printf("[FW_COMPLIANCE] list_groups_failed deviceId=%s err=%v", deviceID, err)
+		return
+	}
+	member := make(map[string]bool, len(groups))
+	for _, g := range groups {
+		member[g] = true
+	}
+
+	ev := Evaluate(policies, member, fw)
+	s.record(ctx, deviceID, fw, ev, prev, time.Now().UnixMilli())
+	if ev.Enroll {
+		s.enroll(ctx, map[string]map[string]string{ev.Target: {deviceID: fw}})
+	}
+}
+
+// membership — группы устройств, на которые ссылаются политики: deviceId -> {group}.
+func (s *Service) membership(ctx context.Context, policies []registry.FirmwarePolicy) (map[string]map[string]bool, error) {
+	out := map[string]map[string]bool{}
+	seen := map[string]bool{}
+	for _, p := range policies {
+		if p.Group == "" || seen[p.Group] {
+			continue
+		}
+		seen[p.Group] = true
+		ids, err := s.store.ListGroupDevices(ctx, p.Group)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			if out[id] == nil {
+				out[id] = map[string]bool{}
+			}
+			out[id][p.Group] = true
+		}
+	}
+	return out, nil
+}
+
+// record сохраняет результат, если он изменился, и пишет событие при входе/выходе из соответствия.
+func (s *Service) record(ctx context.Context, deviceID, fw string, ev Evaluation, prev *registry.FWComplianceRecord, now int64) {
+	if prev != nil && prev.Status == ev.Status && prev.FW == fw && slices.Equal(prev.Reasons, ev.Reasons) {
+		return
+	}
+	rec := registry.FWComplianceRecord{
+		DeviceID:      deviceID,
+		Status:        ev.Status,
+		Reasons:       ev.Reasons,
+		FW:            fw,
+		ChangedMillis: now,
+		UpdatedMillis: now,
+	}
+	if prev != nil && prev.Status == ev.Status {
+		rec.ChangedMillis = prev.ChangedMillis
+	}
+	if err := s.store.SetFWCompliance(ctx, rec); err != nil {
+		log.Printf("[FW_COMPLIANCE] set_state_failed deviceId=%s err=%v", deviceID, err)
+		return
+	}
+
+	wasNonCompliant := prev != nil && prev.Status == StatusNonCompliant
+	switch {
+	case ev.Status == StatusNonCompliant && !wasNonCompliant:
+		log.Printf("[FW_COMPLIANCE] non_compliant deviceId=%s fw=%s reasons=%v", deviceID, fw, ev.Reasons)
+		s.writeEvent(deviceID, EventFWNonCompliant, "warn", fw, ev)
+	case ev.Status != StatusNonCompliant && wasNonCompliant:
+		log.Printf("[FW_COMPLIANCE] compliant deviceId=%s fw=%s status=%s", deviceID, fw, ev.Status)
+		s.writeEvent(deviceID, EventFWCompliant, "info", fw, ev)
+	}
+}
+
+func (s *Service) enroll(ctx context.Context, byTarget map[string]map[string]string) {
+	if s.enroller == nil {
+		return
+	}
+	for target, devices := range byTarget {
+		campaignID, n, err := s.enroller.Enroll(ctx, target, devices)
+		if err != nil {
+			log.Printf("[FW_COMPLIANCE] enroll_failed version=%s err=%v", target, err)
+			continue
+		}
+		if n > 0 {
+			log.Printf("[FW_COMPLIANCE] enrolled campaignId=%s version=%s count=%d", campaignID, target, n)
+		}
+	}
+}
+
+func (s *Service) writeEvent(deviceID, code, severity, fw string, ev Evaluation) {
+	if s.events == nil {
+		return
+	}
+	data := map[string]any{"fw": fw, "reasons": ev.Reasons, "policies": ev.Policies}
+	if ev.Target != "" {
+		data["targetVersion"] = ev.Target
+	}
+	s.events.WriteEvent(model.EventPayload{
+		V:        1,
+		DeviceID: deviceID,
+		Ts:       time.Now().UnixMilli(),
+		Code:     code,
+		Severity: severity,
+		Msg:      "firmware " + fw + " is " + ev.Status,
+		Data:     data,
+	})
+}
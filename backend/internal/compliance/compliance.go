@@ -0,0 +1,286 @@
+package compliance
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/perm1ss10n/vexora/backend/internal/firmware"
+	"github.com/perm1ss10n/vexora/backend/internal/model"
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+)
+
+var (
+	ErrInvalid  = errors.New("invalid firmware policy")
+	ErrNotFound = errors.New("firmware policy not found")
+)
+
+// Статусы соответствия устройства.
+const (
+	StatusCompliant    = "compliant"
+	StatusNonCompliant = "non_compliant"
+	StatusUnknown      = "unknown" // устройство не сообщало fw или версия не разбирается
+)
+
+// Причины несоответствия: "<код>:<политика>".
+const (
+	ReasonBelowMin = "below_min"
+	ReasonKnownBad = "known_bad"
+)
+
+// События backend'а по устройству (device-state-machine.md §4).
+const (
+	EventFWNonCompliant = "FW_NONCOMPLIANT"
+	EventFWCompliant    = "FW_COMPLIANT"
+)
+
+var policyNameRe = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Store — политики, устройства, группы и последнее соответствие (реализует registry.SQLiteStore).
+type Store interface {
+	UpsertFirmwarePolicy(ctx context.Context, p registry.FirmwarePolicy) error
+	GetFirmwarePolicy(ctx context.Context, name string) (*registry.FirmwarePolicy, error)
+	ListFirmwarePolicies(ctx context.Context) ([]registry.FirmwarePolicy, error)
+	DeleteFirmwarePolicy(ctx context.Context, name string) (bool, error)
+	ListFWCompliance(ctx context.Context) (map[string]registry.FWComplianceRecord, error)
+	GetFWCompliance(ctx context.Context, deviceID string) (*registry.FWComplianceRecord, error)
+	SetFWCompliance(ctx context.Context, rec registry.FWComplianceRecord) error
+
+	ListDevices(ctx context.Context) ([]registry.DeviceRecord, error)
+	ListGroupDevices(ctx context.Context, group string) ([]string, error)
+	ListDeviceGroups(ctx context.Context, deviceID string) ([]string, error)
+}
+
+// Enroller — запись несоответствующих устройств в текущую OTA-кампанию (реализует ota.Service).
+type Enroller interface {
+	Enroll(ctx context.Context, targetVersion string, devices map[string]string) (string, int, error)
+}
+
+// EventSink — куда писать события, сгенерированные backend (реализует influx.Client).
+type EventSink interface {
+	WriteEvent(e model.EventPayload)
+}
+
+type Config struct {
+	Tick time.Duration // периодический пересчёт: политики, группы и fw меняются независимо
+}
+
+func LoadConfigFromEnv() Config {
+	return Config{
+		Tick: time.Duration(getenvInt("FW_COMPLIANCE_TICK_MS", 60000)) * time.Millisecond,
+	}
+}
+
+// PolicyRequest — политика в том виде, в каком её задаёт пользователь.
+type PolicyRequest struct {
+	Group         string
+	MinVersion    string
+	KnownBad      []string
+	TargetVersion string
+	AutoEnroll    bool
+}
+
+type Service struct {
+	store    Store
+	cfg      Config
+	events   EventSink
+	enroller Enroller
+
+	mu sync.Mutex // пересчёт и запись соответствия
+}
+
+func New(store Store, cfg Config) *Service {
+	if cfg.Tick <= 0 {
+		cfg.Tick = time.Minute
+	}
+	return &Service{store: store, cfg: cfg}
+}
+
+func (s *Service) SetEvents(events EventSink) {
+	s.events = events
+}
+
+func (s *Service) SetEnroller(enroller Enroller) {
+	s.enroller = enroller
+}
+
+func (s *Service) Tick() time.Duration {
+	return s.cfg.Tick
+}
+
+func (s *Service) ListPolicies(ctx context.Context) ([]registry.FirmwarePolicy, error) {
+	return s.store.ListFirmwarePolicies(ctx)
+}
+
+func (s *Service) GetPolicy(ctx context.Context, name string) (*registry.FirmwarePolicy, error) {
+	p, err := s.store.GetFirmwarePolicy(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if p == nil {
+		return nil, ErrNotFound
+	}
+	return p, nil
+}
+
+// PutPolicy создаёт или заменяет политику и сразу пересчитывает соответствие парка.
+func (s *Service) PutPolicy(ctx context.Context, name string, req PolicyRequest, actor string) (*registry.FirmwarePolicy, bool, error) {
+	p, err := normalizePolicy(name, req)
+	if err != nil {
+		return nil, false, err
+	}
+	prev, err := s.store.GetFirmwarePolicy(ctx, p.Name)
+	if err != nil {
+		return nil, false, err
+	}
+	now := time.Now().UnixMilli()
+	p.UpdatedBy = actor
+	p.CreatedMillis = now
+	p.UpdatedMillis = now
+	if prev != nil {
+		p.CreatedMillis = prev.CreatedMillis
+	}
+	if err := s.store.UpsertFirmwarePolicy(ctx, p); err != nil {
+		return nil, false, err
+	}
+	go s.Sweep(context.Background())
+	return &p, prev == nil, nil
+}
+
+func (s *Service) DeletePolicy(ctx context.Context, name string) error {
+	ok, err := s.store.DeleteFirmwarePolicy(ctx, name)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrNotFound
+	}
+	go s.Sweep(context.Background())
+	return nil
+}
+
+func normalizePolicy(name string, req PolicyRequest) (registry.FirmwarePolicy, error) {
+	p := registry.FirmwarePolicy{
+		Name:       strings.TrimSpace(name),
+		Group:      strings.TrimSpace(req.Group),
+		KnownBad:   []string{},
+		AutoEnroll: req.AutoEnroll,
+	}
+	if !policyNameRe.MatchString(p.Name) {
+		return p, fmt.Errorf("%w: name must match %s", ErrInvalid, policyNameRe.String())
+	}
+	var minV, targetV *firmware.Version
+	if v := strings.TrimSpace(req.MinVersion); v != "" {
+		ver, err := firmware.ParseVersion(v)
+		if err != nil {
+			return p, fmt.Errorf("%w: minVersion: %v", ErrInvalid, err)
+		}
+		p.MinVersion, minV = ver.String(), &ver
+	}
+	if v := strings.TrimSpace(req.TargetVersion); v != "" {
+		ver, err := firmware.ParseVersion(v)
+		if err != nil {
+			return p, fmt.Errorf("%w: targetVersion: %v", ErrInvalid, err)
+		}
+		p.TargetVersion, targetV = ver.String(), &ver
+	}
+	for _, raw := range req.KnownBad {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		c, err := firmware.ParseConstraint(raw)
+		if err != nil {
+			return p, fmt.Errorf("%w: knownBad: %v", ErrInvalid, err)
+		}
+		if targetV != nil && c.Match(targetV.String()) {
+			return p, fmt.Errorf("%w: targetVersion %s is listed in knownBad %q", ErrInvalid, p.TargetVersion, raw)
+		}
+		p.KnownBad = append(p.KnownBad, c.String())
+	}
+	if minV != nil && targetV != nil && targetV.Compare(*minV) < 0 {
+		return p, fmt.Errorf("%w: targetVersion is below minVersion", ErrInvalid)
+	}
+	if p.MinVersion == "" && len(p.KnownBad) == 0 && p.TargetVersion == "" {
+		return p, fmt.Errorf("%w: minVersion, knownBad or targetVersion is required", ErrInvalid)
+	}
+	if p.AutoEnroll && p.TargetVersion == "" {
+		return p, fmt.Errorf("%w: autoEnroll requires targetVersion", ErrInvalid)
+	}
+	return p, nil
+}
+
+// Evaluation — соответствие устройства всем применимым к нему политикам.
+type Evaluation struct {
+	Status   string
+	Reasons  []string
+	Policies []string // применимые политики
+	Target   string   // старшая из целевых версий применимых политик
+	OnTarget bool
+	Enroll   bool // есть применимая политика с autoEnroll
+}
+
+// Evaluate — fw против политик; groups — группы устройства.
+func Evaluate(policies []registry.FirmwarePolicy, groups map[string]bool, fw string) Evaluation {
+	ev := Evaluation{Status: StatusCompliant, Reasons: []string{}, Policies: []string{}}
+	ver, verErr := firmware.ParseVersion(fw)
+	for _, p := range policies {
+		if p.Group != "" && !groups[p.Group] {
+			continue
+		}
+		ev.Policies = append(ev.Policies, p.Name)
+		if p.TargetVersion != "" && (ev.Target == "" || firmware.CompareVersions(p.TargetVersion, ev.Target) > 0) {
+			ev.Target = p.TargetVersion
+		}
+		if verErr != nil {
+			continue
+		}
+		if p.MinVersion != "" && firmware.CompareVersions(ver.String(), p.MinVersion) < 0 {
+			ev.Reasons = append(ev.Reasons, ReasonBelowMin+":"+p.Name)
+		}
+		for _, raw := range p.KnownBad {
+			if c, err := firmware.ParseConstraint(raw); err == nil && c.Match(ver.String()) {
+				ev.Reasons = append(ev.Reasons, ReasonKnownBad+":"+p.Name)
+				break
+			}
+		}
+	}
+	switch {
+	case len(ev.Policies) > 0 && verErr != nil:
+		ev.Status = StatusUnknown
+	case len(ev.Reasons) > 0:
+		ev.Status = StatusNonCompliant
+	}
+	if ev.Target != "" && verErr == nil {
+		ev.OnTarget = firmware.CompareVersions(ver.String(), ev.Target) >= 0
+	}
+	if ev.Status == StatusNonCompliant && ev.Target != "" {
+		for _, p := range policies {
+			if p.AutoEnroll && p.TargetVersion == ev.Target && (p.Group == "" || groups[p.Group]) {
+				ev.Enroll = true
+				break
+			}
+		}
+	}
+	sort.Strings(ev.Reasons)
+	return ev
+}
+
+func getenvInt(k string, def int) int {
+	v := os.Getenv(k)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return def
+	}
+	return n
+}
@@ -0,0 +1,144 @@
+package compliance
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/perm1ss10n/vexora/backend/internal/firmware"
+)
+
+// Summary — счётчики по парку (или по группе).
+type Summary struct {
+	Total        int
+	Compliant    int
+	NonCompliant int
+	Unknown      int
+	OnTarget     int
+}
+
+// VersionCount — строка распределения версий прошивки.
+type VersionCount struct {
+	Version      string // "" — устройство не сообщало fw
+	Devices      int
+	NonCompliant int
+}
+
+// DeviceReport — соответствие одного устройства.
+type DeviceReport struct {
+	DeviceID       string
+	Status         string
+	FW             string
+	Reasons        []string
+	Policies       []string
+	Target         string
+	OnTarget       bool
+	SinceMillis    int64 // когда статус стал текущим (0 — ещё не сохранён)
+	LastSeenMillis int64
+}
+
+type Report struct {
+	GeneratedMillis int64
+	Summary         Summary
+	Versions        []VersionCount
+	Devices         []DeviceReport // по умолчанию только несоответствующие
+}
+
+// Report — отчёт по парку; group — только устройства группы, all — все устройства, а не только нарушители.
+// Статус считается по текущим политикам, "since" берётся из сохранённого соответствия.
+func (s *Service) Report(ctx context.Context, group string, all bool) (*Report, error) {
+	policies, err := s.store.ListFirmwarePolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := s.store.ListDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	membership, err := s.membership(ctx, policies)
+	if err != nil {
+		return nil, err
+	}
+	var inGroup map[string]bool
+	if group != "" {
+		ids, err := s.store.ListGroupDevices(ctx, group)
+		if err != nil {
+			return nil, err
+		}
+		inGroup = make(map[string]bool, len(ids))
+		for _, id := range ids {
+			inGroup[id] = true
+		}
+	}
+	stored, err := s.store.ListFWCompliance(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &Report{GeneratedMillis: time.Now().UnixMilli(), Versions: []VersionCount{}, Devices: []DeviceReport{}}
+	versions := map[string]*VersionCount{}
+	for _, d := range devices {
+		if inGroup != nil && !inGroup[d.DeviceID] {
+			continue
+		}
+		fw := d.FW.String
+		ev := Evaluate(policies, membership[d.DeviceID], fw)
+
+		rep.Summary.Total++
+		switch ev.Status {
+		case StatusCompliant:
+			rep.Summary.Compliant++
+		case StatusNonCompliant:
+			rep.Summary.NonCompliant++
+		default:
+			rep.Summary.Unknown++
+		}
+		if ev.OnTarget {
+			rep.Summary.OnTarget++
+		}
+
+		key := fw
+		if v, err := firmware.ParseVersion(fw); err == nil {
+			key = v.String()
+		}
+		vc := versions[key]
+		if vc == nil {
+			vc = &VersionCount{Version: key}
+			versions[key] = vc
+		}
+		vc.Devices++
+		if ev.Status == StatusNonCompliant {
+			vc.NonCompliant++
+		}
+
+		if !all && ev.Status != StatusNonCompliant {
+			continue
+		}
+		dr := DeviceReport{
+			DeviceID:       d.DeviceID,
+			Status:         ev.Status,
+			FW:             fw,
+			Reasons:        ev.Reasons,
+			Policies:       ev.Policies,
+			Target:         ev.Target,
+			OnTarget:       ev.OnTarget,
+			LastSeenMillis: d.LastSeenMillis,
+		}
+		if rec, ok := stored[d.DeviceID]; ok && rec.Status == ev.Status {
+			dr.SinceMillis = rec.ChangedMillis
+		}
+		rep.Devices = append(rep.Devices, dr)
+	}
+
+	for _, vc := range versions {
+		rep.Versions = append(rep.Versions, *vc)
+	}
+	sort.Slice(rep.Versions, func(i, j int) bool {
+		if rep.Versions[i].Devices != rep.Versions[j].Devices {
+			return rep.Versions[i].Devices > rep.Versions[j].Devices
+		}
+		return firmware.CompareVersions(rep.Versions[i].Version, rep.Versions[j].Version) > 0
+	})
+	sort.Slice(rep.Devices, func(i, j int) bool { return rep.Devices[i].DeviceID < rep.Devices[j].DeviceID })
+	return rep, nil
+}
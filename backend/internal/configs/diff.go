@@ -0,0 +1,72 @@
+package configs
+
+import (
+	"reflect"
+	"sort"
+)
+
+// Операции в диффе конфигураций.
+const (
+	DiffAdded   = "added"
+	DiffRemoved = "removed"
+	DiffChanged = "changed"
+)
+
+// Change — одно отличие между документами; Path — через точку (telemetry.intervalSec).
+type Change struct {
+	Path string `json:"path"`
+	Op   string `json:"op"`
+	From any    `json:"from,omitempty"`
+	To   any    `json:"to,omitempty"`
+}
+
+// Diff — структурное сравнение from → to. Объекты сравниваются по ключам рекурсивно,
+// массивы и скаляры — целиком. Поле version верхнего уровня не учитывается.
+func Diff(from, to map[string]any) []Change {
+	out := []Change{}
+	diffInto(&out, "", from, to)
+	return out
+}
+
+func diffInto(out *[]Change, prefix string, from, to map[string]any) {
+	keys := map[string]bool{}
+	for k := range from {
+		keys[k] = true
+	}
+	for k := range to {
+		keys[k] = true
+	}
+	sorted := make([]string, 0, len(keys))
+	for k := range keys {
+		if prefix == "" && k == "version" {
+			continue
+		}
+		sorted = append(sorted, k)
+	}
+	sort.Strings(sorted)
+
+	for _, k := range sorted {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		fv, inFrom := from[k]
+		tv, inTo := to[k]
+		switch {
+		case !inFrom:
+			*out = append(*out, Change{Path: path, Op: DiffAdded, To: tv})
+		case !inTo:
+			*out = append(*out, Change{Path: path, Op: DiffRemoved, From: fv})
+		default:
+			fm, fok := fv.(map[string]any)
+			tm, tok := tv.(map[string]any)
+			if fok && tok {
+				diffInto(out, path, fm, tm)
+				continue
+			}
+			if !reflect.DeepEqual(fv, tv) {
+				*out = append(*out, Change{Path: path, Op: DiffChanged, From: fv, To: tv})
+			}
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package configs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+)
+
+var ErrVersionNotFound = errors.New("config version not found")
+
+// VersionInfo — выданная версия и её судьба на устройстве.
+type VersionInfo struct {
+	Record  registry.DeviceConfigRecord
+	Outcome *registry.ConfigOutcome // nil — устройство о версии не сообщало
+	Active  bool                    // сейчас active на устройстве
+	Desired bool                    // последняя выданная версия
+}
+
+// Versions — история версий устройства, новые первыми.
+func (s *Service) Versions(ctx context.Context, deviceID string, limit int) ([]VersionInfo, error) {
+	recs, err := s.store.ListDeviceConfigs(ctx, deviceID, limit)
+	if err != nil {
+		return nil, err
+	}
+	outcomes, err := s.store.ListConfigOutcomes(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	st, err := s.store.GetCfgState(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]VersionInfo, 0, len(recs))
+	for i, rec := range recs {
+		out = append(out, versionInfo(rec, i == 0, outcomes, st))
+	}
+	return out, nil
+}
+
+// VersionDetail — одна версия с итогом применения.
+func (s *Service) VersionDetail(ctx context.Context, deviceID string, version int64) (*VersionInfo, error) {
+	rec, err := s.Version(ctx, deviceID, version)
+	if err != nil {
+		return nil, err
+	}
+	maxVersion, err := s.store.MaxConfigVersion(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	outcomes, err := s.store.ListConfigOutcomes(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	st, err := s.store.GetCfgState(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	info := versionInfo(*rec, rec.Version == maxVersion, outcomes, st)
+	return &info, nil
+}
+
+func versionInfo(rec registry.DeviceConfigRecord, desired bool, outcomes map[int64]registry.ConfigOutcome, st *registry.CfgStateRecord) VersionInfo {
+	info := VersionInfo{Record: rec, Desired: desired}
+	if o, ok := outcomes[rec.Version]; ok {
+		info.Outcome = &o
+	}
+	if st != nil && st.ActiveVersion.Valid && st.ActiveVersion.Int64 == rec.Version {
+		info.Active = true
+	}
+	return info
+}
+
+// Version — конкретная версия; ErrVersionNotFound, если её не выдавали.
+func (s *Service) Version(ctx context.Context, deviceID string, version int64) (*registry.DeviceConfigRecord, error) {
+	rec, err := s.store.GetDeviceConfig(ctx, deviceID, version)
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil {
+		return nil, fmt.Errorf("%w: %d", ErrVersionNotFound, version)
+	}
+	return rec, nil
+}
+
+// DiffVersions сравнивает две выданные версии.
+func (s *Service) DiffVersions(ctx context.Context, deviceID string, from, to int64) ([]Change, error) {
+	a, err := s.Version(ctx, deviceID, from)
+	if err != nil {
+		return nil, err
+	}
+	b, err := s.Version(ctx, deviceID, to)
+	if err != nil {
+		return nil, err
+	}
+	return Diff(a.Doc, b.Doc), nil
+}
+
+// Rollback переиздаёт содержимое версии to как новую, большую версию (устройство требует version > active)
+// и публикует её. Как и в Put, ошибка публикации не отменяет выпуск версии.
+func (s *Service) Rollback(ctx context.Context, deviceID string, to int64, actor string) (*registry.DeviceConfigRecord, error) {
+	old, err := s.Version(ctx, deviceID, to)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkLock(ctx, deviceID); err != nil {
+		return nil, err
+	}
+
+	rec, err := s.mintFrom(ctx, deviceID, old.Doc, actor, sql.NullInt64{Int64: to, Valid: true})
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[CFG] rollback deviceId=%s to=%d cfgVersion=%d by=%s", deviceID, to, rec.Version, actor)
+	return rec, s.Publish(ctx, rec)
+}
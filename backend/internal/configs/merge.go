@@ -0,0 +1,51 @@
+package configs
+
+// Merge накладывает patch на base по правилам JSON Merge Patch (RFC 7386):
+// объекты сливаются рекурсивно, null удаляет ключ, массивы и скаляры заменяются целиком.
+// Исходные документы не изменяются.
+func Merge(base, patch map[string]any) map[string]any {
+	out := deepCopy(base)
+	if out == nil {
+		out = map[string]any{}
+	}
+	for k, pv := range patch {
+		if pv == nil {
+			delete(out, k)
+			continue
+		}
+		pm, ok := pv.(map[string]any)
+		if !ok {
+			out[k] = deepCopyValue(pv)
+			continue
+		}
+		bm, _ := out[k].(map[string]any)
+		out[k] = Merge(bm, pm)
+	}
+	return out
+}
+
+func deepCopy(m map[string]any) map[string]any {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = deepCopyValue(v)
+	}
+	return out
+}
+
+func deepCopyValue(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		return deepCopy(t)
+	case []any:
+		out := make([]any, len(t))
+		for i, e := range t {
+			out[i] = deepCopyValue(e)
+		}
+		return out
+	default:
+		return v
+	}
+}
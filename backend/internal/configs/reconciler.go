@@ -0,0 +1,330 @@
+package configs
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/perm1ss10n/vexora/backend/internal/model"
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+)
+
+// Состояния устройства в отчёте о дрейфе.
+const (
+	DriftInSync   = "in_sync"
+	DriftPending  = "pending"  // устройство применяет desired-версию
+	DriftDrifting = "drifting" // active != desired, ждём повторной отправки
+	DriftOffline  = "offline"  // расходится, но устройство не на связи
+	DriftStuck    = "stuck"    // превышен лимит откатов, reconciler сдался
+)
+
+// EventCfgStuck — событие backend'а, когда reconciler перестаёт пересылать конфиг.
+const EventCfgStuck = "CFG_STUCK"
+
+// EventSink — куда писать события, сгенерированные backend (реализует influx.Client).
+type EventSink interface {
+	WriteEvent(e model.EventPayload)
+}
+
+type ReconcilerConfig struct {
+	Tick         time.Duration
+	Backoff      time.Duration // пауза перед первой повторной отправкой; дальше x2
+	MaxBackoff   time.Duration
+	MaxRollbacks int // после стольких неудачных применений desired-версии — cfg_stuck
+}
+
+func LoadReconcilerConfigFromEnv() ReconcilerConfig {
+	return ReconcilerConfig{
+		Tick:         time.Duration(getenvInt("CFG_RECONCILE_TICK_MS", 30000)) * time.Millisecond,
+		Backoff:      time.Duration(getenvInt("CFG_RESEND_BACKOFF_MS", 60000)) * time.Millisecond,
+		MaxBackoff:   time.Duration(getenvInt("CFG_RESEND_MAX_BACKOFF_MS", 1800000)) * time.Millisecond,
+		MaxRollbacks: getenvInt("CFG_MAX_ROLLBACKS", 3),
+	}
+}
+
+// Reconciler периодически сравнивает reported active с desired и пересылает конфиг.
+type Reconciler struct {
+	svc    *Service
+	events EventSink
+	cfg    ReconcilerConfig
+}
+
+func NewReconciler(svc *Service, events EventSink, cfg ReconcilerConfig) *Reconciler {
+	if cfg.Tick <= 0 {
+		cfg.Tick = 30 * time.Second
+	}
+	if cfg.Backoff <= 0 {
+		cfg.Backoff = time.Minute
+	}
+	if cfg.MaxBackoff < cfg.Backoff {
+		cfg.MaxBackoff = cfg.Backoff
+	}
+	if cfg.MaxRollbacks <= 0 {
+		cfg.MaxRollbacks = 3
+	}
+	return &Reconciler{svc: svc, events: events, cfg: cfg}
+}
+
+func (r *Reconciler) Start(ctx context.Context) {
+	go func() {
+		t := time.NewTicker(r.cfg.Tick)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				r.tick(ctx)
+			}
+		}
+	}()
+}
+
+func (r *Reconciler) tick(ctx context.Context) {
+	rows, err := r.svc.store.ListConfigDrift(ctx)
+	if err != nil {
+		log.Printf("[CFG_RECONCILE] list_failed err=%v", err)
+		return
+	}
+	now := time.Now()
+	for _, row := range rows {
+		r.reconcile(ctx, row, now)
+	}
+}
+
+func (r *Reconciler) reconcile(ctx context.Context, row registry.DriftRow, now time.Time) {
+	nowMs := now.UnixMilli()
+
+	if row.ActiveVersion.Valid && row.ActiveVersion.Int64 == row.DesiredVersion {
+		if row.Drift != nil {
+			if err := r.svc.store.DeleteConfigDrift(ctx, row.DeviceID); err != nil {
+				log.Printf("[CFG_RECONCILE] clear_failed deviceId=%s err=%v", row.DeviceID, err)
+			}
+		}
+		return
+	}
+
+	dr := row.Drift
+	changed := false
+	if dr == nil || dr.DesiredVersion != row.DesiredVersion {
+		// новая desired-версия: счётчики с нуля, первая повторная отправка — через Backoff после публикации
+		next := nowMs
+		if row.PublishedMillis.Valid {
+			next = row.PublishedMillis.Int64 + r.cfg.Backoff.Milliseconds()
+		}
+		dr = &registry.ConfigDriftRecord{
+			DeviceID:          row.DeviceID,
+			DesiredVersion:    row.DesiredVersion,
+			NextAttemptMillis: sql.NullInt64{Int64: next, Valid: true},
+		}
+		changed = true
+	}
+	if dr.Stuck {
+		return
+	}
+
+	// неудачное применение именно desired-версии считаем один раз на отчёт
+	if row.LastApplyVersion.Valid && row.LastApplyVersion.Int64 == row.DesiredVersion &&
+		row.LastApplyOk.Valid && !row.LastApplyOk.Bool &&
+		row.LastApplyMillis.Valid && (!dr.CountedApplyMillis.Valid || row.LastApplyMillis.Int64 > dr.CountedApplyMillis.Int64) {
+		dr.Rollbacks++
+		dr.CountedApplyMillis = row.LastApplyMillis
+		changed = true
+
+		if dr.Rollbacks >= r.cfg.MaxRollbacks {
+			dr.Stuck = true
+			dr.StuckMillis = sql.NullInt64{Int64: nowMs, Valid: true}
+			dr.NextAttemptMillis = sql.NullInt64{}
+			r.save(ctx, dr, nowMs)
+			r.flagStuck(row, dr, nowMs)
+			return
+		}
+	}
+
+	due := !dr.NextAttemptMillis.Valid || nowMs >= dr.NextAttemptMillis.Int64
+	applying := row.PendingVersion.Valid && row.PendingVersion.Int64 == row.DesiredVersion
+	if !due || applying || row.DeviceStatus != "online" {
+		if changed {
+			r.save(ctx, dr, nowMs)
+		}
+		return
+	}
+
+	rec, err := r.svc.store.GetDesiredConfig(ctx, row.DeviceID)
+	if err != nil || rec == nil || rec.Version != row.DesiredVersion {
+		// desired поменялся между запросами — разберёмся на следующем тике
+		if changed {
+			r.save(ctx, dr, nowMs)
+		}
+		return
+	}
+
+	if err := r.svc.Publish(ctx, rec); err == nil {
+		dr.Attempts++
+		dr.LastSentMillis = sql.NullInt64{Int64: nowMs, Valid: true}
+	}
+	dr.NextAttemptMillis = sql.NullInt64{Int64: nowMs + r.backoff(dr.Attempts).Milliseconds(), Valid: true}
+	r.save(ctx, dr, nowMs)
+
+	log.Printf("[CFG_RECONCILE] resend deviceId=%s cfgVersion=%d active=%s attempt=%d rollbacks=%d",
+		row.DeviceID, row.DesiredVersion, nullVersion(row.ActiveVersion), dr.Attempts, dr.Rollbacks,
+	)
+}
+
+// backoff — Backoff * 2^attempts, не больше MaxBackoff.
+func (r *Reconciler) backoff(attempts int) time.Duration {
+	d := r.cfg.Backoff
+	for i := 0; i < attempts && d < r.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > r.cfg.MaxBackoff {
+		d = r.cfg.MaxBackoff
+	}
+	return d
+}
+
+func (r *Reconciler) save(ctx context.Context, dr *registry.ConfigDriftRecord, nowMs int64) {
+	dr.UpdatedMillis = nowMs
+	if err := r.svc.store.UpsertConfigDrift(ctx, *dr); err != nil {
+		log.Printf("[CFG_RECONCILE] save_failed deviceId=%s err=%v", dr.DeviceID, err)
+	}
+}
+
+func (r *Reconciler) flagStuck(row registry.DriftRow, dr *registry.ConfigDriftRecord, nowMs int64) {
+	log.Printf("[CFG_RECONCILE] cfg_stuck deviceId=%s cfgVersion=%d active=%s rollbacks=%d attempts=%d",
+		row.DeviceID, row.DesiredVersion, nullVersion(row.ActiveVersion), dr.Rollbacks, dr.Attempts,
+	)
+	if r.events == nil {
+		return
+	}
+	data := map[string]any{
+		"desiredVersion": row.DesiredVersion,
+		"rollbacks":      dr.Rollbacks,
+		"attempts":       dr.Attempts,
+	}
+	if row.ActiveVersion.Valid {
+		data["activeVersion"] = row.ActiveVersion.Int64
+	}
+	r.events.WriteEvent(model.EventPayload{
+		V:        1,
+		DeviceID: row.DeviceID,
+		Ts:       nowMs,
+		Code:     EventCfgStuck,
+		Severity: "error",
+		Msg:      "config not applied after max rollbacks",
+		Data:     data,
+	})
+}
+
+// DriftItem — строка отчёта о дрейфе.
+type DriftItem struct {
+	DeviceID       string `json:"deviceId"`
+	State          string `json:"state"`
+	DesiredVersion int64  `json:"desiredVersion"`
+	ActiveVersion  *int64 `json:"activeVersion"`
+	PendingVersion *int64 `json:"pendingVersion"`
+	CfgStatus      string `json:"cfgStatus,omitempty"`
+	DeviceStatus   string `json:"deviceStatus,omitempty"`
+	Attempts       int    `json:"attempts"`
+	Rollbacks      int    `json:"rollbacks"`
+	LastSentAt     *int64 `json:"lastSentAt,omitempty"`
+	NextAttemptAt  *int64 `json:"nextAttemptAt,omitempty"`
+	StuckAt        *int64 `json:"stuckAt,omitempty"`
+}
+
+type DriftReport struct {
+	GeneratedAt int64          `json:"generatedAt"`
+	Total       int            `json:"total"`
+	Counts      map[string]int `json:"counts"`
+	Items       []DriftItem    `json:"items"`
+}
+
+// DriftReport — сводка по парку: у кого reported active расходится с desired.
+// state (если не пусто) оставляет в items только устройства в этом состоянии; counts — всегда по всем.
+func (s *Service) DriftReport(ctx context.Context, state string) (*DriftReport, error) {
+	rows, err := s.store.ListConfigDrift(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &DriftReport{
+		GeneratedAt: time.Now().UnixMilli(),
+		Total:       len(rows),
+		Counts:      map[string]int{DriftInSync: 0, DriftPending: 0, DriftDrifting: 0, DriftOffline: 0, DriftStuck: 0},
+		Items:       []DriftItem{},
+	}
+	for _, row := range rows {
+		item := driftItem(row)
+		report.Counts[item.State]++
+		if state == "" || state == item.State {
+			report.Items = append(report.Items, item)
+		}
+	}
+	return report, nil
+}
+
+func driftItem(row registry.DriftRow) DriftItem {
+	item := DriftItem{
+		DeviceID:       row.DeviceID,
+		DesiredVersion: row.DesiredVersion,
+		ActiveVersion:  nullInt(row.ActiveVersion),
+		PendingVersion: nullInt(row.PendingVersion),
+		CfgStatus:      row.CfgStatus.String,
+		DeviceStatus:   row.DeviceStatus,
+	}
+	dr := row.Drift
+	if dr != nil && dr.DesiredVersion == row.DesiredVersion {
+		item.Attempts = dr.Attempts
+		item.Rollbacks = dr.Rollbacks
+		item.LastSentAt = nullInt(dr.LastSentMillis)
+		item.NextAttemptAt = nullInt(dr.NextAttemptMillis)
+		item.StuckAt = nullInt(dr.StuckMillis)
+	} else {
+		dr = nil
+	}
+
+	switch {
+	case row.ActiveVersion.Valid && row.ActiveVersion.Int64 == row.DesiredVersion:
+		item.State = DriftInSync
+	case dr != nil && dr.Stuck:
+		item.State = DriftStuck
+	case row.PendingVersion.Valid && row.PendingVersion.Int64 == row.DesiredVersion:
+		item.State = DriftPending
+	case row.DeviceStatus != "online":
+		item.State = DriftOffline
+	default:
+		item.State = DriftDrifting
+	}
+	return item
+}
+
+func nullInt(v sql.NullInt64) *int64 {
+	if !v.Valid {
+		return nil
+	}
+	n := v.Int64
+	return &n
+}
+
+func nullVersion(v sql.NullInt64) string {
+	if !v.Valid {
+		return "null"
+	}
+	return strconv.FormatInt(v.Int64, 10)
+}
+
+func getenvInt(k string, def int) int {
+	v := os.Getenv(k)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return def
+	}
+	return n
+}
@@ -0,0 +1,131 @@
+package configs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+	"github.com/perm1ss10n/vexora/backend/internal/secrets"
+)
+
+var ErrSecretsDisabled = errors.New("config secrets key is not configured")
+
+// SetSecrets подключает шифрование секретных полей: список путей и keyring для reveal/ротации.
+func (s *Service) SetSecrets(c *secrets.Cipher) {
+	s.secrets = c
+}
+
+// SecretPaths — пути секретных полей, которые скрываются в ответах API.
+func (s *Service) SecretPaths() []string {
+	if s.secrets == nil {
+		return secrets.DefaultPaths
+	}
+	return s.secrets.Paths()
+}
+
+// Redact — документ для ответа API: секреты заменены на secrets.Mask, плюс индикаторы set/unset.
+func (s *Service) Redact(doc map[string]any) (map[string]any, []secrets.Field) {
+	return secrets.Redact(doc, s.SecretPaths())
+}
+
+// RedactChanges скрывает секретные значения в diff (сам факт изменения поля остаётся виден).
+func (s *Service) RedactChanges(changes []Change) []Change {
+	paths := s.SecretPaths()
+	out := make([]Change, len(changes))
+	for i, c := range changes {
+		c.From = secrets.RedactValue(c.Path, c.From, paths)
+		c.To = secrets.RedactValue(c.Path, c.To, paths)
+		out[i] = c
+	}
+	return out
+}
+
+// RevealSecrets — открытые значения секретных полей версии (0 — desired).
+// Каждый reveal пишется в журнал; если запись в журнал не удалась, значения не отдаются.
+func (s *Service) RevealSecrets(ctx context.Context, deviceID string, version int64, actor, reason string) (*registry.DeviceConfigRecord, map[string]string, error) {
+	var rec *registry.DeviceConfigRecord
+	var err error
+	if version > 0 {
+		rec, err = s.Version(ctx, deviceID, version)
+	} else {
+		rec, err = s.store.GetDesiredConfig(ctx, deviceID)
+		if err == nil && rec == nil {
+			err = fmt.Errorf("%w: no desired config", ErrVersionNotFound)
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	values := secrets.Extract(rec.Doc, s.SecretPaths())
+	paths := make([]string, 0, len(values))
+	for _, p := range s.SecretPaths() {
+		if _, ok := values[p]; ok {
+			paths = append(paths, p)
+		}
+	}
+	v := rec.Version
+	if err := s.store.InsertSecretAudit(ctx, registry.SecretAuditRecord{
+		Actor:    actor,
+		Action:   registry.SecretAuditReveal,
+		DeviceID: deviceID,
+		Version:  &v,
+		Paths:    paths,
+		Reason:   reason,
+	}); err != nil {
+		return nil, nil, err
+	}
+
+	log.Printf("[CFG_SECRETS] reveal deviceId=%s cfgVersion=%d paths=%d by=%s", deviceID, rec.Version, len(paths), actor)
+	return rec, values, nil
+}
+
+// AuditDenied фиксирует отказ в доступе к секретам (пользователь не в списке администраторов).
+func (s *Service) AuditDenied(ctx context.Context, deviceID, actor, reason string) {
+	log.Printf("[CFG_SECRETS] denied deviceId=%s by=%s", deviceID, actor)
+	if err := s.store.InsertSecretAudit(ctx, registry.SecretAuditRecord{
+		Actor:    actor,
+		Action:   registry.SecretAuditDenied,
+		DeviceID: deviceID,
+		Reason:   reason,
+	}); err != nil {
+		log.Printf("[CFG_SECRETS] audit_failed err=%v", err)
+	}
+}
+
+// RotateSecretKey выпускает новый ключ в файле ключей и перешифровывает им все сохранённые секреты.
+func (s *Service) RotateSecretKey(ctx context.Context, actor string) (string, int, error) {
+	if s.secrets == nil {
+		return "", 0, ErrSecretsDisabled
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kid, err := s.secrets.Keyring().Rotate()
+	if err != nil {
+		return "", 0, err
+	}
+	n, err := s.store.ResealConfigDocs(ctx)
+	if err != nil {
+		// новый ключ уже active; конверты под старым ключом читаются и перешифруются при следующем старте
+		return kid, 0, err
+	}
+	if err := s.store.InsertSecretAudit(ctx, registry.SecretAuditRecord{
+		Actor:  actor,
+		Action: registry.SecretAuditRotate,
+		Reason: "kid=" + kid,
+	}); err != nil {
+		log.Printf("[CFG_SECRETS] audit_failed err=%v", err)
+	}
+
+	log.Printf("[CFG_SECRETS] rotated kid=%s resealed=%d by=%s", kid, n, actor)
+	return kid, n, nil
+}
+
+// SecretAudit — журнал доступа к секретам; deviceID пустой — по всем устройствам.
+func (s *Service) SecretAudit(ctx context.Context, deviceID string, limit int) ([]registry.SecretAuditRecord, error) {
+	return s.store.ListSecretAudit(ctx, deviceID, limit)
+}
@@ -0,0 +1,262 @@
+package configs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/perm1ss10n/vexora/backend/internal/commands"
+	"github.com/perm1ss10n/vexora/backend/internal/model"
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+	"github.com/perm1ss10n/vexora/backend/internal/secrets"
+	"github.com/perm1ss10n/vexora/backend/internal/validate"
+)
+
+var ErrInvalidConfig = errors.New("invalid config")
+
+// Store — хранение desired/reported конфигураций (реализует registry.SQLiteStore).
+type Store interface {
+	MaxConfigVersion(ctx context.Context, deviceID string) (int64, error)
+	InsertDeviceConfig(ctx context.Context, rec registry.DeviceConfigRecord) error
+	MarkConfigPublished(ctx context.Context, deviceID string, version int64, tsMillis int64) error
+	GetDesiredConfig(ctx context.Context, deviceID string) (*registry.DeviceConfigRecord, error)
+	GetCfgState(ctx context.Context, deviceID string) (*registry.CfgStateRecord, error)
+	ListCfgStatusHistory(ctx context.Context, deviceID string, limit int) ([]registry.CfgStatusRecord, error)
+	GetDeviceConfig(ctx context.Context, deviceID string, version int64) (*registry.DeviceConfigRecord, error)
+	ListDeviceConfigs(ctx context.Context, deviceID string, limit int) ([]registry.DeviceConfigRecord, error)
+	ListConfigOutcomes(ctx context.Context, deviceID string) (map[int64]registry.ConfigOutcome, error)
+
+	// шаблоны и override
+	ListConfigTemplates(ctx context.Context) ([]registry.ConfigTemplateRecord, error)
+	GetConfigTemplate(ctx context.Context, name string) (*registry.ConfigTemplateRecord, error)
+	UpsertConfigTemplate(ctx context.Context, name string, doc map[string]any, actor string) error
+	DeleteConfigTemplate(ctx context.Context, name string) error
+	SetTemplateBindings(ctx context.Context, name string, bindings []registry.TemplateBinding) error
+	ListBindingDevices(ctx context.Context, bindings []registry.TemplateBinding) ([]string, error)
+	ListDeviceTemplates(ctx context.Context, deviceID string) ([]registry.DeviceTemplate, error)
+	GetConfigOverride(ctx context.Context, deviceID string) (*registry.ConfigOverrideRecord, error)
+	SetConfigOverride(ctx context.Context, deviceID string, doc map[string]any, actor string) error
+	DeleteConfigOverride(ctx context.Context, deviceID string) error
+
+	// reconciler
+	ListConfigDrift(ctx context.Context) ([]registry.DriftRow, error)
+	UpsertConfigDrift(ctx context.Context, rec registry.ConfigDriftRecord) error
+	DeleteConfigDrift(ctx context.Context, deviceID string) error
+
+	// секретные поля
+	ResealConfigDocs(ctx context.Context) (int, error)
+	InsertSecretAudit(ctx context.Context, rec registry.SecretAuditRecord) error
+	ListSecretAudit(ctx context.Context, deviceID string, limit int) ([]registry.SecretAuditRecord, error)
+}
+
+// Locker — блокировка устройства на время применения конфигурации (реализует oplock.Manager).
+type Locker interface {
+	Check(ctx context.Context, deviceID, kind string) error
+	Acquire(ctx context.Context, deviceID, kind, ref, holder string, lease time.Duration) error
+	Release(ctx context.Context, deviceID, kind, ref string)
+}
+
+// lockKind — вид блокировки конфигурации (oplock.KindCfg).
+const lockKind = "cfg"
+
+// Service — desired-конфигурации устройств: версионирование, хранение и доставка по v1/dev/{id}/cfg.
+type Service struct {
+	store Store
+	pub   commands.Publisher
+
+	mu sync.Mutex // выдача версий: один backend-процесс пишет конфиги последовательно
+
+	rolloutInterval time.Duration
+	locks           Locker
+	secrets         *secrets.Cipher // nil — ключей нет: redaction по secrets.DefaultPaths, reveal/ротация недоступны
+}
+
+func New(store Store, pub commands.Publisher) *Service {
+	return &Service{store: store, pub: pub, rolloutInterval: DefaultRolloutInterval}
+}
+
+// SetLocks включает блокировку устройства: пока идёт OTA (или другая операция), конфиг не доставляется.
+func (s *Service) SetLocks(l Locker) {
+	s.locks = l
+}
+
+// checkLock — 409 до выпуска версии, если устройство занято (в том числе доставкой прежней версии).
+func (s *Service) checkLock(ctx context.Context, deviceID string) error {
+	if s.locks == nil {
+		return nil
+	}
+	return s.locks.Check(ctx, deviceID, lockKind)
+}
+
+// Put выдаёт документу следующую cfgVersion, валидирует, сохраняет и публикует.
+// Версия всегда больше и ранее выданных, и активной версии, о которой сообщило устройство.
+// Ошибка публикации не откатывает сохранение: конфиг остаётся desired, доставку можно повторить.
+// Секретные поля со значением secrets.Mask сохраняют значение из текущей desired-версии.
+func (s *Service) Put(ctx context.Context, deviceID string, doc map[string]any, actor string) (*registry.DeviceConfigRecord, error) {
+	prev, err := s.store.GetDesiredConfig(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	var prevDoc map[string]any
+	if prev != nil {
+		prevDoc = prev.Doc
+	}
+	doc = secrets.Restore(doc, prevDoc, s.SecretPaths())
+	if err := s.checkLock(ctx, deviceID); err != nil {
+		return nil, err
+	}
+
+	rec, err := s.mint(ctx, deviceID, doc, actor)
+	if err != nil {
+		return nil, err
+	}
+	return rec, s.Publish(ctx, rec)
+}
+
+// mint выдаёт документу следующую версию, валидирует и сохраняет его как desired (без публикации).
+// Любая запись конфигурации проходит через mint, поэтому невалидный документ не попадёт к устройству.
+func (s *Service) mint(ctx context.Context, deviceID string, doc map[string]any, actor string) (*registry.DeviceConfigRecord, error) {
+	return s.mintFrom(ctx, deviceID, doc, actor, sql.NullInt64{})
+}
+
+func (s *Service) mintFrom(ctx context.Context, deviceID string, doc map[string]any, actor string, rollbackOf sql.NullInt64) (*registry.DeviceConfigRecord, error) {
+	s.mu.Lock()
+	version, active, err := s.nextVersion(ctx, deviceID)
+	if err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+
+	rec := registry.DeviceConfigRecord{
+		DeviceID:      deviceID,
+		Version:       version,
+		Doc:           withVersion(doc, version),
+		CreatedBy:     actor,
+		CreatedMillis: time.Now().UnixMilli(),
+		RollbackOf:    rollbackOf,
+	}
+	if err := validate.Config(rec.Doc, validate.ConfigOptions{DeviceID: deviceID, ActiveVersion: active}); err != nil {
+		s.mu.Unlock()
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+	err = s.store.InsertDeviceConfig(ctx, rec)
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("[CFG] stored deviceId=%s cfgVersion=%d by=%s", deviceID, version, actor)
+	return &rec, nil
+}
+
+// Publish отправляет конфигурацию устройству (QoS1) и отмечает время публикации.
+// На время применения берёт cfg-блокировку устройства (ref = cfgVersion); её снимает отчёт cfg/status.
+func (s *Service) Publish(ctx context.Context, rec *registry.DeviceConfigRecord) error {
+	if s.pub == nil {
+		return fmt.Errorf("%w: no publisher", commands.ErrPublish)
+	}
+
+	now := time.Now().UnixMilli()
+	b, err := json.Marshal(model.CfgPayload{
+		V:          1,
+		DeviceID:   rec.DeviceID,
+		Ts:         now,
+		CfgVersion: rec.Version,
+		Cfg:        rec.Doc,
+	})
+	if err != nil {
+		return fmt.Errorf("marshal cfg: %w", err)
+	}
+
+	ref := strconv.FormatInt(rec.Version, 10)
+	if s.locks != nil {
+		holder := "cfg"
+		if rec.CreatedBy != "" {
+			holder += ":" + rec.CreatedBy
+		}
+		if err := s.locks.Acquire(ctx, rec.DeviceID, lockKind, ref, holder, 0); err != nil {
+			return err
+		}
+	}
+
+	topic := fmt.Sprintf("v1/dev/%s/cfg", rec.DeviceID)
+	if err := s.pub.Publish(topic, 1, false, b); err != nil {
+		if s.locks != nil {
+			s.locks.Release(ctx, rec.DeviceID, lockKind, ref)
+		}
+		log.Printf("[CFG] publish_failed topic=%s cfgVersion=%d err=%v", topic, rec.Version, err)
+		return fmt.Errorf("%w: %v", commands.ErrPublish, err)
+	}
+	if err := s.store.MarkConfigPublished(ctx, rec.DeviceID, rec.Version, now); err != nil {
+		log.Printf("[CFG] mark_published_failed deviceId=%s cfgVersion=%d err=%v", rec.DeviceID, rec.Version, err)
+	}
+	rec.PublishedMillis.Int64, rec.PublishedMillis.Valid = now, true
+
+	log.Printf("[CFG] published topic=%s cfgVersion=%d size=%d", topic, rec.Version, len(b))
+	return nil
+}
+
+// Desired — текущая desired-конфигурация (nil, если не задавалась).
+func (s *Service) Desired(ctx context.Context, deviceID string) (*registry.DeviceConfigRecord, error) {
+	return s.store.GetDesiredConfig(ctx, deviceID)
+}
+
+// Reported — что устройство сообщило о своей конфигурации (nil, если ещё ничего).
+func (s *Service) Reported(ctx context.Context, deviceID string) (*registry.CfgStateRecord, error) {
+	return s.store.GetCfgState(ctx, deviceID)
+}
+
+// StatusHistory — отчёты cfg/status устройства, новые первыми.
+func (s *Service) StatusHistory(ctx context.Context, deviceID string, limit int) ([]registry.CfgStatusRecord, error) {
+	return s.store.ListCfgStatusHistory(ctx, deviceID, limit)
+}
+
+// DesiredConfig реализует mqtt.ConfigSource (запрос get_cfg от устройства).
+func (s *Service) DesiredConfig(ctx context.Context, deviceID string) (int64, map[string]any, error) {
+	rec, err := s.store.GetDesiredConfig(ctx, deviceID)
+	if err != nil || rec == nil {
+		return 0, nil, err
+	}
+	return rec.Version, rec.Doc, nil
+}
+
+// Validate проверяет документ для устройства (без выдачи версии и сохранения).
+func (s *Service) Validate(deviceID string, doc map[string]any) error {
+	return validate.Config(doc, validate.ConfigOptions{DeviceID: deviceID})
+}
+
+// nextVersion — следующая cfgVersion и reported active (nil, если устройство не сообщало).
+func (s *Service) nextVersion(ctx context.Context, deviceID string) (int64, *int64, error) {
+	maxVersion, err := s.store.MaxConfigVersion(ctx, deviceID)
+	if err != nil {
+		return 0, nil, err
+	}
+	st, err := s.store.GetCfgState(ctx, deviceID)
+	if err != nil {
+		return 0, nil, err
+	}
+	var active *int64
+	if st != nil && st.ActiveVersion.Valid {
+		active = &st.ActiveVersion.Int64
+		if *active > maxVersion {
+			maxVersion = *active
+		}
+	}
+	return maxVersion + 1, active, nil
+}
+
+// withVersion — поверхностная копия документа с проставленным version.
+func withVersion(doc map[string]any, version int64) map[string]any {
+	out := make(map[string]any, len(doc)+1)
+	for k, v := range doc {
+		out[k] = v
+	}
+	out["version"] = version
+	return out
+}
@@ -0,0 +1,340 @@
+package configs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"time"
+
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+	"github.com/perm1ss10n/vexora/backend/internal/secrets"
+	"github.com/perm1ss10n/vexora/backend/internal/validate"
+)
+
+var ErrTemplateNotFound = errors.New("template not found")
+
+// DefaultRolloutInterval — пауза между публикациями при массовой раздаче конфигов.
+const DefaultRolloutInterval = 200 * time.Millisecond
+
+// Итог пересборки конфига одного устройства.
+const (
+	RolloutMinted    = "minted"     // выпущена новая версия, доставка запланирована
+	RolloutUnchanged = "unchanged"  // effective совпадает с desired
+	RolloutNoSources = "no_sources" // нет ни шаблонов, ни override — desired не трогаем
+	RolloutInvalid   = "invalid"    // effective не проходит валидацию
+	RolloutError     = "error"
+)
+
+// Source — слой, из которого собран effective-конфиг (в порядке наложения).
+type Source struct {
+	Kind     string `json:"kind"` // template/override
+	Name     string `json:"name,omitempty"`
+	Revision int64  `json:"revision,omitempty"`
+	Priority int    `json:"priority,omitempty"`
+}
+
+// Effective — шаблоны устройства + override, слитые по Merge.
+type Effective struct {
+	DeviceID string
+	Doc      map[string]any // nil, если слоёв нет
+	Sources  []Source
+}
+
+type RolloutItem struct {
+	DeviceID string `json:"deviceId"`
+	Status   string `json:"status"`
+	Version  int64  `json:"cfgVersion,omitempty"`
+	Error    string `json:"error,omitempty"`
+
+	Fields validate.ConfigErrors `json:"fields,omitempty"`
+}
+
+func LoadRolloutIntervalFromEnv() time.Duration {
+	if n := getenvInt("CFG_ROLLOUT_INTERVAL_MS", -1); n >= 0 {
+		return time.Duration(n) * time.Millisecond
+	}
+	return DefaultRolloutInterval
+}
+
+func (s *Service) SetRolloutInterval(d time.Duration) {
+	if d < 0 {
+		d = 0
+	}
+	s.rolloutInterval = d
+}
+
+// Effective собирает конфиг устройства из шаблонов и сохранённого override.
+func (s *Service) Effective(ctx context.Context, deviceID string) (*Effective, error) {
+	ov, err := s.store.GetConfigOverride(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	var override map[string]any
+	if ov != nil {
+		override = ov.Doc
+	}
+	return s.effectiveWith(ctx, deviceID, override, ov != nil)
+}
+
+// PreviewEffective — то же, но с переданным (ещё не сохранённым) override.
+func (s *Service) PreviewEffective(ctx context.Context, deviceID string, override map[string]any) (*Effective, error) {
+	if override != nil {
+		var err error
+		if override, err = s.restoreOverride(ctx, deviceID, override); err != nil {
+			return nil, err
+		}
+	}
+	return s.effectiveWith(ctx, deviceID, override, override != nil)
+}
+
+func (s *Service) effectiveWith(ctx context.Context, deviceID string, override map[string]any, hasOverride bool) (*Effective, error) {
+	templates, err := s.store.ListDeviceTemplates(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	eff := &Effective{DeviceID: deviceID, Sources: []Source{}}
+	if len(templates) == 0 && !hasOverride {
+		return eff, nil
+	}
+
+	doc := map[string]any{}
+	for _, t := range templates {
+		doc = Merge(doc, t.Doc)
+		eff.Sources = append(eff.Sources, Source{Kind: "template", Name: t.Name, Revision: t.Revision, Priority: t.Priority})
+	}
+	if hasOverride {
+		doc = Merge(doc, override)
+		eff.Sources = append(eff.Sources, Source{Kind: "override"})
+	}
+	delete(doc, "version") // версию выдаёт backend
+	eff.Doc = doc
+	return eff, nil
+}
+
+// Override — сохранённый per-device override (nil, если нет).
+func (s *Service) Override(ctx context.Context, deviceID string) (*registry.ConfigOverrideRecord, error) {
+	return s.store.GetConfigOverride(ctx, deviceID)
+}
+
+// SetOverride сохраняет override и пересобирает конфиг устройства.
+func (s *Service) SetOverride(ctx context.Context, deviceID string, doc map[string]any, actor string) (RolloutItem, error) {
+	doc, err := s.restoreOverride(ctx, deviceID, doc)
+	if err != nil {
+		return RolloutItem{}, err
+	}
+	if err := s.store.SetConfigOverride(ctx, deviceID, doc, actor); err != nil {
+		return RolloutItem{}, err
+	}
+	return s.rollout(ctx, []string{deviceID}, actor)[0], nil
+}
+
+// restoreOverride подставляет вместо secrets.Mask значения из сохранённого override.
+func (s *Service) restoreOverride(ctx context.Context, deviceID string, doc map[string]any) (map[string]any, error) {
+	ov, err := s.store.GetConfigOverride(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	var prev map[string]any
+	if ov != nil {
+		prev = ov.Doc
+	}
+	return secrets.Restore(doc, prev, s.SecretPaths()), nil
+}
+
+func (s *Service) DeleteOverride(ctx context.Context, deviceID string, actor string) (RolloutItem, error) {
+	if err := s.store.DeleteConfigOverride(ctx, deviceID); err != nil {
+		return RolloutItem{}, err
+	}
+	return s.rollout(ctx, []string{deviceID}, actor)[0], nil
+}
+
+func (s *Service) Templates(ctx context.Context) ([]registry.ConfigTemplateRecord, error) {
+	return s.store.ListConfigTemplates(ctx)
+}
+
+func (s *Service) Template(ctx context.Context, name string) (*registry.ConfigTemplateRecord, error) {
+	return s.store.GetConfigTemplate(ctx, name)
+}
+
+// SaveTemplate создаёт/обновляет шаблон и выпускает новые версии для всех затронутых устройств.
+// Секретные поля со значением secrets.Mask сохраняют прежнее значение шаблона.
+func (s *Service) SaveTemplate(ctx context.Context, name string, doc map[string]any, actor string) ([]RolloutItem, error) {
+	tpl, err := s.store.GetConfigTemplate(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	var prev map[string]any
+	if tpl != nil {
+		prev = tpl.Doc
+	}
+	doc = secrets.Restore(doc, prev, s.SecretPaths())
+
+	if err := s.store.UpsertConfigTemplate(ctx, name, doc, actor); err != nil {
+		return nil, err
+	}
+	tpl, err = s.store.GetConfigTemplate(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if tpl == nil {
+		return nil, ErrTemplateNotFound
+	}
+	affected, err := s.store.ListBindingDevices(ctx, tpl.Bindings)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("[CFG] template_saved name=%s revision=%d devices=%d by=%s", name, tpl.Revision, len(affected), actor)
+	return s.rollout(ctx, affected, actor), nil
+}
+
+// SetTemplateBindings заменяет привязки; пересобираются устройства и старых, и новых привязок.
+func (s *Service) SetTemplateBindings(ctx context.Context, name string, bindings []registry.TemplateBinding, actor string) ([]RolloutItem, error) {
+	tpl, err := s.store.GetConfigTemplate(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if tpl == nil {
+		return nil, ErrTemplateNotFound
+	}
+	if err := ValidateBindings(bindings); err != nil {
+		return nil, err
+	}
+
+	affected, err := s.store.ListBindingDevices(ctx, append(append([]registry.TemplateBinding{}, tpl.Bindings...), bindings...))
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.SetTemplateBindings(ctx, name, bindings); err != nil {
+		return nil, err
+	}
+	log.Printf("[CFG] template_bindings name=%s bindings=%d devices=%d by=%s", name, len(bindings), len(affected), actor)
+	return s.rollout(ctx, affected, actor), nil
+}
+
+func ValidateBindings(bindings []registry.TemplateBinding) error {
+	for _, b := range bindings {
+		if b.Kind != registry.BindingGroup && b.Kind != registry.BindingTag {
+			return fmt.Errorf("%w: binding kind must be group or tag", ErrInvalidConfig)
+		}
+		if b.Target == "" {
+			return fmt.Errorf("%w: binding target is required", ErrInvalidConfig)
+		}
+	}
+	return nil
+}
+
+// DeleteTemplate удаляет шаблон. Устройства без оставшихся слоёв сохраняют последний desired.
+func (s *Service) DeleteTemplate(ctx context.Context, name string, actor string) ([]RolloutItem, error) {
+	tpl, err := s.store.GetConfigTemplate(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if tpl == nil {
+		return nil, ErrTemplateNotFound
+	}
+	affected, err := s.store.ListBindingDevices(ctx, tpl.Bindings)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.store.DeleteConfigTemplate(ctx, name); err != nil {
+		return nil, err
+	}
+	log.Printf("[CFG] template_deleted name=%s devices=%d by=%s", name, len(affected), actor)
+	return s.rollout(ctx, affected, actor), nil
+}
+
+// rollout пересобирает конфиги устройств, выпускает версии сразу,
+// а публикацию ставит в фон с паузой rolloutInterval между устройствами.
+func (s *Service) rollout(ctx context.Context, deviceIDs []string, actor string) []RolloutItem {
+	items := make([]RolloutItem, 0, len(deviceIDs))
+	minted := []*registry.DeviceConfigRecord{}
+	for _, id := range deviceIDs {
+		item, rec := s.materialize(ctx, id, actor)
+		items = append(items, item)
+		if rec != nil {
+			minted = append(minted, rec)
+		}
+	}
+	if len(minted) > 0 {
+		go s.deliver(minted)
+	}
+	return items
+}
+
+func (s *Service) materialize(ctx context.Context, deviceID string, actor string) (RolloutItem, *registry.DeviceConfigRecord) {
+	item := RolloutItem{DeviceID: deviceID}
+
+	eff, err := s.Effective(ctx, deviceID)
+	if err != nil {
+		item.Status, item.Error = RolloutError, err.Error()
+		return item, nil
+	}
+	if eff.Doc == nil {
+		item.Status = RolloutNoSources
+		return item, nil
+	}
+	desired, err := s.store.GetDesiredConfig(ctx, deviceID)
+	if err != nil {
+		item.Status, item.Error = RolloutError, err.Error()
+		return item, nil
+	}
+	if desired != nil && sameDoc(desired.Doc, eff.Doc) {
+		item.Status, item.Version = RolloutUnchanged, desired.Version
+		return item, nil
+	}
+
+	rec, err := s.mint(ctx, deviceID, eff.Doc, actor)
+	if err != nil {
+		var fields validate.ConfigErrors
+		if errors.As(err, &fields) {
+			item.Status, item.Error, item.Fields = RolloutInvalid, ErrInvalidConfig.Error(), fields
+			log.Printf("[CFG] effective_invalid deviceId=%s err=%v", deviceID, fields)
+			return item, nil
+		}
+		item.Status, item.Error = RolloutError, err.Error()
+		return item, nil
+	}
+	item.Status, item.Version = RolloutMinted, rec.Version
+	return item, rec
+}
+
+// deliver публикует выпущенные версии. Не отправленная (блокировка устройства занята OTA или
+// командой, брокер недоступен) остаётся неопубликованной — её перешлёт reconciler.
+func (s *Service) deliver(recs []*registry.DeviceConfigRecord) {
+	sent, failed := 0, 0
+	for i, rec := range recs {
+		if i > 0 && s.rolloutInterval > 0 {
+			time.Sleep(s.rolloutInterval)
+		}
+		// пока ждали очереди, могла выйти более новая версия — старую не отправляем
+		cur, err := s.store.GetDesiredConfig(context.Background(), rec.DeviceID)
+		if err == nil && cur != nil && cur.Version > rec.Version {
+			log.Printf("[CFG] rollout_superseded deviceId=%s cfgVersion=%d latest=%d", rec.DeviceID, rec.Version, cur.Version)
+			continue
+		}
+		if err := s.Publish(context.Background(), rec); err != nil {
+			failed++
+			log.Printf("[CFG] rollout_publish_failed deviceId=%s cfgVersion=%d err=%v", rec.DeviceID, rec.Version, err)
+			continue
+		}
+		sent++
+	}
+	log.Printf("[CFG] rollout_delivered devices=%d sent=%d failed=%d", len(recs), sent, failed)
+}
+
+// sameDoc сравнивает документы без учёта version.
+func sameDoc(a, b map[string]any) bool {
+	strip := func(m map[string]any) map[string]any {
+		out := make(map[string]any, len(m))
+		for k, v := range m {
+			if k != "version" {
+				out[k] = v
+			}
+		}
+		return out
+	}
+	return reflect.DeepEqual(strip(a), strip(b))
+}
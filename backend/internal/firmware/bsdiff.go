@@ -0,0 +1,361 @@
+package firmware
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Формат дельты (docs/ota.md §5) — bsdiff, но одним потоком, чтобы устройство применяло патч
+// без буферизации целиком:
+//
+//	"VXDIFF01" | uint64 LE размер нового образа | raw deflate(записи)
+//	запись: int64 LE add, int64 LE copy, int64 LE seek | add байт diff | copy байт extra
+//
+// new[n+i] = old[o+i] + diff[i] (mod 256) для i < add; затем copy байт extra как есть;
+// o += add + seek, n += add + copy.
+const deltaMagic = "VXDIFF01"
+
+var ErrBadDelta = errors.New("invalid delta")
+
+// Diff строит дельту old → new.
+func Diff(old, new []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(deltaMagic)
+	var hdr [8]byte
+	binary.LittleEndian.PutUint64(hdr[:], uint64(len(new)))
+	buf.Write(hdr[:])
+
+	zw, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	bw := bufio.NewWriter(zw)
+	if err := bsdiff(old, new, bw); err != nil {
+		return nil, err
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Patch применяет дельту к old (backend проверяет ею только что построенную дельту).
+func Patch(old, delta []byte) ([]byte, error) {
+	if len(delta) < len(deltaMagic)+8 || string(delta[:len(deltaMagic)]) != deltaMagic {
+		return nil, fmt.Errorf("%w: bad header", ErrBadDelta)
+	}
+	size := binary.LittleEndian.Uint64(delta[len(deltaMagic):])
+	if size > 1<<32 {
+		return nil, fmt.Errorf("%w: size %d", ErrBadDelta, size)
+	}
+	out := make([]byte, size)
+	zr := flate.NewReader(bytes.NewReader(delta[len(deltaMagic)+8:]))
+	defer zr.Close()
+	r := bufio.NewReader(zr)
+
+	var ctrl [24]byte
+	var o, n int64
+	for n < int64(size) {
+		if _, err := io.ReadFull(r, ctrl[:]); err != nil {
+			return nil, fmt.Errorf("%w: ctrl: %v", ErrBadDelta, err)
+		}
+		add := int64(binary.LittleEndian.Uint64(ctrl[0:]))
+		cp := int64(binary.LittleEndian.Uint64(ctrl[8:]))
+		seek := int64(binary.LittleEndian.Uint64(ctrl[16:]))
+		if add < 0 || cp < 0 || add > int64(size)-n || cp > int64(size)-n-add {
+			return nil, fmt.Errorf("%w: ctrl out of range", ErrBadDelta)
+		}
+		if _, err := io.ReadFull(r, out[n:n+add]); err != nil {
+			return nil, fmt.Errorf("%w: diff: %v", ErrBadDelta, err)
+		}
+		for i := int64(0); i < add; i++ {
+			if o+i >= 0 && o+i < int64(len(old)) {
+				out[n+i] += old[o+i]
+			}
+		}
+		n += add
+		if _, err := io.ReadFull(r, out[n:n+cp]); err != nil {
+			return nil, fmt.Errorf("%w: extra: %v", ErrBadDelta, err)
+		}
+		n += cp
+		o += add + seek
+	}
+	return out, nil
+}
+
+// bsdiff — алгоритм Percival: суффиксный массив old, жадный поиск совпадений с приблизительными
+// (add) и вставленными (extra) участками.
+func bsdiff(old, new []byte, w io.Writer) error {
+	I := qsufsort(old)
+	oldsize, newsize := len(old), len(new)
+
+	var scan, pos, length int
+	var lastscan, lastpos, lastoffset int
+	var ctrl [24]byte
+	diff := []byte{}
+
+	for scan < newsize {
+		oldscore := 0
+		scan += length
+		for scsc := scan; scan < newsize; scan++ {
+			pos, length = search(I, old, new[scan:], 0, oldsize)
+
+			for ; scsc < scan+length; scsc++ {
+				if scsc+lastoffset < oldsize && old[scsc+lastoffset] == new[scsc] {
+					oldscore++
+				}
+			}
+			if (length == oldscore && length != 0) || length > oldscore+8 {
+				break
+			}
+			if scan+lastoffset < oldsize && old[scan+lastoffset] == new[scan] {
+				oldscore--
+			}
+		}
+
+		if length == oldscore && scan != newsize {
+			continue
+		}
+
+		var s, sf, lenf int
+		for i := 0; lastscan+i < scan && lastpos+i < oldsize; {
+			if old[lastpos+i] == new[lastscan+i] {
+				s++
+			}
+			i++
+			if s*2-i > sf*2-lenf {
+				sf, lenf = s, i
+			}
+		}
+
+		lenb := 0
+		if scan < newsize {
+			s, sb := 0, 0
+			for i := 1; scan >= lastscan+i && pos >= i; i++ {
+				if old[pos-i] == new[scan-i] {
+					s++
+				}
+				if s*2-i > sb*2-lenb {
+					sb, lenb = s, i
+				}
+			}
+		}
+
+		if lastscan+lenf > scan-lenb {
+			overlap := (lastscan + lenf) - (scan - lenb)
+			s, ss, lens := 0, 0, 0
+			for i := 0; i < overlap; i++ {
+				if new[lastscan+lenf-overlap+i] == old[lastpos+lenf-overlap+i] {
+					s++
+				}
+				if new[scan-lenb+i] == old[pos-lenb+i] {
+					s--
+				}
+				if s > ss {
+					ss, lens = s, i+1
+				}
+			}
+			lenf += lens - overlap
+			lenb -= lens
+		}
+
+		extra := (scan - lenb) - (lastscan + lenf)
+		binary.LittleEndian.PutUint64(ctrl[0:], uint64(lenf))
+		binary.LittleEndian.PutUint64(ctrl[8:], uint64(extra))
+		binary.LittleEndian.PutUint64(ctrl[16:], uint64(int64((pos-lenb)-(lastpos+lenf))))
+		if _, err := w.Write(ctrl[:]); err != nil {
+			return err
+		}
+		diff = diff[:0]
+		for i := 0; i < lenf; i++ {
+			diff = append(diff, new[lastscan+i]-old[lastpos+i])
+		}
+		if _, err := w.Write(diff); err != nil {
+			return err
+		}
+		if _, err := w.Write(new[lastscan+lenf : lastscan+lenf+extra]); err != nil {
+			return err
+		}
+
+		lastscan = scan - lenb
+		lastpos = pos - lenb
+		lastoffset = pos - scan
+	}
+	return nil
+}
+
+// qsufsort — суффиксный массив (Larsson–Sadakane), int32: образы ограничены FIRMWARE_MAX_SIZE_MB.
+func qsufsort(old []byte) []int32 {
+	n := len(old)
+	I := make([]int32, n+1)
+	V := make([]int32, n+1)
+
+	var buckets [256]int32
+	for _, c := range old {
+		buckets[c]++
+	}
+	for i := 1; i < 256; i++ {
+		buckets[i] += buckets[i-1]
+	}
+	for i := 255; i > 0; i-- {
+		buckets[i] = buckets[i-1]
+	}
+	buckets[0] = 0
+
+	for i, c := range old {
+		buckets[c]++
+		I[buckets[c]] = int32(i)
+	}
+	I[0] = int32(n)
+	for i, c := range old {
+		V[i] = buckets[c]
+	}
+	V[n] = 0
+	for i := 1; i < 256; i++ {
+		if buckets[i] == buckets[i-1]+1 {
+			I[buckets[i]] = -1
+		}
+	}
+	I[0] = -1
+
+	for h := int32(1); I[0] != -int32(n+1); h += h {
+		var length int32
+		i := int32(0)
+		for i < int32(n+1) {
+			if I[i] < 0 {
+				length -= I[i]
+				i -= I[i]
+			} else {
+				if length != 0 {
+					I[i-length] = -length
+				}
+				length = V[I[i]] + 1 - i
+				split(I, V, i, length, h)
+				i += length
+				length = 0
+			}
+		}
+		if length != 0 {
+			I[i-length] = -length
+		}
+	}
+
+	for i := 0; i < n+1; i++ {
+		I[V[i]] = int32(i)
+	}
+	return I
+}
+
+func split(I, V []int32, start, length, h int32) {
+	if length < 16 {
+		for k := start; k < start+length; {
+			j := int32(1)
+			x := V[I[k]+h]
+			for i := int32(1); k+i < start+length; i++ {
+				if V[I[k+i]+h] < x {
+					x = V[I[k+i]+h]
+					j = 0
+				}
+				if V[I[k+i]+h] == x {
+					I[k+j], I[k+i] = I[k+i], I[k+j]
+					j++
+				}
+			}
+			for i := int32(0); i < j; i++ {
+				V[I[k+i]] = k + j - 1
+			}
+			if j == 1 {
+				I[k] = -1
+			}
+			k += j
+		}
+		return
+	}
+
+	x := V[I[start+length/2]+h]
+	var jj, kk int32
+	for i := start; i < start+length; i++ {
+		if V[I[i]+h] < x {
+			jj++
+		}
+		if V[I[i]+h] == x {
+			kk++
+		}
+	}
+	jj += start
+	kk += jj
+
+	i, j, k := start, int32(0), int32(0)
+	for i < jj {
+		switch {
+		case V[I[i]+h] < x:
+			i++
+		case V[I[i]+h] == x:
+			I[i], I[jj+j] = I[jj+j], I[i]
+			j++
+		default:
+			I[i], I[kk+k] = I[kk+k], I[i]
+			k++
+		}
+	}
+	for jj+j < kk {
+		if V[I[jj+j]+h] == x {
+			j++
+		} else {
+			I[jj+j], I[kk+k] = I[kk+k], I[jj+j]
+			k++
+		}
+	}
+
+	if jj > start {
+		split(I, V, start, jj-start, h)
+	}
+	for i := int32(0); i < kk-jj; i++ {
+		V[I[jj+i]] = kk - 1
+	}
+	if jj == kk-1 {
+		I[jj] = -1
+	}
+	if start+length > kk {
+		split(I, V, kk, start+length-kk, h)
+	}
+}
+
+// search — самое длинное совпадение префикса new с суффиксом old (бинарный поиск по I[st..en]).
+func search(I []int32, old, new []byte, st, en int) (pos, n int) {
+	for en-st >= 2 {
+		x := st + (en-st)/2
+		suffix := old[I[x]:]
+		m := len(suffix)
+		if len(new) < m {
+			m = len(new)
+		}
+		if bytes.Compare(suffix[:m], new[:m]) < 0 {
+			st = x
+		} else {
+			en = x
+		}
+	}
+	x := matchlen(old[I[st]:], new)
+	y := matchlen(old[I[en]:], new)
+	if x > y {
+		return int(I[st]), x
+	}
+	return int(I[en]), y
+}
+
+func matchlen(a, b []byte) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
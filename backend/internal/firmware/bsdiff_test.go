@@ -0,0 +1,189 @@
+package firmware
+
+import (
+	"bytes"
+	"compress/flate"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+)
+
+func randBytes(r *rand.Rand, n int) []byte {
+	b := make([]byte, n)
+	r.Read(b)
+	return b
+}
+
+func TestDiffPatchRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	base := randBytes(r, 64<<10)
+
+	// "прошивка": база с точечными правками, вставкой и удалением
+	edited := append([]byte(nil), base...)
+	for i := 0; i < 200; i++ {
+		edited[r.Intn(len(edited))] ^= byte(r.Intn(255) + 1)
+	}
+	edited = append(edited[:1000], append(randBytes(r, 3000), edited[1000:]...)...)
+	edited = append(edited[:40000], edited[45000:]...)
+
+	cases := []struct {
+		name     string
+		old, new []byte
+	}{
+		{"both empty", nil, nil},
+		{"empty old", nil, []byte("fresh image")},
+		{"empty new", base[:100], nil},
+		{"identical", base, base},
+		{"single byte", []byte{0x42}, []byte{0x43}},
+		{"edited image", base, edited},
+		{"unrelated", base[:4096], randBytes(r, 4096)},
+		{"repetitive", bytes.Repeat([]byte{0xff}, 8192), append(bytes.Repeat([]byte{0xff}, 4096), bytes.Repeat([]byte{0x00}, 4096)...)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			patch, err := Diff(tc.old, tc.new)
+			if err != nil {
+				t.Fatalf("diff: %v", err)
+			}
+			got, err := Patch(tc.old, patch)
+			if err != nil {
+				t.Fatalf("patch: %v", err)
+			}
+			if !bytes.Equal(got, tc.new) {
+				t.Fatalf("reconstructed %d bytes, want %d", len(got), len(tc.new))
+			}
+		})
+	}
+
+	patch, err := Diff(base, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(patch) > len(base)/50 {
+		t.Errorf("delta of identical images is %d bytes for %d byte image", len(patch), len(base))
+	}
+}
+
+func TestPatchTruncated(t *testing.T) {
+	r := rand.New(rand.NewSource(2))
+	old := randBytes(r, 16<<10)
+	new := append(append([]byte(nil), old[:8000]...), randBytes(r, 2000)...)
+	new = append(new, old[9000:]...)
+	patch, err := Diff(old, new)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for n := 0; n < len(patch); n++ {
+		got, err := Patch(old, patch[:n])
+		// хвост deflate (пустой финальный блок) может быть не нужен — но неверного образа быть не должно
+		if err == nil && !bytes.Equal(got, new) {
+			t.Fatalf("truncated to %d/%d bytes: produced a wrong image", n, len(patch))
+		}
+		if err != nil && !errors.Is(err, ErrBadDelta) {
+			t.Fatalf("truncated to %d: err = %v, want ErrBadDelta", n, err)
+		}
+		if n <= len(patch)/2 && err == nil {
+			t.Fatalf("truncated to %d/%d bytes: accepted", n, len(patch))
+		}
+	}
+}
+
+func TestPatchBadInput(t *testing.T) {
+	header := func(size uint64) []byte {
+		b := []byte(deltaMagic)
+		return binary.LittleEndian.AppendUint64(b, size)
+	}
+	cases := []struct {
+		name  string
+		delta []byte
+	}{
+		{"empty", nil},
+		{"bad magic", append([]byte("VXDIFF00"), make([]byte, 8)...)},
+		{"short header", []byte(deltaMagic + "\x01")},
+		{"huge size", header(1 << 40)},
+		{"no body", header(10)},
+		// add+copy переполняют int64
+		{"ctrl overflow", append(header(10), deflateRaw(t, ctrl(1<<62, 1<<62, 0))...)},
+		{"negative add", append(header(10), deflateRaw(t, ctrl(-1, 0, 0))...)},
+		{"copy past end", append(header(10), deflateRaw(t, ctrl(4, 7, 0))...)},
+	}
+	for _, tc := range cases {
+		if _, err := Patch([]byte("old image"), tc.delta); !errors.Is(err, ErrBadDelta) {
+			t.Errorf("%s: err = %v, want ErrBadDelta", tc.name, err)
+		}
+	}
+}
+
+func ctrl(add, cp, seek int64) []byte {
+	b := binary.LittleEndian.AppendUint64(nil, uint64(add))
+	b = binary.LittleEndian.AppendUint64(b, uint64(cp))
+	return binary.LittleEndian.AppendUint64(b, uint64(seek))
+}
+
+func deflateRaw(t *testing.T, b []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw, err := flate.NewWriter(&buf, flate.DefaultCompression)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := zw.Write(b); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func writeImage(t *testing.T, dir, name string, data []byte) registry.FirmwareRecord {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	return registry.FirmwareRecord{ID: name, Version: name, FileName: name, Size: int64(len(data)), SHA256: hex.EncodeToString(sum[:])}
+}
+
+// Дельта не сохраняется, если образы на диске не совпадают с sha256 из репозитория.
+func TestBuildDeltaVerifiesHashes(t *testing.T) {
+	dir := t.TempDir()
+	s := &Service{cfg: Config{Dir: dir, DeltaMaxRatio: 1}} // store не нужен: до записи дело не доходит
+	r := rand.New(rand.NewSource(3))
+	oldImg := randBytes(r, 4096)
+	newImg := append(append([]byte(nil), oldImg[:2000]...), randBytes(r, 100)...)
+
+	from := writeImage(t, dir, "1.0.0", oldImg)
+	rec := writeImage(t, dir, "1.1.0", newImg)
+
+	t.Run("target on disk differs from its sha256", func(t *testing.T) {
+		corrupt := append([]byte(nil), newImg...)
+		corrupt[0] ^= 1
+		if err := s.buildDelta(context.Background(), rec, corrupt, from); !errors.Is(err, ErrBadDelta) {
+			t.Fatalf("err = %v, want ErrBadDelta", err)
+		}
+	})
+	t.Run("source on disk differs from its sha256", func(t *testing.T) {
+		bad := from
+		bad.SHA256 = rec.SHA256
+		if err := s.buildDelta(context.Background(), rec, newImg, bad); !errors.Is(err, ErrBadDelta) {
+			t.Fatalf("err = %v, want ErrBadDelta", err)
+		}
+	})
+
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if filepath.Ext(e.Name()) == ".delta" || filepath.Ext(e.Name()) == ".tmp" {
+			t.Errorf("delta file written: %s", e.Name())
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package firmware
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+)
+
+// DeltaOffer — дельта, предложенная устройству в OTA job, с подписанной ссылкой.
+type DeltaOffer struct {
+	Delta registry.FirmwareDelta
+	URL   SignedURL
+}
+
+// BuildDeltas пересчитывает дельты к артефакту от самых распространённых в парке версий (devices.fw),
+// для которых в репозитории есть образ той же модели. Уже построенные дельты перестраиваются.
+func (s *Service) BuildDeltas(ctx context.Context, id string) ([]registry.FirmwareDelta, error) {
+	rec, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if s.cfg.DeltaSources <= 0 {
+		return s.store.ListFirmwareDeltas(ctx, rec.ID)
+	}
+	top, err := s.store.TopInstalledFirmware(ctx, s.cfg.DeltaSources)
+	if err != nil {
+		return nil, err
+	}
+
+	s.deltaMu.Lock()
+	defer s.deltaMu.Unlock()
+
+	var target []byte
+	seen := map[string]bool{} // "1.3.0" и "v1.3.0" в devices.fw — одна версия
+	for _, v := range top {
+		ver, err := ParseVersion(v.Version)
+		if err != nil || ver.String() == rec.Version || seen[ver.String()] {
+			continue
+		}
+		seen[ver.String()] = true
+		from, err := s.store.FindFirmware(ctx, rec.HWModel, ver.String())
+		if err != nil {
+			return nil, err
+		}
+		if from == nil {
+			log.Printf("[FW] delta_skipped id=%s from=%s reason=no_source_image devices=%d", rec.ID, ver.String(), v.Devices)
+			continue
+		}
+		if target == nil {
+			if target, err = s.readFile(*rec); err != nil {
+				return nil, err
+			}
+		}
+		if err := s.buildDelta(ctx, *rec, target, *from); err != nil {
+			log.Printf("[FW] delta_failed id=%s from=%s err=%v", rec.ID, from.Version, err)
+		}
+	}
+	return s.store.ListFirmwareDeltas(ctx, rec.ID)
+}
+
+func (s *Service) buildDelta(ctx context.Context, rec registry.FirmwareRecord, target []byte, from registry.FirmwareRecord) error {
+	started := time.Now()
+	old, err := s.readFile(from)
+	if err != nil {
+		return err
+	}
+	// файлы на диске сверяем с sha256 из репозитория: дельта от испорченного образа не сойдётся на устройстве
+	if sum := sha256.Sum256(old); hex.EncodeToString(sum[:]) != from.SHA256 {
+		return fmt.Errorf("%w: source image id=%s does not match its sha256", ErrBadDelta, from.ID)
+	}
+	patch, err := Diff(old, target)
+	if err != nil {
+		return err
+	}
+	// проверяем дельту тем же алгоритмом, что и устройство, до того как её кому-то предложить:
+	// восстановленный образ должен совпасть с sha256 артефакта, который устройство проверит после patch
+	check, err := Patch(old, patch)
+	if err != nil {
+		return err
+	}
+	if sum := sha256.Sum256(check); hex.EncodeToString(sum[:]) != rec.SHA256 {
+		return fmt.Errorf("%w: patch does not reproduce image sha256=%s", ErrBadDelta, rec.SHA256)
+	}
+	if float64(len(patch)) > float64(rec.Size)*s.cfg.DeltaMaxRatio {
+		log.Printf("[FW] delta_skipped id=%s from=%s reason=too_large size=%d full=%d", rec.ID, from.Version, len(patch), rec.Size)
+		return nil
+	}
+
+	sum := sha256.Sum256(patch)
+	d := registry.FirmwareDelta{
+		ID:             uuid.NewString(),
+		FirmwareID:     rec.ID,
+		FromFirmwareID: from.ID,
+		FromVersion:    from.Version,
+		FromSHA256:     from.SHA256,
+		SHA256:         hex.EncodeToString(sum[:]),
+		Size:           int64(len(patch)),
+		CreatedMillis:  time.Now().UnixMilli(),
+	}
+	d.FileName = d.ID + ".delta"
+	tmp := filepath.Join(s.cfg.Dir, d.FileName+".tmp")
+	if err := os.WriteFile(tmp, patch, 0o644); err != nil {
+		return fmt.Errorf("firmware write delta: %w", err)
+	}
+	if err := os.Rename(tmp, filepath.Join(s.cfg.Dir, d.FileName)); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("firmware store delta: %w", err)
+	}
+	prev, err := s.store.UpsertFirmwareDelta(ctx, d)
+	if err != nil {
+		_ = os.Remove(filepath.Join(s.cfg.Dir, d.FileName))
+		return err
+	}
+	if prev != "" {
+		_ = os.Remove(filepath.Join(s.cfg.Dir, prev))
+	}
+	log.Printf("[FW] delta_built id=%s from=%s size=%d full=%d took=%s", rec.ID, from.Version, d.Size, rec.Size, time.Since(started).Round(time.Millisecond))
+	return nil
+}
+
+func (s *Service) buildDeltasAsync(id string) {
+	list, err := s.BuildDeltas(context.Background(), id)
+	if err != nil {
+		log.Printf("[FW] deltas_failed id=%s err=%v", id, err)
+		return
+	}
+	log.Printf("[FW] deltas_ready id=%s count=%d", id, len(list))
+}
+
+// Deltas — дельты к артефакту.
+func (s *Service) Deltas(ctx context.Context, id string) ([]registry.FirmwareDelta, error) {
+	rec, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.store.ListFirmwareDeltas(ctx, rec.ID)
+}
+
+// IssueDelta — дельта к артефакту от версии fromVersion с подписанной ссылкой; nil — дельты нет.
+func (s *Service) IssueDelta(ctx context.Context, id, fromVersion string, ttl time.Duration) (*DeltaOffer, error) {
+	ver, err := ParseVersion(fromVersion)
+	if err != nil {
+		return nil, nil
+	}
+	d, err := s.store.FindFirmwareDelta(ctx, id, ver.String())
+	if err != nil || d == nil {
+		return nil, err
+	}
+	return &DeltaOffer{Delta: *d, URL: s.SignDeltaURL(id, d.ID, ttl)}, nil
+}
+
+// OpenDelta — файл дельты для отдачи (вызывающий закрывает).
+func (s *Service) OpenDelta(ctx context.Context, id, deltaID string) (*registry.FirmwareDelta, *os.File, error) {
+	d, err := s.store.GetFirmwareDelta(ctx, deltaID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if d == nil || d.FirmwareID != id {
+		return nil, nil, ErrNotFound
+	}
+	f, err := os.Open(filepath.Join(s.cfg.Dir, d.FileName))
+	if err != nil {
+		return d, nil, fmt.Errorf("firmware open delta id=%s: %w", deltaID, err)
+	}
+	return d, f, nil
+}
+
+func (s *Service) readFile(rec registry.FirmwareRecord) ([]byte, error) {
+	b, err := os.ReadFile(filepath.Join(s.cfg.Dir, rec.FileName))
+	if err != nil {
+		return nil, fmt.Errorf("firmware read id=%s: %w", rec.ID, err)
+	}
+	return b, nil
+}
@@ -0,0 +1,340 @@
+package firmware
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+)
+
+var (
+	ErrInvalid    = errors.New("invalid firmware")
+	ErrExists     = errors.New("firmware version already exists for this hw model")
+	ErrTooLarge   = errors.New("firmware file is too large")
+	ErrNotFound   = errors.New("firmware not found")
+	ErrDeprecated = errors.New("firmware is deprecated")
+)
+
+// hwModelRe — модель железа: попадает в имена и фильтры, поэтому без пробелов и слэшей.
+var hwModelRe = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// Store — метаданные артефактов (реализует registry.SQLiteStore).
+type Store interface {
+	CreateFirmware(ctx context.Context, rec registry.FirmwareRecord) error
+	GetFirmware(ctx context.Context, id string) (*registry.FirmwareRecord, error)
+	FindFirmware(ctx context.Context, hwModel, version string) (*registry.FirmwareRecord, error)
+	ListFirmware(ctx context.Context, filter registry.FirmwareFilter) ([]registry.FirmwareRecord, error)
+	SetFirmwareDeprecated(ctx context.Context, id string, deprecated bool, actor, reason string, nowMillis int64) (bool, error)
+
+	UpsertFirmwareDelta(ctx context.Context, d registry.FirmwareDelta) (string, error)
+	ListFirmwareDeltas(ctx context.Context, firmwareID string) ([]registry.FirmwareDelta, error)
+	FindFirmwareDelta(ctx context.Context, firmwareID, fromVersion string) (*registry.FirmwareDelta, error)
+	GetFirmwareDelta(ctx context.Context, id string) (*registry.FirmwareDelta, error)
+	TopInstalledFirmware(ctx context.Context, limit int) ([]registry.FirmwareVersionCount, error)
+}
+
+type Config struct {
+	Dir       string        // каталог с бинарниками
+	MaxSize   int64         // байт
+	URLSecret []byte        // HMAC подписанных ссылок
+	URLTTL    time.Duration // срок ссылки по умолчанию
+	URLMaxTTL time.Duration
+	PublicURL string // префикс ссылок для устройств (https://ota.example.com); пусто — относительный путь
+
+	DeltaSources  int     // от скольких самых распространённых версий строить дельты; 0 — не строить
+	DeltaMaxRatio float64 // дельта больше этой доли полного образа не сохраняется
+}
+
+func LoadConfigFromEnv() Config {
+	dir := os.Getenv("FIRMWARE_DIR")
+	if dir == "" {
+		dir = "./.data/firmware"
+	}
+	return Config{
+		Dir:       dir,
+		MaxSize:   int64(getenvInt("FIRMWARE_MAX_SIZE_MB", 16)) << 20,
+		URLSecret: []byte(os.Getenv("FIRMWARE_URL_SECRET")),
+		URLTTL:    time.Duration(getenvInt("FIRMWARE_URL_TTL_MS", 900000)) * time.Millisecond,
+		URLMaxTTL: time.Duration(getenvInt("FIRMWARE_URL_MAX_TTL_MS", 86400000)) * time.Millisecond,
+		PublicURL: strings.TrimRight(os.Getenv("FIRMWARE_PUBLIC_URL"), "/"),
+
+		DeltaSources:  getenvInt("FIRMWARE_DELTA_SOURCES", 3),
+		DeltaMaxRatio: getenvFloat("FIRMWARE_DELTA_MAX_RATIO", 0.7),
+	}
+}
+
+// UploadMeta — метаданные загружаемой прошивки.
+type UploadMeta struct {
+	Version  string
+	HWModel  string
+	MinHWRev int
+	Notes    string
+	Actor    string
+}
+
+// Service — репозиторий прошивок: файлы в cfg.Dir, метаданные в registry.
+type Service struct {
+	store Store
+	cfg   Config
+
+	mu      sync.Mutex // проверка уникальности (hwModel, version) + вставка
+	deltaMu sync.Mutex // дельты строятся по одной: суффиксный массив старого образа занимает 8 байт на байт
+	signer  *Signer
+}
+
+func New(store Store, cfg Config) (*Service, error) {
+	if cfg.Dir == "" {
+		return nil, errors.New("firmware dir is empty")
+	}
+	if err := os.MkdirAll(cfg.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("firmware dir: %w", err)
+	}
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = 16 << 20
+	}
+	if cfg.URLTTL <= 0 {
+		cfg.URLTTL = 15 * time.Minute
+	}
+	if cfg.URLMaxTTL < cfg.URLTTL {
+		cfg.URLMaxTTL = cfg.URLTTL
+	}
+	if cfg.DeltaSources < 0 {
+		cfg.DeltaSources = 0
+	}
+	if cfg.DeltaMaxRatio <= 0 || cfg.DeltaMaxRatio > 1 {
+		cfg.DeltaMaxRatio = 0.7
+	}
+	if len(cfg.URLSecret) == 0 {
+		// без секрета ссылки живут до рестарта процесса
+		cfg.URLSecret = make([]byte, 32)
+		if _, err := rand.Read(cfg.URLSecret); err != nil {
+			return nil, fmt.Errorf("firmware url secret: %w", err)
+		}
+		log.Printf("[FW] FIRMWARE_URL_SECRET is empty, signed urls are valid until restart")
+	}
+	return &Service{store: store, cfg: cfg}, nil
+}
+
+func (s *Service) MaxSize() int64 {
+	return s.cfg.MaxSize
+}
+
+// Upload сохраняет бинарник: sha256 и размер считаются при записи, файл появляется под финальным
+// именем только после успешной записи метаданных.
+func (s *Service) Upload(ctx context.Context, meta UploadMeta, body io.Reader) (*registry.FirmwareRecord, error) {
+	meta.HWModel = strings.TrimSpace(meta.HWModel)
+	if !hwModelRe.MatchString(meta.HWModel) {
+		return nil, fmt.Errorf("%w: hwModel must match %s", ErrInvalid, hwModelRe.String())
+	}
+	ver, err := ParseVersion(meta.Version)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	version := ver.String()
+	if meta.MinHWRev < 0 {
+		return nil, fmt.Errorf("%w: minHwRev must be >= 0", ErrInvalid)
+	}
+
+	tmp, err := os.CreateTemp(s.cfg.Dir, "upload-*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("firmware temp file: %w", err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // после rename — no-op
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), io.LimitReader(body, s.cfg.MaxSize+1))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return nil, fmt.Errorf("firmware write: %w", err)
+	}
+	if n > s.cfg.MaxSize {
+		return nil, fmt.Errorf("%w: limit %d bytes", ErrTooLarge, s.cfg.MaxSize)
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("%w: empty file", ErrInvalid)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	existing, err := s.store.FindFirmware(ctx, meta.HWModel, version)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("%w: %s %s (id=%s)", ErrExists, meta.HWModel, version, existing.ID)
+	}
+
+	rec := registry.FirmwareRecord{
+		ID:            uuid.NewString(),
+		Version:       version,
+		HWModel:       meta.HWModel,
+		MinHWRev:      meta.MinHWRev,
+		Notes:         strings.TrimSpace(meta.Notes),
+		SHA256:        hex.EncodeToString(h.Sum(nil)),
+		Size:          n,
+		UploadedBy:    meta.Actor,
+		CreatedMillis: time.Now().UnixMilli(),
+	}
+	rec.FileName = rec.ID + ".bin"
+	if err := os.Rename(tmpName, filepath.Join(s.cfg.Dir, rec.FileName)); err != nil {
+		return nil, fmt.Errorf("firmware store file: %w", err)
+	}
+	if err := s.store.CreateFirmware(ctx, rec); err != nil {
+		_ = os.Remove(filepath.Join(s.cfg.Dir, rec.FileName))
+		return nil, err
+	}
+
+	log.Printf("[FW] uploaded id=%s hwModel=%s version=%s minHwRev=%d size=%d sha256=%s by=%s", rec.ID, rec.HWModel, rec.Version, rec.MinHWRev, rec.Size, rec.SHA256, rec.UploadedBy)
+	if s.cfg.DeltaSources > 0 {
+		go s.buildDeltasAsync(rec.ID)
+	}
+	return &rec, nil
+}
+
+// List — артефакты по модели (по алфавиту), внутри модели — от старшей версии к младшей.
+func (s *Service) List(ctx context.Context, filter registry.FirmwareFilter) ([]registry.FirmwareRecord, error) {
+	list, err := s.store.ListFirmware(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].HWModel != list[j].HWModel {
+			return list[i].HWModel < list[j].HWModel
+		}
+		return CompareVersions(list[i].Version, list[j].Version) > 0
+	})
+	return list, nil
+}
+
+func (s *Service) Get(ctx context.Context, id string) (*registry.FirmwareRecord, error) {
+	rec, err := s.store.GetFirmware(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil {
+		return nil, ErrNotFound
+	}
+	return rec, nil
+}
+
+// Deprecate помечает артефакт устаревшим: новые ссылки не выдаются, уже выданные работают до истечения.
+func (s *Service) Deprecate(ctx context.Context, id string, deprecated bool, actor, reason string) (*registry.FirmwareRecord, error) {
+	ok, err := s.store.SetFirmwareDeprecated(ctx, id, deprecated, actor, strings.TrimSpace(reason), time.Now().UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrNotFound
+	}
+	log.Printf("[FW] deprecated id=%s value=%v by=%s", id, deprecated, actor)
+	return s.Get(ctx, id)
+}
+
+// SetSigner подключает ключ подписи манифестов OTA.
+func (s *Service) SetSigner(signer *Signer) {
+	s.signer = signer
+}
+
+// Signer — ключ подписи манифестов (nil, если не подключён).
+func (s *Service) Signer() *Signer {
+	return s.signer
+}
+
+// SignManifest — подписанный манифест артефакта: срок манифеста совпадает со сроком ссылки.
+// delta != nil — в манифест добавляется дельта, полный образ остаётся запасным вариантом.
+func (s *Service) SignManifest(rec registry.FirmwareRecord, url SignedURL, delta *DeltaOffer, deviceID, jobID string) (SignedManifest, error) {
+	if s.signer == nil {
+		return SignedManifest{}, errors.New("ota signing key is not configured")
+	}
+	m := Manifest{
+		V:         1,
+		Version:   rec.Version,
+		HWModel:   rec.HWModel,
+		MinHWRev:  rec.MinHWRev,
+		URL:       url.URL,
+		SHA256:    rec.SHA256,
+		Size:      rec.Size,
+		ExpiresAt: url.ExpiresMillis,
+		DeviceID:  deviceID,
+		JobID:     jobID,
+	}
+	if delta != nil {
+		m.Delta = &ManifestDelta{
+			From:       delta.Delta.FromVersion,
+			FromSHA256: delta.Delta.FromSHA256,
+			URL:        delta.URL.URL,
+			SHA256:     delta.Delta.SHA256,
+			Size:       delta.Delta.Size,
+		}
+	}
+	return s.signer.Sign(m)
+}
+
+// IssueURL — подписанная ссылка на неустаревший артефакт.
+func (s *Service) IssueURL(ctx context.Context, id string, ttl time.Duration) (*registry.FirmwareRecord, SignedURL, error) {
+	rec, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, SignedURL{}, err
+	}
+	if rec.Deprecated {
+		return rec, SignedURL{}, ErrDeprecated
+	}
+	return rec, s.SignURL(rec.ID, ttl), nil
+}
+
+// Open — файл артефакта для отдачи (вызывающий закрывает).
+func (s *Service) Open(ctx context.Context, id string) (*registry.FirmwareRecord, *os.File, error) {
+	rec, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	f, err := os.Open(filepath.Join(s.cfg.Dir, rec.FileName))
+	if err != nil {
+		return rec, nil, fmt.Errorf("firmware open id=%s: %w", id, err)
+	}
+	return rec, f, nil
+}
+
+func getenvFloat(k string, def float64) float64 {
+	v := os.Getenv(k)
+	if v == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return def
+	}
+	return f
+}
+
+func getenvInt(k string, def int) int {
+	v := os.Getenv(k)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return def
+	}
+	return n
+}
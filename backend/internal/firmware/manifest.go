@@ -0,0 +1,184 @@
+package firmware
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ManifestAlg — алгоритм подписи манифестов OTA.
+const ManifestAlg = "Ed25519"
+
+var ErrBadManifest = errors.New("invalid manifest signature")
+
+// Manifest — то, чему доверяет устройство: брокер может подменить payload, но не подпись.
+// Устройство проверяет подпись публичным ключом из прошивки, срок, модель/ревизию железа,
+// а после скачивания — sha256 и размер образа.
+type Manifest struct {
+	V         int    `json:"v"`
+	Version   string `json:"version"`
+	HWModel   string `json:"hwModel"`
+	MinHWRev  int    `json:"minHwRev"` // 0 — любая ревизия
+	URL       string `json:"url"`
+	SHA256    string `json:"sha256"`
+	Size      int64  `json:"size"`
+	ExpiresAt int64  `json:"expiresAt"`          // unix ms; после — манифест отвергается
+	DeviceID  string `json:"deviceId,omitempty"` // пусто — манифест не привязан к устройству (офлайн-подпись)
+	JobID     string `json:"jobId,omitempty"`
+
+	Delta *ManifestDelta `json:"delta,omitempty"`
+}
+
+// ManifestDelta — патч от установленного образа (docs/ota.md §5). Результат применения
+// проверяется по sha256 полного образа; при любой ошибке устройство качает полный образ по url.
+type ManifestDelta struct {
+	From       string `json:"from"`
+	FromSHA256 string `json:"fromSha256"` // образ, к которому применим патч
+	URL        string `json:"url"`
+	SHA256     string `json:"sha256"` // самого патча
+	Size       int64  `json:"size"`
+}
+
+// SignedManifest — манифест в том виде, в каком его получает устройство.
+// Подписываются ровно байты manifest (base64 JSON), устройство не пересериализует JSON.
+type SignedManifest struct {
+	Manifest string `json:"manifest"` // base64(JSON Manifest)
+	Sig      string `json:"sig"`      // base64(Ed25519(manifest bytes))
+	KeyID    string `json:"kid"`
+	Alg      string `json:"alg"`
+}
+
+// Signer — ключ подписи манифестов из локального файла.
+type Signer struct {
+	kid  string
+	priv ed25519.PrivateKey
+}
+
+// signerFile — формат файла ключа: {"kid":"…","seed":"<base64 32 байта>"}.
+type signerFile struct {
+	KeyID string `json:"kid"`
+	Seed  string `json:"seed"`
+}
+
+// SigningKeyPathFromEnv — путь к ключу подписи (по умолчанию рядом с БД).
+func SigningKeyPathFromEnv() string {
+	p := os.Getenv("OTA_SIGNING_KEY_FILE")
+	if p == "" {
+		p = "./.data/ota-signing.key"
+	}
+	return p
+}
+
+// OpenSigner читает ключ; если файла нет и create=true — генерирует и сохраняет новый.
+func OpenSigner(path string, create bool) (*Signer, error) {
+	if path == "" {
+		return nil, errors.New("ota signing key file path is empty")
+	}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && create {
+		return generateSigner(path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read signing key %s: %w", path, err)
+	}
+
+	var f signerFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("parse signing key %s: %w", path, err)
+	}
+	seed, err := base64.StdEncoding.DecodeString(f.Seed)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("signing key %s: seed must be base64 of %d bytes", path, ed25519.SeedSize)
+	}
+	s := newSigner(ed25519.NewKeyFromSeed(seed))
+	if f.KeyID != "" && f.KeyID != s.kid {
+		return nil, fmt.Errorf("signing key %s: kid %q does not match key", path, f.KeyID)
+	}
+	return s, nil
+}
+
+func generateSigner(path string) (*Signer, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate signing key: %w", err)
+	}
+	s := newSigner(priv)
+	b, err := json.MarshalIndent(signerFile{KeyID: s.kid, Seed: base64.StdEncoding.EncodeToString(priv.Seed())}, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal signing key: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("mkdir %s: %w", dir, err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return nil, fmt.Errorf("write signing key %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return nil, fmt.Errorf("replace signing key %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// kid — первые 8 байт sha256 публичного ключа: устройство с несколькими вшитыми ключами выбирает нужный.
+func newSigner(priv ed25519.PrivateKey) *Signer {
+	sum := sha256.Sum256(priv.Public().(ed25519.PublicKey))
+	return &Signer{kid: hex.EncodeToString(sum[:8]), priv: priv}
+}
+
+func (s *Signer) KeyID() string {
+	return s.kid
+}
+
+func (s *Signer) PublicKey() ed25519.PublicKey {
+	return s.priv.Public().(ed25519.PublicKey)
+}
+
+// Sign сериализует манифест и подписывает полученные байты.
+func (s *Signer) Sign(m Manifest) (SignedManifest, error) {
+	if m.V == 0 {
+		m.V = 1
+	}
+	m.SHA256 = strings.ToLower(m.SHA256)
+	b, err := json.Marshal(m)
+	if err != nil {
+		return SignedManifest{}, fmt.Errorf("marshal manifest: %w", err)
+	}
+	return SignedManifest{
+		Manifest: base64.StdEncoding.EncodeToString(b),
+		Sig:      base64.StdEncoding.EncodeToString(ed25519.Sign(s.priv, b)),
+		KeyID:    s.kid,
+		Alg:      ManifestAlg,
+	}, nil
+}
+
+// VerifyManifest — проверка, которую выполняет устройство (срок не проверяется: это забота вызывающего).
+func VerifyManifest(pub ed25519.PublicKey, sm SignedManifest) (*Manifest, error) {
+	if sm.Alg != "" && sm.Alg != ManifestAlg {
+		return nil, fmt.Errorf("%w: unsupported alg %q", ErrBadManifest, sm.Alg)
+	}
+	b, err := base64.StdEncoding.DecodeString(sm.Manifest)
+	if err != nil {
+		return nil, ErrBadManifest
+	}
+	sig, err := base64.StdEncoding.DecodeString(sm.Sig)
+	if err != nil || !ed25519.Verify(pub, b, sig) {
+		return nil, ErrBadManifest
+	}
+	var m Manifest
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrBadManifest, err)
+	}
+	return &m, nil
+}
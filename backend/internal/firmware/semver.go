@@ -0,0 +1,242 @@
+package firmware
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version — semver 2.0: MAJOR.MINOR.PATCH[-pre][+build].
+type Version struct {
+	Major, Minor, Patch int64
+	Pre                 []string
+	Build               string
+}
+
+// ParseVersion разбирает semver; ведущая "v" допускается ("v1.2.3").
+func ParseVersion(s string) (Version, error) {
+	var v Version
+	raw := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if raw == "" {
+		return v, fmt.Errorf("empty version")
+	}
+	if i := strings.IndexByte(raw, '+'); i >= 0 {
+		v.Build = raw[i+1:]
+		raw = raw[:i]
+		if !validIdents(v.Build, false) {
+			return v, fmt.Errorf("invalid build metadata %q", v.Build)
+		}
+	}
+	if i := strings.IndexByte(raw, '-'); i >= 0 {
+		pre := raw[i+1:]
+		raw = raw[:i]
+		if !validIdents(pre, true) {
+			return v, fmt.Errorf("invalid pre-release %q", pre)
+		}
+		v.Pre = strings.Split(pre, ".")
+	}
+
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return v, fmt.Errorf("version %q is not MAJOR.MINOR.PATCH", s)
+	}
+	nums := make([]int64, 3)
+	for i, p := range parts {
+		n, err := parseNumeric(p)
+		if err != nil {
+			return v, fmt.Errorf("version %q: %v", s, err)
+		}
+		nums[i] = n
+	}
+	v.Major, v.Minor, v.Patch = nums[0], nums[1], nums[2]
+	return v, nil
+}
+
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if len(v.Pre) > 0 {
+		s += "-" + strings.Join(v.Pre, ".")
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Compare — порядок по semver (build не учитывается): -1, 0, 1.
+func (v Version) Compare(o Version) int {
+	for _, d := range [][2]int64{{v.Major, o.Major}, {v.Minor, o.Minor}, {v.Patch, o.Patch}} {
+		if d[0] != d[1] {
+			if d[0] < d[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+	// версия без pre-release старше любой pre-release той же тройки
+	switch {
+	case len(v.Pre) == 0 && len(o.Pre) == 0:
+		return 0
+	case len(v.Pre) == 0:
+		return 1
+	case len(o.Pre) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.Pre) && i < len(o.Pre); i++ {
+		if c := comparePreIdent(v.Pre[i], o.Pre[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(v.Pre) < len(o.Pre):
+		return -1
+	case len(v.Pre) > len(o.Pre):
+		return 1
+	}
+	return 0
+}
+
+// CompareVersions сравнивает строки semver; неразбираемые считаются младше и сравниваются как строки.
+func CompareVersions(a, b string) int {
+	va, errA := ParseVersion(a)
+	vb, errB := ParseVersion(b)
+	switch {
+	case errA == nil && errB == nil:
+		return va.Compare(vb)
+	case errA == nil:
+		return 1
+	case errB == nil:
+		return -1
+	}
+	return strings.Compare(a, b)
+}
+
+func comparePreIdent(a, b string) int {
+	na, errA := strconv.ParseInt(a, 10, 64)
+	nb, errB := strconv.ParseInt(b, 10, 64)
+	switch {
+	case errA == nil && errB == nil:
+		switch {
+		case na < nb:
+			return -1
+		case na > nb:
+			return 1
+		}
+		return 0
+	case errA == nil:
+		return -1 // числовые идентификаторы младше буквенных
+	case errB == nil:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func parseNumeric(p string) (int64, error) {
+	if p == "" {
+		return 0, fmt.Errorf("empty numeric part")
+	}
+	if len(p) > 1 && p[0] == '0' {
+		return 0, fmt.Errorf("leading zero in %q", p)
+	}
+	n, err := strconv.ParseInt(p, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid numeric part %q", p)
+	}
+	return n, nil
+}
+
+func validIdents(s string, noLeadingZero bool) bool {
+	if s == "" {
+		return false
+	}
+	for _, id := range strings.Split(s, ".") {
+		if id == "" {
+			return false
+		}
+		numeric := true
+		for _, c := range id {
+			switch {
+			case c >= '0' && c <= '9':
+			case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '-':
+				numeric = false
+			default:
+				return false
+			}
+		}
+		if noLeadingZero && numeric && len(id) > 1 && id[0] == '0' {
+			return false
+		}
+	}
+	return true
+}
+
+// Constraint — условие на версию прошивки: "<1.4.0", ">=1.2.0 <1.4.0", "=1.3.1", "!=1.3.0".
+// Условия через пробел или запятую объединяются по AND.
+type Constraint struct {
+	raw   string
+	terms []constraintTerm
+}
+
+type constraintTerm struct {
+	op string
+	v  Version
+}
+
+func ParseConstraint(s string) (Constraint, error) {
+	c := Constraint{raw: strings.TrimSpace(s)}
+	for _, f := range strings.FieldsFunc(c.raw, func(r rune) bool { return r == ' ' || r == ',' }) {
+		op := ""
+		for _, p := range []string{">=", "<=", "!=", ">", "<", "="} {
+			if strings.HasPrefix(f, p) {
+				op = p
+				break
+			}
+		}
+		if op == "" {
+			op = "="
+		}
+		v, err := ParseVersion(strings.TrimPrefix(f, op))
+		if err != nil {
+			return c, fmt.Errorf("constraint %q: %v", f, err)
+		}
+		c.terms = append(c.terms, constraintTerm{op: op, v: v})
+	}
+	if len(c.terms) == 0 {
+		return c, fmt.Errorf("empty constraint")
+	}
+	return c, nil
+}
+
+func (c Constraint) String() string {
+	return c.raw
+}
+
+// Match — версия удовлетворяет всем условиям; неразбираемая версия не подходит ни под одно.
+func (c Constraint) Match(version string) bool {
+	v, err := ParseVersion(version)
+	if err != nil {
+		return false
+	}
+	for _, t := range c.terms {
+		cmp := v.Compare(t.v)
+		ok := false
+		switch t.op {
+		case "=":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+package firmware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+var ErrBadSignature = errors.New("invalid or expired download url")
+
+// SignedURL — короткоживущая ссылка на скачивание без токена пользователя (для устройств).
+type SignedURL struct {
+	URL           string
+	ExpiresMillis int64
+}
+
+// DownloadPath — путь скачивания артефакта (без подписи).
+func DownloadPath(id string) string {
+	return "/api/v1/firmware/" + url.PathEscape(id) + "/download"
+}
+
+// DeltaDownloadPath — путь скачивания дельты к артефакту.
+func DeltaDownloadPath(id, deltaID string) string {
+	return "/api/v1/firmware/" + url.PathEscape(id) + "/deltas/" + url.PathEscape(deltaID) + "/download"
+}
+
+// SignURL выдаёт ссылку со сроком ttl (0 — FIRMWARE_URL_TTL_MS).
+func (s *Service) SignURL(id string, ttl time.Duration) SignedURL {
+	return s.signPath(DownloadPath(id), id, ttl)
+}
+
+// SignDeltaURL — то же для дельты: подпись покрывает и артефакт, и дельту.
+func (s *Service) SignDeltaURL(id, deltaID string, ttl time.Duration) SignedURL {
+	return s.signPath(DeltaDownloadPath(id, deltaID), deltaKey(id, deltaID), ttl)
+}
+
+// VerifyURL проверяет подпись и срок ссылки из query (exp, sig).
+func (s *Service) VerifyURL(id string, query url.Values) error {
+	return s.verify(id, query)
+}
+
+func (s *Service) VerifyDeltaURL(id, deltaID string, query url.Values) error {
+	return s.verify(deltaKey(id, deltaID), query)
+}
+
+func (s *Service) signPath(path, key string, ttl time.Duration) SignedURL {
+	if ttl <= 0 || ttl > s.cfg.URLMaxTTL {
+		ttl = s.cfg.URLTTL
+	}
+	exp := time.Now().Add(ttl).Unix()
+	q := url.Values{}
+	q.Set("exp", strconv.FormatInt(exp, 10))
+	q.Set("sig", s.sign(key, exp))
+	return SignedURL{
+		URL:           s.cfg.PublicURL + path + "?" + q.Encode(),
+		ExpiresMillis: exp * 1000,
+	}
+}
+
+func (s *Service) verify(key string, query url.Values) error {
+	exp, err := strconv.ParseInt(query.Get("exp"), 10, 64)
+	if err != nil {
+		return ErrBadSignature
+	}
+	if time.Now().Unix() > exp {
+		return ErrBadSignature
+	}
+	if !hmac.Equal([]byte(query.Get("sig")), []byte(s.sign(key, exp))) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+func deltaKey(id, deltaID string) string {
+	return id + "/deltas/" + deltaID
+}
+
+func (s *Service) sign(id string, exp int64) string {
+	mac := hmac.New(sha256.New, s.cfg.URLSecret)
+	mac.Write([]byte(id))
+	mac.Write([]byte{'.'})
+	mac.Write([]byte(strconv.FormatInt(exp, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,210 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/perm1ss10n/vexora/backend/internal/commands"
+	"github.com/perm1ss10n/vexora/backend/internal/model"
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+)
+
+type CommandResponse struct {
+	ID        string            `json:"id"`
+	DeviceID  string            `json:"deviceId"`
+	Type      string            `json:"type"`
+	Params    map[string]any    `json:"params,omitempty"`
+	Status    string            `json:"status"`
+	Attempts  int               `json:"attempts"`
+	Ack       *model.AckPayload `json:"ack,omitempty"`
+	CreatedAt int64             `json:"createdAt"`
+	UpdatedAt int64             `json:"updatedAt"`
+	AckedAt   *int64            `json:"ackedAt,omitempty"`
+}
+
+func commandResponse(rec registry.CommandRecord) CommandResponse {
+	resp := CommandResponse{
+		ID:        rec.ID,
+		DeviceID:  rec.DeviceID,
+		Type:      rec.Type,
+		Params:    rec.Params,
+		Status:    rec.Status,
+		Attempts:  rec.Attempts,
+		Ack:       rec.Ack,
+		CreatedAt: rec.CreatedMillis,
+		UpdatedAt: rec.UpdatedMillis,
+	}
+	if rec.AckedMillis.Valid {
+		v := rec.AckedMillis.Int64
+		resp.AckedAt = &v
+	}
+	return resp
+}
+
+type CancelCmdResponse struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+}
+
+// handleCommands: GET/DELETE /api/v1/commands/{id}, GET /api/v1/commands/stream (SSE)
+func (s *Server) handleCommands(w http.ResponseWriter, r *http.Request) {
+	id := strings.TrimSpace(strings.TrimPrefix(r.URL.Path, "/api/v1/commands/"))
+	if id == "" || strings.Contains(id, "/") {
+		http.Error(w, "bad path", http.StatusBadRequest)
+		return
+	}
+	if id == "stream" {
+		s.handleCommandStream(w, r)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		s.handleCancelCommand(w, r, id)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.reg == nil {
+		http.Error(w, "device registry unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	rec, err := s.reg.GetCommand(r.Context(), id)
+	if err != nil {
+		log.Printf("[HTTP] get command failed: %v", err)
+		http.Error(w, "failed to get command", http.StatusInternalServerError)
+		return
+	}
+	if rec == nil {
+		http.Error(w, "command not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, commandResponse(*rec))
+}
+
+// handleCancelCommand: DELETE /api/v1/commands/{id} — отмена команды, по которой ещё ждём ACK.
+func (s *Server) handleCancelCommand(w http.ResponseWriter, r *http.Request, id string) {
+	err := s.cmd.Cancel(id)
+	if errors.Is(err, commands.ErrNotPending) {
+		if s.reg != nil {
+			rec, gerr := s.reg.GetCommand(r.Context(), id)
+			if gerr != nil {
+				log.Printf("[HTTP] get command failed: %v", gerr)
+				http.Error(w, "failed to get command", http.StatusInternalServerError)
+				return
+			}
+			if rec != nil {
+				http.Error(w, "command is not pending (status "+rec.Status+")", http.StatusConflict)
+				return
+			}
+		}
+		http.Error(w, "command not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		// Send уже разбужен с CANCELLED; не удалось только уведомить устройство
+		log.Printf("[HTTP] cmd_cancel id=%s err=%v", id, err)
+	}
+
+	log.Printf("[HTTP] cmd_cancel id=%s", id)
+	writeJSON(w, http.StatusAccepted, CancelCmdResponse{ID: id, Status: registry.CommandStatusCancelled})
+}
+
+// handleCommandStream — live-обновления статусов команд (включая acked_late) через SSE.
+func (s *Server) handleCommandStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	deviceFilter := strings.TrimSpace(r.URL.Query().Get("deviceId"))
+
+	updates, unsubscribe := s.cmd.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case u, ok := <-updates:
+			if !ok {
+				return
+			}
+			if deviceFilter != "" && u.DeviceID != deviceFilter {
+				continue
+			}
+			b, err := json.Marshal(u)
+			if err != nil {
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: command\ndata: %s\n\n", b); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// handleDeviceCommands: GET /api/v1/devices/{id}/commands?limit=N
+func (s *Server) handleDeviceCommands(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/devices/")
+	parts := strings.Split(path, "/")
+	if len(parts) != 2 || parts[1] != "commands" {
+		http.Error(w, "bad path", http.StatusBadRequest)
+		return
+	}
+	deviceID := strings.TrimSpace(parts[0])
+	if deviceID == "" {
+		http.Error(w, "bad path", http.StatusBadRequest)
+		return
+	}
+
+	limit := 50
+	if limitStr := strings.TrimSpace(r.URL.Query().Get("limit")); limitStr != "" {
+		parsed, err := strconv.Atoi(limitStr)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	if limit > 500 {
+		limit = 500
+	}
+
+	records, err := s.reg.ListDeviceCommands(r.Context(), deviceID, limit)
+	if err != nil {
+		log.Printf("[HTTP] list device commands failed: %v", err)
+		http.Error(w, "failed to list commands", http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]CommandResponse, 0, len(records))
+	for _, rec := range records {
+		response = append(response, commandResponse(rec))
+	}
+	writeJSON(w, http.StatusOK, response)
+}
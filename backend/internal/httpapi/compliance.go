@@ -0,0 +1,271 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/perm1ss10n/vexora/backend/internal/auth"
+	"github.com/perm1ss10n/vexora/backend/internal/compliance"
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+)
+
+type FirmwarePolicyRequest struct {
+	Name          string   `json:"name,omitempty"`
+	Group         string   `json:"group,omitempty"`
+	MinVersion    string   `json:"minVersion,omitempty"`
+	KnownBad      []string `json:"knownBad,omitempty"`
+	TargetVersion string   `json:"targetVersion,omitempty"`
+	AutoEnroll    bool     `json:"autoEnroll,omitempty"`
+}
+
+type FirmwarePolicyResponse struct {
+	Name          string   `json:"name"`
+	Group         string   `json:"group,omitempty"`
+	MinVersion    string   `json:"minVersion,omitempty"`
+	KnownBad      []string `json:"knownBad"`
+	TargetVersion string   `json:"targetVersion,omitempty"`
+	AutoEnroll    bool     `json:"autoEnroll"`
+	UpdatedBy     string   `json:"updatedBy,omitempty"`
+	CreatedAt     int64    `json:"createdAt"`
+	UpdatedAt     int64    `json:"updatedAt"`
+}
+
+type FirmwareComplianceSummary struct {
+	Total        int `json:"total"`
+	Compliant    int `json:"compliant"`
+	NonCompliant int `json:"nonCompliant"`
+	Unknown      int `json:"unknown"`
+	OnTarget     int `json:"onTarget"`
+}
+
+type FirmwareVersionCount struct {
+	Version      string `json:"version"`
+	Devices      int    `json:"devices"`
+	NonCompliant int    `json:"nonCompliant"`
+}
+
+type FirmwareComplianceDevice struct {
+	DeviceID      string   `json:"deviceId"`
+	Status        string   `json:"status"`
+	FW            string   `json:"fw,omitempty"`
+	Reasons       []string `json:"reasons"`
+	Policies      []string `json:"policies"`
+	TargetVersion string   `json:"targetVersion,omitempty"`
+	OnTarget      bool     `json:"onTarget"`
+	Since         int64    `json:"since,omitempty"`
+	LastSeenAt    int64    `json:"lastSeenAt"`
+}
+
+type FirmwareComplianceResponse struct {
+	GeneratedAt int64                      `json:"generatedAt"`
+	Group       string                     `json:"group,omitempty"`
+	Summary     FirmwareComplianceSummary  `json:"summary"`
+	Versions    []FirmwareVersionCount     `json:"versions"`
+	Devices     []FirmwareComplianceDevice `json:"devices"`
+}
+
+// WithCompliance подключает политики прошивки и отчёт о соответствии парка.
+func (s *Server) WithCompliance(svc *compliance.Service) *Server {
+	s.compliance = svc
+	return s
+}
+
+func firmwarePolicyResponse(p registry.FirmwarePolicy) FirmwarePolicyResponse {
+	return FirmwarePolicyResponse{
+		Name:          p.Name,
+		Group:         p.Group,
+		MinVersion:    p.MinVersion,
+		KnownBad:      p.KnownBad,
+		TargetVersion: p.TargetVersion,
+		AutoEnroll:    p.AutoEnroll,
+		UpdatedBy:     p.UpdatedBy,
+		CreatedAt:     p.CreatedMillis,
+		UpdatedAt:     p.UpdatedMillis,
+	}
+}
+
+func (req FirmwarePolicyRequest) policy() compliance.PolicyRequest {
+	return compliance.PolicyRequest{
+		Group:         req.Group,
+		MinVersion:    req.MinVersion,
+		KnownBad:      req.KnownBad,
+		TargetVersion: req.TargetVersion,
+		AutoEnroll:    req.AutoEnroll,
+	}
+}
+
+// handleFirmwarePolicies: GET /api/v1/firmware-policies, POST /api/v1/firmware-policies
+func (s *Server) handleFirmwarePolicies(w http.ResponseWriter, r *http.Request) {
+	if s.compliance == nil {
+		http.Error(w, "firmware compliance unavailable", http.StatusNotImplemented)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		list, err := s.compliance.ListPolicies(r.Context())
+		if err != nil {
+			log.Printf("[HTTP] list firmware policies failed: %v", err)
+			http.Error(w, "failed to list firmware policies", http.StatusInternalServerError)
+			return
+		}
+		response := make([]FirmwarePolicyResponse, 0, len(list))
+		for _, p := range list {
+			response = append(response, firmwarePolicyResponse(p))
+		}
+		writeJSON(w, http.StatusOK, response)
+
+	case http.MethodPost:
+		var req FirmwarePolicyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		existing, err := s.compliance.GetPolicy(r.Context(), strings.TrimSpace(req.Name))
+		if err != nil && !errors.Is(err, compliance.ErrNotFound) {
+			log.Printf("[HTTP] get firmware policy failed: %v", err)
+			http.Error(w, "failed to get firmware policy", http.StatusInternalServerError)
+			return
+		}
+		if existing != nil {
+			http.Error(w, "firmware policy already exists", http.StatusConflict)
+			return
+		}
+		actor, _ := auth.UserIDFromContext(r.Context())
+		p, _, err := s.compliance.PutPolicy(r.Context(), req.Name, req.policy(), actor)
+		if err != nil {
+			writeFirmwarePolicyError(w, err)
+			return
+		}
+		log.Printf("[HTTP] fw_policy_created name=%s group=%s by=%s", p.Name, p.Group, actor)
+		writeJSON(w, http.StatusCreated, firmwarePolicyResponse(*p))
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleFirmwarePolicy:
+//
+//	GET    /api/v1/firmware-policies/{name}
+//	PUT    /api/v1/firmware-policies/{name} — создать или заменить
+//	DELETE /api/v1/firmware-policies/{name}
+func (s *Server) handleFirmwarePolicy(w http.ResponseWriter, r *http.Request) {
+	if s.compliance == nil {
+		http.Error(w, "firmware compliance unavailable", http.StatusNotImplemented)
+		return
+	}
+	name := strings.TrimSpace(strings.TrimPrefix(r.URL.Path, "/api/v1/firmware-policies/"))
+	if name == "" || strings.Contains(name, "/") {
+		http.Error(w, "bad path", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		p, err := s.compliance.GetPolicy(r.Context(), name)
+		if err != nil {
+			writeFirmwarePolicyError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, firmwarePolicyResponse(*p))
+
+	case http.MethodPut:
+		var req FirmwarePolicyRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		actor, _ := auth.UserIDFromContext(r.Context())
+		p, created, err := s.compliance.PutPolicy(r.Context(), name, req.policy(), actor)
+		if err != nil {
+			writeFirmwarePolicyError(w, err)
+			return
+		}
+		status := http.StatusOK
+		if created {
+			status = http.StatusCreated
+		}
+		log.Printf("[HTTP] fw_policy_saved name=%s group=%s created=%t by=%s", p.Name, p.Group, created, actor)
+		writeJSON(w, status, firmwarePolicyResponse(*p))
+
+	case http.MethodDelete:
+		if err := s.compliance.DeletePolicy(r.Context(), name); err != nil {
+			writeFirmwarePolicyError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleFirmwareCompliance: GET /api/v1/firmware-compliance?group=&all=1
+// По умолчанию в devices — только несоответствующие устройства; all=1 — все.
+func (s *Server) handleFirmwareCompliance(w http.ResponseWriter, r *http.Request) {
+	if s.compliance == nil {
+		http.Error(w, "firmware compliance unavailable", http.StatusNotImplemented)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	group := strings.TrimSpace(q.Get("group"))
+	all := q.Get("all") == "1" || q.Get("all") == "true"
+
+	rep, err := s.compliance.Report(r.Context(), group, all)
+	if err != nil {
+		log.Printf("[HTTP] firmware compliance report failed: %v", err)
+		http.Error(w, "failed to build compliance report", http.StatusInternalServerError)
+		return
+	}
+
+	resp := FirmwareComplianceResponse{
+		GeneratedAt: rep.GeneratedMillis,
+		Group:       group,
+		Summary: FirmwareComplianceSummary{
+			Total:        rep.Summary.Total,
+			Compliant:    rep.Summary.Compliant,
+			NonCompliant: rep.Summary.NonCompliant,
+			Unknown:      rep.Summary.Unknown,
+			OnTarget:     rep.Summary.OnTarget,
+		},
+		Versions: make([]FirmwareVersionCount, 0, len(rep.Versions)),
+		Devices:  make([]FirmwareComplianceDevice, 0, len(rep.Devices)),
+	}
+	for _, v := range rep.Versions {
+		resp.Versions = append(resp.Versions, FirmwareVersionCount{Version: v.Version, Devices: v.Devices, NonCompliant: v.NonCompliant})
+	}
+	for _, d := range rep.Devices {
+		resp.Devices = append(resp.Devices, FirmwareComplianceDevice{
+			DeviceID:      d.DeviceID,
+			Status:        d.Status,
+			FW:            d.FW,
+			Reasons:       d.Reasons,
+			Policies:      d.Policies,
+			TargetVersion: d.Target,
+			OnTarget:      d.OnTarget,
+			Since:         d.SinceMillis,
+			LastSeenAt:    d.LastSeenMillis,
+		})
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func writeFirmwarePolicyError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, compliance.ErrNotFound):
+		http.Error(w, "firmware policy not found", http.StatusNotFound)
+	case errors.Is(err, compliance.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("[HTTP] firmware policy change failed: %v", err)
+		http.Error(w, "failed to update firmware policy", http.StatusInternalServerError)
+	}
+}
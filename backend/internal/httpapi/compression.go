@@ -0,0 +1,145 @@
+package httpapi
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/perm1ss10n/vexora/backend/internal/codec"
+	"github.com/perm1ss10n/vexora/backend/internal/mqtt"
+)
+
+type CompressionStatsResponse struct {
+	DeviceID   string  `json:"deviceId"`
+	Messages   uint64  `json:"messages"`
+	Compressed uint64  `json:"compressed"`
+	WireBytes  uint64  `json:"wireBytes"`
+	RawBytes   uint64  `json:"rawBytes"`
+	Ratio      float64 `json:"ratio"`
+	LastAlg    string  `json:"lastAlg,omitempty"`
+	LastDictID uint16  `json:"lastDictId,omitempty"`
+	UpdatedAt  int64   `json:"updatedAt,omitempty"`
+}
+
+type CompressionStatsListResponse struct {
+	Items []CompressionStatsResponse `json:"items"`
+}
+
+type CompressionDictionaryResponse struct {
+	ID     uint16 `json:"id"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+	URL    string `json:"url"`
+}
+
+type CompressionDictionaryListResponse struct {
+	Items []CompressionDictionaryResponse `json:"items"`
+}
+
+// WithCompression подключает раздачу общих словарей; статистика сжатия берётся из диспетчера WithDelivery.
+func (s *Server) WithCompression(dicts *codec.Dictionaries) *Server {
+	s.dicts = dicts
+	return s
+}
+
+func compressionStatsResponse(st mqtt.CompressionStats) CompressionStatsResponse {
+	return CompressionStatsResponse{
+		DeviceID:   st.DeviceID,
+		Messages:   st.Messages,
+		Compressed: st.Compressed,
+		WireBytes:  st.WireBytes,
+		RawBytes:   st.RawBytes,
+		Ratio:      st.Ratio,
+		LastAlg:    st.LastAlg,
+		LastDictID: st.LastDictID,
+		UpdatedAt:  st.UpdatedMs,
+	}
+}
+
+// handleCompressionStats: GET /api/v1/compression/stats — устройства со сжатыми сообщениями, лучшее сжатие первым.
+func (s *Server) handleCompressionStats(w http.ResponseWriter, r *http.Request) {
+	if s.delivery == nil {
+		http.Error(w, "compression stats unavailable", http.StatusNotImplemented)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	items := []CompressionStatsResponse{}
+	for _, st := range s.delivery.CompressionAll() {
+		items = append(items, compressionStatsResponse(st))
+	}
+	writeJSON(w, http.StatusOK, CompressionStatsListResponse{Items: items})
+}
+
+// handleDeviceCompression: GET /api/v1/devices/{id}/compression
+func (s *Server) handleDeviceCompression(w http.ResponseWriter, r *http.Request) {
+	if s.delivery == nil {
+		http.Error(w, "compression stats unavailable", http.StatusNotImplemented)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/devices/")
+	deviceID := strings.TrimSpace(strings.TrimSuffix(path, "/compression"))
+	if deviceID == "" || strings.Contains(deviceID, "/") {
+		http.Error(w, "bad path", http.StatusBadRequest)
+		return
+	}
+	st, ok := s.delivery.Compression(deviceID)
+	if !ok {
+		http.Error(w, "no messages from device", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, compressionStatsResponse(st))
+}
+
+// handleCompressionDictionaries: GET /api/v1/compression/dictionaries — без токена, как signing-key:
+// словарь вшивается в прошивку или скачивается устройством.
+func (s *Server) handleCompressionDictionaries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	items := []CompressionDictionaryResponse{}
+	for _, d := range s.dicts.List() {
+		items = append(items, CompressionDictionaryResponse{
+			ID:     d.ID,
+			Size:   d.Size,
+			SHA256: d.SHA256,
+			URL:    "/api/v1/compression/dictionaries/" + strconv.Itoa(int(d.ID)),
+		})
+	}
+	writeJSON(w, http.StatusOK, CompressionDictionaryListResponse{Items: items})
+}
+
+// handleCompressionDictionary: GET /api/v1/compression/dictionaries/{id} — сам словарь (octet-stream).
+func (s *Server) handleCompressionDictionary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := strconv.ParseUint(strings.TrimPrefix(r.URL.Path, "/api/v1/compression/dictionaries/"), 10, 16)
+	if err != nil {
+		http.Error(w, "bad dictionary id", http.StatusBadRequest)
+		return
+	}
+	d, ok := s.dicts.Get(uint16(id))
+	if !ok {
+		http.Error(w, "dictionary not found", http.StatusNotFound)
+		return
+	}
+	etag := `"` + d.SHA256 + `"`
+	w.Header().Set("ETag", etag)
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(d.Size))
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(d.Data)
+}
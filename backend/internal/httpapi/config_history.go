@@ -0,0 +1,248 @@
+package httpapi
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/perm1ss10n/vexora/backend/internal/auth"
+	"github.com/perm1ss10n/vexora/backend/internal/commands"
+	"github.com/perm1ss10n/vexora/backend/internal/configs"
+	"github.com/perm1ss10n/vexora/backend/internal/oplock"
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+	"github.com/perm1ss10n/vexora/backend/internal/secrets"
+)
+
+type ConfigOutcomeResponse struct {
+	Status string  `json:"status"`
+	Ok     *bool   `json:"ok"`
+	Error  *string `json:"error"`
+	At     int64   `json:"at"`
+}
+
+type ConfigVersionResponse struct {
+	Version     int64                  `json:"version"`
+	CreatedBy   string                 `json:"createdBy,omitempty"`
+	CreatedAt   int64                  `json:"createdAt"`
+	PublishedAt *int64                 `json:"publishedAt"`
+	RollbackOf  *int64                 `json:"rollbackOf,omitempty"`
+	Desired     bool                   `json:"desired"`
+	Active      bool                   `json:"active"`
+	Outcome     *ConfigOutcomeResponse `json:"outcome"`
+	Doc         map[string]any         `json:"doc,omitempty"`
+	Secrets     []secrets.Field        `json:"secrets,omitempty"`
+}
+
+type ConfigVersionsResponse struct {
+	DeviceID string                  `json:"deviceId"`
+	Items    []ConfigVersionResponse `json:"items"`
+}
+
+type ConfigDiffResponse struct {
+	DeviceID string           `json:"deviceId"`
+	From     int64            `json:"from"`
+	To       int64            `json:"to"`
+	Changes  []configs.Change `json:"changes"`
+}
+
+type RollbackConfigResponse struct {
+	PutConfigResponse
+	RollbackOf int64 `json:"rollbackOf"`
+}
+
+func configVersionResponse(info configs.VersionInfo) ConfigVersionResponse {
+	resp := ConfigVersionResponse{
+		Version:     info.Record.Version,
+		CreatedBy:   info.Record.CreatedBy,
+		CreatedAt:   info.Record.CreatedMillis,
+		PublishedAt: nullMillis(info.Record.PublishedMillis),
+		RollbackOf:  nullMillis(info.Record.RollbackOf),
+		Desired:     info.Desired,
+		Active:      info.Active,
+	}
+	if o := info.Outcome; o != nil {
+		resp.Outcome = configOutcomeResponse(*o)
+	}
+	return resp
+}
+
+func configOutcomeResponse(o registry.ConfigOutcome) *ConfigOutcomeResponse {
+	out := &ConfigOutcomeResponse{Status: o.Status, At: o.ReportedMillis}
+	if o.Ok.Valid {
+		ok := o.Ok.Bool
+		out.Ok = &ok
+	}
+	if o.Error.Valid {
+		msg := o.Error.String
+		out.Error = &msg
+	}
+	return out
+}
+
+// handleDeviceConfigVersions:
+//
+//	GET /api/v1/devices/{id}/config/versions?limit=N
+//	GET /api/v1/devices/{id}/config/versions/{version} — с документом
+func (s *Server) handleDeviceConfigVersions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/devices/")
+	parts := strings.Split(path, "/")
+	if len(parts) < 3 || len(parts) > 4 || parts[1] != "config" || parts[2] != "versions" {
+		http.Error(w, "bad path", http.StatusBadRequest)
+		return
+	}
+	deviceID, ok := s.configDevice(w, r, parts[0])
+	if !ok {
+		return
+	}
+
+	if len(parts) == 4 {
+		version, err := strconv.ParseInt(parts[3], 10, 64)
+		if err != nil || version <= 0 {
+			http.Error(w, "invalid version", http.StatusBadRequest)
+			return
+		}
+		info, err := s.configs.VersionDetail(r.Context(), deviceID, version)
+		if err != nil {
+			if errors.Is(err, configs.ErrVersionNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			log.Printf("[HTTP] get config version failed: %v", err)
+			http.Error(w, "failed to get config version", http.StatusInternalServerError)
+			return
+		}
+		resp := configVersionResponse(*info)
+		resp.Doc, resp.Secrets = s.configs.Redact(info.Record.Doc)
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	limit := 50
+	if v := strings.TrimSpace(r.URL.Query().Get("limit")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	infos, err := s.configs.Versions(r.Context(), deviceID, limit)
+	if err != nil {
+		log.Printf("[HTTP] list config versions failed: %v", err)
+		http.Error(w, "failed to list config versions", http.StatusInternalServerError)
+		return
+	}
+	items := make([]ConfigVersionResponse, 0, len(infos))
+	for _, info := range infos {
+		items = append(items, configVersionResponse(info))
+	}
+	writeJSON(w, http.StatusOK, ConfigVersionsResponse{DeviceID: deviceID, Items: items})
+}
+
+// handleDeviceConfigDiff: GET /api/v1/devices/{id}/config/diff?from=N&to=M (to по умолчанию — desired)
+func (s *Server) handleDeviceConfigDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	deviceID, ok := s.configSubresource(w, r, "diff")
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	from, err := strconv.ParseInt(strings.TrimSpace(query.Get("from")), 10, 64)
+	if err != nil || from <= 0 {
+		http.Error(w, "from is required", http.StatusBadRequest)
+		return
+	}
+	var to int64
+	if v := strings.TrimSpace(query.Get("to")); v != "" {
+		to, err = strconv.ParseInt(v, 10, 64)
+		if err != nil || to <= 0 {
+			http.Error(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+	} else {
+		desired, err := s.configs.Desired(r.Context(), deviceID)
+		if err != nil {
+			log.Printf("[HTTP] get desired config failed: %v", err)
+			http.Error(w, "failed to get config", http.StatusInternalServerError)
+			return
+		}
+		if desired == nil {
+			http.Error(w, "config version not found", http.StatusNotFound)
+			return
+		}
+		to = desired.Version
+	}
+
+	changes, err := s.configs.DiffVersions(r.Context(), deviceID, from, to)
+	if err != nil {
+		if errors.Is(err, configs.ErrVersionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("[HTTP] config diff failed: %v", err)
+		http.Error(w, "failed to diff configs", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, ConfigDiffResponse{DeviceID: deviceID, From: from, To: to, Changes: s.configs.RedactChanges(changes)})
+}
+
+// handleDeviceConfigRollback: POST /api/v1/devices/{id}/config/rollback?to=N
+func (s *Server) handleDeviceConfigRollback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	deviceID, ok := s.configSubresource(w, r, "rollback")
+	if !ok {
+		return
+	}
+	to, err := strconv.ParseInt(strings.TrimSpace(r.URL.Query().Get("to")), 10, 64)
+	if err != nil || to <= 0 {
+		http.Error(w, "to is required", http.StatusBadRequest)
+		return
+	}
+	actor, _ := auth.UserIDFromContext(r.Context())
+
+	rec, err := s.configs.Rollback(r.Context(), deviceID, to, actor)
+	published := err == nil
+	if err != nil {
+		switch {
+		case errors.Is(err, configs.ErrVersionNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, configs.ErrInvalidConfig):
+			writeConfigError(w, err)
+			return
+		case rec == nil && writeLockConflict(w, err):
+			return
+		case (errors.Is(err, commands.ErrPublish) || errors.Is(err, oplock.ErrLocked)) && rec != nil:
+			// версия выпущена, доставка не удалась или устройство занято — не 5xx (доставит reconciler)
+		default:
+			log.Printf("[HTTP] config rollback failed: %v", err)
+			http.Error(w, "failed to roll back config", http.StatusInternalServerError)
+			return
+		}
+	}
+	log.Printf("[HTTP] cfg_rollback deviceId=%s to=%d cfgVersion=%d published=%v", deviceID, to, rec.Version, published)
+
+	view, err := s.deviceConfigView(r.Context(), deviceID)
+	if err != nil {
+		log.Printf("[HTTP] get device config failed: %v", err)
+		http.Error(w, "failed to get config", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, RollbackConfigResponse{
+		PutConfigResponse: PutConfigResponse{Config: *view, Published: published},
+		RollbackOf:        to,
+	})
+}
@@ -0,0 +1,179 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/perm1ss10n/vexora/backend/internal/auth"
+	"github.com/perm1ss10n/vexora/backend/internal/configs"
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+)
+
+type RevealSecretsRequest struct {
+	Version int64  `json:"version,omitempty"` // 0 — desired
+	Reason  string `json:"reason"`
+}
+
+type RevealSecretsResponse struct {
+	DeviceID string            `json:"deviceId"`
+	Version  int64             `json:"version"`
+	Secrets  map[string]string `json:"secrets"`
+}
+
+type RotateSecretKeyResponse struct {
+	KeyID    string `json:"keyId"`
+	Resealed int    `json:"resealed"`
+}
+
+type SecretAuditResponse struct {
+	Items []registry.SecretAuditRecord `json:"items"`
+}
+
+// secretAdminsFromEnv — CFG_SECRET_ADMINS: email или id пользователей через запятую.
+// Пустой список — reveal и ротация запрещены всем.
+func secretAdminsFromEnv() map[string]bool {
+	out := map[string]bool{}
+	for _, v := range strings.Split(os.Getenv("CFG_SECRET_ADMINS"), ",") {
+		if v = strings.TrimSpace(strings.ToLower(v)); v != "" {
+			out[v] = true
+		}
+	}
+	return out
+}
+
+// secretAdmin — текущий пользователь и его право на доступ к секретам.
+func (s *Server) secretAdmin(r *http.Request) (string, bool) {
+	userID, _ := auth.UserIDFromContext(r.Context())
+	if userID == "" {
+		return "", false
+	}
+	if s.secretAdmins[strings.ToLower(userID)] {
+		return userID, true
+	}
+	if s.auth == nil {
+		return userID, false
+	}
+	user, err := s.auth.GetUserByID(r.Context(), userID)
+	if err != nil {
+		return userID, false
+	}
+	return userID, s.secretAdmins[strings.ToLower(user.Email)]
+}
+
+// handleDeviceConfigSecrets: POST /api/v1/devices/{id}/config/secrets {version?, reason} — открытые значения, с записью в журнал
+func (s *Server) handleDeviceConfigSecrets(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	deviceID, ok := s.configSubresource(w, r, "secrets")
+	if !ok {
+		return
+	}
+
+	var req RevealSecretsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid json", http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+
+	actor, allowed := s.secretAdmin(r)
+	if !allowed {
+		s.configs.AuditDenied(r.Context(), deviceID, actor, req.Reason)
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if req.Reason == "" {
+		http.Error(w, "reason is required", http.StatusBadRequest)
+		return
+	}
+	if req.Version < 0 {
+		http.Error(w, "invalid version", http.StatusBadRequest)
+		return
+	}
+
+	rec, values, err := s.configs.RevealSecrets(r.Context(), deviceID, req.Version, actor, req.Reason)
+	if err != nil {
+		if errors.Is(err, configs.ErrVersionNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		log.Printf("[HTTP] reveal config secrets failed: %v", err)
+		http.Error(w, "failed to reveal secrets", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, RevealSecretsResponse{DeviceID: deviceID, Version: rec.Version, Secrets: values})
+}
+
+// handleConfigSecretsRotate: POST /api/v1/config-secrets/rotate — новый ключ и перешифрование всех секретов
+func (s *Server) handleConfigSecretsRotate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.configs == nil {
+		http.Error(w, "config store unavailable", http.StatusNotImplemented)
+		return
+	}
+	actor, allowed := s.secretAdmin(r)
+	if !allowed {
+		s.configs.AuditDenied(r.Context(), "", actor, "rotate")
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	kid, n, err := s.configs.RotateSecretKey(r.Context(), actor)
+	if err != nil {
+		if errors.Is(err, configs.ErrSecretsDisabled) {
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+			return
+		}
+		log.Printf("[HTTP] rotate config secrets key failed: %v", err)
+		http.Error(w, "failed to rotate key", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, RotateSecretKeyResponse{KeyID: kid, Resealed: n})
+}
+
+// handleConfigSecretsAudit: GET /api/v1/config-secrets/audit?deviceId=&limit=N
+func (s *Server) handleConfigSecretsAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.configs == nil {
+		http.Error(w, "config store unavailable", http.StatusNotImplemented)
+		return
+	}
+	if _, allowed := s.secretAdmin(r); !allowed {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := 50
+	if v := strings.TrimSpace(query.Get("limit")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	items, err := s.configs.SecretAudit(r.Context(), strings.TrimSpace(query.Get("deviceId")), limit)
+	if err != nil {
+		log.Printf("[HTTP] list secret audit failed: %v", err)
+		http.Error(w, "failed to list audit", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, SecretAuditResponse{Items: items})
+}
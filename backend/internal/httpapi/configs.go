@@ -0,0 +1,352 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/perm1ss10n/vexora/backend/internal/auth"
+	"github.com/perm1ss10n/vexora/backend/internal/commands"
+	"github.com/perm1ss10n/vexora/backend/internal/configs"
+	"github.com/perm1ss10n/vexora/backend/internal/oplock"
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+	"github.com/perm1ss10n/vexora/backend/internal/secrets"
+	"github.com/perm1ss10n/vexora/backend/internal/validate"
+)
+
+// DeviceConfigResponse — desired (что backend хочет) vs reported (что сообщило устройство).
+type DeviceConfigResponse struct {
+	DesiredVersion *int64          `json:"desiredVersion"`
+	Desired        map[string]any  `json:"desired,omitempty"`
+	DesiredSecrets []secrets.Field `json:"desiredSecrets,omitempty"` // set/unset секретных полей desired
+	DesiredAt      *int64          `json:"desiredAt,omitempty"`
+	DesiredBy      string          `json:"desiredBy,omitempty"`
+	PublishedAt    *int64          `json:"publishedAt,omitempty"`
+
+	ReportedActiveVersion  *int64 `json:"reportedActiveVersion"`
+	ReportedPendingVersion *int64 `json:"reportedPendingVersion"`
+	ReportedAt             *int64 `json:"reportedAt,omitempty"`
+
+	// Последний отчёт cfg/status
+	ReportedStatus string            `json:"reportedStatus,omitempty"`
+	LastApply      *CfgApplyResponse `json:"lastApply,omitempty"`
+
+	InSync bool `json:"inSync"`
+}
+
+type CfgApplyResponse struct {
+	CfgVersion int64   `json:"cfgVersion"`
+	Ok         bool    `json:"ok"`
+	Error      *string `json:"error"`
+	At         *int64  `json:"at,omitempty"`
+}
+
+type CfgStatusEntry struct {
+	Ts             int64   `json:"ts"`
+	Status         string  `json:"status"`
+	ActiveVersion  *int64  `json:"activeVersion"`
+	PendingVersion *int64  `json:"pendingVersion"`
+	ApplyVersion   *int64  `json:"applyVersion,omitempty"`
+	ApplyOk        *bool   `json:"applyOk,omitempty"`
+	ApplyError     *string `json:"applyError,omitempty"`
+}
+
+type CfgStatusHistoryResponse struct {
+	DeviceID string           `json:"deviceId"`
+	Items    []CfgStatusEntry `json:"items"`
+}
+
+// ConfigErrorResponse — 400 на запись невалидной конфигурации, ошибки по полям.
+type ConfigErrorResponse struct {
+	Error  string                `json:"error"`
+	Fields validate.ConfigErrors `json:"fields,omitempty"`
+}
+
+type PutConfigResponse struct {
+	Config    DeviceConfigResponse `json:"config"`
+	Published bool                 `json:"published"`
+}
+
+func writeConfigError(w http.ResponseWriter, err error) {
+	response := ConfigErrorResponse{Error: err.Error()}
+	var fields validate.ConfigErrors
+	if errors.As(err, &fields) {
+		response.Error = configs.ErrInvalidConfig.Error()
+		response.Fields = fields
+	}
+	writeJSON(w, http.StatusBadRequest, response)
+}
+
+// WithConfigs подключает desired-конфигурации (device detail + /config).
+func (s *Server) WithConfigs(svc *configs.Service) *Server {
+	s.configs = svc
+	return s
+}
+
+func (s *Server) deviceConfigView(ctx context.Context, deviceID string) (*DeviceConfigResponse, error) {
+	if s.configs == nil {
+		return nil, nil
+	}
+	desired, err := s.configs.Desired(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	reported, err := s.configs.Reported(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	view := &DeviceConfigResponse{}
+	if desired != nil {
+		v, at := desired.Version, desired.CreatedMillis
+		view.DesiredVersion = &v
+		view.Desired, view.DesiredSecrets = s.configs.Redact(desired.Doc)
+		view.DesiredAt = &at
+		view.DesiredBy = desired.CreatedBy
+		view.PublishedAt = nullMillis(desired.PublishedMillis)
+	}
+	if reported != nil {
+		at := reported.ReportedMillis
+		view.ReportedActiveVersion = nullMillis(reported.ActiveVersion)
+		view.ReportedPendingVersion = nullMillis(reported.PendingVersion)
+		view.ReportedAt = &at
+		if reported.CfgStatus.Valid {
+			view.ReportedStatus = reported.CfgStatus.String
+		}
+		if reported.LastApplyVersion.Valid && reported.LastApplyOk.Valid {
+			apply := &CfgApplyResponse{
+				CfgVersion: reported.LastApplyVersion.Int64,
+				Ok:         reported.LastApplyOk.Bool,
+				At:         nullMillis(reported.LastApplyMillis),
+			}
+			if reported.LastApplyError.Valid {
+				apply.Error = &reported.LastApplyError.String
+			}
+			view.LastApply = apply
+		}
+	}
+	view.InSync = view.DesiredVersion != nil && view.ReportedActiveVersion != nil &&
+		*view.DesiredVersion == *view.ReportedActiveVersion
+	return view, nil
+}
+
+// cfgStatusOf — сводный статус для DeviceSettingsResponse.CfgStatus.
+// Неудача применения (rejected/rolled_back) показывается, только если относится к текущей desired-версии.
+func cfgStatusOf(view *DeviceConfigResponse) string {
+	switch {
+	case view == nil:
+		return "unknown"
+	case view.DesiredVersion == nil:
+		if view.ReportedStatus != "" {
+			return view.ReportedStatus
+		}
+		return "unknown"
+	case view.InSync:
+		return registry.CfgStatusApplied
+	case view.LastApply != nil && !view.LastApply.Ok && view.LastApply.CfgVersion == *view.DesiredVersion &&
+		(view.ReportedStatus == registry.CfgStatusRejected || view.ReportedStatus == registry.CfgStatusRolledBack):
+		return view.ReportedStatus
+	default:
+		return registry.CfgStatusPending
+	}
+}
+
+// telemetryIntervalMs — telemetry.intervalSec из документа конфигурации, в мс.
+func telemetryIntervalMs(doc map[string]any) (int, bool) {
+	telemetry, ok := doc["telemetry"].(map[string]any)
+	if !ok {
+		return 0, false
+	}
+	sec, ok := telemetry["intervalSec"].(float64)
+	if !ok || sec <= 0 {
+		return 0, false
+	}
+	return int(sec * 1000), true
+}
+
+// handleDeviceConfig: GET/PUT /api/v1/devices/{id}/config
+func (s *Server) handleDeviceConfig(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/devices/")
+	parts := strings.Split(path, "/")
+	if len(parts) != 2 || parts[1] != "config" {
+		http.Error(w, "bad path", http.StatusBadRequest)
+		return
+	}
+	deviceID := strings.TrimSpace(parts[0])
+	if deviceID == "" {
+		http.Error(w, "bad path", http.StatusBadRequest)
+		return
+	}
+	if s.configs == nil {
+		http.Error(w, "config store unavailable", http.StatusNotImplemented)
+		return
+	}
+
+	device, err := s.reg.GetDevice(r.Context(), deviceID)
+	if err != nil {
+		log.Printf("[HTTP] get device failed: %v", err)
+		http.Error(w, "failed to get device", http.StatusInternalServerError)
+		return
+	}
+	if device == nil {
+		http.Error(w, "device not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		view, err := s.deviceConfigView(r.Context(), deviceID)
+		if err != nil {
+			log.Printf("[HTTP] get device config failed: %v", err)
+			http.Error(w, "failed to get config", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, view)
+
+	case http.MethodPut:
+		var doc map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&doc); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		actor, _ := auth.UserIDFromContext(r.Context())
+
+		rec, err := s.configs.Put(r.Context(), deviceID, doc, actor)
+		published := err == nil
+		if err != nil {
+			switch {
+			case errors.Is(err, configs.ErrInvalidConfig):
+				writeConfigError(w, err)
+				return
+			case rec == nil && writeLockConflict(w, err):
+				return
+			case (errors.Is(err, commands.ErrPublish) || errors.Is(err, oplock.ErrLocked)) && rec != nil:
+				// сохранено как desired, доставка не удалась или устройство занято — не 5xx (доставит reconciler)
+			default:
+				log.Printf("[HTTP] put device config failed: %v", err)
+				http.Error(w, "failed to store config", http.StatusInternalServerError)
+				return
+			}
+		}
+		log.Printf("[HTTP] cfg_put deviceId=%s cfgVersion=%d published=%v", deviceID, rec.Version, published)
+
+		view, err := s.deviceConfigView(r.Context(), deviceID)
+		if err != nil {
+			log.Printf("[HTTP] get device config failed: %v", err)
+			http.Error(w, "failed to get config", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, PutConfigResponse{Config: *view, Published: published})
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleDeviceCfgStatus: GET /api/v1/devices/{id}/config/status?limit=N — история отчётов cfg/status
+func (s *Server) handleDeviceCfgStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/devices/")
+	parts := strings.Split(path, "/")
+	if len(parts) != 3 || parts[1] != "config" || parts[2] != "status" {
+		http.Error(w, "bad path", http.StatusBadRequest)
+		return
+	}
+	deviceID := strings.TrimSpace(parts[0])
+	if deviceID == "" {
+		http.Error(w, "bad path", http.StatusBadRequest)
+		return
+	}
+	if s.configs == nil {
+		http.Error(w, "config store unavailable", http.StatusNotImplemented)
+		return
+	}
+
+	limit := 50
+	if v := strings.TrimSpace(r.URL.Query().Get("limit")); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > 1000 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	device, err := s.reg.GetDevice(r.Context(), deviceID)
+	if err != nil {
+		log.Printf("[HTTP] get device failed: %v", err)
+		http.Error(w, "failed to get device", http.StatusInternalServerError)
+		return
+	}
+	if device == nil {
+		http.Error(w, "device not found", http.StatusNotFound)
+		return
+	}
+
+	history, err := s.configs.StatusHistory(r.Context(), deviceID, limit)
+	if err != nil {
+		log.Printf("[HTTP] list cfg status history failed: %v", err)
+		http.Error(w, "failed to list cfg status", http.StatusInternalServerError)
+		return
+	}
+
+	items := make([]CfgStatusEntry, 0, len(history))
+	for _, h := range history {
+		items = append(items, CfgStatusEntry{
+			Ts:             h.TsMillis,
+			Status:         h.Status,
+			ActiveVersion:  h.ActiveVersion,
+			PendingVersion: h.PendingVersion,
+			ApplyVersion:   h.ApplyVersion,
+			ApplyOk:        h.ApplyOk,
+			ApplyError:     h.ApplyError,
+		})
+	}
+	writeJSON(w, http.StatusOK, CfgStatusHistoryResponse{DeviceID: deviceID, Items: items})
+}
+
+// handleConfigDrift: GET /api/v1/config-drift?state=in_sync|pending|drifting|offline|stuck
+func (s *Server) handleConfigDrift(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.configs == nil {
+		http.Error(w, "config store unavailable", http.StatusNotImplemented)
+		return
+	}
+
+	state := strings.TrimSpace(r.URL.Query().Get("state"))
+	switch state {
+	case "", configs.DriftInSync, configs.DriftPending, configs.DriftDrifting, configs.DriftOffline, configs.DriftStuck:
+	default:
+		http.Error(w, "invalid state", http.StatusBadRequest)
+		return
+	}
+
+	report, err := s.configs.DriftReport(r.Context(), state)
+	if err != nil {
+		log.Printf("[HTTP] config drift report failed: %v", err)
+		http.Error(w, "failed to build drift report", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleConfigSchema: GET /api/v1/config-schema — JSON Schema конфигурации устройства
+func (s *Server) handleConfigSchema(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(validate.ConfigSchema)
+}
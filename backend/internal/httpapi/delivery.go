@@ -0,0 +1,96 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/perm1ss10n/vexora/backend/internal/mqtt"
+)
+
+type TelemetryDeliveryResponse struct {
+	DeviceID     string  `json:"deviceId"`
+	LastSeq      int64   `json:"lastSeq"`
+	Received     uint64  `json:"received"`
+	Duplicates   uint64  `json:"duplicates"`
+	Buffered     uint64  `json:"buffered"`
+	Gaps         uint64  `json:"gaps"`
+	Missing      uint64  `json:"missing"`
+	Recovered    uint64  `json:"recovered"`
+	Resets       uint64  `json:"resets"`
+	Completeness float64 `json:"completeness"`
+	LastGapAt    int64   `json:"lastGapAt,omitempty"`
+	UpdatedAt    int64   `json:"updatedAt"`
+}
+
+type TelemetryDeliveryListResponse struct {
+	Items []TelemetryDeliveryResponse `json:"items"`
+}
+
+// WithDelivery подключает статистику диспетчера MQTT: полноту доставки телеметрии (seq) и сжатие payload.
+func (s *Server) WithDelivery(d *mqtt.Dispatcher) *Server {
+	s.delivery = d
+	return s
+}
+
+func telemetryDeliveryResponse(st mqtt.DeliveryStats) TelemetryDeliveryResponse {
+	return TelemetryDeliveryResponse{
+		DeviceID:     st.DeviceID,
+		LastSeq:      st.LastSeq,
+		Received:     st.Received,
+		Duplicates:   st.Duplicates,
+		Buffered:     st.Buffered,
+		Gaps:         st.Gaps,
+		Missing:      st.Missing,
+		Recovered:    st.Recovered,
+		Resets:       st.Resets,
+		Completeness: st.Completeness,
+		LastGapAt:    st.LastGapMs,
+		UpdatedAt:    st.UpdatedMs,
+	}
+}
+
+// handleTelemetryDelivery: GET /api/v1/telemetry-delivery?incomplete=1 — устройства с seq, худшие первыми.
+func (s *Server) handleTelemetryDelivery(w http.ResponseWriter, r *http.Request) {
+	if s.delivery == nil {
+		http.Error(w, "telemetry delivery stats unavailable", http.StatusNotImplemented)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	incomplete := r.URL.Query().Get("incomplete") == "1"
+
+	items := []TelemetryDeliveryResponse{}
+	for _, st := range s.delivery.DeliveryAll() {
+		if incomplete && st.Missing == 0 {
+			continue
+		}
+		items = append(items, telemetryDeliveryResponse(st))
+	}
+	writeJSON(w, http.StatusOK, TelemetryDeliveryListResponse{Items: items})
+}
+
+// handleDeviceTelemetryDelivery: GET /api/v1/devices/{id}/telemetry/delivery
+func (s *Server) handleDeviceTelemetryDelivery(w http.ResponseWriter, r *http.Request) {
+	if s.delivery == nil {
+		http.Error(w, "telemetry delivery stats unavailable", http.StatusNotImplemented)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/devices/")
+	deviceID := strings.TrimSpace(strings.TrimSuffix(path, "/telemetry/delivery"))
+	if deviceID == "" || strings.Contains(deviceID, "/") {
+		http.Error(w, "bad path", http.StatusBadRequest)
+		return
+	}
+	st, ok := s.delivery.Delivery(deviceID)
+	if !ok {
+		http.Error(w, "no sequenced telemetry for device", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, telemetryDeliveryResponse(st))
+}
@@ -0,0 +1,455 @@
+package httpapi
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/perm1ss10n/vexora/backend/internal/auth"
+	"github.com/perm1ss10n/vexora/backend/internal/firmware"
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+)
+
+type FirmwareResponse struct {
+	ID               string  `json:"id"`
+	Version          string  `json:"version"`
+	HWModel          string  `json:"hwModel"`
+	MinHWRev         int     `json:"minHwRev"`
+	Notes            string  `json:"notes"`
+	SHA256           string  `json:"sha256"`
+	Size             int64   `json:"size"`
+	UploadedBy       string  `json:"uploadedBy,omitempty"`
+	CreatedAt        int64   `json:"createdAt"`
+	Deprecated       bool    `json:"deprecated"`
+	DeprecatedAt     *int64  `json:"deprecatedAt,omitempty"`
+	DeprecatedBy     string  `json:"deprecatedBy,omitempty"`
+	DeprecatedReason *string `json:"deprecatedReason,omitempty"`
+}
+
+type FirmwareListResponse struct {
+	Items []FirmwareResponse `json:"items"`
+}
+
+type FirmwareDeprecateRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+type FirmwareURLRequest struct {
+	TTLSec int `json:"ttlSec,omitempty"`
+}
+
+type FirmwareURLResponse struct {
+	URL       string `json:"url"`
+	ExpiresAt int64  `json:"expiresAt"`
+	SHA256    string `json:"sha256"`
+	Size      int64  `json:"size"`
+}
+
+type FirmwareDeltaResponse struct {
+	ID          string  `json:"id"`
+	FromVersion string  `json:"fromVersion"`
+	FromID      string  `json:"fromFirmwareId"`
+	FromSHA256  string  `json:"fromSha256"`
+	SHA256      string  `json:"sha256"`
+	Size        int64   `json:"size"`
+	Ratio       float64 `json:"ratio"` // размер дельты / размер полного образа
+	CreatedAt   int64   `json:"createdAt"`
+}
+
+type FirmwareDeltasResponse struct {
+	Items []FirmwareDeltaResponse `json:"items"`
+}
+
+type OTASigningKeyResponse struct {
+	KeyID        string `json:"kid"`
+	Alg          string `json:"alg"`
+	PublicKey    string `json:"publicKey"`    // base64, 32 байта
+	PublicKeyHex string `json:"publicKeyHex"` // для вшивания в прошивку массивом байт
+}
+
+// WithFirmware подключает репозиторий прошивок.
+func (s *Server) WithFirmware(svc *firmware.Service) *Server {
+	s.firmware = svc
+	return s
+}
+
+func firmwareResponse(rec registry.FirmwareRecord) FirmwareResponse {
+	resp := FirmwareResponse{
+		ID:           rec.ID,
+		Version:      rec.Version,
+		HWModel:      rec.HWModel,
+		MinHWRev:     rec.MinHWRev,
+		Notes:        rec.Notes,
+		SHA256:       rec.SHA256,
+		Size:         rec.Size,
+		UploadedBy:   rec.UploadedBy,
+		CreatedAt:    rec.CreatedMillis,
+		Deprecated:   rec.Deprecated,
+		DeprecatedAt: rec.DeprecatedMillis,
+		DeprecatedBy: rec.DeprecatedBy,
+	}
+	if rec.Deprecated {
+		reason := rec.DeprecatedReason
+		resp.DeprecatedReason = &reason
+	}
+	return resp
+}
+
+func firmwareDeltaResponse(d registry.FirmwareDelta, full int64) FirmwareDeltaResponse {
+	resp := FirmwareDeltaResponse{
+		ID:          d.ID,
+		FromVersion: d.FromVersion,
+		FromID:      d.FromFirmwareID,
+		FromSHA256:  d.FromSHA256,
+		SHA256:      d.SHA256,
+		Size:        d.Size,
+		CreatedAt:   d.CreatedMillis,
+	}
+	if full > 0 {
+		resp.Ratio = float64(d.Size) / float64(full)
+	}
+	return resp
+}
+
+func writeFirmwareError(w http.ResponseWriter, err error, action string) {
+	switch {
+	case errors.Is(err, firmware.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, firmware.ErrInvalid):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, firmware.ErrExists), errors.Is(err, firmware.ErrDeprecated):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, firmware.ErrTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	default:
+		log.Printf("[HTTP] %s firmware failed: %v", action, err)
+		http.Error(w, "failed to "+action+" firmware", http.StatusInternalServerError)
+	}
+}
+
+// handleFirmwareList:
+//
+//	GET  /api/v1/firmware?hwModel=&deprecated=1 — список
+//	POST /api/v1/firmware (multipart: file, version, hwModel, minHwRev, notes) — загрузка
+func (s *Server) handleFirmwareList(w http.ResponseWriter, r *http.Request) {
+	if s.firmware == nil {
+		http.Error(w, "firmware repository unavailable", http.StatusNotImplemented)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		query := r.URL.Query()
+		list, err := s.firmware.List(r.Context(), registry.FirmwareFilter{
+			HWModel:           strings.TrimSpace(query.Get("hwModel")),
+			IncludeDeprecated: query.Get("deprecated") == "1" || query.Get("deprecated") == "true",
+		})
+		if err != nil {
+			writeFirmwareError(w, err, "list")
+			return
+		}
+		items := make([]FirmwareResponse, 0, len(list))
+		for _, rec := range list {
+			items = append(items, firmwareResponse(rec))
+		}
+		writeJSON(w, http.StatusOK, FirmwareListResponse{Items: items})
+
+	case http.MethodPost:
+		s.uploadFirmware(w, r)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) uploadFirmware(w http.ResponseWriter, r *http.Request) {
+	// запас на поля формы и заголовки частей
+	r.Body = http.MaxBytesReader(w, r.Body, s.firmware.MaxSize()+1<<20)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "multipart/form-data expected", http.StatusBadRequest)
+		return
+	}
+
+	// поля читаются до части file: бинарник пишется на диск потоком, не в память
+	meta := firmware.UploadMeta{}
+	meta.Actor, _ = auth.UserIDFromContext(r.Context())
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			http.Error(w, "file is required", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			writeUploadReadError(w, err)
+			return
+		}
+
+		switch part.FormName() {
+		case "version", "hwModel", "minHwRev", "notes":
+			b, err := io.ReadAll(io.LimitReader(part, 64<<10))
+			if err != nil {
+				writeUploadReadError(w, err)
+				return
+			}
+			switch part.FormName() {
+			case "version":
+				meta.Version = string(b)
+			case "hwModel":
+				meta.HWModel = string(b)
+			case "minHwRev":
+				n, err := strconv.Atoi(strings.TrimSpace(string(b)))
+				if err != nil {
+					http.Error(w, "invalid minHwRev", http.StatusBadRequest)
+					return
+				}
+				meta.MinHWRev = n
+			default:
+				meta.Notes = string(b)
+			}
+
+		case "file":
+			rec, err := s.firmware.Upload(r.Context(), meta, part)
+			if err != nil {
+				var maxErr *http.MaxBytesError
+				if errors.As(err, &maxErr) {
+					http.Error(w, firmware.ErrTooLarge.Error(), http.StatusRequestEntityTooLarge)
+					return
+				}
+				writeFirmwareError(w, err, "upload")
+				return
+			}
+			writeJSON(w, http.StatusCreated, firmwareResponse(*rec))
+			return
+		}
+		_ = part.Close()
+	}
+}
+
+func writeUploadReadError(w http.ResponseWriter, err error) {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		http.Error(w, firmware.ErrTooLarge.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, "invalid multipart body", http.StatusBadRequest)
+}
+
+// handleFirmware:
+//
+//	GET    /api/v1/firmware/{id}           — артефакт
+//	POST   /api/v1/firmware/{id}/deprecate — пометить устаревшим {reason}
+//	DELETE /api/v1/firmware/{id}/deprecate — снять отметку
+//	POST   /api/v1/firmware/{id}/url       — подписанная ссылка для устройства {ttlSec}
+//	GET    /api/v1/firmware/{id}/deltas    — дельты от распространённых версий
+//	POST   /api/v1/firmware/{id}/deltas    — пересчитать дельты (после смены версий в парке)
+func (s *Server) handleFirmware(w http.ResponseWriter, r *http.Request) {
+	if s.firmware == nil {
+		http.Error(w, "firmware repository unavailable", http.StatusNotImplemented)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/firmware/"), "/")
+	id := strings.TrimSpace(parts[0])
+	if id == "" || len(parts) > 2 {
+		http.Error(w, "bad path", http.StatusBadRequest)
+		return
+	}
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+	actor, _ := auth.UserIDFromContext(r.Context())
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		rec, err := s.firmware.Get(r.Context(), id)
+		if err != nil {
+			writeFirmwareError(w, err, "get")
+			return
+		}
+		writeJSON(w, http.StatusOK, firmwareResponse(*rec))
+
+	case action == "deprecate" && (r.Method == http.MethodPost || r.Method == http.MethodDelete):
+		var req FirmwareDeprecateRequest
+		if r.Method == http.MethodPost {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+				http.Error(w, "invalid json", http.StatusBadRequest)
+				return
+			}
+		}
+		rec, err := s.firmware.Deprecate(r.Context(), id, r.Method == http.MethodPost, actor, req.Reason)
+		if err != nil {
+			writeFirmwareError(w, err, "deprecate")
+			return
+		}
+		writeJSON(w, http.StatusOK, firmwareResponse(*rec))
+
+	case action == "url" && r.Method == http.MethodPost:
+		var req FirmwareURLRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		if req.TTLSec < 0 {
+			http.Error(w, "invalid ttlSec", http.StatusBadRequest)
+			return
+		}
+		rec, signed, err := s.firmware.IssueURL(r.Context(), id, time.Duration(req.TTLSec)*time.Second)
+		if err != nil {
+			writeFirmwareError(w, err, "sign")
+			return
+		}
+		writeJSON(w, http.StatusOK, FirmwareURLResponse{
+			URL:       signed.URL,
+			ExpiresAt: signed.ExpiresMillis,
+			SHA256:    rec.SHA256,
+			Size:      rec.Size,
+		})
+
+	case action == "deltas" && (r.Method == http.MethodGet || r.Method == http.MethodPost):
+		rec, err := s.firmware.Get(r.Context(), id)
+		if err != nil {
+			writeFirmwareError(w, err, "get")
+			return
+		}
+		var list []registry.FirmwareDelta
+		if r.Method == http.MethodPost {
+			log.Printf("[HTTP] firmware deltas rebuild id=%s by=%s", id, actor)
+			list, err = s.firmware.BuildDeltas(r.Context(), id)
+		} else {
+			list, err = s.firmware.Deltas(r.Context(), id)
+		}
+		if err != nil {
+			writeFirmwareError(w, err, "build deltas of")
+			return
+		}
+		items := make([]FirmwareDeltaResponse, 0, len(list))
+		for _, d := range list {
+			items = append(items, firmwareDeltaResponse(d, rec.Size))
+		}
+		writeJSON(w, http.StatusOK, FirmwareDeltasResponse{Items: items})
+
+	case action == "" || action == "deprecate" || action == "url" || action == "deltas":
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
+
+// handleFirmwareDownload: GET/HEAD /api/v1/firmware/{id}/download?exp=&sig= — без токена пользователя,
+// по подписанной ссылке. Range / If-Range поддерживаются: устройство на GSM докачивает с места обрыва.
+// /api/v1/firmware/{id}/deltas/{deltaId}/download — то же для дельты.
+func (s *Server) handleFirmwareDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.firmware == nil {
+		http.Error(w, "firmware repository unavailable", http.StatusNotImplemented)
+		return
+	}
+	parts := strings.Split(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/firmware/"), "/download"), "/")
+	id := parts[0]
+	if len(parts) == 3 && parts[1] == "deltas" && id != "" && parts[2] != "" {
+		s.serveFirmwareDelta(w, r, id, parts[2])
+		return
+	}
+	if id == "" || len(parts) != 1 {
+		http.Error(w, "bad path", http.StatusBadRequest)
+		return
+	}
+	if err := s.firmware.VerifyURL(id, r.URL.Query()); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	rec, f, err := s.firmware.Open(r.Context(), id)
+	if err != nil {
+		writeFirmwareError(w, err, "open")
+		return
+	}
+	defer f.Close()
+
+	h := w.Header()
+	h.Set("Content-Type", "application/octet-stream")
+	h.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-%s.bin"`, rec.HWModel, rec.Version))
+	h.Set("ETag", strconv.Quote(rec.SHA256))
+	h.Set("Cache-Control", "private, no-transform")
+	h.Set("X-Firmware-Version", rec.Version)
+	h.Set("X-Firmware-SHA256", rec.SHA256)
+
+	if rng := r.Header.Get("Range"); rng != "" {
+		log.Printf("[FW] download id=%s range=%s", rec.ID, rng)
+	} else if r.Method == http.MethodGet {
+		log.Printf("[FW] download id=%s", rec.ID)
+	}
+	http.ServeContent(w, r, "", time.UnixMilli(rec.CreatedMillis), f)
+}
+
+func (s *Server) serveFirmwareDelta(w http.ResponseWriter, r *http.Request, id, deltaID string) {
+	if err := s.firmware.VerifyDeltaURL(id, deltaID, r.URL.Query()); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	d, f, err := s.firmware.OpenDelta(r.Context(), id, deltaID)
+	if err != nil {
+		writeFirmwareError(w, err, "open delta of")
+		return
+	}
+	defer f.Close()
+
+	h := w.Header()
+	h.Set("Content-Type", "application/octet-stream")
+	h.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.delta"`, d.ID))
+	h.Set("ETag", strconv.Quote(d.SHA256))
+	h.Set("Cache-Control", "private, no-transform")
+	h.Set("X-Firmware-Delta-From", d.FromVersion)
+	h.Set("X-Firmware-SHA256", d.SHA256)
+
+	if r.Method == http.MethodGet {
+		log.Printf("[FW] download_delta id=%s deltaId=%s from=%s range=%s", id, d.ID, d.FromVersion, r.Header.Get("Range"))
+	}
+	http.ServeContent(w, r, "", time.UnixMilli(d.CreatedMillis), f)
+}
+
+// handleOTASigningKey: GET /api/v1/ota/signing-key — публичный ключ проверки манифестов OTA (без токена:
+// ключ вшивается в прошивку на сборке).
+func (s *Server) handleOTASigningKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.firmware == nil || s.firmware.Signer() == nil {
+		http.Error(w, "ota signing key unavailable", http.StatusNotImplemented)
+		return
+	}
+	signer := s.firmware.Signer()
+	pub := signer.PublicKey()
+	writeJSON(w, http.StatusOK, OTASigningKeyResponse{
+		KeyID:        signer.KeyID(),
+		Alg:          firmware.ManifestAlg,
+		PublicKey:    base64.StdEncoding.EncodeToString(pub),
+		PublicKeyHex: hex.EncodeToString(pub),
+	})
+}
+
+// firmwareRoutes — /api/v1/firmware/...: download по подписи, остальное — с токеном пользователя.
+func (s *Server) firmwareRoutes() http.Handler {
+	authed := auth.RequireAuth(s.token, http.HandlerFunc(s.handleFirmware))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/download") {
+			s.handleFirmwareDownload(w, r)
+			return
+		}
+		authed.ServeHTTP(w, r)
+	})
+}
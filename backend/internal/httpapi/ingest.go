@@ -0,0 +1,61 @@
+package httpapi
+
+import (
+	"net/http"
+
+	"github.com/perm1ss10n/vexora/backend/internal/mqtt"
+)
+
+type IngestKindStatsResponse struct {
+	Received  uint64 `json:"received"`
+	Processed uint64 `json:"processed"`
+	Dropped   uint64 `json:"dropped"`
+	Blocked   uint64 `json:"blocked"`
+}
+
+type IngestStatsResponse struct {
+	Workers     int                                `json:"workers"`
+	QueueSize   int                                `json:"queueSize"`
+	Policy      string                             `json:"policy"`
+	Depth       int                                `json:"depth"`
+	ShardDepths []int                              `json:"shardDepths"`
+	MaxDepth    int                                `json:"maxDepth"`
+	Dropped     uint64                             `json:"dropped"`
+	Kinds       map[string]IngestKindStatsResponse `json:"kinds"`
+	Rejected    map[string]uint64                  `json:"rejected"`
+}
+
+// WithIngest подключает статистику очереди приёма MQTT.
+func (s *Server) WithIngest(in *mqtt.Ingest) *Server {
+	s.ingest = in
+	return s
+}
+
+// handleIngestStats: GET /api/v1/ingest/stats — глубина очередей, счётчики отброшенных и отклонённых сообщений.
+func (s *Server) handleIngestStats(w http.ResponseWriter, r *http.Request) {
+	if s.ingest == nil {
+		http.Error(w, "ingest stats unavailable", http.StatusNotImplemented)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	st := s.ingest.Stats()
+	resp := IngestStatsResponse{
+		Workers:     st.Workers,
+		QueueSize:   st.QueueSize,
+		Policy:      st.Policy,
+		Depth:       st.Depth,
+		ShardDepths: st.ShardDepths,
+		MaxDepth:    st.MaxDepth,
+		Dropped:     st.Dropped,
+		Kinds:       make(map[string]IngestKindStatsResponse, len(st.Kinds)),
+		Rejected:    st.Rejected,
+	}
+	for k, ks := range st.Kinds {
+		resp.Kinds[k] = IngestKindStatsResponse{Received: ks.Received, Processed: ks.Processed, Dropped: ks.Dropped, Blocked: ks.Blocked}
+	}
+	writeJSON(w, http.StatusOK, resp)
+}
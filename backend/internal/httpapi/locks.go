@@ -0,0 +1,140 @@
+package httpapi
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/perm1ss10n/vexora/backend/internal/auth"
+	"github.com/perm1ss10n/vexora/backend/internal/oplock"
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+)
+
+type DeviceLockResponse struct {
+	DeviceID   string `json:"deviceId"`
+	Kind       string `json:"kind"`
+	Ref        string `json:"ref"`
+	Holder     string `json:"holder"`
+	AcquiredAt int64  `json:"acquiredAt"`
+	ExpiresAt  int64  `json:"expiresAt"`
+}
+
+// LockConflictResponse — 409: устройство занято другой операцией.
+type LockConflictResponse struct {
+	Error string             `json:"error"`
+	Lock  DeviceLockResponse `json:"lock"`
+}
+
+type DeviceLockView struct {
+	Lock *DeviceLockResponse `json:"lock"`
+}
+
+type DeviceLocksResponse struct {
+	Items []DeviceLockResponse `json:"items"`
+}
+
+// WithLocks подключает блокировки устройств (просмотр и ручное снятие).
+func (s *Server) WithLocks(m *oplock.Manager) *Server {
+	s.locks = m
+	return s
+}
+
+func deviceLockResponse(rec registry.DeviceLockRecord) DeviceLockResponse {
+	return DeviceLockResponse{
+		DeviceID:   rec.DeviceID,
+		Kind:       rec.Kind,
+		Ref:        rec.Ref,
+		Holder:     rec.Holder,
+		AcquiredAt: rec.AcquiredMillis,
+		ExpiresAt:  rec.ExpiresMillis,
+	}
+}
+
+// writeLockConflict отвечает 409, если err — занятая блокировка устройства.
+func writeLockConflict(w http.ResponseWriter, err error) bool {
+	var locked *oplock.LockedError
+	if !errors.As(err, &locked) {
+		return false
+	}
+	writeJSON(w, http.StatusConflict, LockConflictResponse{
+		Error: oplock.ErrLocked.Error(),
+		Lock:  deviceLockResponse(locked.Lock),
+	})
+	return true
+}
+
+// handleDeviceLock:
+//
+//	GET    /api/v1/devices/{id}/lock — текущая блокировка (lock: null, если свободно)
+//	DELETE /api/v1/devices/{id}/lock — снять вручную (зависшая операция)
+func (s *Server) handleDeviceLock(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/devices/")
+	parts := strings.Split(path, "/")
+	if len(parts) != 2 || parts[1] != "lock" || strings.TrimSpace(parts[0]) == "" {
+		http.Error(w, "bad path", http.StatusBadRequest)
+		return
+	}
+	deviceID := strings.TrimSpace(parts[0])
+	if s.locks == nil {
+		http.Error(w, "device locks unavailable", http.StatusNotImplemented)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rec, err := s.locks.Get(r.Context(), deviceID)
+		if err != nil {
+			log.Printf("[HTTP] get device lock failed: %v", err)
+			http.Error(w, "failed to get lock", http.StatusInternalServerError)
+			return
+		}
+		view := DeviceLockView{}
+		if rec != nil {
+			resp := deviceLockResponse(*rec)
+			view.Lock = &resp
+		}
+		writeJSON(w, http.StatusOK, view)
+
+	case http.MethodDelete:
+		actor, _ := auth.UserIDFromContext(r.Context())
+		rec, err := s.locks.ForceRelease(r.Context(), deviceID, actor)
+		if err != nil {
+			log.Printf("[HTTP] release device lock failed: %v", err)
+			http.Error(w, "failed to release lock", http.StatusInternalServerError)
+			return
+		}
+		if rec == nil {
+			http.Error(w, "lock not found", http.StatusNotFound)
+			return
+		}
+		resp := deviceLockResponse(*rec)
+		writeJSON(w, http.StatusOK, DeviceLockView{Lock: &resp})
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleDeviceLocks: GET /api/v1/device-locks — все действующие блокировки
+func (s *Server) handleDeviceLocks(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if s.locks == nil {
+		http.Error(w, "device locks unavailable", http.StatusNotImplemented)
+		return
+	}
+	list, err := s.locks.List(r.Context())
+	if err != nil {
+		log.Printf("[HTTP] list device locks failed: %v", err)
+		http.Error(w, "failed to list locks", http.StatusInternalServerError)
+		return
+	}
+	items := make([]DeviceLockResponse, 0, len(list))
+	for _, rec := range list {
+		items = append(items, deviceLockResponse(rec))
+	}
+	writeJSON(w, http.StatusOK, DeviceLocksResponse{Items: items})
+}
@@ -0,0 +1,349 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/perm1ss10n/vexora/backend/internal/auth"
+	"github.com/perm1ss10n/vexora/backend/internal/ota"
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+)
+
+type OTACampaignRequest struct {
+	Name             string                  `json:"name"`
+	FirmwareID       string                  `json:"firmwareId"`
+	Target           registry.TargetSelector `json:"target"`
+	FWPredicate      string                  `json:"fwPredicate,omitempty"`
+	Waves            []int                   `json:"waves,omitempty"`
+	FailureThreshold float64                 `json:"failureThreshold,omitempty"`
+	MinSamples       int                     `json:"minSamples,omitempty"`
+	WaveIntervalSec  int                     `json:"waveIntervalSec,omitempty"`
+	JobTimeoutSec    int                     `json:"jobTimeoutSec,omitempty"`
+}
+
+type OTAWaveResponse struct {
+	Wave    int            `json:"wave"`
+	Percent int            `json:"percent"`
+	Devices int            `json:"devices"`
+	Counts  map[string]int `json:"counts"`
+}
+
+type OTACampaignResponse struct {
+	ID               string                  `json:"id"`
+	Name             string                  `json:"name"`
+	FirmwareID       string                  `json:"firmwareId"`
+	TargetVersion    string                  `json:"targetVersion"`
+	HWModel          string                  `json:"hwModel"`
+	Target           registry.TargetSelector `json:"target"`
+	FWPredicate      string                  `json:"fwPredicate,omitempty"`
+	Waves            []int                   `json:"waves"`
+	FailureThreshold float64                 `json:"failureThreshold"`
+	MinSamples       int                     `json:"minSamples"`
+	WaveIntervalSec  int64                   `json:"waveIntervalSec"`
+	JobTimeoutSec    int64                   `json:"jobTimeoutSec"`
+	Status           string                  `json:"status"`
+	Wave             int                     `json:"wave"`
+	PauseReason      string                  `json:"pauseReason,omitempty"`
+	CreatedBy        string                  `json:"createdBy,omitempty"`
+	CreatedAt        int64                   `json:"createdAt"`
+	UpdatedAt        int64                   `json:"updatedAt"`
+	FinishedAt       *int64                  `json:"finishedAt"`
+	Totals           map[string]int          `json:"totals"`
+	WaveProgress     []OTAWaveResponse       `json:"waveProgress"`
+	Transfer         OTATransferResponse     `json:"transfer"`
+}
+
+// OTATransferResponse — трафик по успешно обновлённым устройствам.
+type OTATransferResponse struct {
+	DeltaJobs  int   `json:"deltaJobs"`
+	FullJobs   int   `json:"fullJobs"`
+	BytesFull  int64 `json:"bytesFull"` // полными образами
+	BytesSent  int64 `json:"bytesSent"`
+	BytesSaved int64 `json:"bytesSaved"`
+}
+
+type OTACampaignListResponse struct {
+	Items []OTACampaignResponse `json:"items"`
+}
+
+type OTACampaignDeviceResponse struct {
+	DeviceID  string `json:"deviceId"`
+	JobID     string `json:"jobId"`
+	Wave      int    `json:"wave"`
+	Status    string `json:"status"`
+	FromFW    string `json:"fromFw,omitempty"`
+	Error     string `json:"error,omitempty"`
+	SentAt    *int64 `json:"sentAt"`
+	UpdatedAt int64  `json:"updatedAt"`
+	Download  string `json:"download,omitempty"` // delta/full
+	DeltaSize int64  `json:"deltaSize,omitempty"`
+	FullSize  int64  `json:"fullSize,omitempty"`
+}
+
+type OTACampaignDevicesResponse struct {
+	Items []OTACampaignDeviceResponse `json:"items"`
+}
+
+type OTACampaignActionRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+// WithOTA подключает OTA-кампании.
+func (s *Server) WithOTA(svc *ota.Service) *Server {
+	s.ota = svc
+	return s
+}
+
+func otaCampaignResponse(rec registry.OTACampaignRecord, counts []registry.OTAStatusCount, transfer registry.OTATransferStats) OTACampaignResponse {
+	resp := OTACampaignResponse{
+		ID:               rec.ID,
+		Name:             rec.Name,
+		FirmwareID:       rec.FirmwareID,
+		TargetVersion:    rec.TargetVersion,
+		HWModel:          rec.HWModel,
+		Target:           rec.Selector,
+		FWPredicate:      rec.FWPredicate,
+		Waves:            rec.Waves,
+		FailureThreshold: rec.FailureThreshold,
+		MinSamples:       rec.MinSamples,
+		WaveIntervalSec:  rec.WaveIntervalMs / 1000,
+		JobTimeoutSec:    rec.JobTimeoutMs / 1000,
+		Status:           rec.Status,
+		Wave:             rec.Wave,
+		PauseReason:      rec.PauseReason,
+		CreatedBy:        rec.CreatedBy,
+		CreatedAt:        rec.CreatedMillis,
+		UpdatedAt:        rec.UpdatedMillis,
+		Totals:           map[string]int{},
+		WaveProgress:     make([]OTAWaveResponse, len(rec.Waves)),
+		Transfer: OTATransferResponse{
+			DeltaJobs:  transfer.DeltaJobs,
+			FullJobs:   transfer.FullJobs,
+			BytesFull:  transfer.BytesFull,
+			BytesSent:  transfer.BytesSent,
+			BytesSaved: transfer.BytesFull - transfer.BytesSent,
+		},
+	}
+	if rec.FinishedMillis.Valid {
+		v := rec.FinishedMillis.Int64
+		resp.FinishedAt = &v
+	}
+	for i, p := range rec.Waves {
+		resp.WaveProgress[i] = OTAWaveResponse{Wave: i, Percent: p, Counts: map[string]int{}}
+	}
+	for _, c := range counts {
+		resp.Totals[c.Status] += c.Count
+		// skipped-устройства не входят ни в одну волну
+		if c.Status == registry.OTADeviceSkipped || c.Wave < 0 || c.Wave >= len(resp.WaveProgress) {
+			continue
+		}
+		resp.WaveProgress[c.Wave].Devices += c.Count
+		resp.WaveProgress[c.Wave].Counts[c.Status] += c.Count
+	}
+	return resp
+}
+
+func otaCampaignDeviceResponse(d registry.OTACampaignDevice) OTACampaignDeviceResponse {
+	resp := OTACampaignDeviceResponse{
+		DeviceID:  d.DeviceID,
+		JobID:     d.JobID,
+		Wave:      d.Wave,
+		Status:    d.Status,
+		FromFW:    d.FromFW,
+		Error:     d.Error,
+		UpdatedAt: d.UpdatedMillis,
+		Download:  d.DownloadMode,
+		DeltaSize: d.DeltaSize,
+		FullSize:  d.FullSize,
+	}
+	if d.SentMillis.Valid {
+		v := d.SentMillis.Int64
+		resp.SentAt = &v
+	}
+	return resp
+}
+
+func writeOTAError(w http.ResponseWriter, err error, action string) {
+	switch {
+	case errors.Is(err, ota.ErrNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ota.ErrInvalid), errors.Is(err, ota.ErrNoTargets), errors.Is(err, ota.ErrFirmwareBad):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ota.ErrBadState):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		log.Printf("[HTTP] %s ota campaign failed: %v", action, err)
+		http.Error(w, "failed to "+action+" campaign", http.StatusInternalServerError)
+	}
+}
+
+func (s *Server) otaCampaignReport(r *http.Request, rec registry.OTACampaignRecord) (OTACampaignResponse, error) {
+	counts, err := s.ota.Counts(r.Context(), rec.ID)
+	if err != nil {
+		return OTACampaignResponse{}, err
+	}
+	transfer, err := s.ota.Transfer(r.Context(), rec.ID)
+	if err != nil {
+		return OTACampaignResponse{}, err
+	}
+	return otaCampaignResponse(rec, counts, transfer), nil
+}
+
+func (s *Server) writeOTACampaign(w http.ResponseWriter, r *http.Request, status int, rec registry.OTACampaignRecord) {
+	resp, err := s.otaCampaignReport(r, rec)
+	if err != nil {
+		writeOTAError(w, err, "get")
+		return
+	}
+	writeJSON(w, status, resp)
+}
+
+// handleOTACampaigns:
+//
+//	GET  /api/v1/ota-campaigns — список
+//	POST /api/v1/ota-campaigns — создать и запустить
+func (s *Server) handleOTACampaigns(w http.ResponseWriter, r *http.Request) {
+	if s.ota == nil {
+		http.Error(w, "ota campaigns unavailable", http.StatusNotImplemented)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		list, err := s.ota.List(r.Context())
+		if err != nil {
+			writeOTAError(w, err, "list")
+			return
+		}
+		items := make([]OTACampaignResponse, 0, len(list))
+		for _, rec := range list {
+			resp, err := s.otaCampaignReport(r, rec)
+			if err != nil {
+				writeOTAError(w, err, "list")
+				return
+			}
+			items = append(items, resp)
+		}
+		writeJSON(w, http.StatusOK, OTACampaignListResponse{Items: items})
+
+	case http.MethodPost:
+		var req OTACampaignRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		if req.WaveIntervalSec < 0 || req.JobTimeoutSec < 0 {
+			http.Error(w, "invalid waveIntervalSec / jobTimeoutSec", http.StatusBadRequest)
+			return
+		}
+		actor, _ := auth.UserIDFromContext(r.Context())
+		rec, err := s.ota.Create(r.Context(), ota.CampaignRequest{
+			Name:             req.Name,
+			FirmwareID:       strings.TrimSpace(req.FirmwareID),
+			Target:           req.Target,
+			FWPredicate:      req.FWPredicate,
+			Waves:            req.Waves,
+			FailureThreshold: req.FailureThreshold,
+			MinSamples:       req.MinSamples,
+			WaveInterval:     time.Duration(req.WaveIntervalSec) * time.Second,
+			JobTimeout:       time.Duration(req.JobTimeoutSec) * time.Second,
+		}, actor)
+		if err != nil {
+			writeOTAError(w, err, "create")
+			return
+		}
+		s.writeOTACampaign(w, r, http.StatusCreated, *rec)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleOTACampaign:
+//
+//	GET  /api/v1/ota-campaigns/{id}                  — кампания с прогрессом по волнам
+//	GET  /api/v1/ota-campaigns/{id}/devices?status=  — устройства
+//	POST /api/v1/ota-campaigns/{id}/pause {reason}   — пауза
+//	POST /api/v1/ota-campaigns/{id}/resume           — продолжить
+//	POST /api/v1/ota-campaigns/{id}/abort            — прервать
+func (s *Server) handleOTACampaign(w http.ResponseWriter, r *http.Request) {
+	if s.ota == nil {
+		http.Error(w, "ota campaigns unavailable", http.StatusNotImplemented)
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/ota-campaigns/"), "/")
+	id := strings.TrimSpace(parts[0])
+	if id == "" || len(parts) > 2 {
+		http.Error(w, "bad path", http.StatusBadRequest)
+		return
+	}
+	action := ""
+	if len(parts) == 2 {
+		action = parts[1]
+	}
+	actor, _ := auth.UserIDFromContext(r.Context())
+
+	switch action {
+	case "":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		rec, err := s.ota.Get(r.Context(), id)
+		if err != nil {
+			writeOTAError(w, err, "get")
+			return
+		}
+		s.writeOTACampaign(w, r, http.StatusOK, *rec)
+
+	case "devices":
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		list, err := s.ota.Devices(r.Context(), id, strings.TrimSpace(r.URL.Query().Get("status")))
+		if err != nil {
+			writeOTAError(w, err, "list devices of")
+			return
+		}
+		items := make([]OTACampaignDeviceResponse, 0, len(list))
+		for _, d := range list {
+			items = append(items, otaCampaignDeviceResponse(d))
+		}
+		writeJSON(w, http.StatusOK, OTACampaignDevicesResponse{Items: items})
+
+	case "pause", "resume", "abort":
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req OTACampaignActionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		var rec *registry.OTACampaignRecord
+		var err error
+		switch action {
+		case "pause":
+			rec, err = s.ota.Pause(r.Context(), id, actor, req.Reason)
+		case "resume":
+			rec, err = s.ota.Resume(r.Context(), id, actor)
+		default:
+			rec, err = s.ota.Abort(r.Context(), id, actor)
+		}
+		if err != nil {
+			writeOTAError(w, err, action)
+			return
+		}
+		s.writeOTACampaign(w, r, http.StatusOK, *rec)
+
+	default:
+		http.Error(w, "not found", http.StatusNotFound)
+	}
+}
@@ -0,0 +1,467 @@
+package httpapi
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/perm1ss10n/vexora/backend/internal/commands"
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+	"github.com/perm1ss10n/vexora/backend/internal/scheduler"
+)
+
+type ScheduleRequest struct {
+	Name      string                  `json:"name"`
+	Cron      string                  `json:"cron"`
+	TZ        string                  `json:"tz,omitempty"`
+	Type      string                  `json:"type"`
+	Params    map[string]any          `json:"params,omitempty"`
+	Targets   registry.TargetSelector `json:"targets"`
+	TimeoutMs int                     `json:"timeoutMs,omitempty"`
+	Enabled   *bool                   `json:"enabled,omitempty"`
+}
+
+type ScheduleResponse struct {
+	ID        string                  `json:"id"`
+	Name      string                  `json:"name"`
+	Cron      string                  `json:"cron"`
+	TZ        string                  `json:"tz"`
+	Type      string                  `json:"type"`
+	Params    map[string]any          `json:"params,omitempty"`
+	Targets   registry.TargetSelector `json:"targets"`
+	TimeoutMs int                     `json:"timeoutMs"`
+	Enabled   bool                    `json:"enabled"`
+	NextRunAt *int64                  `json:"nextRunAt"`
+	LastRunAt *int64                  `json:"lastRunAt"`
+	CreatedAt int64                   `json:"createdAt"`
+	UpdatedAt int64                   `json:"updatedAt"`
+}
+
+type SchedulePreviewResponse struct {
+	Cron     string   `json:"cron"`
+	TZ       string   `json:"tz"`
+	NextRuns []int64  `json:"nextRuns"`
+	Targets  []string `json:"targets,omitempty"`
+}
+
+type ScheduleRunResponse struct {
+	ID         string                    `json:"id"`
+	ScheduleID string                    `json:"scheduleId"`
+	Status     string                    `json:"status"`
+	Targets    int                       `json:"targets"`
+	OkCount    int                       `json:"okCount"`
+	FailCount  int                       `json:"failCount"`
+	Error      string                    `json:"error,omitempty"`
+	StartedAt  int64                     `json:"startedAt"`
+	FinishedAt *int64                    `json:"finishedAt"`
+	Items      []ScheduleRunItemResponse `json:"items,omitempty"`
+}
+
+type ScheduleRunItemResponse struct {
+	DeviceID  string `json:"deviceId"`
+	CommandID string `json:"commandId,omitempty"`
+	Ok        bool   `json:"ok"`
+	Code      string `json:"code,omitempty"`
+	Ts        int64  `json:"ts"`
+}
+
+type GroupResponse struct {
+	Name      string   `json:"name"`
+	Devices   int      `json:"devices"`
+	DeviceIDs []string `json:"deviceIds,omitempty"`
+}
+
+type GroupRequest struct {
+	DeviceIDs []string `json:"deviceIds"`
+}
+
+func scheduleResponse(rec registry.ScheduleRecord) ScheduleResponse {
+	return ScheduleResponse{
+		ID:        rec.ID,
+		Name:      rec.Name,
+		Cron:      rec.Cron,
+		TZ:        rec.TZ,
+		Type:      rec.CmdType,
+		Params:    rec.Params,
+		Targets:   rec.Selector,
+		TimeoutMs: rec.TimeoutMs,
+		Enabled:   rec.Enabled,
+		NextRunAt: nullMillis(rec.NextRunMillis),
+		LastRunAt: nullMillis(rec.LastRunMillis),
+		CreatedAt: rec.CreatedMillis,
+		UpdatedAt: rec.UpdatedMillis,
+	}
+}
+
+func scheduleRunResponse(run registry.ScheduleRunRecord) ScheduleRunResponse {
+	return ScheduleRunResponse{
+		ID:         run.ID,
+		ScheduleID: run.ScheduleID,
+		Status:     run.Status,
+		Targets:    run.Targets,
+		OkCount:    run.OkCount,
+		FailCount:  run.FailCount,
+		Error:      run.Error.String,
+		StartedAt:  run.StartedMillis,
+		FinishedAt: nullMillis(run.FinishedMillis),
+	}
+}
+
+func nullMillis(v sql.NullInt64) *int64 {
+	if !v.Valid {
+		return nil
+	}
+	n := v.Int64
+	return &n
+}
+
+// handleSchedules: GET /api/v1/schedules, POST /api/v1/schedules
+func (s *Server) handleSchedules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		list, err := s.reg.ListSchedules(r.Context())
+		if err != nil {
+			log.Printf("[HTTP] list schedules failed: %v", err)
+			http.Error(w, "failed to list schedules", http.StatusInternalServerError)
+			return
+		}
+		response := make([]ScheduleResponse, 0, len(list))
+		for _, rec := range list {
+			response = append(response, scheduleResponse(rec))
+		}
+		writeJSON(w, http.StatusOK, response)
+
+	case http.MethodPost:
+		var req ScheduleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		now := time.Now()
+		rec := registry.ScheduleRecord{
+			ID:            uuid.NewString(),
+			Enabled:       true,
+			CreatedMillis: now.UnixMilli(),
+		}
+		if msg := applyScheduleRequest(&rec, req, now); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		if err := s.reg.CreateSchedule(r.Context(), rec); err != nil {
+			log.Printf("[HTTP] create schedule failed: %v", err)
+			http.Error(w, "failed to create schedule", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("[HTTP] schedule_created id=%s name=%q cron=%q tz=%s type=%s", rec.ID, rec.Name, rec.Cron, rec.TZ, rec.CmdType)
+		writeJSON(w, http.StatusCreated, scheduleResponse(rec))
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSchedule:
+//
+//	GET    /api/v1/schedules/preview?cron=..&tz=..&n=5
+//	GET    /api/v1/schedules/{id}
+//	PUT    /api/v1/schedules/{id}
+//	DELETE /api/v1/schedules/{id}
+//	POST   /api/v1/schedules/{id}/enable | /disable
+//	GET    /api/v1/schedules/{id}/preview?n=5
+//	GET    /api/v1/schedules/{id}/runs
+//	GET    /api/v1/schedules/{id}/runs/{runId}
+func (s *Server) handleSchedule(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/schedules/")
+	parts := strings.Split(path, "/")
+	id := strings.TrimSpace(parts[0])
+	if id == "" {
+		http.Error(w, "bad path", http.StatusBadRequest)
+		return
+	}
+
+	if id == "preview" && len(parts) == 1 {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		query := r.URL.Query()
+		s.writeSchedulePreview(w, r, query.Get("cron"), query.Get("tz"), nil)
+		return
+	}
+
+	rec, err := s.reg.GetSchedule(r.Context(), id)
+	if err != nil {
+		log.Printf("[HTTP] get schedule failed: %v", err)
+		http.Error(w, "failed to get schedule", http.StatusInternalServerError)
+		return
+	}
+	if rec == nil {
+		http.Error(w, "schedule not found", http.StatusNotFound)
+		return
+	}
+
+	action := ""
+	if len(parts) > 1 {
+		action = parts[1]
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, scheduleResponse(*rec))
+
+	case action == "" && r.Method == http.MethodPut:
+		var req ScheduleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		if msg := applyScheduleRequest(rec, req, time.Now()); msg != "" {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		if err := s.reg.UpdateSchedule(r.Context(), *rec); err != nil {
+			log.Printf("[HTTP] update schedule failed: %v", err)
+			http.Error(w, "failed to update schedule", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, scheduleResponse(*rec))
+
+	case action == "" && r.Method == http.MethodDelete:
+		if err := s.reg.DeleteSchedule(r.Context(), id); err != nil {
+			log.Printf("[HTTP] delete schedule failed: %v", err)
+			http.Error(w, "failed to delete schedule", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	case (action == "enable" || action == "disable") && len(parts) == 2 && r.Method == http.MethodPost:
+		now := time.Now()
+		rec.Enabled = action == "enable"
+		rec.UpdatedMillis = now.UnixMilli()
+		rec.NextRunMillis = sql.NullInt64{}
+		if rec.Enabled {
+			rec.NextRunMillis = nextRunMillis(rec.Cron, rec.TZ, now)
+		}
+		if err := s.reg.UpdateSchedule(r.Context(), *rec); err != nil {
+			log.Printf("[HTTP] %s schedule failed: %v", action, err)
+			http.Error(w, "failed to update schedule", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, scheduleResponse(*rec))
+
+	case action == "preview" && len(parts) == 2 && r.Method == http.MethodGet:
+		s.writeSchedulePreview(w, r, rec.Cron, rec.TZ, &rec.Selector)
+
+	case action == "runs" && len(parts) == 2 && r.Method == http.MethodGet:
+		runs, err := s.reg.ListScheduleRuns(r.Context(), id, 50)
+		if err != nil {
+			log.Printf("[HTTP] list schedule runs failed: %v", err)
+			http.Error(w, "failed to list runs", http.StatusInternalServerError)
+			return
+		}
+		response := make([]ScheduleRunResponse, 0, len(runs))
+		for _, run := range runs {
+			response = append(response, scheduleRunResponse(run))
+		}
+		writeJSON(w, http.StatusOK, response)
+
+	case action == "runs" && len(parts) == 3 && r.Method == http.MethodGet:
+		s.writeScheduleRun(w, r, id, parts[2])
+
+	default:
+		http.Error(w, "bad path", http.StatusBadRequest)
+	}
+}
+
+func (s *Server) writeScheduleRun(w http.ResponseWriter, r *http.Request, scheduleID, runID string) {
+	run, err := s.reg.GetScheduleRun(r.Context(), scheduleID, runID)
+	if err != nil {
+		log.Printf("[HTTP] get schedule run failed: %v", err)
+		http.Error(w, "failed to get run", http.StatusInternalServerError)
+		return
+	}
+	if run == nil {
+		http.Error(w, "run not found", http.StatusNotFound)
+		return
+	}
+	items, err := s.reg.ListScheduleRunItems(r.Context(), runID)
+	if err != nil {
+		log.Printf("[HTTP] list schedule run items failed: %v", err)
+		http.Error(w, "failed to get run", http.StatusInternalServerError)
+		return
+	}
+	response := scheduleRunResponse(*run)
+	response.Items = make([]ScheduleRunItemResponse, 0, len(items))
+	for _, it := range items {
+		response.Items = append(response.Items, ScheduleRunItemResponse{
+			DeviceID:  it.DeviceID,
+			CommandID: it.CommandID,
+			Ok:        it.Ok,
+			Code:      it.Code,
+			Ts:        it.TsMillis,
+		})
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) writeSchedulePreview(w http.ResponseWriter, r *http.Request, cron, tz string, sel *registry.TargetSelector) {
+	n := 5
+	if nStr := strings.TrimSpace(r.URL.Query().Get("n")); nStr != "" {
+		parsed, err := strconv.Atoi(nStr)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "invalid n", http.StatusBadRequest)
+			return
+		}
+		n = parsed
+	}
+	if n > 50 {
+		n = 50
+	}
+
+	runs, err := scheduler.NextRuns(cron, tz, time.Now(), n)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	response := SchedulePreviewResponse{Cron: cron, TZ: tz, NextRuns: make([]int64, 0, len(runs))}
+	for _, t := range runs {
+		response.NextRuns = append(response.NextRuns, t.UnixMilli())
+	}
+	if sel != nil {
+		targets, err := scheduler.ResolveTargets(r.Context(), s.reg, *sel)
+		if err != nil {
+			log.Printf("[HTTP] resolve schedule targets failed: %v", err)
+			http.Error(w, "failed to resolve targets", http.StatusInternalServerError)
+			return
+		}
+		response.Targets = targets
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// applyScheduleRequest валидирует запрос и переносит поля в rec. Возвращает текст ошибки для 400.
+func applyScheduleRequest(rec *registry.ScheduleRecord, req ScheduleRequest, now time.Time) string {
+	req.Name = strings.TrimSpace(req.Name)
+	req.Cron = strings.TrimSpace(req.Cron)
+	req.TZ = strings.TrimSpace(req.TZ)
+	if req.TZ == "" {
+		req.TZ = "UTC"
+	}
+
+	if req.Name == "" {
+		return "name is required"
+	}
+	if req.Cron == "" {
+		return "cron is required"
+	}
+	if _, err := scheduler.Parse(req.Cron, req.TZ); err != nil {
+		return err.Error()
+	}
+	if !commands.IsKnownType(req.Type) {
+		return "unknown command type"
+	}
+	if req.Targets.Empty() {
+		return "targets are required"
+	}
+	if req.TimeoutMs < 0 {
+		return "invalid timeoutMs"
+	}
+
+	rec.Name = req.Name
+	rec.Cron = req.Cron
+	rec.TZ = req.TZ
+	rec.CmdType = req.Type
+	rec.Params = req.Params
+	rec.Selector = req.Targets
+	rec.TimeoutMs = req.TimeoutMs
+	if req.Enabled != nil {
+		rec.Enabled = *req.Enabled
+	}
+	rec.UpdatedMillis = now.UnixMilli()
+	rec.NextRunMillis = sql.NullInt64{}
+	if rec.Enabled {
+		rec.NextRunMillis = nextRunMillis(rec.Cron, rec.TZ, now)
+	}
+	return ""
+}
+
+func nextRunMillis(cron, tz string, now time.Time) sql.NullInt64 {
+	spec, err := scheduler.Parse(cron, tz)
+	if err != nil {
+		return sql.NullInt64{}
+	}
+	next := spec.Next(now)
+	if next.IsZero() {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: next.UnixMilli(), Valid: true}
+}
+
+// handleGroups: GET /api/v1/groups
+func (s *Server) handleGroups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	groups, err := s.reg.ListGroups(r.Context())
+	if err != nil {
+		log.Printf("[HTTP] list groups failed: %v", err)
+		http.Error(w, "failed to list groups", http.StatusInternalServerError)
+		return
+	}
+	response := make([]GroupResponse, 0, len(groups))
+	for _, g := range groups {
+		response = append(response, GroupResponse{Name: g.Name, Devices: g.Devices})
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// handleGroup: GET/PUT/DELETE /api/v1/groups/{name}
+func (s *Server) handleGroup(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimSpace(strings.TrimPrefix(r.URL.Path, "/api/v1/groups/"))
+	if name == "" || strings.Contains(name, "/") {
+		http.Error(w, "bad path", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req GroupRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		if err := s.reg.SetGroupDevices(r.Context(), name, req.DeviceIDs); err != nil {
+			log.Printf("[HTTP] set group failed: %v", err)
+			http.Error(w, "failed to update group", http.StatusInternalServerError)
+			return
+		}
+	case http.MethodDelete:
+		if err := s.reg.SetGroupDevices(r.Context(), name, nil); err != nil {
+			log.Printf("[HTTP] delete group failed: %v", err)
+			http.Error(w, "failed to delete group", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ids, err := s.reg.ListGroupDevices(r.Context(), name)
+	if err != nil {
+		log.Printf("[HTTP] list group devices failed: %v", err)
+		http.Error(w, "failed to get group", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, GroupResponse{Name: name, Devices: len(ids), DeviceIDs: ids})
+}
@@ -1,6 +1,9 @@
 package httpapi
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"log"
@@ -10,19 +13,40 @@ import (
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
+
 	"github.com/perm1ss10n/vexora/backend/internal/auth"
+	"github.com/perm1ss10n/vexora/backend/internal/codec"
 	"github.com/perm1ss10n/vexora/backend/internal/commands"
+	"github.com/perm1ss10n/vexora/backend/internal/compliance"
+	"github.com/perm1ss10n/vexora/backend/internal/configs"
+	"github.com/perm1ss10n/vexora/backend/internal/firmware"
 	"github.com/perm1ss10n/vexora/backend/internal/influx"
 	"github.com/perm1ss10n/vexora/backend/internal/model"
+	"github.com/perm1ss10n/vexora/backend/internal/mqtt"
+	"github.com/perm1ss10n/vexora/backend/internal/oplock"
+	"github.com/perm1ss10n/vexora/backend/internal/ota"
 	"github.com/perm1ss10n/vexora/backend/internal/registry"
 )
 
 type Server struct {
-	cmd    *commands.Manager
-	auth   *auth.Store
-	token  *auth.TokenService
-	reg    *registry.SQLiteStore
-	influx *influx.Client
+	cmd     *commands.Manager
+	auth    *auth.Store
+	token   *auth.TokenService
+	reg     *registry.SQLiteStore
+	influx  *influx.Client
+	configs *configs.Service
+	locks   *oplock.Manager
+	idemTTL time.Duration
+
+	firmware   *firmware.Service
+	ota        *ota.Service
+	compliance *compliance.Service
+	ingest     *mqtt.Ingest
+	delivery   *mqtt.Dispatcher
+	dicts      *codec.Dictionaries
+
+	secretAdmins map[string]bool // CFG_SECRET_ADMINS: кому доступны reveal и ротация ключа
 }
 
 type SendCmdRequest struct {
@@ -32,11 +56,22 @@ type SendCmdRequest struct {
 }
 
 type SendCmdResponse struct {
-	Ack model.AckPayload `json:"ack"`
+	Ack   model.AckPayload    `json:"ack"`
+	Error string              `json:"error,omitempty"`
+	Lock  *DeviceLockResponse `json:"lock,omitempty"` // 409: устройство занято другой операцией
 }
 
 func New(cmd *commands.Manager, authStore *auth.Store, tokenService *auth.TokenService, registryStore *registry.SQLiteStore, influxClient *influx.Client) *Server {
-	return &Server{cmd: cmd, auth: authStore, token: tokenService, reg: registryStore, influx: influxClient}
+	return &Server{
+		cmd:     cmd,
+		auth:    authStore,
+		token:   tokenService,
+		reg:     registryStore,
+		influx:  influxClient,
+		idemTTL: idempotencyTTLFromEnv(),
+
+		secretAdmins: secretAdminsFromEnv(),
+	}
 }
 
 func (s *Server) Handler() http.Handler {
@@ -52,12 +87,38 @@ func (s *Server) Handler() http.Handler {
 	if s.reg != nil && s.token != nil {
 		mux.Handle("/api/v1/devices", auth.RequireAuth(s.token, http.HandlerFunc(s.handleDevices)))
 		mux.Handle("/api/v1/devices/", auth.RequireAuth(s.token, http.HandlerFunc(s.handleDeviceDetail)))
+		mux.Handle("/api/v1/groups", auth.RequireAuth(s.token, http.HandlerFunc(s.handleGroups)))
+		mux.Handle("/api/v1/groups/", auth.RequireAuth(s.token, http.HandlerFunc(s.handleGroup)))
+		mux.Handle("/api/v1/schedules", auth.RequireAuth(s.token, http.HandlerFunc(s.handleSchedules)))
+		mux.Handle("/api/v1/schedules/", auth.RequireAuth(s.token, http.HandlerFunc(s.handleSchedule)))
+		mux.Handle("/api/v1/config-templates", auth.RequireAuth(s.token, http.HandlerFunc(s.handleTemplates)))
+		mux.Handle("/api/v1/config-templates/", auth.RequireAuth(s.token, http.HandlerFunc(s.handleTemplate)))
+		mux.Handle("/api/v1/config-drift", auth.RequireAuth(s.token, http.HandlerFunc(s.handleConfigDrift)))
+		mux.Handle("/api/v1/device-locks", auth.RequireAuth(s.token, http.HandlerFunc(s.handleDeviceLocks)))
+		mux.Handle("/api/v1/config-secrets/rotate", auth.RequireAuth(s.token, http.HandlerFunc(s.handleConfigSecretsRotate)))
+		mux.Handle("/api/v1/config-secrets/audit", auth.RequireAuth(s.token, http.HandlerFunc(s.handleConfigSecretsAudit)))
+		mux.Handle("/api/v1/firmware", auth.RequireAuth(s.token, http.HandlerFunc(s.handleFirmwareList)))
+		mux.Handle("/api/v1/firmware/", s.firmwareRoutes())
+		mux.Handle("/api/v1/ota-campaigns", auth.RequireAuth(s.token, http.HandlerFunc(s.handleOTACampaigns)))
+		mux.Handle("/api/v1/ota-campaigns/", auth.RequireAuth(s.token, http.HandlerFunc(s.handleOTACampaign)))
+		mux.Handle("/api/v1/firmware-policies", auth.RequireAuth(s.token, http.HandlerFunc(s.handleFirmwarePolicies)))
+		mux.Handle("/api/v1/firmware-policies/", auth.RequireAuth(s.token, http.HandlerFunc(s.handleFirmwarePolicy)))
+		mux.Handle("/api/v1/firmware-compliance", auth.RequireAuth(s.token, http.HandlerFunc(s.handleFirmwareCompliance)))
+		mux.Handle("/api/v1/ingest/stats", auth.RequireAuth(s.token, http.HandlerFunc(s.handleIngestStats)))
+		mux.Handle("/api/v1/telemetry-delivery", auth.RequireAuth(s.token, http.HandlerFunc(s.handleTelemetryDelivery)))
+		mux.Handle("/api/v1/compression/stats", auth.RequireAuth(s.token, http.HandlerFunc(s.handleCompressionStats)))
 	}
 	if s.token != nil {
 		mux.Handle("/api/v1/dev/", auth.RequireAuth(s.token, http.HandlerFunc(s.handleDev)))
+		mux.Handle("/api/v1/commands/", auth.RequireAuth(s.token, http.HandlerFunc(s.handleCommands)))
 	} else {
 		mux.HandleFunc("/api/v1/dev/", s.handleDev)
+		mux.HandleFunc("/api/v1/commands/", s.handleCommands)
 	}
+	mux.HandleFunc("/api/v1/config-schema", s.handleConfigSchema)
+	mux.HandleFunc("/api/v1/ota/signing-key", s.handleOTASigningKey)
+	mux.HandleFunc("/api/v1/compression/dictionaries", s.handleCompressionDictionaries)
+	mux.HandleFunc("/api/v1/compression/dictionaries/", s.handleCompressionDictionary)
 	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(200)
 		_, _ = w.Write([]byte("ok"))
@@ -112,6 +173,9 @@ type DeviceDetailResponse struct {
 	LastTelemetry  *LastTelemetryResponse `json:"lastTelemetry"`
 	Settings       DeviceSettingsResponse `json:"settings"`
 	SettingsSource *string                `json:"settingsSource,omitempty"`
+	Config         *DeviceConfigResponse  `json:"config,omitempty"`
+	Lock           *DeviceLockResponse    `json:"lock,omitempty"`
+	Encoding       string                 `json:"encoding"` // json/msgpack/cbor — в ней уходят cmd/cfg
 }
 
 func (s *Server) handleDevices(w http.ResponseWriter, r *http.Request) {
@@ -156,10 +220,62 @@ func (s *Server) handleDevices(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleDeviceDetail(w http.ResponseWriter, r *http.Request) {
+	if strings.HasSuffix(r.URL.Path, "/telemetry/delivery") {
+		s.handleDeviceTelemetryDelivery(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/compression") {
+		s.handleDeviceCompression(w, r)
+		return
+	}
 	if strings.HasSuffix(r.URL.Path, "/telemetry") {
 		s.handleDeviceTelemetry(w, r)
 		return
 	}
+	if strings.HasSuffix(r.URL.Path, "/commands") {
+		s.handleDeviceCommands(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/lock") {
+		s.handleDeviceLock(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/tags") {
+		s.handleDeviceTags(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/config/override") {
+		s.handleDeviceConfigOverride(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/config/effective") {
+		s.handleDeviceConfigEffective(w, r)
+		return
+	}
+	if strings.Contains(r.URL.Path, "/config/versions") {
+		s.handleDeviceConfigVersions(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/config/diff") {
+		s.handleDeviceConfigDiff(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/config/rollback") {
+		s.handleDeviceConfigRollback(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/config/secrets") {
+		s.handleDeviceConfigSecrets(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/config/status") {
+		s.handleDeviceCfgStatus(w, r)
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/config") {
+		s.handleDeviceConfig(w, r)
+		return
+	}
 
 	if r.Method != http.MethodGet {
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
@@ -235,6 +351,34 @@ func (s *Server) handleDeviceDetail(w http.ResponseWriter, r *http.Request) {
 		CfgStatus: "unknown",
 	}
 
+	cfgView, err := s.deviceConfigView(r.Context(), deviceID)
+	if err != nil {
+		log.Printf("[HTTP] get device config failed: %v", err)
+	}
+	if cfgView != nil {
+		settings.CfgStatus = cfgStatusOf(cfgView)
+		if intervalMs, ok := telemetryIntervalMs(cfgView.Desired); ok {
+			settings.Telemetry.IntervalMs = intervalMs
+			settingsSource = "desired_config"
+		}
+	}
+
+	var lock *DeviceLockResponse
+	if rec, err := s.locks.Get(r.Context(), deviceID); err != nil {
+		log.Printf("[HTTP] get device lock failed: %v", err)
+	} else if rec != nil {
+		resp := deviceLockResponse(*rec)
+		lock = &resp
+	}
+
+	encoding, err := s.reg.GetDeviceEncoding(r.Context(), deviceID)
+	if err != nil {
+		log.Printf("[HTTP] get device encoding failed: %v", err)
+	}
+	if encoding == "" {
+		encoding = "json"
+	}
+
 	writeJSON(w, http.StatusOK, DeviceDetailResponse{
 		Device: DeviceResponse{
 			DeviceID:  device.DeviceID,
@@ -246,6 +390,9 @@ func (s *Server) handleDeviceDetail(w http.ResponseWriter, r *http.Request) {
 		LastTelemetry:  lastTelemetry,
 		Settings:       settings,
 		SettingsSource: &settingsSource,
+		Config:         cfgView,
+		Lock:           lock,
+		Encoding:       encoding,
 	})
 }
 
@@ -397,9 +544,7 @@ func (s *Server) handleDev(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "type is required", http.StatusBadRequest)
 		return
 	}
-	switch req.Type {
-	case "ping", "reboot", "get_state", "apply_cfg":
-	default:
+	if !commands.IsKnownType(req.Type) {
 		http.Error(w, "unknown command type", http.StatusBadRequest)
 		return
 	}
@@ -409,22 +554,121 @@ func (s *Server) handleDev(w http.ResponseWriter, r *http.Request) {
 		timeout = time.Duration(req.TimeoutMs) * time.Millisecond
 	}
 
-	log.Printf("[HTTP] cmd_send deviceId=%s type=%s", deviceID, req.Type)
-	ack, err := s.cmd.Send(r.Context(), deviceID, req.Type, req.Params, timeout)
+	cmdID := uuid.NewString()
+	ctx := r.Context()
+
+	idemKey := strings.TrimSpace(r.Header.Get("Idempotency-Key"))
+	if idemKey != "" && s.reg != nil {
+		if len(idemKey) > 255 {
+			http.Error(w, "Idempotency-Key too long", http.StatusBadRequest)
+			return
+		}
+		userID, _ := auth.UserIDFromContext(r.Context())
+		hash := cmdRequestHash(deviceID, req)
+		now := time.Now()
+		existing, err := s.reg.ReserveIdempotencyKey(r.Context(), registry.IdempotencyRecord{
+			UserID:              userID,
+			Key:                 idemKey,
+			RequestHash:         hash,
+			CommandID:           cmdID,
+			CreatedMillis:       now.UnixMilli(),
+			ReservedUntilMillis: now.Add(s.cmd.MaxWait(timeout) + idemStaleMargin).UnixMilli(),
+			ExpiresMillis:       now.Add(s.idemTTL).UnixMilli(),
+		})
+		if err != nil {
+			log.Printf("[HTTP] idempotency reserve failed: %v", err)
+			http.Error(w, "failed to reserve idempotency key", http.StatusInternalServerError)
+			return
+		}
+		if existing != nil {
+			replayIdempotent(w, existing, hash)
+			return
+		}
+
+		// результат должен сохраниться, даже если клиент отвалился посреди ожидания ACK
+		ctx = context.WithoutCancel(ctx)
+		code, resp := s.sendCmd(ctx, cmdID, deviceID, req, timeout)
+		if code == http.StatusInternalServerError || resp.Lock != nil {
+			// до устройства ничего не дошло — разрешаем повтор с тем же ключом
+			_ = s.reg.ReleaseIdempotencyKey(context.Background(), userID, idemKey)
+		} else if b, err := json.Marshal(resp); err == nil {
+			if err := s.reg.CompleteIdempotencyKey(context.Background(), userID, idemKey, code, b); err != nil {
+				log.Printf("[HTTP] idempotency complete failed: %v", err)
+			}
+		}
+		writeJSON(w, code, resp)
+		return
+	}
+
+	code, resp := s.sendCmd(ctx, cmdID, deviceID, req, timeout)
+	writeJSON(w, code, resp)
+}
+
+func (s *Server) sendCmd(ctx context.Context, cmdID, deviceID string, req SendCmdRequest, timeout time.Duration) (int, SendCmdResponse) {
+	log.Printf("[HTTP] cmd_send deviceId=%s type=%s id=%s", deviceID, req.Type, cmdID)
+	ack, err := s.cmd.SendWithID(ctx, cmdID, deviceID, req.Type, req.Params, timeout)
 	if err != nil {
+		log.Printf("[HTTP] cmd_result deviceId=%s type=%s ok=%t code=%s attempts=%d err=%v", deviceID, req.Type, ack.Ok, ack.Code, ack.Attempts, err)
+		switch {
 		// TIMEOUT — это не “500”, это ожидаемое поведение
-		if errors.Is(err, commands.ErrTimeout) {
-			log.Printf("[HTTP] cmd_result deviceId=%s type=%s ok=%t code=%s err=%v", deviceID, req.Type, ack.Ok, ack.Code, err)
-			writeJSON(w, http.StatusGatewayTimeout, SendCmdResponse{Ack: ack})
-			return
+		case errors.Is(err, commands.ErrTimeout):
+			return http.StatusGatewayTimeout, SendCmdResponse{Ack: ack}
+		case errors.Is(err, commands.ErrCancelled):
+			return http.StatusConflict, SendCmdResponse{Ack: ack}
+		case errors.Is(err, oplock.ErrLocked):
+			var locked *oplock.LockedError
+			errors.As(err, &locked)
+			lock := deviceLockResponse(locked.Lock)
+			return http.StatusConflict, SendCmdResponse{Ack: ack, Error: oplock.ErrLocked.Error(), Lock: &lock}
+		default:
+			return http.StatusInternalServerError, SendCmdResponse{Ack: ack}
 		}
-		log.Printf("[HTTP] cmd_result deviceId=%s type=%s ok=%t code=%s err=%v", deviceID, req.Type, ack.Ok, ack.Code, err)
-		writeJSON(w, http.StatusInternalServerError, SendCmdResponse{Ack: ack})
+	}
+
+	log.Printf("[HTTP] cmd_result deviceId=%s type=%s ok=%t code=%s attempts=%d", deviceID, req.Type, ack.Ok, ack.Code, ack.Attempts)
+	return http.StatusOK, SendCmdResponse{Ack: ack}
+}
+
+// idemStaleMargin — запас сверх ожидания ACK: ключ без результата дольше этого считаем
+// брошенным (backend упал посреди команды) и отдаём повтору.
+const idemStaleMargin = time.Minute
+
+// replayIdempotent отдаёт результат первого запроса с тем же Idempotency-Key.
+func replayIdempotent(w http.ResponseWriter, rec *registry.IdempotencyRecord, hash string) {
+	w.Header().Set("X-Command-Id", rec.CommandID)
+	if rec.RequestHash != hash {
+		http.Error(w, "Idempotency-Key reused with a different request", http.StatusUnprocessableEntity)
 		return
 	}
+	if !rec.StatusCode.Valid {
+		http.Error(w, "request with this Idempotency-Key is still in progress", http.StatusConflict)
+		return
+	}
+	log.Printf("[HTTP] cmd_replay key=%s id=%s code=%d", rec.Key, rec.CommandID, rec.StatusCode.Int64)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(int(rec.StatusCode.Int64))
+	_, _ = w.Write([]byte(rec.Response.String + "\n"))
+}
 
-	log.Printf("[HTTP] cmd_result deviceId=%s type=%s ok=%t code=%s", deviceID, req.Type, ack.Ok, ack.Code)
-	writeJSON(w, http.StatusOK, SendCmdResponse{Ack: ack})
+// cmdRequestHash — отпечаток запроса, чтобы ключ нельзя было переиспользовать для другой команды.
+func cmdRequestHash(deviceID string, req SendCmdRequest) string {
+	b, _ := json.Marshal(struct {
+		DeviceID string         `json:"deviceId"`
+		Type     string         `json:"type"`
+		Params   map[string]any `json:"params,omitempty"`
+	}{deviceID, req.Type, req.Params})
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+func idempotencyTTLFromEnv() time.Duration {
+	if v := os.Getenv("IDEMPOTENCY_TTL_MS"); v != "" {
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil && n > 0 {
+			return time.Duration(n) * time.Millisecond
+		}
+	}
+	return 24 * time.Hour
 }
 
 func writeJSON(w http.ResponseWriter, code int, v any) {
@@ -441,8 +685,9 @@ func withCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", allowedOrigin)
 		w.Header().Set("Access-Control-Allow-Credentials", "true")
-		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type, Idempotency-Key")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Expose-Headers", "Idempotent-Replayed, X-Command-Id")
 		if r.Method == http.MethodOptions {
 			w.WriteHeader(http.StatusNoContent)
 			return
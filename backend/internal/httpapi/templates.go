@@ -0,0 +1,442 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/perm1ss10n/vexora/backend/internal/auth"
+	"github.com/perm1ss10n/vexora/backend/internal/configs"
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+	"github.com/perm1ss10n/vexora/backend/internal/secrets"
+	"github.com/perm1ss10n/vexora/backend/internal/validate"
+)
+
+type TemplateRequest struct {
+	Name     string                     `json:"name,omitempty"`
+	Doc      map[string]any             `json:"doc"`
+	Bindings []registry.TemplateBinding `json:"bindings,omitempty"`
+}
+
+type TemplateBindingsRequest struct {
+	Bindings []registry.TemplateBinding `json:"bindings"`
+}
+
+type TemplateResponse struct {
+	Name      string                     `json:"name"`
+	Doc       map[string]any             `json:"doc"`
+	Secrets   []secrets.Field            `json:"secrets,omitempty"`
+	Revision  int64                      `json:"revision"`
+	UpdatedBy string                     `json:"updatedBy,omitempty"`
+	CreatedAt int64                      `json:"createdAt"`
+	UpdatedAt int64                      `json:"updatedAt"`
+	Bindings  []registry.TemplateBinding `json:"bindings"`
+}
+
+type TemplateChangeResponse struct {
+	Template *TemplateResponse     `json:"template,omitempty"`
+	Rollout  []configs.RolloutItem `json:"rollout"`
+}
+
+type ConfigOverrideResponse struct {
+	DeviceID  string               `json:"deviceId"`
+	Doc       map[string]any       `json:"doc"`
+	Secrets   []secrets.Field      `json:"secrets,omitempty"`
+	UpdatedBy string               `json:"updatedBy,omitempty"`
+	UpdatedAt int64                `json:"updatedAt,omitempty"`
+	Rollout   *configs.RolloutItem `json:"rollout,omitempty"`
+}
+
+type EffectiveConfigRequest struct {
+	Override map[string]any `json:"override"`
+}
+
+type EffectiveConfigResponse struct {
+	DeviceID string                `json:"deviceId"`
+	Config   map[string]any        `json:"config"`
+	Secrets  []secrets.Field       `json:"secrets,omitempty"`
+	Sources  []configs.Source      `json:"sources"`
+	Valid    bool                  `json:"valid"`
+	Error    string                `json:"error,omitempty"`
+	Fields   validate.ConfigErrors `json:"fields,omitempty"`
+}
+
+type DeviceTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+type DeviceTagsResponse struct {
+	DeviceID string   `json:"deviceId"`
+	Tags     []string `json:"tags"`
+}
+
+func (s *Server) templateResponse(rec registry.ConfigTemplateRecord) TemplateResponse {
+	bindings := rec.Bindings
+	if bindings == nil {
+		bindings = []registry.TemplateBinding{}
+	}
+	doc, fields := s.configs.Redact(rec.Doc)
+	return TemplateResponse{
+		Name:      rec.Name,
+		Doc:       doc,
+		Secrets:   fields,
+		Revision:  rec.Revision,
+		UpdatedBy: rec.UpdatedBy,
+		CreatedAt: rec.CreatedMillis,
+		UpdatedAt: rec.UpdatedMillis,
+		Bindings:  bindings,
+	}
+}
+
+// handleTemplates: GET /api/v1/config-templates, POST /api/v1/config-templates
+func (s *Server) handleTemplates(w http.ResponseWriter, r *http.Request) {
+	if s.configs == nil {
+		http.Error(w, "config store unavailable", http.StatusNotImplemented)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		list, err := s.configs.Templates(r.Context())
+		if err != nil {
+			log.Printf("[HTTP] list templates failed: %v", err)
+			http.Error(w, "failed to list templates", http.StatusInternalServerError)
+			return
+		}
+		response := make([]TemplateResponse, 0, len(list))
+		for _, rec := range list {
+			response = append(response, s.templateResponse(rec))
+		}
+		writeJSON(w, http.StatusOK, response)
+
+	case http.MethodPost:
+		var req TemplateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" || strings.Contains(req.Name, "/") {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+		if req.Doc == nil {
+			http.Error(w, "doc is required", http.StatusBadRequest)
+			return
+		}
+		if err := configs.ValidateBindings(req.Bindings); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		existing, err := s.configs.Template(r.Context(), req.Name)
+		if err != nil {
+			log.Printf("[HTTP] get template failed: %v", err)
+			http.Error(w, "failed to get template", http.StatusInternalServerError)
+			return
+		}
+		if existing != nil {
+			http.Error(w, "template already exists", http.StatusConflict)
+			return
+		}
+
+		actor, _ := auth.UserIDFromContext(r.Context())
+		rollout, err := s.configs.SaveTemplate(r.Context(), req.Name, req.Doc, actor)
+		if err == nil && req.Bindings != nil {
+			rollout, err = s.configs.SetTemplateBindings(r.Context(), req.Name, req.Bindings, actor)
+		}
+		if err != nil {
+			s.writeTemplateError(w, err)
+			return
+		}
+		s.writeTemplateChange(w, r, http.StatusCreated, req.Name, rollout)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleTemplate:
+//
+//	GET    /api/v1/config-templates/{name}
+//	PUT    /api/v1/config-templates/{name}           — новый doc, новые версии для затронутых устройств
+//	DELETE /api/v1/config-templates/{name}
+//	PUT    /api/v1/config-templates/{name}/bindings
+func (s *Server) handleTemplate(w http.ResponseWriter, r *http.Request) {
+	if s.configs == nil {
+		http.Error(w, "config store unavailable", http.StatusNotImplemented)
+		return
+	}
+
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/config-templates/")
+	parts := strings.Split(path, "/")
+	name := strings.TrimSpace(parts[0])
+	if name == "" || len(parts) > 2 || (len(parts) == 2 && parts[1] != "bindings") {
+		http.Error(w, "bad path", http.StatusBadRequest)
+		return
+	}
+	actor, _ := auth.UserIDFromContext(r.Context())
+
+	if len(parts) == 2 {
+		if r.Method != http.MethodPut {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		var req TemplateBindingsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		rollout, err := s.configs.SetTemplateBindings(r.Context(), name, req.Bindings, actor)
+		if err != nil {
+			s.writeTemplateError(w, err)
+			return
+		}
+		s.writeTemplateChange(w, r, http.StatusOK, name, rollout)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rec, err := s.configs.Template(r.Context(), name)
+		if err != nil {
+			log.Printf("[HTTP] get template failed: %v", err)
+			http.Error(w, "failed to get template", http.StatusInternalServerError)
+			return
+		}
+		if rec == nil {
+			http.Error(w, "template not found", http.StatusNotFound)
+			return
+		}
+		writeJSON(w, http.StatusOK, s.templateResponse(*rec))
+
+	case http.MethodPut:
+		var req TemplateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		if req.Doc == nil {
+			http.Error(w, "doc is required", http.StatusBadRequest)
+			return
+		}
+		rollout, err := s.configs.SaveTemplate(r.Context(), name, req.Doc, actor)
+		if err != nil {
+			s.writeTemplateError(w, err)
+			return
+		}
+		s.writeTemplateChange(w, r, http.StatusOK, name, rollout)
+
+	case http.MethodDelete:
+		rollout, err := s.configs.DeleteTemplate(r.Context(), name, actor)
+		if err != nil {
+			s.writeTemplateError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, TemplateChangeResponse{Rollout: rollout})
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) writeTemplateChange(w http.ResponseWriter, r *http.Request, status int, name string, rollout []configs.RolloutItem) {
+	rec, err := s.configs.Template(r.Context(), name)
+	if err != nil || rec == nil {
+		log.Printf("[HTTP] get template failed: %v", err)
+		http.Error(w, "failed to get template", http.StatusInternalServerError)
+		return
+	}
+	tpl := s.templateResponse(*rec)
+	writeJSON(w, status, TemplateChangeResponse{Template: &tpl, Rollout: rollout})
+}
+
+func (s *Server) writeTemplateError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, configs.ErrTemplateNotFound):
+		http.Error(w, "template not found", http.StatusNotFound)
+	case errors.Is(err, configs.ErrInvalidConfig):
+		writeConfigError(w, err)
+	default:
+		log.Printf("[HTTP] template change failed: %v", err)
+		http.Error(w, "failed to update template", http.StatusInternalServerError)
+	}
+}
+
+// handleDeviceConfigOverride: GET/PUT/DELETE /api/v1/devices/{id}/config/override
+func (s *Server) handleDeviceConfigOverride(w http.ResponseWriter, r *http.Request) {
+	deviceID, ok := s.configSubresource(w, r, "override")
+	if !ok {
+		return
+	}
+	actor, _ := auth.UserIDFromContext(r.Context())
+
+	switch r.Method {
+	case http.MethodGet:
+		rec, err := s.configs.Override(r.Context(), deviceID)
+		if err != nil {
+			log.Printf("[HTTP] get config override failed: %v", err)
+			http.Error(w, "failed to get override", http.StatusInternalServerError)
+			return
+		}
+		if rec == nil {
+			http.Error(w, "override not found", http.StatusNotFound)
+			return
+		}
+		doc, fields := s.configs.Redact(rec.Doc)
+		writeJSON(w, http.StatusOK, ConfigOverrideResponse{
+			DeviceID:  deviceID,
+			Doc:       doc,
+			Secrets:   fields,
+			UpdatedBy: rec.UpdatedBy,
+			UpdatedAt: rec.UpdatedMillis,
+		})
+
+	case http.MethodPut:
+		var doc map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&doc); err != nil || doc == nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		item, err := s.configs.SetOverride(r.Context(), deviceID, doc, actor)
+		if err != nil {
+			log.Printf("[HTTP] set config override failed: %v", err)
+			http.Error(w, "failed to store override", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("[HTTP] cfg_override deviceId=%s status=%s cfgVersion=%d", deviceID, item.Status, item.Version)
+		doc, fields := s.configs.Redact(doc)
+		writeJSON(w, http.StatusOK, ConfigOverrideResponse{DeviceID: deviceID, Doc: doc, Secrets: fields, Rollout: &item})
+
+	case http.MethodDelete:
+		item, err := s.configs.DeleteOverride(r.Context(), deviceID, actor)
+		if err != nil {
+			log.Printf("[HTTP] delete config override failed: %v", err)
+			http.Error(w, "failed to delete override", http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, ConfigOverrideResponse{DeviceID: deviceID, Rollout: &item})
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleDeviceConfigEffective:
+//
+//	GET  /api/v1/devices/{id}/config/effective — шаблоны + сохранённый override
+//	POST /api/v1/devices/{id}/config/effective — предпросмотр с override из тела, без сохранения
+func (s *Server) handleDeviceConfigEffective(w http.ResponseWriter, r *http.Request) {
+	deviceID, ok := s.configSubresource(w, r, "effective")
+	if !ok {
+		return
+	}
+
+	var eff *configs.Effective
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		eff, err = s.configs.Effective(r.Context(), deviceID)
+	case http.MethodPost:
+		var req EffectiveConfigRequest
+		if decodeErr := json.NewDecoder(r.Body).Decode(&req); decodeErr != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		eff, err = s.configs.PreviewEffective(r.Context(), deviceID, req.Override)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		log.Printf("[HTTP] effective config failed: %v", err)
+		http.Error(w, "failed to build effective config", http.StatusInternalServerError)
+		return
+	}
+
+	response := EffectiveConfigResponse{DeviceID: deviceID, Sources: eff.Sources}
+	response.Config, response.Secrets = s.configs.Redact(eff.Doc)
+	if eff.Doc != nil {
+		if err := s.configs.Validate(deviceID, eff.Doc); err != nil {
+			response.Error = configs.ErrInvalidConfig.Error()
+			errors.As(err, &response.Fields)
+		} else {
+			response.Valid = true
+		}
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// configSubresource разбирает /api/v1/devices/{id}/config/{sub} и проверяет устройство.
+func (s *Server) configSubresource(w http.ResponseWriter, r *http.Request, sub string) (string, bool) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/devices/")
+	parts := strings.Split(path, "/")
+	if len(parts) != 3 || parts[1] != "config" || parts[2] != sub {
+		http.Error(w, "bad path", http.StatusBadRequest)
+		return "", false
+	}
+	return s.configDevice(w, r, parts[0])
+}
+
+// configDevice проверяет, что конфигурации подключены и устройство существует.
+func (s *Server) configDevice(w http.ResponseWriter, r *http.Request, rawID string) (string, bool) {
+	deviceID := strings.TrimSpace(rawID)
+	if deviceID == "" {
+		http.Error(w, "bad path", http.StatusBadRequest)
+		return "", false
+	}
+	if s.configs == nil {
+		http.Error(w, "config store unavailable", http.StatusNotImplemented)
+		return "", false
+	}
+
+	device, err := s.reg.GetDevice(r.Context(), deviceID)
+	if err != nil {
+		log.Printf("[HTTP] get device failed: %v", err)
+		http.Error(w, "failed to get device", http.StatusInternalServerError)
+		return "", false
+	}
+	if device == nil {
+		http.Error(w, "device not found", http.StatusNotFound)
+		return "", false
+	}
+	return deviceID, true
+}
+
+// handleDeviceTags: GET/PUT /api/v1/devices/{id}/tags
+func (s *Server) handleDeviceTags(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/devices/")
+	parts := strings.Split(path, "/")
+	if len(parts) != 2 || parts[1] != "tags" || strings.TrimSpace(parts[0]) == "" {
+		http.Error(w, "bad path", http.StatusBadRequest)
+		return
+	}
+	deviceID := strings.TrimSpace(parts[0])
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var req DeviceTagsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid json", http.StatusBadRequest)
+			return
+		}
+		if err := s.reg.SetDeviceTags(r.Context(), deviceID, req.Tags); err != nil {
+			log.Printf("[HTTP] set device tags failed: %v", err)
+			http.Error(w, "failed to update tags", http.StatusInternalServerError)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	tags, err := s.reg.ListDeviceTags(r.Context(), deviceID)
+	if err != nil {
+		log.Printf("[HTTP] list device tags failed: %v", err)
+		http.Error(w, "failed to get tags", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, DeviceTagsResponse{DeviceID: deviceID, Tags: tags})
+}
@@ -0,0 +1,42 @@
+package influx
+
+import (
+	"encoding/json"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+
+	"github.com/perm1ss10n/vexora/backend/internal/model"
+)
+
+// WriteEvent пишет событие, сгенерированное самим backend (source=backend), в measurement "event".
+func (c *Client) WriteEvent(e model.EventPayload) {
+	if c == nil {
+		return
+	}
+	tags := map[string]string{
+		"deviceId": e.DeviceID,
+		"source":   "backend",
+	}
+	if e.Code != "" {
+		tags["code"] = e.Code
+	}
+	if e.Severity != "" {
+		tags["severity"] = e.Severity
+	}
+
+	fields := map[string]interface{}{}
+	if e.Msg != "" {
+		fields["msg"] = e.Msg
+	}
+	if len(e.Data) > 0 {
+		if b, err := json.Marshal(e.Data); err == nil {
+			fields["data"] = string(b)
+		}
+	}
+	if len(fields) == 0 {
+		fields["seen"] = 1
+	}
+
+	c.WritePoint(influxdb2.NewPoint("event", tags, fields, time.UnixMilli(e.Ts)))
+}
@@ -9,4 +9,6 @@ type AckPayload struct {
 	Code     string         `json:"code,omitempty"`
 	Msg      string         `json:"msg,omitempty"`
 	Data     map[string]any `json:"data,omitempty"`
+	Dup      bool           `json:"dup,omitempty"`      // устройство уже выполняло этот id и не повторяло действие
+	Attempts int            `json:"attempts,omitempty"` // заполняет backend: сколько публикаций понадобилось
 }
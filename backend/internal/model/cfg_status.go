@@ -0,0 +1,19 @@
+package model
+
+// CfgStatusPayload — payload для v1/dev/{deviceId}/cfg/status (retained), docs/device-config.md §8
+type CfgStatusPayload struct {
+	V              int       `json:"v"`
+	DeviceID       string    `json:"deviceId"`
+	Ts             int64     `json:"ts"`
+	ActiveVersion  *int64    `json:"activeVersion"`
+	PendingVersion *int64    `json:"pendingVersion"`
+	LastApply      *CfgApply `json:"lastApply,omitempty"`
+	Status         string    `json:"status,omitempty"` // legacy-прошивка: applied/rejected без версий
+}
+
+type CfgApply struct {
+	CfgVersion int64   `json:"cfgVersion"`
+	Ok         bool    `json:"ok"`
+	Error      *string `json:"error"`
+	RolledBack *bool   `json:"rolledBack,omitempty"` // ok=false: true — откатились на previous, иначе отклонено валидацией
+}
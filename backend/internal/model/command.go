@@ -7,4 +7,5 @@ type CommandPayload struct {
 	Ts       int64          `json:"ts"`
 	Type     string         `json:"type"`
 	Params   map[string]any `json:"params,omitempty"`
+	Attempt  int            `json:"attempt,omitempty"` // 1..N, при повторе id тот же
 }
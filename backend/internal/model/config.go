@@ -0,0 +1,10 @@
+package model
+
+// CfgPayload — payload для v1/dev/{deviceId}/cfg (облако → устройство)
+type CfgPayload struct {
+	V          int            `json:"v"`
+	DeviceID   string         `json:"deviceId"`
+	Ts         int64          `json:"ts"`
+	CfgVersion int64          `json:"cfgVersion"`
+	Cfg        map[string]any `json:"cfg"` // документ по docs/device-config.md, cfg.version == CfgVersion
+}
@@ -0,0 +1,35 @@
+package model
+
+// OTAPayload — payload для v1/dev/{deviceId}/ota (облако → устройство).
+// Устройство отвечает ack с тем же id и сообщает ход обновления событиями OTA_*.
+// fw — справочно; устройство обязано брать параметры только из проверенного manifest.
+type OTAPayload struct {
+	V          int         `json:"v"`
+	ID         string      `json:"id"` // jobId: один на устройство в кампании
+	DeviceID   string      `json:"deviceId"`
+	Ts         int64       `json:"ts"`
+	CampaignID string      `json:"campaignId,omitempty"`
+	FW         OTAFirmware `json:"fw"`
+	Manifest   string      `json:"manifest"` // base64(JSON манифеста), docs/ota.md §4
+	Sig        string      `json:"sig"`      // base64(Ed25519 по байтам manifest)
+	KeyID      string      `json:"kid"`
+	Alg        string      `json:"alg"`
+}
+
+type OTAFirmware struct {
+	Version  string    `json:"version"`
+	HWModel  string    `json:"hwModel"` // устройство другой модели отвечает ack ok=false code=HW_MISMATCH
+	URL      string    `json:"url"`     // подписанная ссылка, Range поддерживается
+	SHA256   string    `json:"sha256"`
+	Size     int64     `json:"size"`
+	MinHWRev int       `json:"minHwRev"`
+	Delta    *OTADelta `json:"delta,omitempty"`
+}
+
+// OTADelta — патч от текущей версии устройства (ota.md §5); полный образ — запасной вариант.
+type OTADelta struct {
+	From   string `json:"from"`
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+	Size   int64  `json:"size"`
+}
@@ -0,0 +1,23 @@
+package model
+
+// RequestPayload — payload для v1/dev/{deviceId}/req (устройство → облако)
+type RequestPayload struct {
+	V        int            `json:"v"`
+	ID       string         `json:"id"` // id запроса, возвращается в resp
+	DeviceID string         `json:"deviceId"`
+	Ts       int64          `json:"ts"`
+	Method   string         `json:"method"` // time, get_cfg, get_pending_cmds, ...
+	Params   map[string]any `json:"params,omitempty"`
+}
+
+// ResponsePayload — payload для v1/dev/{deviceId}/resp (облако → устройство)
+type ResponsePayload struct {
+	V        int            `json:"v"`
+	ID       string         `json:"id"`
+	DeviceID string         `json:"deviceId"`
+	Ts       int64          `json:"ts"`
+	Ok       bool           `json:"ok"`
+	Code     string         `json:"code,omitempty"`
+	Msg      string         `json:"msg,omitempty"`
+	Data     map[string]any `json:"data,omitempty"`
+}
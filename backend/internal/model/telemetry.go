@@ -6,9 +6,16 @@ type TelemetryPayload struct {
 	Ts       int64   `json:"ts"`
 	Seq      *int64  `json:"seq,omitempty"`
 	Metrics  []Metric `json:"metrics"`
+	Samples  []TelemetrySample `json:"samples,omitempty"` // пачка измерений со своими ts (офлайн-буфер)
 	Meta     map[string]any `json:"meta,omitempty"`
 }
 
+// TelemetrySample — измерения на момент ts внутри пачки.
+type TelemetrySample struct {
+	Ts      int64    `json:"ts"`
+	Metrics []Metric `json:"metrics"`
+}
+
 type Metric struct {
 	Key   string  `json:"key"`
 	Value float64 `json:"value"`
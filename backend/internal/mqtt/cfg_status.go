@@ -0,0 +1,124 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	influxdb2 "github.com/influxdata/influxdb-client-go/v2"
+
+	"github.com/perm1ss10n/vexora/backend/internal/model"
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+)
+
+func (d *Dispatcher) handleCfgStatus(topic string, payload []byte, env model.Envelope) {
+	var s model.CfgStatusPayload
+	if err := json.Unmarshal(payload, &s); err != nil {
+		log.Printf("[CFG_STATUS] invalid_json topic=%s err=%v", topic, err)
+		return
+	}
+
+	status := cfgApplyStatus(s)
+	if status == "" {
+		log.Printf("[CFG_STATUS] unknown_status topic=%s deviceId=%s status=%q", topic, env.DeviceID, s.Status)
+		return
+	}
+
+	rec := registry.CfgStatusRecord{
+		DeviceID:       env.DeviceID,
+		TsMillis:       env.Ts,
+		Status:         status,
+		ActiveVersion:  s.ActiveVersion,
+		PendingVersion: s.PendingVersion,
+	}
+	if s.LastApply != nil {
+		rec.ApplyVersion = &s.LastApply.CfgVersion
+		rec.ApplyOk = &s.LastApply.Ok
+		rec.ApplyError = s.LastApply.Error
+	}
+
+	log.Printf("[CFG_STATUS] recv topic=%s deviceId=%s status=%s active=%s pending=%s ts=%d size=%d",
+		topic, env.DeviceID, status, fmtVersion(s.ActiveVersion), fmtVersion(s.PendingVersion), env.Ts, len(payload),
+	)
+
+	if d.Registry != nil {
+		if err := d.Registry.RecordCfgStatus(context.Background(), rec); err != nil {
+			log.Printf("[CFG_STATUS] registry_failed deviceId=%s err=%v", env.DeviceID, err)
+		}
+	}
+
+	// применение завершено (успешно или нет) — снимаем cfg-блокировку этой и более старых версий
+	if s.PendingVersion == nil {
+		var applied int64
+		if s.ActiveVersion != nil {
+			applied = *s.ActiveVersion
+		}
+		if s.LastApply != nil && s.LastApply.CfgVersion > applied {
+			applied = s.LastApply.CfgVersion
+		}
+		if applied > 0 {
+			d.Locks.ReleaseCfg(context.Background(), env.DeviceID, applied)
+		}
+	}
+
+	if d.Influx == nil {
+		return
+	}
+
+	tags := map[string]string{
+		"deviceId": env.DeviceID,
+		"status":   status,
+	}
+	fields := map[string]interface{}{}
+	if s.ActiveVersion != nil {
+		fields["activeVersion"] = *s.ActiveVersion
+	}
+	if s.PendingVersion != nil {
+		fields["pendingVersion"] = *s.PendingVersion
+	}
+	if s.LastApply != nil {
+		fields["applyVersion"] = s.LastApply.CfgVersion
+		fields["applyOk"] = s.LastApply.Ok
+		if s.LastApply.Error != nil {
+			fields["applyError"] = *s.LastApply.Error
+		}
+	}
+	if len(fields) == 0 {
+		fields["seen"] = 1
+	}
+
+	p := influxdb2.NewPoint("cfg_status", tags, fields, time.UnixMilli(env.Ts))
+	d.Influx.WritePoint(p)
+}
+
+// cfgApplyStatus сводит отчёт к pending/applied/rejected/rolled_back.
+// Legacy-прошивка присылает только status — берём его как есть.
+func cfgApplyStatus(s model.CfgStatusPayload) string {
+	switch s.Status {
+	case registry.CfgStatusPending, registry.CfgStatusApplied, registry.CfgStatusRejected, registry.CfgStatusRolledBack:
+		return s.Status
+	case "":
+	default:
+		return ""
+	}
+
+	switch {
+	case s.PendingVersion != nil:
+		return registry.CfgStatusPending
+	case s.LastApply == nil || s.LastApply.Ok:
+		return registry.CfgStatusApplied
+	case s.LastApply.RolledBack != nil && *s.LastApply.RolledBack:
+		return registry.CfgStatusRolledBack
+	default:
+		return registry.CfgStatusRejected
+	}
+}
+
+func fmtVersion(v *int64) string {
+	if v == nil {
+		return "null"
+	}
+	return strconv.FormatInt(*v, 10)
+}
@@ -15,6 +15,9 @@ type Config struct {
 	ClientID  string
 	Username  string
 	Password  string
+
+	Version   int           // 3 — paho v3.1.1 (NewClient), 5 — MQTT 5 (NewClient5)
+	CmdExpiry time.Duration // MQTT 5: message expiry для cmd; 0 — без срока
 }
 
 func LoadConfigFromEnv() Config {
@@ -23,6 +26,14 @@ func LoadConfigFromEnv() Config {
 		ClientID:  getenv("MQTT_CLIENT_ID", "vexora-backend-dev"),
 		Username:  os.Getenv("MQTT_USERNAME"),
 		Password:  os.Getenv("MQTT_PASSWORD"),
+		Version:   3,
+		CmdExpiry: time.Duration(getenvInt("MQTT_CMD_EXPIRY_MS", 60000)) * time.Millisecond,
+	}
+	if getenv("MQTT_VERSION", "3") == "5" {
+		cfg.Version = 5
+	}
+	if cfg.CmdExpiry < 0 {
+		cfg.CmdExpiry = 0
 	}
 	return cfg
 }
@@ -123,7 +134,7 @@ func getenv(k, def string) string {
 }
 
 func MustPrintConfig(cfg Config) {
-	log.Printf("[MQTT] broker=%s clientId=%s user=%s", cfg.BrokerURL, cfg.ClientID, mask(cfg.Username))
+	log.Printf("[MQTT] broker=%s clientId=%s user=%s proto=%d", cfg.BrokerURL, cfg.ClientID, mask(cfg.Username), cfg.Version)
 }
 
 func mask(s string) string {
@@ -0,0 +1,296 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/eclipse/paho.golang/autopaho"
+	"github.com/eclipse/paho.golang/paho"
+
+	"github.com/perm1ss10n/vexora/backend/internal/codec"
+)
+
+// Props — свойства MQTT 5 входящего сообщения (по v3 всегда пустые).
+type Props struct {
+	CorrelationID string // correlation data: id команды, на которую отвечает ack
+	ContentType   string
+}
+
+// MessageSink — куда клиент MQTT 5 отдаёт входящие сообщения (реализует Ingest).
+type MessageSink interface {
+	EnqueueProps(topic string, payload []byte, props Props) bool
+}
+
+// User properties исходящих сообщений MQTT 5.
+const (
+	UserPropContentType   = "content-type"
+	UserPropSchemaVersion = "schema-version"
+)
+
+// ReasonError — брокер отказал с reason code MQTT 5 (CONNACK / SUBACK / PUBACK).
+type ReasonError struct {
+	Op     string // connect / subscribe / publish
+	Code   byte
+	Reason string // reason string из свойств пакета, если брокер его прислал
+}
+
+func (e *ReasonError) Error() string {
+	msg := fmt.Sprintf("mqtt5 %s rejected: reason=0x%02x %s", e.Op, e.Code, ReasonName(e.Code))
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+// ReasonName — имя reason code из спецификации MQTT 5 (§2.4).
+func ReasonName(code byte) string {
+	if name, ok := reasonNames[code]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+var reasonNames = map[byte]string{
+	0x00: "success",
+	0x10: "no_matching_subscribers",
+	0x80: "unspecified_error",
+	0x81: "malformed_packet",
+	0x82: "protocol_error",
+	0x83: "implementation_specific_error",
+	0x84: "unsupported_protocol_version",
+	0x85: "client_identifier_not_valid",
+	0x86: "bad_user_name_or_password",
+	0x87: "not_authorized",
+	0x88: "server_unavailable",
+	0x89: "server_busy",
+	0x8a: "banned",
+	0x8c: "bad_authentication_method",
+	0x8f: "topic_filter_invalid",
+	0x90: "topic_name_invalid",
+	0x91: "packet_identifier_in_use",
+	0x95: "packet_too_large",
+	0x97: "quota_exceeded",
+	0x99: "payload_format_invalid",
+	0x9a: "retain_not_supported",
+	0x9b: "qos_not_supported",
+	0x9c: "use_another_server",
+	0x9d: "server_moved",
+	0x9e: "shared_subscriptions_not_supported",
+	0x9f: "connection_rate_exceeded",
+	0xa1: "subscription_identifiers_not_supported",
+	0xa2: "wildcard_subscriptions_not_supported",
+}
+
+// Client5 — MQTT 5 (paho.golang/autopaho): переподключение, подписки на AllTopics,
+// публикация со свойствами. Реализует commands.Publisher.
+type Client5 struct {
+	cfg  Config
+	sink MessageSink
+	cm   atomic.Pointer[autopaho.ConnectionManager] // пишется в Connect, читается из Publish в других горутинах
+}
+
+func NewClient5(cfg Config, sink MessageSink) *Client5 {
+	return &Client5{cfg: cfg, sink: sink}
+}
+
+// Connect подключается и дальше держит соединение сам (backoff как у v3: 1s..30s).
+// Ошибка — только если не удалось первое подключение.
+func (c *Client5) Connect(ctx context.Context) error {
+	u, err := url.Parse(c.cfg.BrokerURL)
+	if err != nil {
+		return fmt.Errorf("mqtt5: broker url: %w", err)
+	}
+
+	acfg := autopaho.ClientConfig{
+		ServerUrls:                    []*url.URL{u},
+		KeepAlive:                     30,
+		CleanStartOnInitialConnection: true,
+		ConnectTimeout:                10 * time.Second,
+		ReconnectBackoff:              reconnectBackoff,
+		OnConnectionUp:                c.onConnectionUp,
+		OnConnectError: func(err error) {
+			var ce *autopaho.ConnackError
+			if errors.As(err, &ce) {
+				err = &ReasonError{Op: "connect", Code: ce.ReasonCode, Reason: ce.Reason}
+			}
+			log.Printf("[MQTT] connect_failed proto=5 err=%v", err)
+		},
+		ClientConfig: paho.ClientConfig{
+			ClientID: c.cfg.ClientID,
+			OnPublishReceived: []func(paho.PublishReceived) (bool, error){
+				c.onPublish,
+			},
+			OnServerDisconnect: func(d *paho.Disconnect) {
+				reason := ""
+				if d.Properties != nil {
+					reason = d.Properties.ReasonString
+				}
+				log.Printf("[MQTT] connection_lost proto=5 reason=0x%02x %s %s", d.ReasonCode, ReasonName(d.ReasonCode), reason)
+			},
+			OnClientError: func(err error) {
+				log.Printf("[MQTT] connection_lost proto=5 err=%v", err)
+			},
+		},
+	}
+	if c.cfg.Username != "" {
+		acfg.ConnectUsername = c.cfg.Username
+		acfg.ConnectPassword = []byte(c.cfg.Password)
+	}
+
+	cm, err := autopaho.NewConnection(context.Background(), acfg)
+	if err != nil {
+		return fmt.Errorf("mqtt5: %w", err)
+	}
+	// сразу после создания: OnConnectionUp и входящие сообщения могут прийти раньше AwaitConnection
+	c.cm.Store(cm)
+	waitCtx, cancel := context.WithTimeout(ctx, acfg.ConnectTimeout)
+	defer cancel()
+	if err := cm.AwaitConnection(waitCtx); err != nil {
+		c.cm.Store(nil)
+		_ = cm.Disconnect(context.Background())
+		return fmt.Errorf("mqtt5: initial connect to %s: %w", c.cfg.BrokerURL, err)
+	}
+	return nil
+}
+
+// Disconnect закрывает соединение и останавливает переподключение; входящих сообщений больше не будет.
+func (c *Client5) Disconnect(ctx context.Context) error {
+	cm := c.cm.Swap(nil)
+	if cm == nil {
+		return nil
+	}
+	if err := cm.Disconnect(ctx); err != nil {
+		return fmt.Errorf("mqtt5: disconnect: %w", err)
+	}
+	return nil
+}
+
+func reconnectBackoff(attempt int) time.Duration {
+	if attempt <= 0 {
+		return 0
+	}
+	backoff := time.Second
+	for i := 1; i < attempt && backoff < 30*time.Second; i++ {
+		backoff *= 2
+	}
+	return minDur(backoff, 30*time.Second)
+}
+
+func (c *Client5) onConnectionUp(cm *autopaho.ConnectionManager, _ *paho.Connack) {
+	log.Printf("[MQTT] connected to %s proto=5", c.cfg.BrokerURL)
+	sub := &paho.Subscribe{}
+	for _, t := range AllTopics {
+		sub.Subscriptions = append(sub.Subscriptions, paho.SubscribeOptions{Topic: t, QoS: 1})
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	sa, err := cm.Subscribe(ctx, sub)
+	if sa == nil {
+		log.Printf("[MQTT] subscribe_failed proto=5 err=%v", err)
+		return
+	}
+	for i, t := range AllTopics {
+		if i >= len(sa.Reasons) {
+			break
+		}
+		if code := sa.Reasons[i]; code >= 0x80 {
+			log.Printf("[MQTT] subscribe_failed topic=%s err=%v", t, &ReasonError{Op: "subscribe", Code: code})
+		} else {
+			log.Printf("[MQTT] subscribed topic=%s qos=%d", t, code)
+		}
+	}
+}
+
+func (c *Client5) onPublish(pr paho.PublishReceived) (bool, error) {
+	p := pr.Packet
+	var props Props
+	if p.Properties != nil {
+		props.CorrelationID = string(p.Properties.CorrelationData)
+		props.ContentType = p.Properties.ContentType
+	}
+	c.sink.EnqueueProps(p.Topic, p.Payload, props)
+	return true, nil
+}
+
+// Publish публикует со свойствами MQTT 5: content type и schema version (user properties) у всех сообщений;
+// у cmd ещё response topic = v1/dev/{id}/ack, correlation data = id команды и message expiry,
+// чтобы устаревшая команда (reboot) не выполнилась после долгого офлайна устройства.
+func (c *Client5) Publish(topic string, qos byte, retained bool, payload []byte) error {
+	cm := c.cm.Load()
+	if cm == nil {
+		return errors.New("mqtt5: not connected")
+	}
+	p := &paho.Publish{
+		Topic:      topic,
+		QoS:        qos,
+		Retain:     retained,
+		Payload:    payload,
+		Properties: c.publishProps(topic, payload),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := cm.Publish(ctx, p)
+	if resp != nil && resp.ReasonCode >= 0x80 {
+		re := &ReasonError{Op: "publish", Code: resp.ReasonCode}
+		if resp.Properties != nil {
+			re.Reason = resp.Properties.ReasonString
+		}
+		return re
+	}
+	if err != nil {
+		return err
+	}
+	if resp != nil && resp.ReasonCode == 0x10 {
+		log.Printf("[MQTT] publish topic=%s reason=0x10 %s", topic, ReasonName(resp.ReasonCode))
+	}
+	return nil
+}
+
+func (c *Client5) publishProps(topic string, payload []byte) *paho.PublishProperties {
+	enc := codec.Detect(payload)
+	props := &paho.PublishProperties{ContentType: contentType(enc)}
+
+	// v и id читаем из самого сообщения (cmd/cfg уже перекодированы в кодировку устройства)
+	var head struct {
+		V  int    `json:"v"`
+		ID string `json:"id"`
+	}
+	if b, _, err := codec.ToJSON(payload); err == nil {
+		_ = json.Unmarshal(b, &head)
+	}
+	props.User.Add(UserPropContentType, props.ContentType)
+	if head.V > 0 {
+		props.User.Add(UserPropSchemaVersion, strconv.Itoa(head.V))
+	}
+
+	if deviceID, ok := strings.CutSuffix(strings.TrimPrefix(topic, "v1/dev/"), "/cmd"); ok && !strings.Contains(deviceID, "/") {
+		props.ResponseTopic = "v1/dev/" + deviceID + "/ack"
+		if head.ID != "" {
+			props.CorrelationData = []byte(head.ID)
+		}
+		if c.cfg.CmdExpiry > 0 {
+			sec := uint32((c.cfg.CmdExpiry + time.Second - 1) / time.Second)
+			props.MessageExpiry = &sec
+		}
+	}
+	return props
+}
+
+func contentType(enc string) string {
+	switch enc {
+	case codec.MsgPack:
+		return "application/msgpack"
+	case codec.CBOR:
+		return "application/cbor"
+	}
+	return "application/json"
+}
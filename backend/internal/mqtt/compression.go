@@ -0,0 +1,106 @@
+package mqtt
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/perm1ss10n/vexora/backend/internal/codec"
+)
+
+// CompressionStats — сжатие payload устройства с момента старта backend.
+type CompressionStats struct {
+	DeviceID   string
+	Messages   uint64 // все принятые сообщения
+	Compressed uint64 // из них сжатые
+	WireBytes  uint64 // сжатые: байт на входе (с заголовком)
+	RawBytes   uint64 // сжатые: байт после распаковки
+	Ratio      float64
+	LastAlg    string
+	LastDictID uint16
+	UpdatedMs  int64
+}
+
+type compressionState struct {
+	mu      sync.Mutex
+	limits  codec.CompressionLimits
+	dicts   *codec.Dictionaries
+	devices map[string]*CompressionStats
+}
+
+// SetCompression задаёт лимиты распаковки и общие словари.
+func (d *Dispatcher) SetCompression(l codec.CompressionLimits, dicts *codec.Dictionaries) {
+	d.compression.mu.Lock()
+	defer d.compression.mu.Unlock()
+	d.compression.limits = l
+	d.compression.dicts = dicts
+}
+
+func (d *Dispatcher) decompress(payload []byte) ([]byte, codec.Frame, error) {
+	if d == nil {
+		return codec.Decompress(payload, codec.CompressionLimits{}, nil)
+	}
+	d.compression.mu.Lock()
+	l, dicts := d.compression.limits, d.compression.dicts
+	d.compression.mu.Unlock()
+	return codec.Decompress(payload, l, dicts)
+}
+
+func (d *Dispatcher) trackCompression(deviceID string, f codec.Frame) {
+	s := &d.compression
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.devices == nil {
+		s.devices = make(map[string]*CompressionStats)
+	}
+	st := s.devices[deviceID]
+	if st == nil {
+		st = &CompressionStats{DeviceID: deviceID}
+		s.devices[deviceID] = st
+	}
+	st.Messages++
+	if f.Alg != "" {
+		st.Compressed++
+		st.WireBytes += uint64(f.Wire)
+		st.RawBytes += uint64(f.Size)
+		st.LastAlg, st.LastDictID = f.Alg, f.DictID
+		st.UpdatedMs = time.Now().UnixMilli()
+	}
+}
+
+func (st CompressionStats) withRatio() CompressionStats {
+	if st.WireBytes > 0 {
+		st.Ratio = float64(st.RawBytes) / float64(st.WireBytes)
+	}
+	return st
+}
+
+// Compression — сжатие payload устройства; false — сообщений от устройства не было.
+func (d *Dispatcher) Compression(deviceID string) (CompressionStats, bool) {
+	d.compression.mu.Lock()
+	defer d.compression.mu.Unlock()
+	st := d.compression.devices[deviceID]
+	if st == nil {
+		return CompressionStats{}, false
+	}
+	return st.withRatio(), true
+}
+
+// CompressionAll — устройства, присылавшие сжатые сообщения; лучшее сжатие первым.
+func (d *Dispatcher) CompressionAll() []CompressionStats {
+	d.compression.mu.Lock()
+	out := make([]CompressionStats, 0, len(d.compression.devices))
+	for _, st := range d.compression.devices {
+		if st.Compressed > 0 {
+			out = append(out, st.withRatio())
+		}
+	}
+	d.compression.mu.Unlock()
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Ratio != out[j].Ratio {
+			return out[i].Ratio > out[j].Ratio
+		}
+		return out[i].DeviceID < out[j].DeviceID
+	})
+	return out
+}
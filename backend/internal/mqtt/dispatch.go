@@ -15,17 +15,55 @@ import (
 	"github.com/perm1ss10n/vexora/backend/internal/commands"
 	"github.com/perm1ss10n/vexora/backend/internal/influx"
 	"github.com/perm1ss10n/vexora/backend/internal/model"
+	"github.com/perm1ss10n/vexora/backend/internal/oplock"
 	"github.com/perm1ss10n/vexora/backend/internal/registry"
 )
 
-type Dispatcher struct {
-	Influx   *influx.Client
-	Registry registry.Store
-	Commands *commands.Manager
+// ConfigSource — desired-конфигурация устройства (для запроса get_cfg).
+// cfg == nil — конфигурация не задана.
+type ConfigSource interface {
+	DesiredConfig(ctx context.Context, deviceID string) (version int64, cfg map[string]any, err error)
+}
+
+// OTATracker — учёт хода OTA-кампаний по отчётам устройства (реализует ota.Service).
+type OTATracker interface {
+	OnEvent(deviceID string, e model.EventPayload)
+	OnAck(deviceID string, a model.AckPayload) bool
+	OnFirmware(deviceID, fw string)
+}
+
+// FirmwareCompliance — проверка state.fw на соответствие политикам прошивки (реализует compliance.Service).
+type FirmwareCompliance interface {
+	OnFirmware(deviceID, fw string)
+}
+
+// EncodingObserver — запоминает кодировку сообщений устройства (реализует codec.Preferences).
+type EncodingObserver interface {
+	Observe(deviceID, enc string)
+}
 
-	mu         sync.Mutex
-	lastWrite  map[string]int64 // key = deviceId|metric -> unixMillis
-	minWriteMs int64
+type Dispatcher struct {
+	Influx     *influx.Client
+	Registry   registry.Store
+	Commands   *commands.Manager
+	Publisher  commands.Publisher // ответы на v1/dev/{id}/req
+	Configs    ConfigSource
+	Locks      *oplock.Manager // снимаются по отчётам устройства (cfg/status, state, event)
+	OTA        OTATracker
+	Compliance FirmwareCompliance
+	Encodings  EncodingObserver // в этой кодировке устройству уходят cmd/cfg/resp/ota
+
+	mu          sync.Mutex
+	lastWrite   map[string]int64 // key = deviceId|metric -> unixMillis
+	minWriteMs  int64
+	reqHandlers map[string]RequestHandler
+
+	rejected     rejectCounters
+	seq          seqTracker       // seq телеметрии: дубли, пропуски, буферизованные точки
+	limits       TelemetryLimits  // пачки samples
+	compression  compressionState // распаковка payload и степень сжатия по устройствам
+	requests     requestSlots     // одновременные запросы v1/dev/{id}/req
+	lastSecEvent map[string]int64 // deviceId -> unixMillis последнего SEC_DEVICE_ID_MISMATCH
 }
 
 func (d *Dispatcher) InitRateLimitFromEnv() {
@@ -47,43 +85,60 @@ func (d *Dispatcher) InitRateLimitFromEnv() {
 	}
 	d.minWriteMs = n
 }
-func (d *Dispatcher) handleAck(topic string, payload []byte, env model.Envelope) {
+func (d *Dispatcher) handleAck(topic string, payload []byte, env model.Envelope, corrID string) {
 	var a model.AckPayload
 	if err := json.Unmarshal(payload, &a); err != nil {
 		log.Printf("[ACK] invalid_json topic=%s err=%v", topic, err)
 		return
 	}
 
+	// MQTT 5: id команды может прийти только в correlation data; при расхождении верим payload
+	switch {
+	case a.ID == "" && corrID != "":
+		a.ID = corrID
+	case corrID != "" && corrID != a.ID:
+		log.Printf("[ACK] correlation_mismatch topic=%s id=%s correlationId=%s", topic, a.ID, corrID)
+	}
+
 	// лог
-	log.Printf("[ACK] recv topic=%s deviceId=%s id=%s ok=%v code=%s ts=%d size=%d",
-		topic, env.DeviceID, a.ID, a.Ok, a.Code, env.Ts, len(payload),
+	log.Printf("[ACK] recv topic=%s deviceId=%s id=%s ok=%v code=%s dup=%v ts=%d size=%d",
+		topic, env.DeviceID, a.ID, a.Ok, a.Code, a.Dup, env.Ts, len(payload),
 	)
 
+	// ack на OTA job кампании — не команда
+	if d.OTA != nil && d.OTA.OnAck(env.DeviceID, a) {
+		return
+	}
+
 	// пробуждаем ожидающую команду
 	if d.Commands != nil {
 		d.Commands.OnAck(a)
 	}
 }
 
-func (d *Dispatcher) Dispatch(topic string, payload []byte, env model.Envelope) {
+// Dispatch — сообщение с проверенным топиком и envelope (env.DeviceID == info.DeviceID).
+// props — свойства MQTT 5 (correlation data у ack); по v3 пустые.
+func (d *Dispatcher) Dispatch(info TopicInfo, props Props, topic string, payload []byte, env model.Envelope) {
 	// 2.3.1: любое сообщение = “устройство живое/на связи”
-	if d.Registry != nil && env.DeviceID != "" {
+	if d.Registry != nil {
 		_ = d.Registry.Touch(context.Background(), env.DeviceID, env.Ts, topic)
 	}
 
-	switch {
-	case strings.HasSuffix(topic, "/telemetry"):
+	switch info.Kind {
+	case KindTelemetry:
 		d.handleTelemetry(topic, payload, env)
-	case strings.HasSuffix(topic, "/event"):
+	case KindEvent:
 		d.handleEvent(topic, payload, env)
-	case strings.HasSuffix(topic, "/state"):
+	case KindState:
 		d.handleState(topic, payload, env)
-	case strings.HasSuffix(topic, "/ack"):
-		d.handleAck(topic, payload, env)
-	case strings.HasSuffix(topic, "/cfg/status"):
-		log.Printf("[CFG_STATUS] topic=%s deviceId=%s ts=%d size=%d", topic, env.DeviceID, env.Ts, len(payload))
-	case strings.HasSuffix(topic, "/lwt"):
+	case KindAck:
+		d.handleAck(topic, payload, env, props.CorrelationID)
+	case KindCfgStatus:
+		d.handleCfgStatus(topic, payload, env)
+	case KindLWT:
 		d.handleLWT(topic, payload, env)
+	case KindReq:
+		d.handleRequest(topic, payload, env)
 	default:
 		log.Printf("[MQTT] topic=%s deviceId=%s ts=%d size=%d", topic, env.DeviceID, env.Ts, len(payload))
 	}
@@ -95,59 +150,95 @@ func (d *Dispatcher) handleTelemetry(topic string, payload []byte, env model.Env
 		log.Printf("[TEL] invalid_json topic=%s err=%v", topic, err)
 		return
 	}
-	if len(t.Metrics) == 0 {
+	if len(t.Metrics) == 0 && len(t.Samples) == 0 {
 		log.Printf("[TEL] no_metrics topic=%s deviceId=%s ts=%d", topic, env.DeviceID, env.Ts)
 		return
 	}
-
-	if d.Influx == nil {
-		log.Printf("[TEL] influx_disabled topic=%s deviceId=%s metrics=%d", topic, env.DeviceID, len(t.Metrics))
+	limits := d.telemetryLimits()
+	if len(t.Samples) > limits.MaxSamples {
+		log.Printf("[TEL] too_many_samples topic=%s deviceId=%s samples=%d max=%d", topic, env.DeviceID, len(t.Samples), limits.MaxSamples)
 		return
 	}
 
-	ts := time.UnixMilli(env.Ts)
 	nowMs := time.Now().UnixMilli()
+	samples, rejected := telemetrySamples(t, env, limits, nowMs)
+	if rejected > 0 {
+		log.Printf("[TEL] samples_rejected topic=%s deviceId=%s rejected=%d reason=ts_out_of_range", topic, env.DeviceID, rejected)
+	}
 
-	wrote := 0
-	for _, m := range t.Metrics {
-		if strings.TrimSpace(m.Key) == "" {
-			continue
+	// seq учитываем и у сообщения без годных samples: иначе следующее покажет ложный пропуск
+	replay, ok := d.trackSeq(topic, env, t)
+	if !ok || len(samples) == 0 {
+		return
+	}
+	lagMs := d.bufferedLag().Milliseconds()
+	batch := len(t.Samples) > 0
+	anyBuffered := false
+	for _, smp := range samples {
+		if replay || smp.Ts < nowMs-lagMs {
+			anyBuffered = true
+			break
 		}
+	}
+	if anyBuffered && t.Seq != nil {
+		d.seq.markBuffered(env.DeviceID)
+	}
 
-		// Rate-limit (защита от спайков)
-		if d.minWriteMs > 0 {
-			key := env.DeviceID + "|" + m.Key
+	if d.Influx == nil {
+		log.Printf("[TEL] influx_disabled topic=%s deviceId=%s samples=%d", topic, env.DeviceID, len(samples))
+		return
+	}
 
-			d.mu.Lock()
-			if d.lastWrite == nil {
-				d.lastWrite = make(map[string]int64)
+	wrote, metrics := 0, 0
+	for _, smp := range samples {
+		ts := time.UnixMilli(smp.Ts)
+		buffered := replay || smp.Ts < nowMs-lagMs
+		for _, m := range smp.Metrics {
+			metrics++
+			if strings.TrimSpace(m.Key) == "" {
+				continue
 			}
-			last := d.lastWrite[key]
-			if last != 0 && (nowMs-last) < d.minWriteMs {
+
+			// Rate-limit (защита от спайков) — только для одиночных живых измерений:
+			// пачки и точки из офлайн-буфера приходят разом по определению
+			if d.minWriteMs > 0 && !buffered && !batch {
+				key := env.DeviceID + "|" + m.Key
+
+				d.mu.Lock()
+				if d.lastWrite == nil {
+					d.lastWrite = make(map[string]int64)
+				}
+				last := d.lastWrite[key]
+				if last != 0 && (nowMs-last) < d.minWriteMs {
+					d.mu.Unlock()
+					continue
+				}
+				d.lastWrite[key] = nowMs
 				d.mu.Unlock()
-				continue
 			}
-			d.lastWrite[key] = nowMs
-			d.mu.Unlock()
-		}
 
-		p := influxdb2.NewPoint(
-			"telemetry",
-			map[string]string{
+			tags := map[string]string{
 				"deviceId": env.DeviceID,
 				"metric":   m.Key,
 				"unit":     m.Unit,
-			},
-			map[string]interface{}{
-				"value": m.Value,
-			},
-			ts,
-		)
-
-		d.Influx.WritePoint(p) // async batching
-		wrote++
+			}
+			if buffered {
+				tags["buffered"] = "true"
+			}
+			p := influxdb2.NewPoint(
+				"telemetry",
+				tags,
+				map[string]interface{}{
+					"value": m.Value,
+				},
+				ts,
+			)
+
+			d.Influx.WritePoint(p) // async batching
+			wrote++
+		}
 	}
-	log.Printf("[TEL] stored topic=%s deviceId=%s metrics=%d wrote=%d", topic, env.DeviceID, len(t.Metrics), wrote)
+	log.Printf("[TEL] stored topic=%s deviceId=%s samples=%d metrics=%d wrote=%d buffered=%t", topic, env.DeviceID, len(samples), metrics, wrote, anyBuffered)
 }
 
 func (d *Dispatcher) handleState(topic string, payload []byte, env model.Envelope) {
@@ -178,6 +269,28 @@ func (d *Dispatcher) handleState(topic string, payload []byte, env model.Envelop
 			fw,
 			env.Ts,
 		)
+
+		if s.Cfg != nil {
+			_ = d.Registry.UpdateCfgState(
+				context.Background(),
+				env.DeviceID,
+				s.Cfg.ActiveVersion,
+				s.Cfg.PendingVersion,
+				env.Ts,
+			)
+		}
+	}
+
+	if d.OTA != nil && s.FW != "" {
+		d.OTA.OnFirmware(env.DeviceID, s.FW)
+	}
+	if d.Compliance != nil && s.FW != "" {
+		d.Compliance.OnFirmware(env.DeviceID, s.FW)
+	}
+
+	// устройство ничего не применяет — cfg-блокировка доставленной версии больше не нужна
+	if s.Cfg != nil && s.Cfg.PendingVersion == nil && s.Cfg.ActiveVersion != nil {
+		d.Locks.ReleaseCfg(context.Background(), env.DeviceID, *s.Cfg.ActiveVersion)
 	}
 
 	// Influx: опционально
@@ -244,6 +357,10 @@ func (d *Dispatcher) handleEvent(topic string, payload []byte, env model.Envelop
 			"event",
 		)
 	}
+	d.lockFromEvent(env.DeviceID, e.Code)
+	if d.OTA != nil {
+		d.OTA.OnEvent(env.DeviceID, e)
+	}
 
 	if d.Influx == nil {
 		return
@@ -277,6 +394,39 @@ func (d *Dispatcher) handleEvent(topic string, payload []byte, env model.Envelop
 	p := influxdb2.NewPoint("event", tags, fields, ts)
 	d.Influx.WritePoint(p)
 }
+
+// lockFromEvent — события OTA/CFG (device-state-machine.md §4) берут и снимают блокировку устройства.
+// OTA, начатое самим устройством, тоже блокирует доставку конфигурации.
+func (d *Dispatcher) lockFromEvent(deviceID, code string) {
+	if d.Locks == nil || deviceID == "" {
+		return
+	}
+	ctx := context.Background()
+	switch code {
+	case "OTA_START":
+		cur, err := d.Locks.Get(ctx, deviceID)
+		if err != nil {
+			return
+		}
+		if cur != nil && cur.Kind == oplock.KindOTA {
+			d.Locks.Extend(ctx, deviceID, oplock.KindOTA, cur.Ref, 0)
+			return
+		}
+		if err := d.Locks.Acquire(ctx, deviceID, oplock.KindOTA, "device", "device", 0); err != nil {
+			log.Printf("[EVENT] ota_lock_conflict deviceId=%s err=%v", deviceID, err)
+		}
+	case "OTA_PROGRESS", "OTA_INSTALL":
+		// обновление идёт — продлеваем аренду, чтобы блокировка не истекла посреди записи образа
+		if cur, err := d.Locks.Get(ctx, deviceID); err == nil && cur != nil && cur.Kind == oplock.KindOTA {
+			d.Locks.Extend(ctx, deviceID, oplock.KindOTA, cur.Ref, 0)
+		}
+	case "OTA_OK", "OTA_FAIL":
+		d.Locks.Release(ctx, deviceID, oplock.KindOTA, "")
+	case "CFG_APPLY_OK", "CFG_APPLY_FAIL":
+		d.Locks.Release(ctx, deviceID, oplock.KindCfg, "")
+	}
+}
+
 func (d *Dispatcher) handleLWT(topic string, payload []byte, env model.Envelope) {
 	log.Printf("[LWT] recv topic=%s deviceId=%s ts=%d size=%d", topic, env.DeviceID, env.Ts, len(payload))
 
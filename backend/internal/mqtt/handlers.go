@@ -2,35 +2,195 @@ package mqtt
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
+	"sync/atomic"
+	"time"
 
 	mqtt "github.com/eclipse/paho.mqtt.golang"
 
+	"github.com/perm1ss10n/vexora/backend/internal/codec"
 	"github.com/perm1ss10n/vexora/backend/internal/model"
 	"github.com/perm1ss10n/vexora/backend/internal/validate"
 )
 
+// Причины отказа в обработке сообщения.
+const (
+	RejectBadTopic               = "bad_topic"
+	RejectInvalidCompression     = "invalid_compression"     // битый сжатый payload или неизвестный словарь
+	RejectUnsupportedCompression = "unsupported_compression" // неизвестный алгоритм в заголовке
+	RejectTooLarge               = "too_large"               // после распаковки больше лимита
+	RejectInvalidEncoding        = "invalid_encoding"        // битый MessagePack/CBOR
+	RejectInvalidJSON            = "invalid_json"
+	RejectInvalidEnvelope        = "invalid_envelope"
+	RejectDeviceMismatch         = "device_mismatch" // deviceId в payload не совпадает с топиком
+)
+
+// EventDeviceIDMismatch — событие безопасности: устройство пишет от имени другого (docs/security.md).
+const EventDeviceIDMismatch = "SEC_DEVICE_ID_MISMATCH"
+
+// secEventInterval — не чаще одного события о подмене deviceId на устройство.
+const secEventInterval = time.Minute
+
+type rejectCounters struct {
+	badTopic               atomic.Uint64
+	invalidCompression     atomic.Uint64
+	unsupportedCompression atomic.Uint64
+	tooLarge               atomic.Uint64
+	invalidEncoding        atomic.Uint64
+	invalidJSON            atomic.Uint64
+	invalidEnvelope        atomic.Uint64
+	deviceMismatch         atomic.Uint64
+}
+
+// MakeMessageHandler — обработка прямо в callback paho (без очереди приёма, см. Ingest).
 func MakeMessageHandler(d *Dispatcher) mqtt.MessageHandler {
 	return func(_ mqtt.Client, msg mqtt.Message) {
-		topic := msg.Topic()
-		payload := msg.Payload()
+		d.HandleMessage(msg.Topic(), msg.Payload())
+	}
+}
 
-		var env model.Envelope
-		if err := json.Unmarshal(payload, &env); err != nil {
-			log.Printf("[MQTT] topic=%s invalid_json err=%v payload=%q", topic, err, truncate(payload, 512))
-			return
-		}
-		if err := validate.EnvelopeBasic(env); err != nil {
-			log.Printf("[MQTT] topic=%s invalid_envelope err=%v deviceId=%q ts=%d v=%d", topic, err, env.DeviceID, env.Ts, env.V)
-			return
+// HandleMessage разбирает топик и envelope и передаёт сообщение обработчику своего вида.
+func (d *Dispatcher) HandleMessage(topic string, payload []byte) {
+	info, err := ParseTopic(topic)
+	if err != nil {
+		d.RejectTopic(topic)
+		return
+	}
+	d.handle(info, Props{}, topic, payload)
+}
+
+// RejectTopic учитывает сообщение с топиком вне v1/dev/{deviceId}/{kind}.
+func (d *Dispatcher) RejectTopic(topic string) {
+	if d != nil {
+		d.rejected.badTopic.Add(1)
+	}
+	log.Printf("[MQTT] topic=%s rejected reason=%s", topic, RejectBadTopic)
+}
+
+func (d *Dispatcher) handle(info TopicInfo, props Props, topic string, payload []byte) {
+	// сжатый payload (заголовок 0x00 'Z') распаковываем с лимитами размера до разбора кодировки
+	payload, frame, err := d.decompress(payload)
+	if err != nil {
+		d.rejectCompression(topic, frame, err)
+		return
+	}
+
+	// MessagePack/CBOR переводим в JSON: дальше всё разбирается в те же model-структуры
+	payload, enc, err := codec.ToJSON(payload)
+	if err != nil {
+		if d != nil {
+			d.rejected.invalidEncoding.Add(1)
 		}
+		log.Printf("[MQTT] topic=%s invalid_encoding encoding=%s err=%v", topic, enc, err)
+		return
+	}
+	// до Dispatch: ответ на это же сообщение (resp на req, например get_cfg) уходит уже в новой кодировке
+	if d != nil && d.Encodings != nil {
+		d.Encodings.Observe(info.DeviceID, enc)
+	}
 
+	var env model.Envelope
+	if err := json.Unmarshal(payload, &env); err != nil {
 		if d != nil {
-			d.Dispatch(topic, payload, env)
-			return
+			d.rejected.invalidJSON.Add(1)
 		}
+		log.Printf("[MQTT] topic=%s invalid_json err=%v payload=%q", topic, err, truncate(payload, 512))
+		return
+	}
+	if err := validate.EnvelopeBasic(env); err != nil {
+		if d != nil {
+			d.rejected.invalidEnvelope.Add(1)
+		}
+		log.Printf("[MQTT] topic=%s invalid_envelope err=%v deviceId=%q ts=%d v=%d", topic, err, env.DeviceID, env.Ts, env.V)
+		return
+	}
 
+	if d == nil {
 		log.Printf("[MQTT] topic=%s deviceId=%s ts=%d v=%d size=%d", topic, env.DeviceID, env.Ts, env.V, len(payload))
+		return
+	}
+	if env.DeviceID != info.DeviceID {
+		d.rejectMismatch(info, topic, env)
+		return
+	}
+	d.Dispatch(info, props, topic, payload, env)
+	d.trackCompression(info.DeviceID, frame)
+}
+
+func (d *Dispatcher) rejectCompression(topic string, f codec.Frame, err error) {
+	reason := RejectInvalidCompression
+	switch {
+	case errors.Is(err, codec.ErrTooLarge):
+		reason = RejectTooLarge
+	case errors.Is(err, codec.ErrUnsupportedCompression):
+		reason = RejectUnsupportedCompression
+	}
+	if d != nil {
+		switch reason {
+		case RejectTooLarge:
+			d.rejected.tooLarge.Add(1)
+		case RejectUnsupportedCompression:
+			d.rejected.unsupportedCompression.Add(1)
+		default:
+			d.rejected.invalidCompression.Add(1)
+		}
+	}
+	log.Printf("[MQTT] topic=%s %s alg=%s dictId=%d size=%d err=%v", topic, reason, f.Alg, f.DictID, f.Wire, err)
+}
+
+// rejectMismatch — payload от имени другого устройства: не обрабатываем ничего из сообщения,
+// даже Touch, и пишем событие безопасности на устройство из топика (его проверил брокер).
+func (d *Dispatcher) rejectMismatch(info TopicInfo, topic string, env model.Envelope) {
+	n := d.rejected.deviceMismatch.Add(1)
+
+	now := time.Now().UnixMilli()
+	d.mu.Lock()
+	if d.lastSecEvent == nil {
+		d.lastSecEvent = make(map[string]int64)
+	}
+	last := d.lastSecEvent[info.DeviceID]
+	report := last == 0 || now-last >= secEventInterval.Milliseconds()
+	if report {
+		d.lastSecEvent[info.DeviceID] = now
+	}
+	d.mu.Unlock()
+	if !report {
+		return
+	}
+
+	log.Printf("[SECURITY] device_id_mismatch topic=%s topicDeviceId=%s payloadDeviceId=%q mismatchesTotal=%d",
+		topic, info.DeviceID, env.DeviceID, n,
+	)
+	if d.Influx == nil {
+		return
+	}
+	d.Influx.WriteEvent(model.EventPayload{
+		V:        1,
+		DeviceID: info.DeviceID,
+		Ts:       now,
+		Code:     EventDeviceIDMismatch,
+		Severity: "error",
+		Msg:      "payload deviceId does not match topic",
+		Data: map[string]any{
+			"topic":           topic,
+			"kind":            info.Kind,
+			"payloadDeviceId": env.DeviceID,
+		},
+	})
+}
+
+// Rejected — счётчики отказов по причинам с момента старта.
+func (d *Dispatcher) Rejected() map[string]uint64 {
+	return map[string]uint64{
+		RejectBadTopic:               d.rejected.badTopic.Load(),
+		RejectInvalidCompression:     d.rejected.invalidCompression.Load(),
+		RejectUnsupportedCompression: d.rejected.unsupportedCompression.Load(),
+		RejectTooLarge:               d.rejected.tooLarge.Load(),
+		RejectInvalidEncoding:        d.rejected.invalidEncoding.Load(),
+		RejectInvalidJSON:            d.rejected.invalidJSON.Load(),
+		RejectInvalidEnvelope:        d.rejected.invalidEnvelope.Load(),
+		RejectDeviceMismatch:         d.rejected.deviceMismatch.Load(),
 	}
 }
 
@@ -0,0 +1,46 @@
+package mqtt
+
+import (
+	"testing"
+
+	"github.com/perm1ss10n/vexora/backend/internal/codec"
+	"github.com/perm1ss10n/vexora/backend/internal/model"
+)
+
+type encodingRecorder struct {
+	enc map[string]string
+}
+
+func (r *encodingRecorder) Observe(deviceID, enc string) { r.enc[deviceID] = enc }
+
+// otaProbe запоминает, какую кодировку устройства видел обработчик ack.
+type otaProbe struct {
+	encodings *encodingRecorder
+	seen      string
+}
+
+func (p *otaProbe) OnEvent(string, model.EventPayload) {}
+func (p *otaProbe) OnFirmware(string, string)          {}
+func (p *otaProbe) OnAck(deviceID string, _ model.AckPayload) bool {
+	p.seen = p.encodings.enc[deviceID]
+	return true
+}
+
+// Кодировка запоминается до Dispatch: ответы на само сообщение уходят уже в ней.
+func TestHandleObservesEncodingBeforeDispatch(t *testing.T) {
+	rec := &encodingRecorder{enc: map[string]string{"dev-1": codec.JSON}}
+	probe := &otaProbe{encodings: rec}
+	d := &Dispatcher{Encodings: rec, OTA: probe}
+
+	ack := []byte(`{"v":1,"deviceId":"dev-1","ts":1730000000000,"id":"job-1","ok":true}`)
+	for _, enc := range []string{codec.MsgPack, codec.CBOR, codec.JSON} {
+		payload, err := codec.FromJSON(ack, enc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		d.HandleMessage("v1/dev/dev-1/ack", payload)
+		if probe.seen != enc {
+			t.Errorf("%s ack: dispatch saw encoding %q", enc, probe.seen)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package mqtt
+
+import (
+	"hash/fnv"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// Политики перегрузки очереди приёма.
+const (
+	OverloadBlock = "block" // callback paho ждёт места в очереди (backpressure до брокера)
+	OverloadDrop  = "drop"  // telemetry отбрасывается первой, затем event/state/lwt; ack, cfg/status и req — никогда
+)
+
+var ingestKinds = []string{KindTelemetry, KindEvent, KindState, KindAck, KindCfgStatus, KindLWT, KindReq}
+
+type IngestConfig struct {
+	Workers   int     // шарды = воркеры; 0 — обработка прямо в callback paho (как раньше)
+	QueueSize int     // ёмкость очереди одного шарда
+	Policy    string  // block / drop
+	HighWater float64 // drop: доля заполнения шарда, выше которой telemetry уже не принимается
+}
+
+func LoadIngestConfigFromEnv() IngestConfig {
+	cfg := IngestConfig{
+		Workers:   getenvInt("INGEST_WORKERS", 8),
+		QueueSize: getenvInt("INGEST_QUEUE_SIZE", 1024),
+		Policy:    strings.ToLower(getenv("INGEST_OVERLOAD_POLICY", OverloadBlock)),
+		HighWater: 0.8,
+	}
+	if v, err := strconv.ParseFloat(os.Getenv("INGEST_TELEMETRY_HIGH_WATER"), 64); err == nil && v > 0 && v <= 1 {
+		cfg.HighWater = v
+	}
+	return cfg
+}
+
+type ingestItem struct {
+	info     TopicInfo
+	props    Props
+	topic    string
+	payload  []byte
+	enqueued time.Time
+}
+
+type kindCounters struct {
+	received  atomic.Uint64
+	processed atomic.Uint64
+	dropped   atomic.Uint64
+	blocked   atomic.Uint64 // сколько раз callback ждал места в очереди
+}
+
+// Ingest — очередь приёма MQTT: шарды по deviceId (порядок сообщений одного устройства сохраняется),
+// у каждого шарда свой воркер. Медленная запись в SQLite/Influx задерживает только свой шард.
+type Ingest struct {
+	d      *Dispatcher
+	cfg    IngestConfig
+	shards []chan ingestItem
+
+	counters map[string]*kindCounters
+	maxDepth atomic.Int64
+	lastLog  atomic.Int64 // unix ms последнего лога об отбрасывании
+	wg       sync.WaitGroup
+
+	// closeMu: EnqueueProps держит RLock на время отправки в шард, Close закрывает шарды под Lock —
+	// после Close сообщения отбрасываются, а не пишутся в закрытый канал
+	closeMu sync.RWMutex
+	closed  bool
+}
+
+// NewIngest создаёт очередь и запускает воркеры (при Workers > 0).
+func NewIngest(d *Dispatcher, cfg IngestConfig) *Ingest {
+	if cfg.Workers < 0 {
+		cfg.Workers = 0
+	}
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = 1024
+	}
+	if cfg.Policy != OverloadDrop {
+		cfg.Policy = OverloadBlock
+	}
+	if cfg.HighWater <= 0 || cfg.HighWater > 1 {
+		cfg.HighWater = 0.8
+	}
+
+	in := &Ingest{d: d, cfg: cfg, counters: make(map[string]*kindCounters, len(ingestKinds))}
+	for _, k := range ingestKinds {
+		in.counters[k] = &kindCounters{}
+	}
+	for i := 0; i < cfg.Workers; i++ {
+		ch := make(chan ingestItem, cfg.QueueSize)
+		in.shards = append(in.shards, ch)
+		in.wg.Add(1)
+		go in.worker(ch)
+	}
+	return in
+}
+
+func (in *Ingest) Config() IngestConfig {
+	return in.cfg
+}
+
+// Handler — MessageHandler для подписок paho.
+func (in *Ingest) Handler() mqtt.MessageHandler {
+	return func(_ mqtt.Client, msg mqtt.Message) {
+		in.Enqueue(msg.Topic(), msg.Payload())
+	}
+}
+
+// Enqueue ставит сообщение в очередь шарда устройства; false — сообщение отброшено.
+// Топик разбирается до очереди: шард выбирается по deviceId из топика, а не из payload.
+func (in *Ingest) Enqueue(topic string, payload []byte) bool {
+	return in.EnqueueProps(topic, payload, Props{})
+}
+
+// EnqueueProps — Enqueue со свойствами MQTT 5 (Client5).
+func (in *Ingest) EnqueueProps(topic string, payload []byte, props Props) bool {
+	info, err := ParseTopic(topic)
+	if err != nil {
+		in.d.RejectTopic(topic)
+		return false
+	}
+	kind := info.Kind
+	c := in.counters[kind]
+	c.received.Add(1)
+
+	in.closeMu.RLock()
+	defer in.closeMu.RUnlock()
+	if in.closed {
+		in.drop(c, topic, kind, 0)
+		return false
+	}
+
+	if len(in.shards) == 0 {
+		in.d.handle(info, props, topic, payload)
+		c.processed.Add(1)
+		return true
+	}
+
+	it := ingestItem{info: info, props: props, topic: topic, payload: payload, enqueued: time.Now()}
+	ch := in.shards[shardOf(info.DeviceID, len(in.shards))]
+
+	if in.cfg.Policy == OverloadDrop && !neverDrop(kind) {
+		limit := cap(ch)
+		if kind == KindTelemetry {
+			limit = int(float64(cap(ch)) * in.cfg.HighWater)
+		}
+		if len(ch) >= limit {
+			in.drop(c, topic, kind, len(ch))
+			return false
+		}
+		select {
+		case ch <- it:
+			in.observeDepth(len(ch))
+			return true
+		default:
+			in.drop(c, topic, kind, len(ch))
+			return false
+		}
+	}
+
+	select {
+	case ch <- it:
+	default:
+		c.blocked.Add(1)
+		ch <- it
+	}
+	in.observeDepth(len(ch))
+	return true
+}
+
+func (in *Ingest) worker(ch chan ingestItem) {
+	defer in.wg.Done()
+	for it := range ch {
+		in.d.handle(it.info, it.props, it.topic, it.payload)
+		in.counters[it.info.Kind].processed.Add(1)
+	}
+}
+
+// Close перестаёт принимать сообщения и дожидается обработки уже поставленных в очередь.
+// Клиент MQTT лучше остановить раньше: что придёт после Close, отбрасывается (dropped).
+func (in *Ingest) Close() {
+	in.closeMu.Lock()
+	if in.closed {
+		in.closeMu.Unlock()
+		return
+	}
+	in.closed = true
+	for _, ch := range in.shards {
+		close(ch)
+	}
+	in.closeMu.Unlock()
+	in.wg.Wait()
+}
+
+func (in *Ingest) drop(c *kindCounters, topic, kind string, depth int) {
+	n := c.dropped.Add(1)
+	// при перегрузке лог сам становится нагрузкой: не чаще раза в секунду
+	now := time.Now().UnixMilli()
+	last := in.lastLog.Load()
+	if now-last >= 1000 && in.lastLog.CompareAndSwap(last, now) {
+		log.Printf("[INGEST] dropped topic=%s kind=%s depth=%d droppedTotal=%d", topic, kind, depth, n)
+	}
+}
+
+func (in *Ingest) observeDepth(depth int) {
+	for {
+		cur := in.maxDepth.Load()
+		if int64(depth) <= cur || in.maxDepth.CompareAndSwap(cur, int64(depth)) {
+			return
+		}
+	}
+}
+
+// IngestKindStats — счётчики по виду сообщений с момента старта.
+type IngestKindStats struct {
+	Received  uint64
+	Processed uint64
+	Dropped   uint64
+	Blocked   uint64
+}
+
+type IngestStats struct {
+	Workers     int
+	QueueSize   int
+	Policy      string
+	Depth       int   // сейчас в очередях всех шардов
+	ShardDepths []int // по шардам
+	MaxDepth    int   // максимум заполнения одного шарда с момента старта
+	Dropped     uint64
+	Kinds       map[string]IngestKindStats
+	Rejected    map[string]uint64 // не прошли проверку топика/envelope (в очередь не попадают или отбрасываются воркером)
+}
+
+func (in *Ingest) Stats() IngestStats {
+	st := IngestStats{
+		Workers:     in.cfg.Workers,
+		QueueSize:   in.cfg.QueueSize,
+		Policy:      in.cfg.Policy,
+		ShardDepths: make([]int, 0, len(in.shards)),
+		MaxDepth:    int(in.maxDepth.Load()),
+		Kinds:       make(map[string]IngestKindStats, len(in.counters)),
+		Rejected:    in.d.Rejected(),
+	}
+	for _, ch := range in.shards {
+		st.ShardDepths = append(st.ShardDepths, len(ch))
+		st.Depth += len(ch)
+	}
+	for k, c := range in.counters {
+		ks := IngestKindStats{
+			Received:  c.received.Load(),
+			Processed: c.processed.Load(),
+			Dropped:   c.dropped.Load(),
+			Blocked:   c.blocked.Load(),
+		}
+		st.Dropped += ks.Dropped
+		st.Kinds[k] = ks
+	}
+	return st
+}
+
+// neverDrop — потеря этих сообщений ломает протокол: ожидающие команды, блокировки cfg, ответы на req.
+func neverDrop(kind string) bool {
+	return kind == KindAck || kind == KindCfgStatus || kind == KindReq
+}
+
+func shardOf(key string, n int) int {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	return int(h.Sum32() % uint32(n))
+}
+
+func getenvInt(k string, def int) int {
+	v := os.Getenv(k)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return def
+	}
+	return n
+}
@@ -0,0 +1,47 @@
+package mqtt
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// Close во время приёма: без паники на закрытом канале, принятое до Close обработано, после — отброшено.
+func TestIngestCloseWhileEnqueueing(t *testing.T) {
+	for _, policy := range []string{OverloadBlock, OverloadDrop} {
+		t.Run(policy, func(t *testing.T) {
+			in := NewIngest(&Dispatcher{}, IngestConfig{Workers: 4, QueueSize: 8, Policy: policy})
+
+			var accepted atomic.Uint64
+			var wg sync.WaitGroup
+			for g := 0; g < 8; g++ {
+				wg.Add(1)
+				go func(g int) {
+					defer wg.Done()
+					for i := 0; i < 500; i++ {
+						// пустой envelope: воркер быстро отбрасывает его как invalid_envelope
+						if in.Enqueue(fmt.Sprintf("v1/dev/dev-%d/ack", i%16), []byte(`{}`)) {
+							accepted.Add(1)
+						}
+					}
+				}(g)
+			}
+			in.Close()
+			wg.Wait()
+			in.Close() // повторный Close безопасен
+
+			if in.Enqueue("v1/dev/dev-1/ack", []byte(`{}`)) {
+				t.Error("message accepted after Close")
+			}
+			st := in.Stats()
+			ack := st.Kinds[KindAck]
+			if ack.Processed != accepted.Load() {
+				t.Errorf("processed %d of %d accepted", ack.Processed, accepted.Load())
+			}
+			if ack.Received != ack.Processed+ack.Dropped {
+				t.Errorf("received %d != processed %d + dropped %d", ack.Received, ack.Processed, ack.Dropped)
+			}
+		})
+	}
+}
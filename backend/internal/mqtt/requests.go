@@ -0,0 +1,224 @@
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/perm1ss10n/vexora/backend/internal/model"
+)
+
+// RequestHandler обрабатывает запрос устройства (v1/dev/{id}/req) и возвращает data для resp.
+type RequestHandler func(ctx context.Context, deviceID string, req model.RequestPayload) (map[string]any, error)
+
+// RequestError — ошибка с кодом для устройства. Прочие ошибки уходят как INTERNAL.
+type RequestError struct {
+	Code string
+	Msg  string
+}
+
+func (e *RequestError) Error() string {
+	return e.Code + ": " + e.Msg
+}
+
+const requestTimeout = 5 * time.Second
+
+// RequestLimits — сколько запросов устройств обрабатывается одновременно. Сверх лимита
+// устройство сразу получает resp с code=BUSY и повторяет запрос позже.
+type RequestLimits struct {
+	MaxInflight  int // всего
+	MaxPerDevice int // от одного устройства
+}
+
+func LoadRequestLimitsFromEnv() RequestLimits {
+	return RequestLimits{
+		MaxInflight:  getenvInt("REQ_MAX_INFLIGHT", 64),
+		MaxPerDevice: getenvInt("REQ_MAX_INFLIGHT_PER_DEVICE", 4),
+	}
+}
+
+type requestSlots struct {
+	mu       sync.Mutex
+	limits   RequestLimits
+	total    int
+	byDevice map[string]int
+}
+
+// SetRequestLimits задаёт лимиты одновременных запросов.
+func (d *Dispatcher) SetRequestLimits(l RequestLimits) {
+	d.requests.mu.Lock()
+	defer d.requests.mu.Unlock()
+	d.requests.limits = l
+}
+
+func (s *requestSlots) acquire(deviceID string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l := s.limits
+	if l.MaxInflight <= 0 {
+		l.MaxInflight = 64
+	}
+	if l.MaxPerDevice <= 0 {
+		l.MaxPerDevice = 4
+	}
+	if s.total >= l.MaxInflight || s.byDevice[deviceID] >= l.MaxPerDevice {
+		return false
+	}
+	if s.byDevice == nil {
+		s.byDevice = make(map[string]int)
+	}
+	s.total++
+	s.byDevice[deviceID]++
+	return true
+}
+
+func (s *requestSlots) release(deviceID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.total--
+	if s.byDevice[deviceID] <= 1 {
+		delete(s.byDevice, deviceID)
+	} else {
+		s.byDevice[deviceID]--
+	}
+}
+
+// HandleRequest регистрирует обработчик метода. Повторная регистрация заменяет прежний.
+func (d *Dispatcher) HandleRequest(method string, h RequestHandler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.reqHandlers == nil {
+		d.reqHandlers = make(map[string]RequestHandler)
+	}
+	d.reqHandlers[method] = h
+}
+
+// RegisterDefaultRequestHandlers — встроенные методы: time, get_cfg, get_pending_cmds.
+func (d *Dispatcher) RegisterDefaultRequestHandlers() {
+	d.HandleRequest("time", d.reqTime)
+	d.HandleRequest("get_cfg", d.reqGetCfg)
+	d.HandleRequest("get_pending_cmds", d.reqGetPendingCmds)
+}
+
+func (d *Dispatcher) handleRequest(topic string, payload []byte, env model.Envelope) {
+	var req model.RequestPayload
+	if err := json.Unmarshal(payload, &req); err != nil {
+		log.Printf("[REQ] invalid_json topic=%s err=%v", topic, err)
+		return
+	}
+
+	log.Printf("[REQ] recv topic=%s deviceId=%s id=%s method=%s ts=%d size=%d", topic, env.DeviceID, req.ID, req.Method, env.Ts, len(payload))
+
+	// не блокируем callback paho: ответ публикуется с ожиданием токена. Горутин не больше лимитов;
+	// сверх них BUSY публикуется сразу здесь — это дёшево и притормаживает только шард устройства
+	if !d.requests.acquire(env.DeviceID) {
+		log.Printf("[REQ] busy deviceId=%s id=%s method=%s", env.DeviceID, req.ID, req.Method)
+		d.publishResponse(model.ResponsePayload{
+			V:        1,
+			ID:       req.ID,
+			DeviceID: env.DeviceID,
+			Code:     "BUSY",
+			Msg:      "too many requests in flight, retry later",
+		})
+		return
+	}
+	go func() {
+		defer d.requests.release(env.DeviceID)
+		d.serveRequest(env.DeviceID, req)
+	}()
+}
+
+func (d *Dispatcher) serveRequest(deviceID string, req model.RequestPayload) {
+	resp := model.ResponsePayload{
+		V:        1,
+		ID:       req.ID,
+		DeviceID: deviceID,
+	}
+
+	d.mu.Lock()
+	h := d.reqHandlers[req.Method]
+	d.mu.Unlock()
+
+	switch {
+	case req.ID == "":
+		resp.Code, resp.Msg = "BAD_REQUEST", "missing id"
+	case req.Method == "":
+		resp.Code, resp.Msg = "BAD_REQUEST", "missing method"
+	case h == nil:
+		resp.Code, resp.Msg = "UNKNOWN_METHOD", req.Method
+	default:
+		ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
+		data, err := h(ctx, deviceID, req)
+		cancel()
+
+		var reqErr *RequestError
+		switch {
+		case err == nil:
+			resp.Ok, resp.Code, resp.Data = true, "OK", data
+		case errors.As(err, &reqErr):
+			resp.Code, resp.Msg = reqErr.Code, reqErr.Msg
+		default:
+			log.Printf("[REQ] handler_failed deviceId=%s id=%s method=%s err=%v", deviceID, req.ID, req.Method, err)
+			resp.Code, resp.Msg = "INTERNAL", "internal error"
+		}
+	}
+
+	d.publishResponse(resp)
+}
+
+func (d *Dispatcher) publishResponse(resp model.ResponsePayload) {
+	if d.Publisher == nil {
+		log.Printf("[REQ] no_publisher deviceId=%s id=%s", resp.DeviceID, resp.ID)
+		return
+	}
+	resp.Ts = time.Now().UnixMilli()
+
+	b, err := json.Marshal(resp)
+	if err != nil {
+		log.Printf("[REQ] marshal_failed deviceId=%s id=%s err=%v", resp.DeviceID, resp.ID, err)
+		return
+	}
+	topic := fmt.Sprintf("v1/dev/%s/resp", resp.DeviceID)
+	if err := d.Publisher.Publish(topic, 1, false, b); err != nil {
+		log.Printf("[REQ] publish_failed topic=%s id=%s err=%v", topic, resp.ID, err)
+		return
+	}
+	log.Printf("[REQ] resp topic=%s id=%s ok=%v code=%s", topic, resp.ID, resp.Ok, resp.Code)
+}
+
+// ===== built-in handlers =====
+
+func (d *Dispatcher) reqTime(_ context.Context, _ string, _ model.RequestPayload) (map[string]any, error) {
+	now := time.Now()
+	return map[string]any{
+		"ts":   now.UnixMilli(),
+		"unix": now.Unix(),
+		"iso":  now.UTC().Format(time.RFC3339),
+	}, nil
+}
+
+func (d *Dispatcher) reqGetCfg(ctx context.Context, deviceID string, _ model.RequestPayload) (map[string]any, error) {
+	if d.Configs == nil {
+		return nil, &RequestError{Code: "NOT_FOUND", Msg: "no desired config"}
+	}
+	version, cfg, err := d.Configs.DesiredConfig(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if cfg == nil {
+		return nil, &RequestError{Code: "NOT_FOUND", Msg: "no desired config"}
+	}
+	return map[string]any{"cfgVersion": version, "cfg": cfg}, nil
+}
+
+func (d *Dispatcher) reqGetPendingCmds(_ context.Context, deviceID string, _ model.RequestPayload) (map[string]any, error) {
+	cmds := []model.CommandPayload{}
+	if d.Commands != nil {
+		cmds = d.Commands.PendingFor(deviceID)
+	}
+	return map[string]any{"cmds": cmds}, nil
+}
@@ -0,0 +1,301 @@
+package mqtt
+
+import (
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/perm1ss10n/vexora/backend/internal/model"
+)
+
+// EventTelemetryGap — backend обнаружил пропуск seq телеметрии устройства.
+const EventTelemetryGap = "TELEMETRY_GAP"
+
+// Результат учёта seq одного сообщения телеметрии.
+const (
+	seqNew       = iota // новое сообщение по порядку
+	seqDuplicate        // уже принято — отбрасываем
+	seqLate             // заполняет ранее обнаруженный пропуск или старше окна — из буфера устройства
+)
+
+type SeqConfig struct {
+	Window      int           // сколько последних seq помним для дедупликации
+	BufferedLag time.Duration // ts старше now-BufferedLag — точка из офлайн-буфера устройства
+}
+
+func LoadSeqConfigFromEnv() SeqConfig {
+	cfg := SeqConfig{Window: 4096, BufferedLag: time.Minute}
+	if n, err := strconv.Atoi(os.Getenv("TELEMETRY_SEQ_WINDOW")); err == nil && n > 0 {
+		cfg.Window = n
+	}
+	if n, err := strconv.ParseInt(os.Getenv("TELEMETRY_BUFFERED_LAG_MS"), 10, 64); err == nil && n > 0 {
+		cfg.BufferedLag = time.Duration(n) * time.Millisecond
+	}
+	return cfg
+}
+
+// DeliveryStats — полнота доставки телеметрии устройства (по seq, с момента старта backend).
+type DeliveryStats struct {
+	DeviceID     string
+	LastSeq      int64
+	Received     uint64 // принятые сообщения с seq (без дублей)
+	Duplicates   uint64
+	Buffered     uint64 // принятые из офлайн-буфера (поздние / со старым ts)
+	Gaps         uint64 // сколько раз обнаружен пропуск
+	Missing      uint64 // seq, которые так и не пришли
+	Recovered    uint64 // пропущенные seq, пришедшие позже
+	Resets       uint64 // seq начался заново (перезагрузка устройства)
+	Completeness float64
+	LastGapMs    int64
+	UpdatedMs    int64
+}
+
+// deviceSeq — окно последних seq устройства: бит i — принят ли seq с seq%window == i.
+type deviceSeq struct {
+	w     int64 // размер окна
+	max   int64
+	maxTs int64
+	seen  []uint64
+	stats DeliveryStats
+}
+
+type seqTracker struct {
+	mu      sync.Mutex
+	cfg     SeqConfig
+	devices map[string]*deviceSeq
+}
+
+// SetSeqConfig задаёт окно дедупликации и порог "буферизованной" точки.
+func (d *Dispatcher) SetSeqConfig(cfg SeqConfig) {
+	d.seq.mu.Lock()
+	defer d.seq.mu.Unlock()
+	if cfg.Window <= 0 {
+		cfg.Window = 4096
+	}
+	d.seq.cfg = cfg
+}
+
+// gap — обнаруженный пропуск: seq from..to включительно не пришли.
+type gap struct {
+	from, to int64
+}
+
+// track учитывает seq сообщения. Перезагрузка устройства (seq меньше максимального) распознаётся,
+// если ts новее последнего, либо по самому seq — часы после перезагрузки могут быть не синхронизированы:
+// отсчёт начался заново (seq 0/1, уже виденный в окне) или seq из начала счётчика отстал на окно и больше.
+// Иначе seq меньше максимального — дубль или поздняя точка из офлайн-буфера.
+func (t *seqTracker) track(deviceID string, seq, ts int64) (int, *gap) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.cfg.Window <= 0 {
+		t.cfg.Window = 4096
+	}
+	if t.devices == nil {
+		t.devices = make(map[string]*deviceSeq)
+	}
+	now := time.Now().UnixMilli()
+	ds := t.devices[deviceID]
+	if ds == nil {
+		ds = &deviceSeq{w: int64(t.cfg.Window), seen: make([]uint64, (t.cfg.Window+63)/64)}
+		ds.stats.DeviceID = deviceID
+		ds.reset(seq, ts)
+		ds.stats.Received++
+		ds.stats.UpdatedMs = now
+		t.devices[deviceID] = ds
+		return seqNew, nil
+	}
+	ds.stats.UpdatedMs = now
+
+	switch {
+	case seq > ds.max:
+		var g *gap
+		if seq-ds.max > 1 {
+			g = &gap{from: ds.max + 1, to: seq - 1}
+			ds.stats.Gaps++
+			ds.stats.Missing += uint64(seq - ds.max - 1)
+			ds.stats.LastGapMs = now
+		}
+		if seq-ds.max >= ds.w {
+			clear(ds.seen)
+		} else {
+			for s := ds.max + 1; s < seq; s++ {
+				ds.setBit(s, false)
+			}
+		}
+		ds.max, ds.maxTs = seq, ts
+		ds.setBit(seq, true)
+		ds.stats.Received++
+		return seqNew, g
+
+	case ds.restarted(seq, ts):
+		ds.stats.Resets++
+		ds.reset(seq, ts)
+		ds.stats.Received++
+		return seqNew, nil
+
+	case seq > ds.max-ds.w:
+		if ds.bit(seq) {
+			ds.stats.Duplicates++
+			return seqDuplicate, nil
+		}
+		ds.setBit(seq, true)
+		if ds.stats.Missing > 0 {
+			ds.stats.Missing--
+		}
+		ds.stats.Recovered++
+		ds.stats.Received++
+		return seqLate, nil
+	}
+
+	// старше окна: не можем отличить дубль от поздней точки — принимаем как буферизованную
+	ds.stats.Received++
+	return seqLate, nil
+}
+
+func (t *seqTracker) markBuffered(deviceID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if ds := t.devices[deviceID]; ds != nil {
+		ds.stats.Buffered++
+	}
+}
+
+func (t *seqTracker) snapshot(deviceID string) (DeliveryStats, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ds := t.devices[deviceID]
+	if ds == nil {
+		return DeliveryStats{}, false
+	}
+	return ds.snapshot(), true
+}
+
+func (t *seqTracker) all() []DeliveryStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]DeliveryStats, 0, len(t.devices))
+	for _, ds := range t.devices {
+		out = append(out, ds.snapshot())
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Completeness != out[j].Completeness {
+			return out[i].Completeness < out[j].Completeness
+		}
+		return out[i].DeviceID < out[j].DeviceID
+	})
+	return out
+}
+
+// restarted — seq <= max начинает новый отсчёт, а не повторяет старый.
+func (ds *deviceSeq) restarted(seq, ts int64) bool {
+	switch {
+	case ts > ds.maxTs:
+		return true
+	case seq <= 1 && ds.bit(seq):
+		return true
+	case seq < ds.w && ds.max-seq >= ds.w:
+		// поздние точки из буфера так далеко от max не отстают: они близко к старому max, а не к началу счётчика
+		return true
+	}
+	return false
+}
+
+func (ds *deviceSeq) reset(seq, ts int64) {
+	clear(ds.seen)
+	ds.max, ds.maxTs = seq, ts
+	ds.setBit(seq, true)
+}
+
+func (ds *deviceSeq) snapshot() DeliveryStats {
+	st := ds.stats
+	st.LastSeq = ds.max
+	st.Completeness = 1
+	if expected := st.Received + st.Missing; expected > 0 {
+		st.Completeness = float64(st.Received) / float64(expected)
+	}
+	return st
+}
+
+func (ds *deviceSeq) bit(seq int64) bool {
+	i := ((seq % ds.w) + ds.w) % ds.w
+	return ds.seen[i/64]&(1<<(i%64)) != 0
+}
+
+func (ds *deviceSeq) setBit(seq int64, v bool) {
+	i := ((seq % ds.w) + ds.w) % ds.w
+	if v {
+		ds.seen[i/64] |= 1 << (i % 64)
+	} else {
+		ds.seen[i/64] &^= 1 << (i % 64)
+	}
+}
+
+// trackSeq — учёт seq сообщения телеметрии: false — дубль, сообщение не записываем.
+// replay — всё сообщение из офлайн-буфера устройства: заполняет пропуск seq или meta.buffered.
+func (d *Dispatcher) trackSeq(topic string, env model.Envelope, t model.TelemetryPayload) (replay bool, ok bool) {
+	if flag, _ := t.Meta["buffered"].(bool); flag {
+		replay = true
+	}
+	if t.Seq == nil {
+		return replay, true
+	}
+
+	res, g := d.seq.track(env.DeviceID, *t.Seq, env.Ts)
+	switch res {
+	case seqDuplicate:
+		log.Printf("[TEL] duplicate topic=%s deviceId=%s seq=%d ts=%d", topic, env.DeviceID, *t.Seq, env.Ts)
+		return false, false
+	case seqLate:
+		replay = true
+	}
+	if g != nil {
+		d.telemetryGap(env.DeviceID, *g, time.Now().UnixMilli())
+	}
+	return replay, true
+}
+
+// bufferedLag — точка с ts старше now-lag считается буферизованной.
+func (d *Dispatcher) bufferedLag() time.Duration {
+	d.seq.mu.Lock()
+	lag := d.seq.cfg.BufferedLag
+	d.seq.mu.Unlock()
+	if lag <= 0 {
+		lag = time.Minute
+	}
+	return lag
+}
+
+func (d *Dispatcher) telemetryGap(deviceID string, g gap, nowMs int64) {
+	missing := g.to - g.from + 1
+	log.Printf("[TEL] gap deviceId=%s fromSeq=%d toSeq=%d missing=%d", deviceID, g.from, g.to, missing)
+	if d.Influx == nil {
+		return
+	}
+	d.Influx.WriteEvent(model.EventPayload{
+		V:        1,
+		DeviceID: deviceID,
+		Ts:       nowMs,
+		Code:     EventTelemetryGap,
+		Severity: "warn",
+		Msg:      "telemetry seq gap",
+		Data: map[string]any{
+			"fromSeq": g.from,
+			"toSeq":   g.to,
+			"missing": missing,
+		},
+	})
+}
+
+// Delivery — полнота доставки телеметрии устройства; false — устройство не присылало seq.
+func (d *Dispatcher) Delivery(deviceID string) (DeliveryStats, bool) {
+	return d.seq.snapshot(deviceID)
+}
+
+// DeliveryAll — все устройства с seq, худшая полнота первой.
+func (d *Dispatcher) DeliveryAll() []DeliveryStats {
+	return d.seq.all()
+}
@@ -0,0 +1,119 @@
+package mqtt
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func newTestTracker(window int) *seqTracker {
+	return &seqTracker{cfg: SeqConfig{Window: window}}
+}
+
+// Перезагрузка с несинхронизированными часами: ts уходит назад, seq начинается с 1.
+func TestSeqResetWithBackwardTs(t *testing.T) {
+	const window = 64
+	cases := []struct {
+		name    string
+		lastSeq int64 // до перезагрузки; отсчёт с 1 (с 0 у zero-based)
+		first   int64 // первый seq после перезагрузки, что дошёл
+	}{
+		{"counter beyond window", 1000, 1},
+		{"counter within window", 20, 1},
+		{"zero-based counter", 20, 0},
+		{"first message after reboot lost", 1000, 3},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			tr := newTestTracker(window)
+			const dev = "dev-1"
+			for seq := min(tc.first, 1); seq <= tc.lastSeq; seq++ {
+				tr.track(dev, seq, 1_730_000_000_000+seq*1000)
+			}
+			// часы после перезагрузки — с 2000 года
+			for seq := tc.first; seq < tc.first+10; seq++ {
+				if res, _ := tr.track(dev, seq, 946_684_800_000+seq*1000); res != seqNew {
+					t.Fatalf("seq %d after reboot: result %d, want new", seq, res)
+				}
+			}
+			st, _ := tr.snapshot(dev)
+			if st.Resets != 1 || st.Duplicates != 0 {
+				t.Errorf("resets=%d duplicates=%d, want 1 and 0", st.Resets, st.Duplicates)
+			}
+			if st.LastSeq != tc.first+9 {
+				t.Errorf("lastSeq = %d, want %d", st.LastSeq, tc.first+9)
+			}
+		})
+	}
+}
+
+func TestSeqTrack(t *testing.T) {
+	const dev = "dev-1"
+	ts := func(seq int64) int64 { return 1_730_000_000_000 + seq*1000 }
+
+	tr := newTestTracker(64)
+	for seq := int64(1); seq <= 10; seq++ {
+		tr.track(dev, seq, ts(seq))
+	}
+
+	// повтор после flush офлайн-очереди — дубль, а не перезагрузка
+	if res, _ := tr.track(dev, 7, ts(7)); res != seqDuplicate {
+		t.Errorf("repeated seq 7: result %d, want duplicate", res)
+	}
+
+	// пропуск и его заполнение из буфера
+	res, g := tr.track(dev, 15, ts(15))
+	if res != seqNew || g == nil || g.from != 11 || g.to != 14 {
+		t.Fatalf("seq 15: result %d gap %+v, want new with gap 11..14", res, g)
+	}
+	if res, _ := tr.track(dev, 12, ts(12)); res != seqLate {
+		t.Errorf("seq 12 filling the gap: result %d, want late", res)
+	}
+
+	// перезагрузка с синхронизированными часами: seq 1, ts новее
+	if res, _ := tr.track(dev, 1, ts(100)); res != seqNew {
+		t.Errorf("reboot with newer ts: result %d, want new", res)
+	}
+
+	st, _ := tr.snapshot(dev)
+	want := DeliveryStats{DeviceID: dev, LastSeq: 1, Received: 13, Duplicates: 1, Gaps: 1, Missing: 3, Recovered: 1, Resets: 1}
+	st.Completeness, st.UpdatedMs, st.LastGapMs = 0, 0, 0
+	if st != want {
+		t.Errorf("stats:\n got %+v\nwant %+v", st, want)
+	}
+}
+
+// Долгий офлайн-буфер: точки старше окна, но не из начала счётчика — поздние, не перезагрузка.
+func TestSeqOldBufferedIsNotReset(t *testing.T) {
+	const dev = "dev-1"
+	tr := newTestTracker(64)
+	tr.track(dev, 500, 1_730_000_500_000)
+	for seq := int64(300); seq < 310; seq++ {
+		if res, _ := tr.track(dev, seq, 1_730_000_000_000+seq*1000); res != seqLate {
+			t.Fatalf("seq %d: result %d, want late", seq, res)
+		}
+	}
+	if st, _ := tr.snapshot(dev); st.Resets != 0 || st.LastSeq != 500 {
+		t.Errorf("resets=%d lastSeq=%d, want 0 and 500", st.Resets, st.LastSeq)
+	}
+}
+
+// Сообщение, у которого все samples отброшены по ts, всё равно учитывается в seq.
+func TestTelemetrySeqWithAllSamplesRejected(t *testing.T) {
+	d := &Dispatcher{}
+	now := time.Now().UnixMilli()
+	msg := func(seq, sampleTs int64) []byte {
+		return []byte(fmt.Sprintf(`{"v":1,"deviceId":"dev-1","ts":%d,"seq":%d,"samples":[{"ts":%d,"metrics":[{"key":"temp","value":21.5}]}]}`, now, seq, sampleTs))
+	}
+	d.HandleMessage("v1/dev/dev-1/telemetry", msg(1, now))
+	d.HandleMessage("v1/dev/dev-1/telemetry", msg(2, now+time.Hour.Milliseconds())) // из будущего — отброшен
+	d.HandleMessage("v1/dev/dev-1/telemetry", msg(3, now))
+
+	st, ok := d.Delivery("dev-1")
+	if !ok {
+		t.Fatal("no delivery stats")
+	}
+	if st.Gaps != 0 || st.Missing != 0 || st.LastSeq != 3 || st.Received != 3 {
+		t.Errorf("stats = %+v, want lastSeq 3, 3 received, no gaps", st)
+	}
+}
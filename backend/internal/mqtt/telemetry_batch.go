@@ -0,0 +1,75 @@
+package mqtt
+
+import (
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/perm1ss10n/vexora/backend/internal/model"
+)
+
+// TelemetryLimits — ограничения пачки samples в одном сообщении телеметрии.
+type TelemetryLimits struct {
+	MaxSamples int           // больше — сообщение отклоняется целиком (устройство делит пачку)
+	MaxFuture  time.Duration // ts sample не может опережать время backend больше чем на это
+	MaxAge     time.Duration // и не может быть старше
+}
+
+func LoadTelemetryLimitsFromEnv() TelemetryLimits {
+	l := TelemetryLimits{MaxSamples: 500, MaxFuture: 5 * time.Minute, MaxAge: 30 * 24 * time.Hour}
+	if n, err := strconv.Atoi(os.Getenv("TELEMETRY_MAX_SAMPLES")); err == nil && n > 0 {
+		l.MaxSamples = n
+	}
+	if n, err := strconv.ParseInt(os.Getenv("TELEMETRY_MAX_FUTURE_MS"), 10, 64); err == nil && n >= 0 {
+		l.MaxFuture = time.Duration(n) * time.Millisecond
+	}
+	if n, err := strconv.ParseInt(os.Getenv("TELEMETRY_MAX_SAMPLE_AGE_MS"), 10, 64); err == nil && n > 0 {
+		l.MaxAge = time.Duration(n) * time.Millisecond
+	}
+	return l
+}
+
+// SetTelemetryLimits задаёт ограничения пачек телеметрии.
+func (d *Dispatcher) SetTelemetryLimits(l TelemetryLimits) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.limits = l
+}
+
+func (d *Dispatcher) telemetryLimits() TelemetryLimits {
+	d.mu.Lock()
+	l := d.limits
+	d.mu.Unlock()
+	if l.MaxSamples <= 0 {
+		l.MaxSamples = 500
+	}
+	if l.MaxFuture <= 0 {
+		l.MaxFuture = 5 * time.Minute
+	}
+	if l.MaxAge <= 0 {
+		l.MaxAge = 30 * 24 * time.Hour
+	}
+	return l
+}
+
+// telemetrySamples разворачивает сообщение в samples: metrics верхнего уровня — sample на env.ts,
+// затем samples пачки с проверкой ts. rejected — отброшенные samples с недопустимым ts.
+func telemetrySamples(t model.TelemetryPayload, env model.Envelope, l TelemetryLimits, nowMs int64) (out []model.TelemetrySample, rejected int) {
+	out = make([]model.TelemetrySample, 0, len(t.Samples)+1)
+	if len(t.Metrics) > 0 {
+		out = append(out, model.TelemetrySample{Ts: env.Ts, Metrics: t.Metrics})
+	}
+	minTs := nowMs - l.MaxAge.Milliseconds()
+	maxTs := nowMs + l.MaxFuture.Milliseconds()
+	for _, s := range t.Samples {
+		if s.Ts <= 0 || s.Ts < minTs || s.Ts > maxTs {
+			rejected++
+			continue
+		}
+		if len(s.Metrics) == 0 {
+			continue
+		}
+		out = append(out, s)
+	}
+	return out, rejected
+}
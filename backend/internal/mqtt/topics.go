@@ -1,5 +1,10 @@
 package mqtt
 
+import (
+	"errors"
+	"strings"
+)
+
 var (
 	TopicTelemetry = "v1/dev/+/telemetry"
 	TopicEvent     = "v1/dev/+/event"
@@ -7,6 +12,7 @@ var (
 	TopicAck       = "v1/dev/+/ack"
 	TopicCfgStatus = "v1/dev/+/cfg/status"
 	TopicLWT       = "v1/dev/+/lwt"
+	TopicReq       = "v1/dev/+/req"
 )
 
 var AllTopics = []string{
@@ -16,4 +22,51 @@ var AllTopics = []string{
 	TopicAck,
 	TopicCfgStatus,
 	TopicLWT,
+	TopicReq,
+}
+
+// Виды сообщений устройство → облако (последние сегменты топика).
+const (
+	KindTelemetry = "telemetry"
+	KindEvent     = "event"
+	KindState     = "state"
+	KindAck       = "ack"
+	KindCfgStatus = "cfg_status"
+	KindLWT       = "lwt"
+	KindReq       = "req"
+)
+
+var topicKinds = map[string]string{
+	"telemetry":  KindTelemetry,
+	"event":      KindEvent,
+	"state":      KindState,
+	"ack":        KindAck,
+	"cfg/status": KindCfgStatus,
+	"lwt":        KindLWT,
+	"req":        KindReq,
+}
+
+var ErrBadTopic = errors.New("bad topic")
+
+// TopicInfo — разобранный топик v1/dev/{deviceId}/{kind}.
+// DeviceID из топика — то, что проверил брокер (ACL); deviceId в payload обязан с ним совпадать.
+type TopicInfo struct {
+	DeviceID string
+	Kind     string
+}
+
+func ParseTopic(topic string) (TopicInfo, error) {
+	rest, ok := strings.CutPrefix(topic, "v1/dev/")
+	if !ok {
+		return TopicInfo{}, ErrBadTopic
+	}
+	id, suffix, ok := strings.Cut(rest, "/")
+	if !ok || id == "" || strings.ContainsAny(id, "+#") {
+		return TopicInfo{}, ErrBadTopic
+	}
+	kind, ok := topicKinds[suffix]
+	if !ok {
+		return TopicInfo{}, ErrBadTopic
+	}
+	return TopicInfo{DeviceID: id, Kind: kind}, nil
 }
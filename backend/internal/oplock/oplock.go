@@ -0,0 +1,227 @@
+package oplock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+)
+
+// Виды операций, которые держат блокировку устройства.
+// Действующую блокировку может продлить только та же операция (вид и ref), остальные ждут.
+const (
+	KindCmd = "cmd" // команды, меняющие состояние устройства (reboot)
+	KindCfg = "cfg" // доставка/применение конфигурации (cfg, apply_cfg)
+	KindOTA = "ota"
+)
+
+var ErrLocked = errors.New("device is locked by another operation")
+
+// LockedError — блокировку держит другая операция (её holder виден в ответе API).
+type LockedError struct {
+	Lock registry.DeviceLockRecord
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("%s: kind=%s ref=%s holder=%s", ErrLocked, e.Lock.Kind, e.Lock.Ref, e.Lock.Holder)
+}
+
+func (e *LockedError) Unwrap() error {
+	return ErrLocked
+}
+
+// Store — хранение блокировок (реализует registry.SQLiteStore).
+type Store interface {
+	AcquireDeviceLock(ctx context.Context, rec registry.DeviceLockRecord) (*registry.DeviceLockRecord, bool, error)
+	ReleaseDeviceLock(ctx context.Context, deviceID, kind, ref string) (bool, error)
+	DeleteDeviceLock(ctx context.Context, deviceID string) (*registry.DeviceLockRecord, error)
+	ExtendDeviceLock(ctx context.Context, deviceID, kind, ref string, expiresMillis int64) (bool, error)
+	GetDeviceLock(ctx context.Context, deviceID string, nowMillis int64) (*registry.DeviceLockRecord, error)
+	ListDeviceLocks(ctx context.Context, nowMillis int64) ([]registry.DeviceLockRecord, error)
+}
+
+// Config — аренда по умолчанию для каждого вида (если вызывающий не передал свою).
+type Config struct {
+	CmdLease time.Duration
+	CfgLease time.Duration
+	OTALease time.Duration
+}
+
+func LoadConfigFromEnv() Config {
+	return Config{
+		CmdLease: time.Duration(getenvInt("DEVICE_LOCK_CMD_LEASE_MS", 60000)) * time.Millisecond,
+		CfgLease: time.Duration(getenvInt("DEVICE_LOCK_CFG_LEASE_MS", 300000)) * time.Millisecond,
+		OTALease: time.Duration(getenvInt("DEVICE_LOCK_OTA_LEASE_MS", 1800000)) * time.Millisecond,
+	}
+}
+
+// Manager — блокировки устройств для command/config/OTA. Методы безопасны на nil (блокировки выключены).
+type Manager struct {
+	store Store
+	cfg   Config
+}
+
+func New(store Store, cfg Config) *Manager {
+	if cfg.CmdLease <= 0 {
+		cfg.CmdLease = time.Minute
+	}
+	if cfg.CfgLease <= 0 {
+		cfg.CfgLease = 5 * time.Minute
+	}
+	if cfg.OTALease <= 0 {
+		cfg.OTALease = 30 * time.Minute
+	}
+	return &Manager{store: store, cfg: cfg}
+}
+
+// Acquire берёт блокировку на lease (0 — аренда по умолчанию для kind).
+// Если устройство занято другой операцией — *LockedError (errors.Is(err, ErrLocked)).
+func (m *Manager) Acquire(ctx context.Context, deviceID, kind, ref, holder string, lease time.Duration) error {
+	if m == nil {
+		return nil
+	}
+	if lease <= 0 {
+		lease = m.lease(kind)
+	}
+	now := time.Now().UnixMilli()
+	cur, acquired, err := m.store.AcquireDeviceLock(ctx, registry.DeviceLockRecord{
+		DeviceID:       deviceID,
+		Kind:           kind,
+		Ref:            ref,
+		Holder:         holder,
+		AcquiredMillis: now,
+		ExpiresMillis:  now + lease.Milliseconds(),
+	})
+	if err != nil {
+		return err
+	}
+	if !acquired {
+		log.Printf("[LOCK] busy deviceId=%s want=%s/%s held=%s/%s holder=%s", deviceID, kind, ref, cur.Kind, cur.Ref, cur.Holder)
+		return &LockedError{Lock: *cur}
+	}
+	log.Printf("[LOCK] acquired deviceId=%s kind=%s ref=%s holder=%s lease=%s", deviceID, kind, ref, holder, lease)
+	return nil
+}
+
+// Check — можно ли сейчас взять блокировку под новую операцию вида kind (без захвата):
+// действующая блокировка, даже того же вида, — *LockedError.
+func (m *Manager) Check(ctx context.Context, deviceID, kind string) error {
+	if m == nil {
+		return nil
+	}
+	cur, err := m.store.GetDeviceLock(ctx, deviceID, time.Now().UnixMilli())
+	if err != nil {
+		return err
+	}
+	if cur != nil {
+		return &LockedError{Lock: *cur}
+	}
+	return nil
+}
+
+// Release снимает блокировку, если её держит kind/ref (ref пустой — любая операция вида kind).
+func (m *Manager) Release(ctx context.Context, deviceID, kind, ref string) {
+	if m == nil {
+		return
+	}
+	released, err := m.store.ReleaseDeviceLock(ctx, deviceID, kind, ref)
+	if err != nil {
+		log.Printf("[LOCK] release_failed deviceId=%s kind=%s ref=%s err=%v", deviceID, kind, ref, err)
+		return
+	}
+	if released {
+		log.Printf("[LOCK] released deviceId=%s kind=%s ref=%s", deviceID, kind, ref)
+	}
+}
+
+// ReleaseCfg снимает cfg-блокировку доставки версии <= applied: устройство больше её не применяет.
+// Блокировку apply_cfg (ref = cmdId) снимает ACK команды.
+func (m *Manager) ReleaseCfg(ctx context.Context, deviceID string, applied int64) {
+	if m == nil {
+		return
+	}
+	cur, err := m.store.GetDeviceLock(ctx, deviceID, time.Now().UnixMilli())
+	if err != nil || cur == nil || cur.Kind != KindCfg {
+		return
+	}
+	v, err := strconv.ParseInt(cur.Ref, 10, 64)
+	if err != nil || v > applied {
+		return
+	}
+	m.Release(ctx, deviceID, KindCfg, cur.Ref)
+}
+
+// Extend продлевает аренду текущего владельца (например, по прогрессу OTA).
+func (m *Manager) Extend(ctx context.Context, deviceID, kind, ref string, lease time.Duration) bool {
+	if m == nil {
+		return false
+	}
+	if lease <= 0 {
+		lease = m.lease(kind)
+	}
+	ok, err := m.store.ExtendDeviceLock(ctx, deviceID, kind, ref, time.Now().Add(lease).UnixMilli())
+	if err != nil {
+		log.Printf("[LOCK] extend_failed deviceId=%s kind=%s ref=%s err=%v", deviceID, kind, ref, err)
+		return false
+	}
+	return ok
+}
+
+// ForceRelease снимает любую блокировку устройства (оператор); nil — блокировки не было.
+func (m *Manager) ForceRelease(ctx context.Context, deviceID, actor string) (*registry.DeviceLockRecord, error) {
+	if m == nil {
+		return nil, nil
+	}
+	rec, err := m.store.DeleteDeviceLock(ctx, deviceID)
+	if err != nil {
+		return nil, err
+	}
+	if rec != nil {
+		log.Printf("[LOCK] force_released deviceId=%s kind=%s ref=%s holder=%s by=%s", deviceID, rec.Kind, rec.Ref, rec.Holder, actor)
+	}
+	return rec, nil
+}
+
+// Get — действующая блокировка устройства (nil, если нет).
+func (m *Manager) Get(ctx context.Context, deviceID string) (*registry.DeviceLockRecord, error) {
+	if m == nil {
+		return nil, nil
+	}
+	return m.store.GetDeviceLock(ctx, deviceID, time.Now().UnixMilli())
+}
+
+// List — все действующие блокировки.
+func (m *Manager) List(ctx context.Context) ([]registry.DeviceLockRecord, error) {
+	if m == nil {
+		return []registry.DeviceLockRecord{}, nil
+	}
+	return m.store.ListDeviceLocks(ctx, time.Now().UnixMilli())
+}
+
+func (m *Manager) lease(kind string) time.Duration {
+	switch kind {
+	case KindCfg:
+		return m.cfg.CfgLease
+	case KindOTA:
+		return m.cfg.OTALease
+	default:
+		return m.cfg.CmdLease
+	}
+}
+
+func getenvInt(k string, def int) int {
+	v := os.Getenv(k)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return def
+	}
+	return n
+}
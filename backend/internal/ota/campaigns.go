@@ -0,0 +1,563 @@
+package ota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/perm1ss10n/vexora/backend/internal/commands"
+	"github.com/perm1ss10n/vexora/backend/internal/firmware"
+	"github.com/perm1ss10n/vexora/backend/internal/model"
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+	"github.com/perm1ss10n/vexora/backend/internal/scheduler"
+)
+
+var (
+	ErrInvalid     = errors.New("invalid campaign")
+	ErrNotFound    = errors.New("campaign not found")
+	ErrNoTargets   = errors.New("no devices to update")
+	ErrBadState    = errors.New("campaign state does not allow this action")
+	ErrFirmwareBad = errors.New("firmware is unavailable for rollout")
+)
+
+// EventOTACampaignPaused — событие backend'а при автоматической паузе кампании.
+const EventOTACampaignPaused = "OTA_CAMPAIGN_PAUSED"
+
+// Store — кампании и устройства (реализует registry.SQLiteStore).
+type Store interface {
+	scheduler.TargetStore
+	CreateOTACampaign(ctx context.Context, rec registry.OTACampaignRecord, devices []registry.OTACampaignDevice) error
+	UpdateOTACampaign(ctx context.Context, rec registry.OTACampaignRecord) error
+	GetOTACampaign(ctx context.Context, id string) (*registry.OTACampaignRecord, error)
+	ListOTACampaigns(ctx context.Context, statuses ...string) ([]registry.OTACampaignRecord, error)
+	ListOTACampaignDevices(ctx context.Context, campaignID, status string) ([]registry.OTACampaignDevice, error)
+	CountOTACampaignDevices(ctx context.Context, campaignID string) ([]registry.OTAStatusCount, error)
+	SetOTADeviceStatus(ctx context.Context, campaignID, deviceID string, from []string, to, errMsg string, sentMillis, nowMillis int64) (bool, error)
+	TouchOTADevice(ctx context.Context, campaignID, deviceID string, nowMillis int64) error
+	SetOTADeviceDownload(ctx context.Context, campaignID, deviceID, mode, deltaID string, deltaSize, fullSize int64) error
+	OTACampaignTransfer(ctx context.Context, campaignID string) (registry.OTATransferStats, error)
+	AbortOTACampaignDevices(ctx context.Context, campaignID string, nowMillis int64) (int, error)
+	FindOTAJob(ctx context.Context, deviceID, jobID string) (*registry.OTAJob, error)
+	ListOTABusyDevices(ctx context.Context) (map[string]string, error)
+	AddOTACampaignDevices(ctx context.Context, campaignID string, devices []registry.OTACampaignDevice) (int, error)
+}
+
+// Firmware — артефакты и ссылки на скачивание (реализует firmware.Service).
+type Firmware interface {
+	Get(ctx context.Context, id string) (*registry.FirmwareRecord, error)
+	IssueURL(ctx context.Context, id string, ttl time.Duration) (*registry.FirmwareRecord, firmware.SignedURL, error)
+	IssueDelta(ctx context.Context, id, fromVersion string, ttl time.Duration) (*firmware.DeltaOffer, error)
+	SignManifest(rec registry.FirmwareRecord, url firmware.SignedURL, delta *firmware.DeltaOffer, deviceID, jobID string) (firmware.SignedManifest, error)
+}
+
+// Locker — блокировка устройства на время OTA (реализует oplock.Manager).
+type Locker interface {
+	Acquire(ctx context.Context, deviceID, kind, ref, holder string, lease time.Duration) error
+	Release(ctx context.Context, deviceID, kind, ref string)
+}
+
+// lockKind — вид блокировки OTA (oplock.KindOTA).
+const lockKind = "ota"
+
+// EventSink — куда писать события, сгенерированные backend (реализует influx.Client).
+type EventSink interface {
+	WriteEvent(e model.EventPayload)
+}
+
+type Config struct {
+	Tick             time.Duration
+	JobTimeout       time.Duration // нет прогресса дольше — job failed (TIMEOUT)
+	FailureThreshold float64       // доля неудачных, после которой кампания встаёт на паузу
+	MinSamples       int           // сколько завершённых устройств нужно, чтобы судить о доле неудач
+	SendPerTick      int           // сколько job публиковать за тик на кампанию
+}
+
+func LoadConfigFromEnv() Config {
+	threshold := 0.2
+	if v := os.Getenv("OTA_FAILURE_THRESHOLD"); v != "" {
+		if f, err := strconv.ParseFloat(v, 64); err == nil {
+			threshold = f
+		}
+	}
+	return Config{
+		Tick:             time.Duration(getenvInt("OTA_CAMPAIGN_TICK_MS", 10000)) * time.Millisecond,
+		JobTimeout:       time.Duration(getenvInt("OTA_JOB_TIMEOUT_MS", 1800000)) * time.Millisecond,
+		FailureThreshold: threshold,
+		MinSamples:       getenvInt("OTA_MIN_SAMPLES", 3),
+		SendPerTick:      getenvInt("OTA_SEND_PER_TICK", 50),
+	}
+}
+
+// DefaultWaves — волны по умолчанию: 1% → 10% → 100%.
+var DefaultWaves = []int{1, 10, 100}
+
+// CampaignRequest — параметры новой кампании; нулевые значения берутся из Config.
+type CampaignRequest struct {
+	Name             string
+	FirmwareID       string
+	Target           registry.TargetSelector
+	FWPredicate      string // semver-условие на текущую прошивку: "<1.4.0"
+	Waves            []int
+	FailureThreshold float64
+	MinSamples       int
+	WaveInterval     time.Duration
+	JobTimeout       time.Duration
+}
+
+// Service — OTA-кампании: раскатка прошивки волнами, учёт хода по событиям устройства, авто-пауза.
+type Service struct {
+	store  Store
+	fw     Firmware
+	pub    commands.Publisher
+	locks  Locker
+	events EventSink
+	cfg    Config
+
+	mu sync.Mutex // шаг кампании и ручные действия не выполняются параллельно
+}
+
+func New(store Store, fw Firmware, pub commands.Publisher, cfg Config) *Service {
+	if cfg.Tick <= 0 {
+		cfg.Tick = 10 * time.Second
+	}
+	if cfg.JobTimeout <= 0 {
+		cfg.JobTimeout = 30 * time.Minute
+	}
+	if cfg.FailureThreshold <= 0 || cfg.FailureThreshold > 1 {
+		cfg.FailureThreshold = 0.2
+	}
+	if cfg.MinSamples <= 0 {
+		cfg.MinSamples = 3
+	}
+	if cfg.SendPerTick <= 0 {
+		cfg.SendPerTick = 50
+	}
+	return &Service{store: store, fw: fw, pub: pub, cfg: cfg}
+}
+
+// SetLocks подключает блокировки устройств: OTA не начинается, пока устройство применяет конфигурацию.
+func (s *Service) SetLocks(l Locker) {
+	s.locks = l
+}
+
+// SetEvents подключает запись событий backend (авто-пауза кампании).
+func (s *Service) SetEvents(e EventSink) {
+	s.events = e
+}
+
+// Create фиксирует состав кампании и распределяет устройства по волнам; первая волна уходит на ближайшем тике.
+func (s *Service) Create(ctx context.Context, req CampaignRequest, actor string) (*registry.OTACampaignRecord, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalid)
+	}
+	waves, err := normalizeWaves(req.Waves)
+	if err != nil {
+		return nil, err
+	}
+	threshold := req.FailureThreshold
+	if threshold == 0 {
+		threshold = s.cfg.FailureThreshold
+	}
+	if threshold < 0 || threshold > 1 {
+		return nil, fmt.Errorf("%w: failureThreshold must be in (0, 1]", ErrInvalid)
+	}
+	minSamples := req.MinSamples
+	if minSamples == 0 {
+		minSamples = s.cfg.MinSamples
+	}
+	if minSamples < 0 || req.WaveInterval < 0 || req.JobTimeout < 0 {
+		return nil, fmt.Errorf("%w: negative minSamples / waveInterval / jobTimeout", ErrInvalid)
+	}
+	jobTimeout := req.JobTimeout
+	if jobTimeout == 0 {
+		jobTimeout = s.cfg.JobTimeout
+	}
+
+	var predicate *firmware.Constraint
+	req.FWPredicate = strings.TrimSpace(req.FWPredicate)
+	if req.FWPredicate != "" {
+		c, err := firmware.ParseConstraint(req.FWPredicate)
+		if err != nil {
+			return nil, fmt.Errorf("%w: fwPredicate: %v", ErrInvalid, err)
+		}
+		predicate = &c
+	}
+	sel := req.Target
+	sel.OnlineOnly = false // на связи ли устройство, проверяется при отправке job
+	if sel.Empty() {
+		if predicate == nil {
+			return nil, fmt.Errorf("%w: target or fwPredicate is required", ErrInvalid)
+		}
+		sel.All = true
+	}
+
+	fw, err := s.fw.Get(ctx, req.FirmwareID)
+	if err != nil {
+		if errors.Is(err, firmware.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %v", ErrFirmwareBad, err)
+		}
+		return nil, err
+	}
+	if fw.Deprecated {
+		return nil, fmt.Errorf("%w: firmware %s is deprecated", ErrFirmwareBad, fw.ID)
+	}
+
+	ids, err := scheduler.ResolveTargets(ctx, s.store, sel)
+	if err != nil {
+		return nil, err
+	}
+	devices, err := s.store.ListDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fwByDevice := make(map[string]string, len(devices))
+	for _, d := range devices {
+		if d.FW.Valid {
+			fwByDevice[d.DeviceID] = d.FW.String
+		}
+	}
+	busy, err := s.store.ListOTABusyDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UnixMilli()
+	rec := registry.OTACampaignRecord{
+		ID:               uuid.NewString(),
+		Name:             req.Name,
+		FirmwareID:       fw.ID,
+		TargetVersion:    fw.Version,
+		HWModel:          fw.HWModel,
+		Selector:         req.Target,
+		FWPredicate:      req.FWPredicate,
+		Waves:            waves,
+		FailureThreshold: threshold,
+		MinSamples:       minSamples,
+		WaveIntervalMs:   req.WaveInterval.Milliseconds(),
+		JobTimeoutMs:     jobTimeout.Milliseconds(),
+		Status:           registry.OTACampaignRunning,
+		WaveStartedMs:    now,
+		CreatedBy:        actor,
+		CreatedMillis:    now,
+		UpdatedMillis:    now,
+	}
+
+	eligible := []registry.OTACampaignDevice{}
+	skipped := []registry.OTACampaignDevice{}
+	for _, id := range ids {
+		cur := fwByDevice[id]
+		if predicate != nil && !predicate.Match(cur) {
+			continue
+		}
+		d := registry.OTACampaignDevice{
+			CampaignID:    rec.ID,
+			DeviceID:      id,
+			JobID:         uuid.NewString(),
+			Status:        registry.OTADevicePending,
+			FromFW:        cur,
+			UpdatedMillis: now,
+		}
+		switch {
+		case cur != "" && firmware.CompareVersions(cur, fw.Version) == 0:
+			d.Status, d.Error = registry.OTADeviceSkipped, "already on target version"
+		case busy[id] != "":
+			d.Status, d.Error = registry.OTADeviceSkipped, "in campaign "+busy[id]
+		}
+		if d.Status == registry.OTADeviceSkipped {
+			skipped = append(skipped, d)
+			continue
+		}
+		eligible = append(eligible, d)
+	}
+	if len(eligible) == 0 {
+		return nil, ErrNoTargets
+	}
+
+	assignWaves(rec.ID, eligible, waves)
+
+	if err := s.store.CreateOTACampaign(ctx, rec, append(eligible, skipped...)); err != nil {
+		return nil, err
+	}
+	log.Printf("[OTA] campaign_created id=%s name=%q fw=%s version=%s devices=%d skipped=%d waves=%v by=%s",
+		rec.ID, rec.Name, fw.ID, fw.Version, len(eligible), len(skipped), waves, actor)
+	return &rec, nil
+}
+
+func (s *Service) List(ctx context.Context) ([]registry.OTACampaignRecord, error) {
+	return s.store.ListOTACampaigns(ctx)
+}
+
+func (s *Service) Get(ctx context.Context, id string) (*registry.OTACampaignRecord, error) {
+	rec, err := s.store.GetOTACampaign(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil {
+		return nil, ErrNotFound
+	}
+	return rec, nil
+}
+
+// Counts — число устройств кампании по волнам и статусам.
+func (s *Service) Counts(ctx context.Context, id string) ([]registry.OTAStatusCount, error) {
+	return s.store.CountOTACampaignDevices(ctx, id)
+}
+
+// Enroll добавляет устройства (deviceId -> текущая прошивка) в текущую волну активной кампании
+// на targetVersion (running предпочтительнее paused). Устройства, уже входящие в эту кампанию
+// (в любом статусе) или занятые другой, пропускаются. Нет такой кампании — "", 0.
+func (s *Service) Enroll(ctx context.Context, targetVersion string, devices map[string]string) (string, int, error) {
+	if len(devices) == 0 || targetVersion == "" {
+		return "", 0, nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	list, err := s.store.ListOTACampaigns(ctx, registry.OTACampaignRunning, registry.OTACampaignPaused)
+	if err != nil {
+		return "", 0, err
+	}
+	var c *registry.OTACampaignRecord
+	for i := range list {
+		if firmware.CompareVersions(list[i].TargetVersion, targetVersion) != 0 {
+			continue
+		}
+		if c == nil || (c.Status != registry.OTACampaignRunning && list[i].Status == registry.OTACampaignRunning) {
+			c = &list[i]
+		}
+	}
+	if c == nil {
+		return "", 0, nil
+	}
+
+	busy, err := s.store.ListOTABusyDevices(ctx)
+	if err != nil {
+		return "", 0, err
+	}
+	now := time.Now().UnixMilli()
+	add := []registry.OTACampaignDevice{}
+	for id, cur := range devices {
+		if busy[id] != "" || (cur != "" && firmware.CompareVersions(cur, c.TargetVersion) == 0) {
+			continue
+		}
+		add = append(add, registry.OTACampaignDevice{
+			CampaignID:    c.ID,
+			DeviceID:      id,
+			JobID:         uuid.NewString(),
+			Wave:          c.Wave,
+			Status:        registry.OTADevicePending,
+			FromFW:        cur,
+			UpdatedMillis: now,
+		})
+	}
+	if len(add) == 0 {
+		return c.ID, 0, nil
+	}
+	n, err := s.store.AddOTACampaignDevices(ctx, c.ID, add)
+	if err != nil {
+		return c.ID, 0, err
+	}
+	if n > 0 {
+		log.Printf("[OTA] devices_enrolled id=%s version=%s count=%d", c.ID, c.TargetVersion, n)
+	}
+	return c.ID, n, nil
+}
+
+// Transfer — трафик по успешно обновлённым устройствам: сколько сэкономили дельты.
+func (s *Service) Transfer(ctx context.Context, id string) (registry.OTATransferStats, error) {
+	return s.store.OTACampaignTransfer(ctx, id)
+}
+
+// Devices — устройства кампании; status пустой — все.
+func (s *Service) Devices(ctx context.Context, id, status string) ([]registry.OTACampaignDevice, error) {
+	if _, err := s.Get(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.store.ListOTACampaignDevices(ctx, id, status)
+}
+
+// Pause останавливает отправку новых job; уже начатые обновления отслеживаются до конца.
+func (s *Service) Pause(ctx context.Context, id, actor, reason string) (*registry.OTACampaignRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Status != registry.OTACampaignRunning {
+		return rec, fmt.Errorf("%w: campaign is %s", ErrBadState, rec.Status)
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		reason = "paused by " + actor
+	}
+	if err := s.pause(ctx, rec, reason); err != nil {
+		return nil, err
+	}
+	return rec, nil
+}
+
+// Resume продолжает кампанию; доля неудач дальше считается по результатам после resume.
+func (s *Service) Resume(ctx context.Context, id, actor string) (*registry.OTACampaignRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Status != registry.OTACampaignPaused {
+		return rec, fmt.Errorf("%w: campaign is %s", ErrBadState, rec.Status)
+	}
+	counts, err := s.store.CountOTACampaignDevices(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	t := tally(counts, -1)
+	rec.Status = registry.OTACampaignRunning
+	rec.PauseReason = ""
+	rec.BaselineDone = t.done()
+	rec.BaselineFailed = t.failed
+	rec.UpdatedMillis = time.Now().UnixMilli()
+	if err := s.store.UpdateOTACampaign(ctx, *rec); err != nil {
+		return nil, err
+	}
+	log.Printf("[OTA] campaign_resumed id=%s by=%s", rec.ID, actor)
+	return rec, nil
+}
+
+// Abort завершает кампанию: ожидающие и выполняющиеся job помечаются aborted
+// (устройство, уже скачивающее прошивку, может её всё же установить — это видно по state.fw).
+func (s *Service) Abort(ctx context.Context, id, actor string) (*registry.OTACampaignRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rec, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if rec.Status != registry.OTACampaignRunning && rec.Status != registry.OTACampaignPaused {
+		return rec, fmt.Errorf("%w: campaign is %s", ErrBadState, rec.Status)
+	}
+	now := time.Now().UnixMilli()
+	n, err := s.store.AbortOTACampaignDevices(ctx, rec.ID, now)
+	if err != nil {
+		return nil, err
+	}
+	rec.Status = registry.OTACampaignAborted
+	rec.UpdatedMillis = now
+	rec.FinishedMillis.Int64, rec.FinishedMillis.Valid = now, true
+	if err := s.store.UpdateOTACampaign(ctx, *rec); err != nil {
+		return nil, err
+	}
+	log.Printf("[OTA] campaign_aborted id=%s devices=%d by=%s", rec.ID, n, actor)
+	return rec, nil
+}
+
+func (s *Service) pause(ctx context.Context, rec *registry.OTACampaignRecord, reason string) error {
+	rec.Status = registry.OTACampaignPaused
+	rec.PauseReason = reason
+	rec.UpdatedMillis = time.Now().UnixMilli()
+	if err := s.store.UpdateOTACampaign(ctx, *rec); err != nil {
+		return err
+	}
+	log.Printf("[OTA] campaign_paused id=%s reason=%q", rec.ID, reason)
+	return nil
+}
+
+// normalizeWaves — накопительные проценты по возрастанию, последняя волна — 100.
+func normalizeWaves(waves []int) ([]int, error) {
+	if len(waves) == 0 {
+		return append([]int(nil), DefaultWaves...), nil
+	}
+	prev := 0
+	for _, p := range waves {
+		if p <= prev || p > 100 {
+			return nil, fmt.Errorf("%w: waves must be increasing percents in (0, 100]", ErrInvalid)
+		}
+		prev = p
+	}
+	if prev != 100 {
+		return nil, fmt.Errorf("%w: last wave must be 100", ErrInvalid)
+	}
+	return waves, nil
+}
+
+// assignWaves перемешивает устройства (детерминированно по id кампании) и раздаёт их по волнам:
+// в волну i попадают устройства до ceil(N*waves[i]/100), но не меньше одного нового на волну.
+func assignWaves(campaignID string, devices []registry.OTACampaignDevice, waves []int) {
+	h := fnv.New64a()
+	h.Write([]byte(campaignID))
+	rnd := rand.New(rand.NewSource(int64(h.Sum64())))
+	rnd.Shuffle(len(devices), func(i, j int) { devices[i], devices[j] = devices[j], devices[i] })
+
+	n := len(devices)
+	start := 0
+	for w, p := range waves {
+		end := int(math.Ceil(float64(n) * float64(p) / 100))
+		if end <= start {
+			end = start + 1
+		}
+		if end > n || w == len(waves)-1 {
+			end = n
+		}
+		for i := start; i < end; i++ {
+			devices[i].Wave = w
+		}
+		start = end
+	}
+}
+
+// counts — сводка статусов по волнам <= wave (wave < 0 — по всей кампании).
+type counts struct {
+	pending, inFlight, success, failed int
+}
+
+func (c counts) done() int {
+	return c.success + c.failed
+}
+
+func tally(rows []registry.OTAStatusCount, wave int) counts {
+	var c counts
+	for _, r := range rows {
+		if wave >= 0 && r.Wave > wave {
+			continue
+		}
+		switch r.Status {
+		case registry.OTADevicePending:
+			c.pending += r.Count
+		case registry.OTADeviceSent, registry.OTADeviceDownloading, registry.OTADeviceInstalling:
+			c.inFlight += r.Count
+		case registry.OTADeviceSuccess:
+			c.success += r.Count
+		case registry.OTADeviceFailed:
+			c.failed += r.Count
+		}
+	}
+	return c
+}
+
+func getenvInt(k string, def int) int {
+	v := os.Getenv(k)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return def
+	}
+	return n
+}
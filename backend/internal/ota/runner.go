@@ -0,0 +1,276 @@
+package ota
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/perm1ss10n/vexora/backend/internal/firmware"
+	"github.com/perm1ss10n/vexora/backend/internal/model"
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+)
+
+// Start запускает цикл кампаний: таймауты job, авто-пауза, отправка текущей волны, переход к следующей.
+func (s *Service) Start(ctx context.Context) {
+	go func() {
+		t := time.NewTicker(s.cfg.Tick)
+		defer t.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				s.tick(ctx)
+			}
+		}
+	}()
+}
+
+func (s *Service) tick(ctx context.Context) {
+	list, err := s.store.ListOTACampaigns(ctx, registry.OTACampaignRunning, registry.OTACampaignPaused)
+	if err != nil {
+		log.Printf("[OTA] list_failed err=%v", err)
+		return
+	}
+	if len(list) == 0 {
+		return
+	}
+	devices, err := s.store.ListDevices(ctx)
+	if err != nil {
+		log.Printf("[OTA] list_devices_failed err=%v", err)
+		return
+	}
+	online := make(map[string]bool, len(devices))
+	for _, d := range devices {
+		online[d.DeviceID] = d.Status == "online"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range list {
+		if err := s.step(ctx, &list[i], online, time.Now()); err != nil {
+			log.Printf("[OTA] step_failed id=%s err=%v", list[i].ID, err)
+		}
+	}
+}
+
+func (s *Service) step(ctx context.Context, c *registry.OTACampaignRecord, online map[string]bool, now time.Time) error {
+	nowMs := now.UnixMilli()
+
+	// job без прогресса дольше таймаута — failed (в т.ч. на паузе: начатые обновления доводим до итога)
+	for _, st := range registry.OTAInFlight {
+		list, err := s.store.ListOTACampaignDevices(ctx, c.ID, st)
+		if err != nil {
+			return err
+		}
+		for _, d := range list {
+			if nowMs-d.UpdatedMillis < c.JobTimeoutMs {
+				continue
+			}
+			s.finish(ctx, d.CampaignID, d.DeviceID, d.JobID, registry.OTADeviceFailed, "TIMEOUT: no progress in "+st)
+		}
+	}
+
+	if c.Status != registry.OTACampaignRunning {
+		return nil
+	}
+
+	rows, err := s.store.CountOTACampaignDevices(ctx, c.ID)
+	if err != nil {
+		return err
+	}
+	all := tally(rows, -1)
+
+	// авто-пауза по доле неудач (после resume — только по новым результатам)
+	done := all.done() - c.BaselineDone
+	failed := all.failed - c.BaselineFailed
+	if failed > 0 && done >= c.MinSamples && float64(failed)/float64(done) > c.FailureThreshold {
+		reason := fmt.Sprintf("failure rate %d/%d exceeds %.0f%%", failed, done, c.FailureThreshold*100)
+		if err := s.pause(ctx, c, reason); err != nil {
+			return err
+		}
+		s.writeEvent(c, reason)
+		return nil
+	}
+
+	if all.pending == 0 && all.inFlight == 0 {
+		c.Status = registry.OTACampaignCompleted
+		c.UpdatedMillis = nowMs
+		c.FinishedMillis.Int64, c.FinishedMillis.Valid = nowMs, true
+		log.Printf("[OTA] campaign_completed id=%s success=%d failed=%d", c.ID, all.success, all.failed)
+		return s.store.UpdateOTACampaign(ctx, *c)
+	}
+
+	sent, err := s.sendWave(ctx, c, online, nowMs)
+	if err != nil {
+		return err
+	}
+
+	// волна завершена: никто в ней не обновляется и некому отправить (оставшиеся pending — не на связи)
+	cur := tally(rows, c.Wave)
+	if sent > 0 || cur.inFlight > 0 || c.Wave >= len(c.Waves)-1 {
+		return nil
+	}
+	if cur.pending > 0 {
+		pending, err := s.store.ListOTACampaignDevices(ctx, c.ID, registry.OTADevicePending)
+		if err != nil {
+			return err
+		}
+		for _, d := range pending {
+			if d.Wave <= c.Wave && online[d.DeviceID] {
+				return nil
+			}
+		}
+	}
+	if nowMs-c.WaveStartedMs < c.WaveIntervalMs {
+		return nil
+	}
+	c.Wave++
+	c.WaveStartedMs = nowMs
+	c.UpdatedMillis = nowMs
+	log.Printf("[OTA] wave_started id=%s wave=%d percent=%d", c.ID, c.Wave, c.Waves[c.Wave])
+	return s.store.UpdateOTACampaign(ctx, *c)
+}
+
+// sendWave публикует job устройствам текущей и прошлых волн, которые на связи и ещё не получили его.
+func (s *Service) sendWave(ctx context.Context, c *registry.OTACampaignRecord, online map[string]bool, nowMs int64) (int, error) {
+	pending, err := s.store.ListOTACampaignDevices(ctx, c.ID, registry.OTADevicePending)
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, d := range pending {
+		if sent >= s.cfg.SendPerTick {
+			break
+		}
+		if d.Wave > c.Wave || !online[d.DeviceID] {
+			continue
+		}
+
+		fw, url, err := s.fw.IssueURL(ctx, c.FirmwareID, time.Duration(c.JobTimeoutMs)*time.Millisecond)
+		if err != nil {
+			if errors.Is(err, firmware.ErrDeprecated) || errors.Is(err, firmware.ErrNotFound) {
+				reason := "firmware unavailable: " + err.Error()
+				if perr := s.pause(ctx, c, reason); perr != nil {
+					return sent, perr
+				}
+				s.writeEvent(c, reason)
+				return sent, nil
+			}
+			return sent, err
+		}
+
+		// дельта от текущей версии устройства, если построена; без неё — полный образ
+		delta, err := s.fw.IssueDelta(ctx, c.FirmwareID, d.FromFW, time.Duration(c.JobTimeoutMs)*time.Millisecond)
+		if err != nil {
+			log.Printf("[OTA] delta_lookup_failed id=%s deviceId=%s err=%v", c.ID, d.DeviceID, err)
+			delta = nil
+		}
+
+		// манифест привязан к устройству и job: перехваченный чужой манифест устройство отвергнет
+		signed, err := s.fw.SignManifest(*fw, url, delta, d.DeviceID, d.JobID)
+		if err != nil {
+			return sent, err
+		}
+
+		if s.locks != nil {
+			if err := s.locks.Acquire(ctx, d.DeviceID, lockKind, d.JobID, "ota:"+c.ID, time.Duration(c.JobTimeoutMs)*time.Millisecond); err != nil {
+				// устройство занято (например, применяет конфиг) — попробуем на следующем тике
+				continue
+			}
+		}
+
+		payload := model.OTAPayload{
+			V:          1,
+			ID:         d.JobID,
+			DeviceID:   d.DeviceID,
+			Ts:         nowMs,
+			CampaignID: c.ID,
+			FW: model.OTAFirmware{
+				Version:  fw.Version,
+				HWModel:  fw.HWModel,
+				URL:      url.URL,
+				SHA256:   fw.SHA256,
+				Size:     fw.Size,
+				MinHWRev: fw.MinHWRev,
+			},
+			Manifest: signed.Manifest,
+			Sig:      signed.Sig,
+			KeyID:    signed.KeyID,
+			Alg:      signed.Alg,
+		}
+		mode, deltaID, deltaSize := registry.OTADownloadFull, "", int64(0)
+		if delta != nil {
+			mode, deltaID, deltaSize = registry.OTADownloadDelta, delta.Delta.ID, delta.Delta.Size
+			payload.FW.Delta = &model.OTADelta{
+				From:   delta.Delta.FromVersion,
+				URL:    delta.URL.URL,
+				SHA256: delta.Delta.SHA256,
+				Size:   delta.Delta.Size,
+			}
+		}
+		b, err := json.Marshal(payload)
+		if err != nil {
+			s.releaseLock(ctx, d.DeviceID, d.JobID)
+			return sent, err
+		}
+		topic := "v1/dev/" + d.DeviceID + "/ota"
+		if err := s.pub.Publish(topic, 1, false, b); err != nil {
+			log.Printf("[OTA] publish_failed id=%s deviceId=%s err=%v", c.ID, d.DeviceID, err)
+			s.releaseLock(ctx, d.DeviceID, d.JobID)
+			continue
+		}
+		ok, err := s.store.SetOTADeviceStatus(ctx, c.ID, d.DeviceID, []string{registry.OTADevicePending}, registry.OTADeviceSent, "", nowMs, nowMs)
+		if err != nil {
+			return sent, err
+		}
+		if ok {
+			sent++
+			if err := s.store.SetOTADeviceDownload(ctx, c.ID, d.DeviceID, mode, deltaID, deltaSize, fw.Size); err != nil {
+				log.Printf("[OTA] set_download_failed id=%s deviceId=%s err=%v", c.ID, d.DeviceID, err)
+			}
+			log.Printf("[OTA] job_sent id=%s deviceId=%s jobId=%s wave=%d version=%s mode=%s", c.ID, d.DeviceID, d.JobID, d.Wave, fw.Version, mode)
+		}
+	}
+	return sent, nil
+}
+
+// finish переводит выполняющийся job в итоговый статус и снимает блокировку устройства.
+func (s *Service) finish(ctx context.Context, campaignID, deviceID, jobID, status, errMsg string) {
+	now := time.Now().UnixMilli()
+	ok, err := s.store.SetOTADeviceStatus(ctx, campaignID, deviceID, registry.OTAInFlight, status, errMsg, 0, now)
+	if err != nil {
+		log.Printf("[OTA] set_status_failed id=%s deviceId=%s err=%v", campaignID, deviceID, err)
+		return
+	}
+	if !ok {
+		return
+	}
+	s.releaseLock(ctx, deviceID, jobID)
+	log.Printf("[OTA] job_%s id=%s deviceId=%s jobId=%s err=%q", status, campaignID, deviceID, jobID, errMsg)
+}
+
+func (s *Service) releaseLock(ctx context.Context, deviceID, jobID string) {
+	if s.locks != nil {
+		s.locks.Release(ctx, deviceID, lockKind, jobID)
+	}
+}
+
+func (s *Service) writeEvent(c *registry.OTACampaignRecord, reason string) {
+	if s.events == nil {
+		return
+	}
+	s.events.WriteEvent(model.EventPayload{
+		V:        1,
+		Ts:       time.Now().UnixMilli(),
+		Code:     EventOTACampaignPaused,
+		Severity: "warn",
+		Msg:      reason,
+		Data:     map[string]any{"campaignId": c.ID, "name": c.Name, "wave": c.Wave},
+	})
+}
@@ -0,0 +1,135 @@
+package ota
+
+import (
+	"context"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/perm1ss10n/vexora/backend/internal/firmware"
+	"github.com/perm1ss10n/vexora/backend/internal/model"
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+)
+
+// Коды событий устройства о ходе OTA (device-state-machine.md §4).
+const (
+	EventOTAStart    = "OTA_START"    // начало скачивания
+	EventOTAProgress = "OTA_PROGRESS" // data: { phase: download|install, pct }
+	EventOTAInstall  = "OTA_INSTALL"  // образ скачан и проверен, идёт запись
+	EventOTAOk       = "OTA_OK"
+	EventOTAFail     = "OTA_FAIL" // data: { reason }
+)
+
+// OnEvent — событие устройства: двигает job кампании по downloading → installing → success/failed.
+// Job ищется по data.jobId, иначе — выполняющийся job устройства.
+func (s *Service) OnEvent(deviceID string, e model.EventPayload) {
+	if deviceID == "" || !strings.HasPrefix(e.Code, "OTA_") {
+		return
+	}
+	ctx := context.Background()
+	jobID, _ := e.Data["jobId"].(string)
+	job, err := s.store.FindOTAJob(ctx, deviceID, jobID)
+	if err != nil {
+		log.Printf("[OTA] find_job_failed deviceId=%s err=%v", deviceID, err)
+		return
+	}
+	if job == nil {
+		return
+	}
+
+	now := time.Now().UnixMilli()
+	// устройство не смогло применить дельту и перешло на полный образ (data.mode = "full")
+	if mode, _ := e.Data["mode"].(string); mode == registry.OTADownloadFull && job.DownloadMode == registry.OTADownloadDelta {
+		if err := s.store.SetOTADeviceDownload(ctx, job.CampaignID, deviceID, registry.OTADownloadFull, job.DeltaID, job.DeltaSize, job.FullSize); err != nil {
+			log.Printf("[OTA] set_download_failed deviceId=%s err=%v", deviceID, err)
+		} else {
+			log.Printf("[OTA] delta_fallback id=%s deviceId=%s jobId=%s", job.CampaignID, deviceID, job.JobID)
+		}
+	}
+
+	switch e.Code {
+	case EventOTAStart:
+		s.advance(ctx, job, []string{registry.OTADeviceSent}, registry.OTADeviceDownloading, now)
+	case EventOTAInstall:
+		s.advance(ctx, job, []string{registry.OTADeviceSent, registry.OTADeviceDownloading}, registry.OTADeviceInstalling, now)
+	case EventOTAProgress:
+		if phase, _ := e.Data["phase"].(string); phase == "install" {
+			s.advance(ctx, job, []string{registry.OTADeviceSent, registry.OTADeviceDownloading}, registry.OTADeviceInstalling, now)
+			return
+		}
+		s.advance(ctx, job, []string{registry.OTADeviceSent}, registry.OTADeviceDownloading, now)
+		if err := s.store.TouchOTADevice(ctx, job.CampaignID, deviceID, now); err != nil {
+			log.Printf("[OTA] touch_failed deviceId=%s err=%v", deviceID, err)
+		}
+	case EventOTAOk:
+		s.finish(ctx, job.CampaignID, deviceID, job.JobID, registry.OTADeviceSuccess, "")
+	case EventOTAFail:
+		reason, _ := e.Data["reason"].(string)
+		if reason == "" {
+			reason = e.Msg
+		}
+		if reason == "" {
+			reason = EventOTAFail
+		}
+		s.finish(ctx, job.CampaignID, deviceID, job.JobID, registry.OTADeviceFailed, reason)
+	}
+}
+
+// OnAck — ack на job: ok=false (HW_MISMATCH, нет места, ...) — job failed. true — ack относился к OTA.
+func (s *Service) OnAck(deviceID string, a model.AckPayload) bool {
+	if deviceID == "" || a.ID == "" {
+		return false
+	}
+	ctx := context.Background()
+	job, err := s.store.FindOTAJob(ctx, deviceID, a.ID)
+	if err != nil {
+		log.Printf("[OTA] find_job_failed deviceId=%s err=%v", deviceID, err)
+		return false
+	}
+	if job == nil {
+		return false
+	}
+	if !a.Ok {
+		reason := a.Code
+		if a.Msg != "" {
+			reason = strings.TrimSpace(reason + ": " + a.Msg)
+		}
+		if reason == "" {
+			reason = "rejected"
+		}
+		s.finish(ctx, job.CampaignID, deviceID, job.JobID, registry.OTADeviceFailed, reason)
+		return true
+	}
+	if err := s.store.TouchOTADevice(ctx, job.CampaignID, deviceID, time.Now().UnixMilli()); err != nil {
+		log.Printf("[OTA] touch_failed deviceId=%s err=%v", deviceID, err)
+	}
+	return true
+}
+
+// OnFirmware — state.fw устройства: загрузилось на целевой версии — job success (даже если OTA_OK потерялся).
+func (s *Service) OnFirmware(deviceID, fw string) {
+	if deviceID == "" || fw == "" {
+		return
+	}
+	ctx := context.Background()
+	job, err := s.store.FindOTAJob(ctx, deviceID, "")
+	if err != nil {
+		log.Printf("[OTA] find_job_failed deviceId=%s err=%v", deviceID, err)
+		return
+	}
+	if job == nil || firmware.CompareVersions(fw, job.TargetVersion) != 0 {
+		return
+	}
+	s.finish(ctx, job.CampaignID, deviceID, job.JobID, registry.OTADeviceSuccess, "")
+}
+
+func (s *Service) advance(ctx context.Context, job *registry.OTAJob, from []string, to string, now int64) {
+	ok, err := s.store.SetOTADeviceStatus(ctx, job.CampaignID, job.DeviceID, from, to, "", 0, now)
+	if err != nil {
+		log.Printf("[OTA] set_status_failed id=%s deviceId=%s err=%v", job.CampaignID, job.DeviceID, err)
+		return
+	}
+	if ok {
+		log.Printf("[OTA] job_%s id=%s deviceId=%s jobId=%s", to, job.CampaignID, job.DeviceID, job.JobID)
+	}
+}
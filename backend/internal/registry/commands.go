@@ -0,0 +1,198 @@
+package registry
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/perm1ss10n/vexora/backend/internal/model"
+)
+
+// Статусы команд в истории.
+const (
+	CommandStatusSent          = "sent"
+	CommandStatusAcked         = "acked"
+	CommandStatusFailed        = "failed" // ACK пришёл с ok=false
+	CommandStatusTimeout       = "timeout"
+	CommandStatusAckedLate     = "acked_late" // ACK пришёл после TIMEOUT, в пределах grace-окна
+	CommandStatusPublishFailed = "publish_failed"
+	CommandStatusAborted       = "aborted" // ожидание прервано (клиент отвалился), ACK ещё может прийти
+	CommandStatusCancelled     = "cancelled"
+)
+
+type CommandRecord struct {
+	ID            string
+	DeviceID      string
+	Type          string
+	Params        map[string]any
+	Status        string
+	Attempts      int
+	Ack           *model.AckPayload
+	CreatedMillis int64
+	UpdatedMillis int64
+	AckedMillis   sql.NullInt64
+}
+
+func (s *SQLiteStore) InsertCommand(ctx context.Context, rec CommandRecord) error {
+	if rec.ID == "" || rec.DeviceID == "" {
+		return nil
+	}
+	if rec.CreatedMillis <= 0 {
+		rec.CreatedMillis = time.Now().UnixMilli()
+	}
+
+	var params sql.NullString
+	if len(rec.Params) > 0 {
+		b, err := json.Marshal(rec.Params)
+		if err != nil {
+			return fmt.Errorf("registry insert command id=%s: marshal params: %w", rec.ID, err)
+		}
+		params = sql.NullString{String: string(b), Valid: true}
+	}
+
+	_, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO commands(id, device_id, type, params_json, status, attempts, created_at_ts, updated_at_ts)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?);`,
+		rec.ID,
+		rec.DeviceID,
+		rec.Type,
+		params,
+		rec.Status,
+		rec.Attempts,
+		rec.CreatedMillis,
+		rec.CreatedMillis,
+	)
+	if err != nil {
+		return fmt.Errorf("registry insert command id=%s: %w", rec.ID, err)
+	}
+	return nil
+}
+
+// UpdateCommandResult — финальный (или промежуточный) статус команды.
+// ack может быть nil (timeout/publish_failed); attempts=0 оставляет прежнее значение.
+func (s *SQLiteStore) UpdateCommandResult(ctx context.Context, id string, status string, attempts int, ack *model.AckPayload, tsMillis int64) error {
+	if id == "" {
+		return nil
+	}
+	if tsMillis <= 0 {
+		tsMillis = time.Now().UnixMilli()
+	}
+
+	var ackJSON sql.NullString
+	var ackedAt sql.NullInt64
+	if ack != nil {
+		b, err := json.Marshal(ack)
+		if err != nil {
+			return fmt.Errorf("registry update command id=%s: marshal ack: %w", id, err)
+		}
+		ackJSON = sql.NullString{String: string(b), Valid: true}
+		ackedAt = sql.NullInt64{Int64: tsMillis, Valid: true}
+	}
+
+	q := `
+UPDATE commands SET
+  status = ?,
+  attempts = CASE WHEN ? > 0 THEN ? ELSE attempts END,
+  ack_json = COALESCE(?, ack_json),
+  acked_at_ts = COALESCE(?, acked_at_ts),
+  updated_at_ts = ?
+WHERE id = ?;
+`
+	_, err := s.db.ExecContext(ctx, q, status, attempts, attempts, ackJSON, ackedAt, tsMillis, id)
+	if err != nil {
+		return fmt.Errorf("registry update command id=%s: %w", id, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) GetCommand(ctx context.Context, id string) (*CommandRecord, error) {
+	if id == "" {
+		return nil, nil
+	}
+
+	row := s.db.QueryRowContext(
+		ctx,
+		`SELECT id, device_id, type, params_json, status, attempts, ack_json, created_at_ts, updated_at_ts, acked_at_ts
+FROM commands
+WHERE id = ?;`,
+		id,
+	)
+	rec, err := scanCommand(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("registry get command: %w", err)
+	}
+	return rec, nil
+}
+
+func (s *SQLiteStore) ListDeviceCommands(ctx context.Context, deviceID string, limit int) ([]CommandRecord, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT id, device_id, type, params_json, status, attempts, ack_json, created_at_ts, updated_at_ts, acked_at_ts
+FROM commands
+WHERE device_id = ?
+ORDER BY created_at_ts DESC
+LIMIT ?;`,
+		deviceID,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("registry list commands: %w", err)
+	}
+	defer rows.Close()
+
+	out := []CommandRecord{}
+	for rows.Next() {
+		rec, err := scanCommand(rows)
+		if err != nil {
+			return nil, fmt.Errorf("registry scan commands: %w", err)
+		}
+		out = append(out, *rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("registry list commands rows: %w", err)
+	}
+	return out, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanCommand(row rowScanner) (*CommandRecord, error) {
+	var rec CommandRecord
+	var params, ack sql.NullString
+	if err := row.Scan(
+		&rec.ID,
+		&rec.DeviceID,
+		&rec.Type,
+		&params,
+		&rec.Status,
+		&rec.Attempts,
+		&ack,
+		&rec.CreatedMillis,
+		&rec.UpdatedMillis,
+		&rec.AckedMillis,
+	); err != nil {
+		return nil, err
+	}
+	if params.Valid && params.String != "" {
+		_ = json.Unmarshal([]byte(params.String), &rec.Params)
+	}
+	if ack.Valid && ack.String != "" {
+		var a model.AckPayload
+		if err := json.Unmarshal([]byte(ack.String), &a); err == nil {
+			rec.Ack = &a
+		}
+	}
+	return &rec, nil
+}
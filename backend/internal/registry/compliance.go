@@ -0,0 +1,218 @@
+package registry
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// FirmwarePolicy — требования к прошивке для группы устройств (Group пустой — весь парк).
+type FirmwarePolicy struct {
+	Name          string
+	Group         string
+	MinVersion    string   // ниже — не соответствует
+	KnownBad      []string // условия (firmware.Constraint) на версии с известными ошибками
+	TargetVersion string   // к чему ведём парк; ниже — "можно обновить", но не нарушение
+	AutoEnroll    bool     // несоответствующие — в текущую OTA-кампанию на TargetVersion
+	UpdatedBy     string
+	CreatedMillis int64
+	UpdatedMillis int64
+}
+
+// FWComplianceRecord — последнее вычисленное соответствие устройства политикам.
+type FWComplianceRecord struct {
+	DeviceID      string
+	Status        string // compliant / non_compliant / unknown
+	Reasons       []string
+	FW            string
+	ChangedMillis int64 // когда статус стал текущим
+	UpdatedMillis int64
+}
+
+const firmwarePolicyColumns = `name, group_name, min_version, known_bad_json, target_version, auto_enroll, updated_by,
+created_at_ts, updated_at_ts`
+
+// UpsertFirmwarePolicy создаёт или заменяет политику (created_at_ts сохраняется).
+func (s *SQLiteStore) UpsertFirmwarePolicy(ctx context.Context, p FirmwarePolicy) error {
+	bad, err := json.Marshal(p.KnownBad)
+	if err != nil {
+		return fmt.Errorf("registry upsert firmware policy: %w", err)
+	}
+	_, err = s.db.ExecContext(
+		ctx,
+		`INSERT INTO firmware_policies(`+firmwarePolicyColumns+`)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(name) DO UPDATE SET
+  group_name = excluded.group_name,
+  min_version = excluded.min_version,
+  known_bad_json = excluded.known_bad_json,
+  target_version = excluded.target_version,
+  auto_enroll = excluded.auto_enroll,
+  updated_by = excluded.updated_by,
+  updated_at_ts = excluded.updated_at_ts;`,
+		p.Name,
+		p.Group,
+		p.MinVersion,
+		string(bad),
+		p.TargetVersion,
+		boolToInt(p.AutoEnroll),
+		p.UpdatedBy,
+		p.CreatedMillis,
+		p.UpdatedMillis,
+	)
+	if err != nil {
+		return fmt.Errorf("registry upsert firmware policy name=%s: %w", p.Name, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) GetFirmwarePolicy(ctx context.Context, name string) (*FirmwarePolicy, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+firmwarePolicyColumns+` FROM firmware_policies WHERE name = ?;`, name)
+	p, err := scanFirmwarePolicy(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("registry get firmware policy: %w", err)
+	}
+	return p, nil
+}
+
+func (s *SQLiteStore) ListFirmwarePolicies(ctx context.Context) ([]FirmwarePolicy, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT `+firmwarePolicyColumns+` FROM firmware_policies ORDER BY group_name, name;`)
+	if err != nil {
+		return nil, fmt.Errorf("registry list firmware policies: %w", err)
+	}
+	defer rows.Close()
+
+	out := []FirmwarePolicy{}
+	for rows.Next() {
+		p, err := scanFirmwarePolicy(rows)
+		if err != nil {
+			return nil, fmt.Errorf("registry scan firmware policies: %w", err)
+		}
+		out = append(out, *p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("registry list firmware policies rows: %w", err)
+	}
+	return out, nil
+}
+
+func (s *SQLiteStore) DeleteFirmwarePolicy(ctx context.Context, name string) (bool, error) {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM firmware_policies WHERE name = ?;`, name)
+	if err != nil {
+		return false, fmt.Errorf("registry delete firmware policy name=%s: %w", name, err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ListFWCompliance — сохранённое соответствие всех устройств: deviceId -> запись.
+func (s *SQLiteStore) ListFWCompliance(ctx context.Context) (map[string]FWComplianceRecord, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT device_id, status, reasons_json, fw, changed_at_ts, updated_at_ts FROM device_fw_compliance;`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("registry list fw compliance: %w", err)
+	}
+	defer rows.Close()
+
+	out := map[string]FWComplianceRecord{}
+	for rows.Next() {
+		rec, err := scanFWCompliance(rows)
+		if err != nil {
+			return nil, fmt.Errorf("registry scan fw compliance: %w", err)
+		}
+		out[rec.DeviceID] = *rec
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("registry list fw compliance rows: %w", err)
+	}
+	return out, nil
+}
+
+func (s *SQLiteStore) GetFWCompliance(ctx context.Context, deviceID string) (*FWComplianceRecord, error) {
+	row := s.db.QueryRowContext(
+		ctx,
+		`SELECT device_id, status, reasons_json, fw, changed_at_ts, updated_at_ts FROM device_fw_compliance WHERE device_id = ?;`,
+		deviceID,
+	)
+	rec, err := scanFWCompliance(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("registry get fw compliance: %w", err)
+	}
+	return rec, nil
+}
+
+func (s *SQLiteStore) SetFWCompliance(ctx context.Context, rec FWComplianceRecord) error {
+	reasons, err := json.Marshal(rec.Reasons)
+	if err != nil {
+		return fmt.Errorf("registry set fw compliance: %w", err)
+	}
+	_, err = s.db.ExecContext(
+		ctx,
+		`INSERT INTO device_fw_compliance(device_id, status, reasons_json, fw, changed_at_ts, updated_at_ts)
+VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT(device_id) DO UPDATE SET
+  status = excluded.status,
+  reasons_json = excluded.reasons_json,
+  fw = excluded.fw,
+  changed_at_ts = excluded.changed_at_ts,
+  updated_at_ts = excluded.updated_at_ts;`,
+		rec.DeviceID,
+		rec.Status,
+		string(reasons),
+		rec.FW,
+		rec.ChangedMillis,
+		rec.UpdatedMillis,
+	)
+	if err != nil {
+		return fmt.Errorf("registry set fw compliance deviceId=%s: %w", rec.DeviceID, err)
+	}
+	return nil
+}
+
+func scanFirmwarePolicy(row rowScanner) (*FirmwarePolicy, error) {
+	var p FirmwarePolicy
+	var bad string
+	var auto int
+	if err := row.Scan(
+		&p.Name,
+		&p.Group,
+		&p.MinVersion,
+		&bad,
+		&p.TargetVersion,
+		&auto,
+		&p.UpdatedBy,
+		&p.CreatedMillis,
+		&p.UpdatedMillis,
+	); err != nil {
+		return nil, err
+	}
+	p.AutoEnroll = auto != 0
+	if err := json.Unmarshal([]byte(bad), &p.KnownBad); err != nil {
+		return nil, fmt.Errorf("known_bad_json: %w", err)
+	}
+	if p.KnownBad == nil {
+		p.KnownBad = []string{}
+	}
+	return &p, nil
+}
+
+func scanFWCompliance(row rowScanner) (*FWComplianceRecord, error) {
+	var rec FWComplianceRecord
+	var reasons string
+	if err := row.Scan(&rec.DeviceID, &rec.Status, &reasons, &rec.FW, &rec.ChangedMillis, &rec.UpdatedMillis); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(reasons), &rec.Reasons); err != nil {
+		return nil, fmt.Errorf("reasons_json: %w", err)
+	}
+	return &rec, nil
+}
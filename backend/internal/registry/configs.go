@@ -0,0 +1,449 @@
+package registry
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type DeviceConfigRecord struct {
+	DeviceID        string
+	Version         int64
+	Doc             map[string]any
+	CreatedBy       string
+	CreatedMillis   int64
+	PublishedMillis sql.NullInt64
+	RollbackOf      sql.NullInt64 // откат: версия, чьё содержимое переиздано
+}
+
+// ConfigOutcome — итог применения версии по отчётам cfg/status.
+type ConfigOutcome struct {
+	Status         string // applied/rejected/rolled_back/pending
+	Ok             sql.NullBool
+	Error          sql.NullString
+	ReportedMillis int64
+}
+
+// Статусы применения конфигурации (совпадают с CfgStatus в web).
+const (
+	CfgStatusPending    = "pending"
+	CfgStatusApplied    = "applied"
+	CfgStatusRejected   = "rejected"
+	CfgStatusRolledBack = "rolled_back"
+)
+
+type CfgStateRecord struct {
+	DeviceID       string
+	ActiveVersion  sql.NullInt64
+	PendingVersion sql.NullInt64
+	ReportedMillis int64
+
+	CfgStatus        sql.NullString
+	LastApplyVersion sql.NullInt64
+	LastApplyOk      sql.NullBool
+	LastApplyError   sql.NullString
+	LastApplyMillis  sql.NullInt64
+}
+
+// CfgStatusRecord — один отчёт cfg/status.
+type CfgStatusRecord struct {
+	DeviceID       string
+	TsMillis       int64
+	Status         string
+	ActiveVersion  *int64
+	PendingVersion *int64
+	ApplyVersion   *int64
+	ApplyOk        *bool
+	ApplyError     *string
+}
+
+// MaxConfigVersion — наибольшая выданная версия (0, если конфигураций не было).
+func (s *SQLiteStore) MaxConfigVersion(ctx context.Context, deviceID string) (int64, error) {
+	var v sql.NullInt64
+	row := s.db.QueryRowContext(ctx, `SELECT MAX(version) FROM device_configs WHERE device_id = ?;`, deviceID)
+	if err := row.Scan(&v); err != nil {
+		return 0, fmt.Errorf("registry max config version: %w", err)
+	}
+	return v.Int64, nil
+}
+
+func (s *SQLiteStore) InsertDeviceConfig(ctx context.Context, rec DeviceConfigRecord) error {
+	if rec.CreatedMillis <= 0 {
+		rec.CreatedMillis = time.Now().UnixMilli()
+	}
+	doc, err := s.encodeDoc(rec.Doc)
+	if err != nil {
+		return fmt.Errorf("registry insert config deviceId=%s: %w", rec.DeviceID, err)
+	}
+	var createdBy sql.NullString
+	if rec.CreatedBy != "" {
+		createdBy = sql.NullString{String: rec.CreatedBy, Valid: true}
+	}
+	_, err = s.db.ExecContext(
+		ctx,
+		`INSERT INTO device_configs(device_id, version, doc_json, created_by, created_at_ts, published_at_ts, rollback_of)
+VALUES (?, ?, ?, ?, ?, ?, ?);`,
+		rec.DeviceID,
+		rec.Version,
+		doc,
+		createdBy,
+		rec.CreatedMillis,
+		rec.PublishedMillis,
+		rec.RollbackOf,
+	)
+	if err != nil {
+		return fmt.Errorf("registry insert config deviceId=%s v=%d: %w", rec.DeviceID, rec.Version, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) MarkConfigPublished(ctx context.Context, deviceID string, version int64, tsMillis int64) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`UPDATE device_configs SET published_at_ts = ? WHERE device_id = ? AND version = ?;`,
+		tsMillis,
+		deviceID,
+		version,
+	)
+	if err != nil {
+		return fmt.Errorf("registry mark config published deviceId=%s v=%d: %w", deviceID, version, err)
+	}
+	return nil
+}
+
+// GetDesiredConfig — последняя (максимальная) версия конфигурации устройства.
+func (s *SQLiteStore) GetDesiredConfig(ctx context.Context, deviceID string) (*DeviceConfigRecord, error) {
+	row := s.db.QueryRowContext(
+		ctx,
+		`SELECT device_id, version, doc_json, created_by, created_at_ts, published_at_ts, rollback_of
+FROM device_configs
+WHERE device_id = ?
+ORDER BY version DESC
+LIMIT 1;`,
+		deviceID,
+	)
+	rec, err := s.scanDeviceConfig(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("registry get desired config: %w", err)
+	}
+	return rec, nil
+}
+
+// GetDeviceConfig — конкретная версия (nil, если такой нет).
+func (s *SQLiteStore) GetDeviceConfig(ctx context.Context, deviceID string, version int64) (*DeviceConfigRecord, error) {
+	row := s.db.QueryRowContext(
+		ctx,
+		`SELECT device_id, version, doc_json, created_by, created_at_ts, published_at_ts, rollback_of
+FROM device_configs
+WHERE device_id = ? AND version = ?;`,
+		deviceID,
+		version,
+	)
+	rec, err := s.scanDeviceConfig(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("registry get config version: %w", err)
+	}
+	return rec, nil
+}
+
+// ListDeviceConfigs — все выданные версии, новые первыми.
+func (s *SQLiteStore) ListDeviceConfigs(ctx context.Context, deviceID string, limit int) ([]DeviceConfigRecord, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT device_id, version, doc_json, created_by, created_at_ts, published_at_ts, rollback_of
+FROM device_configs
+WHERE device_id = ?
+ORDER BY version DESC
+LIMIT ?;`,
+		deviceID,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("registry list config versions: %w", err)
+	}
+	defer rows.Close()
+
+	out := []DeviceConfigRecord{}
+	for rows.Next() {
+		rec, err := s.scanDeviceConfig(rows)
+		if err != nil {
+			return nil, fmt.Errorf("registry scan config versions: %w", err)
+		}
+		out = append(out, *rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("registry list config versions rows: %w", err)
+	}
+	return out, nil
+}
+
+// ListConfigOutcomes — последний известный итог по каждой версии из истории cfg/status.
+// Явный lastApply важнее косвенного (версия видна как active/pending).
+func (s *SQLiteStore) ListConfigOutcomes(ctx context.Context, deviceID string) (map[int64]ConfigOutcome, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT ts, cfg_status, active_version, pending_version, apply_version, apply_ok, apply_error
+FROM cfg_status_history
+WHERE device_id = ?
+ORDER BY ts, id;`,
+		deviceID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("registry list config outcomes: %w", err)
+	}
+	defer rows.Close()
+
+	out := map[int64]ConfigOutcome{}
+	explicit := map[int64]bool{}
+	for rows.Next() {
+		var ts int64
+		var status string
+		var active, pending, applyVersion sql.NullInt64
+		var applyOk sql.NullBool
+		var applyErr sql.NullString
+		if err := rows.Scan(&ts, &status, &active, &pending, &applyVersion, &applyOk, &applyErr); err != nil {
+			return nil, fmt.Errorf("registry scan config outcomes: %w", err)
+		}
+		if applyVersion.Valid {
+			st := CfgStatusApplied
+			if applyOk.Valid && !applyOk.Bool {
+				st = status
+				if st != CfgStatusRolledBack {
+					st = CfgStatusRejected
+				}
+			}
+			out[applyVersion.Int64] = ConfigOutcome{Status: st, Ok: applyOk, Error: applyErr, ReportedMillis: ts}
+			explicit[applyVersion.Int64] = true
+		}
+		if active.Valid && !explicit[active.Int64] {
+			out[active.Int64] = ConfigOutcome{Status: CfgStatusApplied, Ok: sql.NullBool{Bool: true, Valid: true}, ReportedMillis: ts}
+		}
+		if pending.Valid && !explicit[pending.Int64] {
+			if _, seen := out[pending.Int64]; !seen {
+				out[pending.Int64] = ConfigOutcome{Status: CfgStatusPending, ReportedMillis: ts}
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("registry list config outcomes rows: %w", err)
+	}
+	return out, nil
+}
+
+func (s *SQLiteStore) UpdateCfgState(ctx context.Context, deviceID string, active *int64, pending *int64, tsMillis int64) error {
+	if deviceID == "" {
+		return nil
+	}
+	if tsMillis <= 0 {
+		tsMillis = time.Now().UnixMilli()
+	}
+
+	// pending передаём как есть (nil = pending нет), active — только если прислали
+	q := `
+INSERT INTO device_cfg_state(device_id, active_version, pending_version, reported_at_ts)
+VALUES (?, ?, ?, ?)
+ON CONFLICT(device_id) DO UPDATE SET
+  active_version = COALESCE(excluded.active_version, active_version),
+  pending_version = excluded.pending_version,
+  reported_at_ts = excluded.reported_at_ts;
+`
+	_, err := s.db.ExecContext(ctx, q, deviceID, active, pending, tsMillis)
+	if err != nil {
+		return fmt.Errorf("registry update cfg state deviceId=%s: %w", deviceID, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) RecordCfgStatus(ctx context.Context, rec CfgStatusRecord) error {
+	if rec.DeviceID == "" {
+		return nil
+	}
+	if rec.TsMillis <= 0 {
+		rec.TsMillis = time.Now().UnixMilli()
+	}
+
+	var applyTs *int64
+	if rec.ApplyVersion != nil || rec.ApplyOk != nil {
+		applyTs = &rec.TsMillis
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("registry record cfg status deviceId=%s: %w", rec.DeviceID, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	// cfg/status — авторитетный отчёт: pending перезаписываем как есть, active — если прислали
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO device_cfg_state(device_id, active_version, pending_version, reported_at_ts,
+  cfg_status, last_apply_version, last_apply_ok, last_apply_error, last_apply_ts)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(device_id) DO UPDATE SET
+  active_version = COALESCE(excluded.active_version, active_version),
+  pending_version = excluded.pending_version,
+  reported_at_ts = excluded.reported_at_ts,
+  cfg_status = excluded.cfg_status,
+  last_apply_version = COALESCE(excluded.last_apply_version, last_apply_version),
+  last_apply_ok = COALESCE(excluded.last_apply_ok, last_apply_ok),
+  last_apply_error = CASE WHEN excluded.last_apply_ts IS NULL THEN last_apply_error ELSE excluded.last_apply_error END,
+  last_apply_ts = COALESCE(excluded.last_apply_ts, last_apply_ts);`,
+		rec.DeviceID,
+		rec.ActiveVersion,
+		rec.PendingVersion,
+		rec.TsMillis,
+		rec.Status,
+		rec.ApplyVersion,
+		rec.ApplyOk,
+		rec.ApplyError,
+		applyTs,
+	)
+	if err != nil {
+		return fmt.Errorf("registry record cfg status deviceId=%s: %w", rec.DeviceID, err)
+	}
+
+	_, err = tx.ExecContext(
+		ctx,
+		`INSERT INTO cfg_status_history(device_id, ts, cfg_status, active_version, pending_version, apply_version, apply_ok, apply_error)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?);`,
+		rec.DeviceID,
+		rec.TsMillis,
+		rec.Status,
+		rec.ActiveVersion,
+		rec.PendingVersion,
+		rec.ApplyVersion,
+		rec.ApplyOk,
+		rec.ApplyError,
+	)
+	if err != nil {
+		return fmt.Errorf("registry record cfg status history deviceId=%s: %w", rec.DeviceID, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("registry record cfg status deviceId=%s: %w", rec.DeviceID, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) ListCfgStatusHistory(ctx context.Context, deviceID string, limit int) ([]CfgStatusRecord, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT device_id, ts, cfg_status, active_version, pending_version, apply_version, apply_ok, apply_error
+FROM cfg_status_history
+WHERE device_id = ?
+ORDER BY ts DESC, id DESC
+LIMIT ?;`,
+		deviceID,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("registry list cfg status history: %w", err)
+	}
+	defer rows.Close()
+
+	out := []CfgStatusRecord{}
+	for rows.Next() {
+		var rec CfgStatusRecord
+		var active, pending, applyVersion sql.NullInt64
+		var applyOk sql.NullBool
+		var applyErr sql.NullString
+		if err := rows.Scan(
+			&rec.DeviceID,
+			&rec.TsMillis,
+			&rec.Status,
+			&active,
+			&pending,
+			&applyVersion,
+			&applyOk,
+			&applyErr,
+		); err != nil {
+			return nil, fmt.Errorf("registry scan cfg status history: %w", err)
+		}
+		if active.Valid {
+			rec.ActiveVersion = &active.Int64
+		}
+		if pending.Valid {
+			rec.PendingVersion = &pending.Int64
+		}
+		if applyVersion.Valid {
+			rec.ApplyVersion = &applyVersion.Int64
+		}
+		if applyOk.Valid {
+			rec.ApplyOk = &applyOk.Bool
+		}
+		if applyErr.Valid {
+			rec.ApplyError = &applyErr.String
+		}
+		out = append(out, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("registry list cfg status history rows: %w", err)
+	}
+	return out, nil
+}
+
+func (s *SQLiteStore) GetCfgState(ctx context.Context, deviceID string) (*CfgStateRecord, error) {
+	row := s.db.QueryRowContext(
+		ctx,
+		`SELECT device_id, active_version, pending_version, reported_at_ts,
+  cfg_status, last_apply_version, last_apply_ok, last_apply_error, last_apply_ts
+FROM device_cfg_state
+WHERE device_id = ?;`,
+		deviceID,
+	)
+	var rec CfgStateRecord
+	if err := row.Scan(
+		&rec.DeviceID,
+		&rec.ActiveVersion,
+		&rec.PendingVersion,
+		&rec.ReportedMillis,
+		&rec.CfgStatus,
+		&rec.LastApplyVersion,
+		&rec.LastApplyOk,
+		&rec.LastApplyError,
+		&rec.LastApplyMillis,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("registry get cfg state: %w", err)
+	}
+	return &rec, nil
+}
+
+func (s *SQLiteStore) scanDeviceConfig(row rowScanner) (*DeviceConfigRecord, error) {
+	var rec DeviceConfigRecord
+	var doc string
+	var createdBy sql.NullString
+	if err := row.Scan(
+		&rec.DeviceID,
+		&rec.Version,
+		&doc,
+		&createdBy,
+		&rec.CreatedMillis,
+		&rec.PublishedMillis,
+		&rec.RollbackOf,
+	); err != nil {
+		return nil, err
+	}
+	rec.CreatedBy = createdBy.String
+	decoded, err := s.decodeDoc(doc)
+	if err != nil {
+		return nil, fmt.Errorf("decode config doc: %w", err)
+	}
+	rec.Doc = decoded
+	return &rec, nil
+}
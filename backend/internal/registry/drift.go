@@ -0,0 +1,149 @@
+package registry
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// ConfigDriftRecord — состояние повторной доставки desired-конфига устройства.
+type ConfigDriftRecord struct {
+	DeviceID           string
+	DesiredVersion     int64
+	Attempts           int
+	Rollbacks          int
+	LastSentMillis     sql.NullInt64
+	NextAttemptMillis  sql.NullInt64
+	CountedApplyMillis sql.NullInt64
+	Stuck              bool
+	StuckMillis        sql.NullInt64
+	UpdatedMillis      int64
+}
+
+// DriftRow — desired vs reported по одному устройству (для reconciler'а и отчёта).
+type DriftRow struct {
+	DeviceID         string
+	DesiredVersion   int64
+	PublishedMillis  sql.NullInt64
+	DeviceStatus     string
+	ActiveVersion    sql.NullInt64
+	PendingVersion   sql.NullInt64
+	CfgStatus        sql.NullString
+	LastApplyVersion sql.NullInt64
+	LastApplyOk      sql.NullBool
+	LastApplyMillis  sql.NullInt64
+	ReportedMillis   sql.NullInt64
+
+	Drift *ConfigDriftRecord // nil, если reconciler ещё не занимался устройством
+}
+
+// ListConfigDrift — все устройства с desired-конфигом (последняя версия) и их отчёты.
+func (s *SQLiteStore) ListConfigDrift(ctx context.Context) ([]DriftRow, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT c.device_id, c.version, c.published_at_ts, COALESCE(d.status, ''),
+  st.active_version, st.pending_version, st.cfg_status, st.last_apply_version, st.last_apply_ok, st.last_apply_ts, st.reported_at_ts,
+  r.desired_version, r.attempts, r.rollbacks, r.last_sent_ts, r.next_attempt_ts, r.counted_apply_ts, r.stuck, r.stuck_at_ts, r.updated_at_ts
+FROM device_configs c
+JOIN (SELECT device_id, MAX(version) AS v FROM device_configs GROUP BY device_id) m
+  ON m.device_id = c.device_id AND m.v = c.version
+LEFT JOIN devices d ON d.device_id = c.device_id
+LEFT JOIN device_cfg_state st ON st.device_id = c.device_id
+LEFT JOIN device_cfg_drift r ON r.device_id = c.device_id
+ORDER BY c.device_id;`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("registry list config drift: %w", err)
+	}
+	defer rows.Close()
+
+	out := []DriftRow{}
+	for rows.Next() {
+		var row DriftRow
+		var desired sql.NullInt64
+		var attempts, rollbacks, stuck, updated sql.NullInt64
+		var dr ConfigDriftRecord
+		if err := rows.Scan(
+			&row.DeviceID,
+			&row.DesiredVersion,
+			&row.PublishedMillis,
+			&row.DeviceStatus,
+			&row.ActiveVersion,
+			&row.PendingVersion,
+			&row.CfgStatus,
+			&row.LastApplyVersion,
+			&row.LastApplyOk,
+			&row.LastApplyMillis,
+			&row.ReportedMillis,
+			&desired,
+			&attempts,
+			&rollbacks,
+			&dr.LastSentMillis,
+			&dr.NextAttemptMillis,
+			&dr.CountedApplyMillis,
+			&stuck,
+			&dr.StuckMillis,
+			&updated,
+		); err != nil {
+			return nil, fmt.Errorf("registry scan config drift: %w", err)
+		}
+		if desired.Valid {
+			dr.DeviceID = row.DeviceID
+			dr.DesiredVersion = desired.Int64
+			dr.Attempts = int(attempts.Int64)
+			dr.Rollbacks = int(rollbacks.Int64)
+			dr.Stuck = stuck.Int64 != 0
+			dr.UpdatedMillis = updated.Int64
+			row.Drift = &dr
+		}
+		out = append(out, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("registry list config drift rows: %w", err)
+	}
+	return out, nil
+}
+
+func (s *SQLiteStore) UpsertConfigDrift(ctx context.Context, rec ConfigDriftRecord) error {
+	if rec.UpdatedMillis <= 0 {
+		rec.UpdatedMillis = time.Now().UnixMilli()
+	}
+	_, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO device_cfg_drift(device_id, desired_version, attempts, rollbacks, last_sent_ts, next_attempt_ts,
+  counted_apply_ts, stuck, stuck_at_ts, updated_at_ts)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(device_id) DO UPDATE SET
+  desired_version = excluded.desired_version,
+  attempts = excluded.attempts,
+  rollbacks = excluded.rollbacks,
+  last_sent_ts = excluded.last_sent_ts,
+  next_attempt_ts = excluded.next_attempt_ts,
+  counted_apply_ts = excluded.counted_apply_ts,
+  stuck = excluded.stuck,
+  stuck_at_ts = excluded.stuck_at_ts,
+  updated_at_ts = excluded.updated_at_ts;`,
+		rec.DeviceID,
+		rec.DesiredVersion,
+		rec.Attempts,
+		rec.Rollbacks,
+		rec.LastSentMillis,
+		rec.NextAttemptMillis,
+		rec.CountedApplyMillis,
+		boolToInt(rec.Stuck),
+		rec.StuckMillis,
+		rec.UpdatedMillis,
+	)
+	if err != nil {
+		return fmt.Errorf("registry upsert config drift deviceId=%s: %w", rec.DeviceID, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) DeleteConfigDrift(ctx context.Context, deviceID string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM device_cfg_drift WHERE device_id = ?;`, deviceID); err != nil {
+		return fmt.Errorf("registry delete config drift deviceId=%s: %w", deviceID, err)
+	}
+	return nil
+}
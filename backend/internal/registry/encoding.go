@@ -0,0 +1,40 @@
+package registry
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// GetDeviceEncoding — кодировка сообщений устройства (json/msgpack/cbor); "" — не известна.
+func (s *SQLiteStore) GetDeviceEncoding(ctx context.Context, deviceID string) (string, error) {
+	var enc string
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT COALESCE(encoding, '') FROM devices WHERE device_id = ?;`,
+		deviceID,
+	).Scan(&enc)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("registry get device encoding: %w", err)
+	}
+	return enc, nil
+}
+
+// SetDeviceEncoding запоминает кодировку устройства (строка devices создаётся при первом Touch).
+func (s *SQLiteStore) SetDeviceEncoding(ctx context.Context, deviceID, enc string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`UPDATE devices SET encoding = ?, updated_at_ts = ? WHERE device_id = ?;`,
+		enc,
+		time.Now().UnixMilli(),
+		deviceID,
+	)
+	if err != nil {
+		return fmt.Errorf("registry set device encoding deviceId=%s: %w", deviceID, err)
+	}
+	return nil
+}
@@ -0,0 +1,357 @@
+package registry
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// FirmwareRecord — бинарник прошивки в репозитории (файл лежит на диске, в SQLite — метаданные).
+type FirmwareRecord struct {
+	ID               string
+	Version          string // semver
+	HWModel          string
+	MinHWRev         int // минимальная ревизия платы; 0 — любая
+	Notes            string
+	SHA256           string // hex
+	Size             int64
+	FileName         string // имя файла в каталоге репозитория
+	UploadedBy       string
+	CreatedMillis    int64
+	Deprecated       bool
+	DeprecatedMillis *int64
+	DeprecatedBy     string
+	DeprecatedReason string
+}
+
+// FirmwareFilter — выборка для списка; пустые поля не фильтруют.
+type FirmwareFilter struct {
+	HWModel           string
+	IncludeDeprecated bool
+}
+
+const firmwareColumns = `id, version, hw_model, notes, sha256, size_bytes, file_name, uploaded_by, created_at_ts,
+deprecated, deprecated_at_ts, deprecated_by, deprecated_reason, min_hw_rev`
+
+func (s *SQLiteStore) CreateFirmware(ctx context.Context, rec FirmwareRecord) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO firmware_artifacts(`+firmwareColumns+`)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		rec.ID,
+		rec.Version,
+		rec.HWModel,
+		rec.Notes,
+		rec.SHA256,
+		rec.Size,
+		rec.FileName,
+		rec.UploadedBy,
+		rec.CreatedMillis,
+		boolToInt(rec.Deprecated),
+		rec.DeprecatedMillis,
+		rec.DeprecatedBy,
+		rec.DeprecatedReason,
+		rec.MinHWRev,
+	)
+	if err != nil {
+		return fmt.Errorf("registry create firmware: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) GetFirmware(ctx context.Context, id string) (*FirmwareRecord, error) {
+	if id == "" {
+		return nil, nil
+	}
+	row := s.db.QueryRowContext(ctx, `SELECT `+firmwareColumns+` FROM firmware_artifacts WHERE id = ?;`, id)
+	rec, err := scanFirmware(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("registry get firmware: %w", err)
+	}
+	return rec, nil
+}
+
+// FindFirmware — артефакт по модели и версии (nil, если нет).
+func (s *SQLiteStore) FindFirmware(ctx context.Context, hwModel, version string) (*FirmwareRecord, error) {
+	row := s.db.QueryRowContext(
+		ctx,
+		`SELECT `+firmwareColumns+` FROM firmware_artifacts WHERE hw_model = ? AND version = ?;`,
+		hwModel,
+		version,
+	)
+	rec, err := scanFirmware(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("registry find firmware: %w", err)
+	}
+	return rec, nil
+}
+
+// ListFirmware — артефакты, новые первыми (порядок semver наводит вызывающий).
+func (s *SQLiteStore) ListFirmware(ctx context.Context, filter FirmwareFilter) ([]FirmwareRecord, error) {
+	where := []string{}
+	args := []any{}
+	if filter.HWModel != "" {
+		where = append(where, "hw_model = ?")
+		args = append(args, filter.HWModel)
+	}
+	if !filter.IncludeDeprecated {
+		where = append(where, "deprecated = 0")
+	}
+	query := `SELECT ` + firmwareColumns + ` FROM firmware_artifacts`
+	if len(where) > 0 {
+		query += ` WHERE ` + strings.Join(where, " AND ")
+	}
+	query += ` ORDER BY created_at_ts DESC, id;`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("registry list firmware: %w", err)
+	}
+	defer rows.Close()
+
+	out := []FirmwareRecord{}
+	for rows.Next() {
+		rec, err := scanFirmware(rows)
+		if err != nil {
+			return nil, fmt.Errorf("registry scan firmware: %w", err)
+		}
+		out = append(out, *rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("registry list firmware rows: %w", err)
+	}
+	return out, nil
+}
+
+// SetFirmwareDeprecated помечает артефакт устаревшим (deprecated=false — снимает отметку).
+func (s *SQLiteStore) SetFirmwareDeprecated(ctx context.Context, id string, deprecated bool, actor, reason string, nowMillis int64) (bool, error) {
+	var ts *int64
+	if deprecated {
+		ts = &nowMillis
+	} else {
+		actor, reason = "", ""
+	}
+	res, err := s.db.ExecContext(
+		ctx,
+		`UPDATE firmware_artifacts
+SET deprecated = ?, deprecated_at_ts = ?, deprecated_by = ?, deprecated_reason = ?
+WHERE id = ?;`,
+		boolToInt(deprecated),
+		ts,
+		actor,
+		reason,
+		id,
+	)
+	if err != nil {
+		return false, fmt.Errorf("registry deprecate firmware id=%s: %w", id, err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func scanFirmware(row rowScanner) (*FirmwareRecord, error) {
+	var rec FirmwareRecord
+	var deprecated int
+	var deprecatedAt sql.NullInt64
+	if err := row.Scan(
+		&rec.ID,
+		&rec.Version,
+		&rec.HWModel,
+		&rec.Notes,
+		&rec.SHA256,
+		&rec.Size,
+		&rec.FileName,
+		&rec.UploadedBy,
+		&rec.CreatedMillis,
+		&deprecated,
+		&deprecatedAt,
+		&rec.DeprecatedBy,
+		&rec.DeprecatedReason,
+		&rec.MinHWRev,
+	); err != nil {
+		return nil, err
+	}
+	rec.Deprecated = deprecated != 0
+	if deprecatedAt.Valid {
+		v := deprecatedAt.Int64
+		rec.DeprecatedMillis = &v
+	}
+	return &rec, nil
+}
+
+// FirmwareDelta — бинарная дельта от установленной версии к артефакту (файл на диске рядом с образами).
+type FirmwareDelta struct {
+	ID             string
+	FirmwareID     string // целевой артефакт
+	FromFirmwareID string
+	FromVersion    string
+	FromSHA256     string // образ, к которому применяется патч
+	SHA256         string // самого патча
+	Size           int64
+	FileName       string
+	CreatedMillis  int64
+}
+
+// FirmwareVersionCount — сколько устройств сообщают версию прошивки (devices.fw).
+type FirmwareVersionCount struct {
+	Version string
+	Devices int
+}
+
+const firmwareDeltaColumns = `id, firmware_id, from_firmware_id, from_version, from_sha256, sha256, size_bytes, file_name, created_at_ts`
+
+// UpsertFirmwareDelta сохраняет дельту; пересчитанная дельта для той же пары заменяет прежнюю.
+// Возвращает имя файла заменённой дельты (пусто — не было), чтобы вызывающий удалил его.
+func (s *SQLiteStore) UpsertFirmwareDelta(ctx context.Context, d FirmwareDelta) (string, error) {
+	var prev string
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT file_name FROM firmware_deltas WHERE firmware_id = ? AND from_version = ?;`,
+		d.FirmwareID,
+		d.FromVersion,
+	).Scan(&prev)
+	if err != nil && err != sql.ErrNoRows {
+		return "", fmt.Errorf("registry upsert firmware delta: %w", err)
+	}
+	_, err = s.db.ExecContext(
+		ctx,
+		`INSERT INTO firmware_deltas(`+firmwareDeltaColumns+`)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+ON CONFLICT(firmware_id, from_version) DO UPDATE SET
+  id = excluded.id,
+  from_firmware_id = excluded.from_firmware_id,
+  from_sha256 = excluded.from_sha256,
+  sha256 = excluded.sha256,
+  size_bytes = excluded.size_bytes,
+  file_name = excluded.file_name,
+  created_at_ts = excluded.created_at_ts;`,
+		d.ID,
+		d.FirmwareID,
+		d.FromFirmwareID,
+		d.FromVersion,
+		d.FromSHA256,
+		d.SHA256,
+		d.Size,
+		d.FileName,
+		d.CreatedMillis,
+	)
+	if err != nil {
+		return "", fmt.Errorf("registry upsert firmware delta: %w", err)
+	}
+	if prev == d.FileName {
+		prev = ""
+	}
+	return prev, nil
+}
+
+// ListFirmwareDeltas — дельты к артефакту, от меньшей к большей.
+func (s *SQLiteStore) ListFirmwareDeltas(ctx context.Context, firmwareID string) ([]FirmwareDelta, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT `+firmwareDeltaColumns+` FROM firmware_deltas WHERE firmware_id = ? ORDER BY size_bytes, from_version;`,
+		firmwareID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("registry list firmware deltas: %w", err)
+	}
+	defer rows.Close()
+
+	out := []FirmwareDelta{}
+	for rows.Next() {
+		d, err := scanFirmwareDelta(rows)
+		if err != nil {
+			return nil, fmt.Errorf("registry scan firmware deltas: %w", err)
+		}
+		out = append(out, *d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("registry list firmware deltas rows: %w", err)
+	}
+	return out, nil
+}
+
+// FindFirmwareDelta — дельта к артефакту от версии fromVersion (nil, если нет).
+func (s *SQLiteStore) FindFirmwareDelta(ctx context.Context, firmwareID, fromVersion string) (*FirmwareDelta, error) {
+	row := s.db.QueryRowContext(
+		ctx,
+		`SELECT `+firmwareDeltaColumns+` FROM firmware_deltas WHERE firmware_id = ? AND from_version = ?;`,
+		firmwareID,
+		fromVersion,
+	)
+	d, err := scanFirmwareDelta(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("registry find firmware delta: %w", err)
+	}
+	return d, nil
+}
+
+func (s *SQLiteStore) GetFirmwareDelta(ctx context.Context, id string) (*FirmwareDelta, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+firmwareDeltaColumns+` FROM firmware_deltas WHERE id = ?;`, id)
+	d, err := scanFirmwareDelta(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("registry get firmware delta: %w", err)
+	}
+	return d, nil
+}
+
+// TopInstalledFirmware — самые распространённые версии прошивки в парке (по devices.fw).
+func (s *SQLiteStore) TopInstalledFirmware(ctx context.Context, limit int) ([]FirmwareVersionCount, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT fw, COUNT(*) AS n
+FROM devices
+WHERE fw IS NOT NULL AND fw != ''
+GROUP BY fw
+ORDER BY n DESC, fw
+LIMIT ?;`,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("registry top installed firmware: %w", err)
+	}
+	defer rows.Close()
+
+	out := []FirmwareVersionCount{}
+	for rows.Next() {
+		var c FirmwareVersionCount
+		if err := rows.Scan(&c.Version, &c.Devices); err != nil {
+			return nil, fmt.Errorf("registry scan top installed firmware: %w", err)
+		}
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("registry top installed firmware rows: %w", err)
+	}
+	return out, nil
+}
+
+func scanFirmwareDelta(row rowScanner) (*FirmwareDelta, error) {
+	var d FirmwareDelta
+	if err := row.Scan(
+		&d.ID,
+		&d.FirmwareID,
+		&d.FromFirmwareID,
+		&d.FromVersion,
+		&d.FromSHA256,
+		&d.SHA256,
+		&d.Size,
+		&d.FileName,
+		&d.CreatedMillis,
+	); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
@@ -0,0 +1,95 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+type GroupSummary struct {
+	Name    string
+	Devices int
+}
+
+func (s *SQLiteStore) ListGroups(ctx context.Context) ([]GroupSummary, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT group_name, COUNT(*) FROM device_groups GROUP BY group_name ORDER BY group_name;`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("registry list groups: %w", err)
+	}
+	defer rows.Close()
+
+	out := []GroupSummary{}
+	for rows.Next() {
+		var g GroupSummary
+		if err := rows.Scan(&g.Name, &g.Devices); err != nil {
+			return nil, fmt.Errorf("registry scan groups: %w", err)
+		}
+		out = append(out, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("registry list groups rows: %w", err)
+	}
+	return out, nil
+}
+
+func (s *SQLiteStore) ListGroupDevices(ctx context.Context, group string) ([]string, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT device_id FROM device_groups WHERE group_name = ? ORDER BY device_id;`,
+		group,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("registry list group devices: %w", err)
+	}
+	defer rows.Close()
+
+	out := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("registry scan group devices: %w", err)
+		}
+		out = append(out, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("registry list group devices rows: %w", err)
+	}
+	return out, nil
+}
+
+// SetGroupDevices заменяет состав группы целиком. Пустой список удаляет группу.
+func (s *SQLiteStore) SetGroupDevices(ctx context.Context, group string, deviceIDs []string) error {
+	if group == "" {
+		return fmt.Errorf("registry set group: empty name")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("registry set group %s: %w", group, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM device_groups WHERE group_name = ?;`, group); err != nil {
+		return fmt.Errorf("registry set group %s: %w", group, err)
+	}
+	now := time.Now().UnixMilli()
+	for _, id := range deviceIDs {
+		if id == "" {
+			continue
+		}
+		if _, err := tx.ExecContext(
+			ctx,
+			`INSERT OR IGNORE INTO device_groups(group_name, device_id, added_at_ts) VALUES (?, ?, ?);`,
+			group, id, now,
+		); err != nil {
+			return fmt.Errorf("registry set group %s: %w", group, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("registry set group %s: %w", group, err)
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package registry
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type IdempotencyRecord struct {
+	UserID              string
+	Key                 string
+	RequestHash         string
+	CommandID           string
+	StatusCode          sql.NullInt64 // не Valid — первый запрос ещё выполняется
+	Response            sql.NullString
+	CreatedMillis       int64
+	ReservedUntilMillis int64 // позже — запрос считается брошенным
+	ExpiresMillis       int64
+}
+
+// ReserveIdempotencyKey пытается занять ключ под новую команду.
+// Если ключ уже занят (и не истёк) — возвращает существующую запись, rec не сохраняется.
+// Исключение — ключ, который всё ещё "выполняется" после ReservedUntilMillis: backend упал
+// между Reserve и Complete. Такой ключ с тем же запросом перезахватывается под rec.CommandID.
+func (s *SQLiteStore) ReserveIdempotencyKey(ctx context.Context, rec IdempotencyRecord) (*IdempotencyRecord, error) {
+	now := time.Now().UnixMilli()
+	if rec.CreatedMillis <= 0 {
+		rec.CreatedMillis = now
+	}
+
+	// истёкшие ключи чистим лениво
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE expires_at_ts < ?;`, now); err != nil {
+		return nil, fmt.Errorf("registry idempotency purge: %w", err)
+	}
+
+	res, err := s.db.ExecContext(
+		ctx,
+		`INSERT OR IGNORE INTO idempotency_keys(user_id, key, request_hash, command_id, created_at_ts, reserved_until_ts, expires_at_ts)
+VALUES (?, ?, ?, ?, ?, ?, ?);`,
+		rec.UserID,
+		rec.Key,
+		rec.RequestHash,
+		rec.CommandID,
+		rec.CreatedMillis,
+		rec.ReservedUntilMillis,
+		rec.ExpiresMillis,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("registry idempotency reserve: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		return nil, nil
+	}
+
+	res, err = s.db.ExecContext(
+		ctx,
+		`UPDATE idempotency_keys SET command_id = ?, created_at_ts = ?, reserved_until_ts = ?
+WHERE user_id = ? AND key = ? AND request_hash = ? AND status_code IS NULL AND reserved_until_ts < ?;`,
+		rec.CommandID,
+		rec.CreatedMillis,
+		rec.ReservedUntilMillis,
+		rec.UserID,
+		rec.Key,
+		rec.RequestHash,
+		now,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("registry idempotency takeover: %w", err)
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		return nil, nil
+	}
+
+	row := s.db.QueryRowContext(
+		ctx,
+		`SELECT user_id, key, request_hash, command_id, status_code, response_json, created_at_ts, reserved_until_ts, expires_at_ts
+FROM idempotency_keys
+WHERE user_id = ? AND key = ?;`,
+		rec.UserID,
+		rec.Key,
+	)
+	var existing IdempotencyRecord
+	if err := row.Scan(
+		&existing.UserID,
+		&existing.Key,
+		&existing.RequestHash,
+		&existing.CommandID,
+		&existing.StatusCode,
+		&existing.Response,
+		&existing.CreatedMillis,
+		&existing.ReservedUntilMillis,
+		&existing.ExpiresMillis,
+	); err != nil {
+		return nil, fmt.Errorf("registry idempotency lookup: %w", err)
+	}
+	return &existing, nil
+}
+
+// CompleteIdempotencyKey сохраняет итоговый ответ для повторов.
+func (s *SQLiteStore) CompleteIdempotencyKey(ctx context.Context, userID, key string, statusCode int, response []byte) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`UPDATE idempotency_keys SET status_code = ?, response_json = ? WHERE user_id = ? AND key = ?;`,
+		statusCode,
+		string(response),
+		userID,
+		key,
+	)
+	if err != nil {
+		return fmt.Errorf("registry idempotency complete: %w", err)
+	}
+	return nil
+}
+
+// ReleaseIdempotencyKey освобождает ключ (например, после 5xx), чтобы клиент мог повторить.
+func (s *SQLiteStore) ReleaseIdempotencyKey(ctx context.Context, userID, key string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM idempotency_keys WHERE user_id = ? AND key = ?;`, userID, key); err != nil {
+		return fmt.Errorf("registry idempotency release: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,188 @@
+package registry
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// DeviceLockRecord — блокировка устройства одной операцией (cmd/cfg/ota) с арендой до ExpiresMillis.
+type DeviceLockRecord struct {
+	DeviceID       string
+	Kind           string
+	Ref            string // cmdId, cfgVersion, id кампании OTA
+	Holder         string // кто держит: подсистема и/или пользователь
+	AcquiredMillis int64
+	ExpiresMillis  int64
+}
+
+// AcquireDeviceLock берёт блокировку, если её нет или аренда истекла. Повторный захват той же
+// операцией (kind и ref совпадают) продлевает аренду; чужую действующую аренду не перехватывает
+// никто, в том числе операция того же вида.
+// acquired=false — блокировку держит другая операция; она и возвращается.
+func (s *SQLiteStore) AcquireDeviceLock(ctx context.Context, rec DeviceLockRecord) (*DeviceLockRecord, bool, error) {
+	// блокировку могут снять между upsert и чтением держателя — тогда пробуем взять ещё раз
+	for attempt := 0; attempt < 2; attempt++ {
+		acquired, err := s.upsertDeviceLock(ctx, rec)
+		if err != nil {
+			return nil, false, err
+		}
+		if acquired {
+			return &rec, true, nil
+		}
+		cur, err := s.GetDeviceLock(ctx, rec.DeviceID, rec.AcquiredMillis)
+		if err != nil {
+			return nil, false, err
+		}
+		if cur != nil {
+			return cur, false, nil
+		}
+	}
+	return nil, false, fmt.Errorf("registry acquire device lock deviceId=%s: lock changed concurrently", rec.DeviceID)
+}
+
+func (s *SQLiteStore) upsertDeviceLock(ctx context.Context, rec DeviceLockRecord) (bool, error) {
+	res, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO device_locks(device_id, kind, ref, holder, acquired_at_ts, expires_at_ts)
+VALUES (?, ?, ?, ?, ?, ?)
+ON CONFLICT(device_id) DO UPDATE SET
+  kind = excluded.kind,
+  ref = excluded.ref,
+  holder = excluded.holder,
+  acquired_at_ts = excluded.acquired_at_ts,
+  expires_at_ts = excluded.expires_at_ts
+WHERE device_locks.expires_at_ts <= excluded.acquired_at_ts
+   OR (device_locks.kind = excluded.kind AND device_locks.ref = excluded.ref);`,
+		rec.DeviceID,
+		rec.Kind,
+		rec.Ref,
+		rec.Holder,
+		rec.AcquiredMillis,
+		rec.ExpiresMillis,
+	)
+	if err != nil {
+		return false, fmt.Errorf("registry acquire device lock deviceId=%s: %w", rec.DeviceID, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("registry acquire device lock deviceId=%s: %w", rec.DeviceID, err)
+	}
+	return n > 0, nil
+}
+
+// ReleaseDeviceLock снимает блокировку вида kind; ref пустой — независимо от ref.
+func (s *SQLiteStore) ReleaseDeviceLock(ctx context.Context, deviceID, kind, ref string) (bool, error) {
+	res, err := s.db.ExecContext(
+		ctx,
+		`DELETE FROM device_locks WHERE device_id = ? AND kind = ? AND (? = '' OR ref = ?);`,
+		deviceID,
+		kind,
+		ref,
+		ref,
+	)
+	if err != nil {
+		return false, fmt.Errorf("registry release device lock deviceId=%s: %w", deviceID, err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// DeleteDeviceLock снимает любую блокировку устройства (ручное вмешательство оператора).
+func (s *SQLiteStore) DeleteDeviceLock(ctx context.Context, deviceID string) (*DeviceLockRecord, error) {
+	row := s.db.QueryRowContext(
+		ctx,
+		`DELETE FROM device_locks WHERE device_id = ?
+RETURNING device_id, kind, ref, holder, acquired_at_ts, expires_at_ts;`,
+		deviceID,
+	)
+	rec, err := scanDeviceLock(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("registry delete device lock deviceId=%s: %w", deviceID, err)
+	}
+	return rec, nil
+}
+
+// ExtendDeviceLock продлевает аренду, если блокировку всё ещё держит kind/ref.
+func (s *SQLiteStore) ExtendDeviceLock(ctx context.Context, deviceID, kind, ref string, expiresMillis int64) (bool, error) {
+	res, err := s.db.ExecContext(
+		ctx,
+		`UPDATE device_locks SET expires_at_ts = ? WHERE device_id = ? AND kind = ? AND ref = ?;`,
+		expiresMillis,
+		deviceID,
+		kind,
+		ref,
+	)
+	if err != nil {
+		return false, fmt.Errorf("registry extend device lock deviceId=%s: %w", deviceID, err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// GetDeviceLock — действующая на nowMillis блокировка (nil, если нет или аренда истекла).
+func (s *SQLiteStore) GetDeviceLock(ctx context.Context, deviceID string, nowMillis int64) (*DeviceLockRecord, error) {
+	row := s.db.QueryRowContext(
+		ctx,
+		`SELECT device_id, kind, ref, holder, acquired_at_ts, expires_at_ts
+FROM device_locks
+WHERE device_id = ? AND expires_at_ts > ?;`,
+		deviceID,
+		nowMillis,
+	)
+	rec, err := scanDeviceLock(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("registry get device lock: %w", err)
+	}
+	return rec, nil
+}
+
+// ListDeviceLocks — действующие блокировки, по device_id.
+func (s *SQLiteStore) ListDeviceLocks(ctx context.Context, nowMillis int64) ([]DeviceLockRecord, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT device_id, kind, ref, holder, acquired_at_ts, expires_at_ts
+FROM device_locks
+WHERE expires_at_ts > ?
+ORDER BY device_id;`,
+		nowMillis,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("registry list device locks: %w", err)
+	}
+	defer rows.Close()
+
+	out := []DeviceLockRecord{}
+	for rows.Next() {
+		rec, err := scanDeviceLock(rows)
+		if err != nil {
+			return nil, fmt.Errorf("registry scan device locks: %w", err)
+		}
+		out = append(out, *rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("registry list device locks rows: %w", err)
+	}
+	return out, nil
+}
+
+func scanDeviceLock(row rowScanner) (*DeviceLockRecord, error) {
+	var rec DeviceLockRecord
+	if err := row.Scan(
+		&rec.DeviceID,
+		&rec.Kind,
+		&rec.Ref,
+		&rec.Holder,
+		&rec.AcquiredMillis,
+		&rec.ExpiresMillis,
+	); err != nil {
+		return nil, err
+	}
+	return &rec, nil
+}
@@ -0,0 +1,49 @@
+package registry
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+)
+
+func TestAcquireDeviceLock(t *testing.T) {
+	s, err := NewSQLite(SQLiteConfig{Path: filepath.Join(t.TempDir(), "reg.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	ctx := context.Background()
+
+	lock := func(kind, ref string, now, lease int64) DeviceLockRecord {
+		return DeviceLockRecord{DeviceID: "dev-1", Kind: kind, Ref: ref, Holder: kind + ":" + ref, AcquiredMillis: now, ExpiresMillis: now + lease}
+	}
+
+	if _, ok, err := s.AcquireDeviceLock(ctx, lock("cfg", "5", 1000, 1000)); err != nil || !ok {
+		t.Fatalf("first acquire: ok=%v err=%v", ok, err)
+	}
+
+	cases := []struct {
+		name    string
+		rec     DeviceLockRecord
+		want    bool
+		heldRef string // кто держит после попытки
+	}{
+		{"same kind, other ref, live lease", lock("cfg", "6", 1500, 1000), false, "5"},
+		{"other kind, live lease", lock("ota", "job-1", 1500, 1000), false, "5"},
+		{"same operation renews", lock("cfg", "5", 1600, 1000), true, "5"},
+		{"renewed lease still holds", lock("cfg", "6", 2500, 1000), false, "5"},
+		{"expired lease is taken over", lock("ota", "job-1", 2600, 1000), true, "job-1"},
+	}
+	for _, tc := range cases {
+		cur, ok, err := s.AcquireDeviceLock(ctx, tc.rec)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if ok != tc.want {
+			t.Errorf("%s: acquired=%v, want %v", tc.name, ok, tc.want)
+		}
+		if cur == nil || cur.Ref != tc.heldRef {
+			t.Errorf("%s: holder = %+v, want ref %s", tc.name, cur, tc.heldRef)
+		}
+	}
+}
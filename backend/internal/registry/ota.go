@@ -0,0 +1,594 @@
+package registry
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Статусы OTA-кампании.
+const (
+	OTACampaignRunning   = "running"
+	OTACampaignPaused    = "paused"
+	OTACampaignCompleted = "completed"
+	OTACampaignAborted   = "aborted"
+)
+
+// Статусы устройства в OTA-кампании.
+const (
+	OTADevicePending     = "pending" // ждёт своей волны (или выхода на связь)
+	OTADeviceSent        = "sent"    // job опубликован в v1/dev/{id}/ota
+	OTADeviceDownloading = "downloading"
+	OTADeviceInstalling  = "installing"
+	OTADeviceSuccess     = "success"
+	OTADeviceFailed      = "failed"
+	OTADeviceSkipped     = "skipped" // уже на целевой версии или в другой кампании
+	OTADeviceAborted     = "aborted"
+)
+
+// Чем устройство скачивает образ.
+const (
+	OTADownloadDelta = "delta"
+	OTADownloadFull  = "full"
+)
+
+// OTAInFlight — статусы, в которых устройство выполняет job.
+var OTAInFlight = []string{OTADeviceSent, OTADeviceDownloading, OTADeviceInstalling}
+
+type OTACampaignRecord struct {
+	ID               string
+	Name             string
+	FirmwareID       string
+	TargetVersion    string
+	HWModel          string
+	Selector         TargetSelector
+	FWPredicate      string
+	Waves            []int // накопительные проценты: [1, 10, 100]
+	FailureThreshold float64
+	MinSamples       int
+	WaveIntervalMs   int64 // минимальная длительность волны
+	JobTimeoutMs     int64
+	Status           string
+	Wave             int // индекс текущей волны
+	WaveStartedMs    int64
+	PauseReason      string
+	BaselineDone     int // счётчики на момент resume: порог считается по новым результатам
+	BaselineFailed   int
+	CreatedBy        string
+	CreatedMillis    int64
+	UpdatedMillis    int64
+	FinishedMillis   sql.NullInt64
+}
+
+type OTACampaignDevice struct {
+	CampaignID    string
+	DeviceID      string
+	JobID         string
+	Wave          int
+	Status        string
+	FromFW        string
+	Error         string
+	SentMillis    sql.NullInt64
+	UpdatedMillis int64
+	DownloadMode  string // OTADownloadDelta / OTADownloadFull, выставляется при отправке job
+	DeltaID       string
+	DeltaSize     int64
+	FullSize      int64
+}
+
+// OTAJob — устройство в активной кампании вместе с целевой версией кампании.
+type OTAJob struct {
+	OTACampaignDevice
+	TargetVersion string
+}
+
+// OTAStatusCount — число устройств кампании в статусе по волнам.
+type OTAStatusCount struct {
+	Wave   int
+	Status string
+	Count  int
+}
+
+const otaCampaignColumns = `id, name, firmware_id, target_version, hw_model, selector_json, fw_predicate, waves_json,
+failure_threshold, min_samples, wave_interval_ms, job_timeout_ms, status, wave, wave_started_ts, pause_reason,
+baseline_done, baseline_failed, created_by, created_at_ts, updated_at_ts, finished_at_ts`
+
+const otaDeviceColumns = `campaign_id, device_id, job_id, wave, status, from_fw, error, sent_at_ts, updated_at_ts,
+download_mode, delta_id, delta_size, full_size`
+
+// CreateOTACampaign сохраняет кампанию вместе со списком устройств (одной транзакцией).
+func (s *SQLiteStore) CreateOTACampaign(ctx context.Context, rec OTACampaignRecord, devices []OTACampaignDevice) error {
+	selector, err := json.Marshal(rec.Selector)
+	if err != nil {
+		return fmt.Errorf("registry create ota campaign: %w", err)
+	}
+	waves, err := json.Marshal(rec.Waves)
+	if err != nil {
+		return fmt.Errorf("registry create ota campaign: %w", err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("registry create ota campaign: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(
+		ctx,
+		`INSERT INTO ota_campaigns(`+otaCampaignColumns+`)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		rec.ID,
+		rec.Name,
+		rec.FirmwareID,
+		rec.TargetVersion,
+		rec.HWModel,
+		string(selector),
+		rec.FWPredicate,
+		string(waves),
+		rec.FailureThreshold,
+		rec.MinSamples,
+		rec.WaveIntervalMs,
+		rec.JobTimeoutMs,
+		rec.Status,
+		rec.Wave,
+		rec.WaveStartedMs,
+		rec.PauseReason,
+		rec.BaselineDone,
+		rec.BaselineFailed,
+		rec.CreatedBy,
+		rec.CreatedMillis,
+		rec.UpdatedMillis,
+		rec.FinishedMillis,
+	); err != nil {
+		return fmt.Errorf("registry create ota campaign: %w", err)
+	}
+	for _, d := range devices {
+		if _, err := tx.ExecContext(
+			ctx,
+			`INSERT INTO ota_campaign_devices(`+otaDeviceColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+			rec.ID,
+			d.DeviceID,
+			d.JobID,
+			d.Wave,
+			d.Status,
+			d.FromFW,
+			d.Error,
+			d.SentMillis,
+			d.UpdatedMillis,
+			d.DownloadMode,
+			d.DeltaID,
+			d.DeltaSize,
+			d.FullSize,
+		); err != nil {
+			return fmt.Errorf("registry create ota campaign device %s: %w", d.DeviceID, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("registry create ota campaign: %w", err)
+	}
+	return nil
+}
+
+// AddOTACampaignDevices добавляет устройства в существующую кампанию; уже входящие в неё пропускаются.
+func (s *SQLiteStore) AddOTACampaignDevices(ctx context.Context, campaignID string, devices []OTACampaignDevice) (int, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("registry add ota campaign devices: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	added := 0
+	for _, d := range devices {
+		res, err := tx.ExecContext(
+			ctx,
+			`INSERT OR IGNORE INTO ota_campaign_devices(`+otaDeviceColumns+`) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+			campaignID,
+			d.DeviceID,
+			d.JobID,
+			d.Wave,
+			d.Status,
+			d.FromFW,
+			d.Error,
+			d.SentMillis,
+			d.UpdatedMillis,
+			d.DownloadMode,
+			d.DeltaID,
+			d.DeltaSize,
+			d.FullSize,
+		)
+		if err != nil {
+			return 0, fmt.Errorf("registry add ota campaign device %s: %w", d.DeviceID, err)
+		}
+		n, _ := res.RowsAffected()
+		added += int(n)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("registry add ota campaign devices: %w", err)
+	}
+	return added, nil
+}
+
+// UpdateOTACampaign перезаписывает изменяемое состояние кампании (статус, волна, пауза, baseline).
+func (s *SQLiteStore) UpdateOTACampaign(ctx context.Context, rec OTACampaignRecord) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`UPDATE ota_campaigns
+SET status = ?, wave = ?, wave_started_ts = ?, pause_reason = ?, baseline_done = ?, baseline_failed = ?,
+    updated_at_ts = ?, finished_at_ts = ?
+WHERE id = ?;`,
+		rec.Status,
+		rec.Wave,
+		rec.WaveStartedMs,
+		rec.PauseReason,
+		rec.BaselineDone,
+		rec.BaselineFailed,
+		rec.UpdatedMillis,
+		rec.FinishedMillis,
+		rec.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("registry update ota campaign id=%s: %w", rec.ID, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) GetOTACampaign(ctx context.Context, id string) (*OTACampaignRecord, error) {
+	if id == "" {
+		return nil, nil
+	}
+	row := s.db.QueryRowContext(ctx, `SELECT `+otaCampaignColumns+` FROM ota_campaigns WHERE id = ?;`, id)
+	rec, err := scanOTACampaign(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("registry get ota campaign: %w", err)
+	}
+	return rec, nil
+}
+
+// ListOTACampaigns — кампании, новые первыми; statuses пустой — все.
+func (s *SQLiteStore) ListOTACampaigns(ctx context.Context, statuses ...string) ([]OTACampaignRecord, error) {
+	query := `SELECT ` + otaCampaignColumns + ` FROM ota_campaigns`
+	args := []any{}
+	if len(statuses) > 0 {
+		query += ` WHERE status IN (` + placeholders(len(statuses)) + `)`
+		for _, st := range statuses {
+			args = append(args, st)
+		}
+	}
+	query += ` ORDER BY created_at_ts DESC, id;`
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("registry list ota campaigns: %w", err)
+	}
+	defer rows.Close()
+
+	out := []OTACampaignRecord{}
+	for rows.Next() {
+		rec, err := scanOTACampaign(rows)
+		if err != nil {
+			return nil, fmt.Errorf("registry scan ota campaigns: %w", err)
+		}
+		out = append(out, *rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("registry list ota campaigns rows: %w", err)
+	}
+	return out, nil
+}
+
+// ListOTACampaignDevices — устройства кампании по волне и device_id; status пустой — все.
+func (s *SQLiteStore) ListOTACampaignDevices(ctx context.Context, campaignID, status string) ([]OTACampaignDevice, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT `+otaDeviceColumns+`
+FROM ota_campaign_devices
+WHERE campaign_id = ? AND (? = '' OR status = ?)
+ORDER BY wave, device_id;`,
+		campaignID,
+		status,
+		status,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("registry list ota campaign devices: %w", err)
+	}
+	defer rows.Close()
+
+	out := []OTACampaignDevice{}
+	for rows.Next() {
+		d, err := scanOTADevice(rows)
+		if err != nil {
+			return nil, fmt.Errorf("registry scan ota campaign devices: %w", err)
+		}
+		out = append(out, *d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("registry list ota campaign devices rows: %w", err)
+	}
+	return out, nil
+}
+
+// CountOTACampaignDevices — сводка по волнам и статусам.
+func (s *SQLiteStore) CountOTACampaignDevices(ctx context.Context, campaignID string) ([]OTAStatusCount, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT wave, status, COUNT(*)
+FROM ota_campaign_devices
+WHERE campaign_id = ?
+GROUP BY wave, status
+ORDER BY wave, status;`,
+		campaignID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("registry count ota campaign devices: %w", err)
+	}
+	defer rows.Close()
+
+	out := []OTAStatusCount{}
+	for rows.Next() {
+		var c OTAStatusCount
+		if err := rows.Scan(&c.Wave, &c.Status, &c.Count); err != nil {
+			return nil, fmt.Errorf("registry scan ota campaign counts: %w", err)
+		}
+		out = append(out, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("registry count ota campaign devices rows: %w", err)
+	}
+	return out, nil
+}
+
+// SetOTADeviceStatus переводит устройство в статус to, если текущий статус входит в from.
+// sentMillis > 0 — выставить время отправки job. false — перехода не было.
+func (s *SQLiteStore) SetOTADeviceStatus(ctx context.Context, campaignID, deviceID string, from []string, to, errMsg string, sentMillis, nowMillis int64) (bool, error) {
+	args := []any{to, errMsg, sentMillis, sentMillis, nowMillis, campaignID, deviceID}
+	for _, st := range from {
+		args = append(args, st)
+	}
+	res, err := s.db.ExecContext(
+		ctx,
+		`UPDATE ota_campaign_devices
+SET status = ?, error = ?, sent_at_ts = CASE WHEN ? > 0 THEN ? ELSE sent_at_ts END, updated_at_ts = ?
+WHERE campaign_id = ? AND device_id = ? AND status IN (`+placeholders(len(from))+`);`,
+		args...,
+	)
+	if err != nil {
+		return false, fmt.Errorf("registry set ota device status campaign=%s deviceId=%s: %w", campaignID, deviceID, err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// SetOTADeviceDownload запоминает, что предложено устройству: дельта (deltaID, deltaSize) или полный образ.
+func (s *SQLiteStore) SetOTADeviceDownload(ctx context.Context, campaignID, deviceID, mode, deltaID string, deltaSize, fullSize int64) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`UPDATE ota_campaign_devices SET download_mode = ?, delta_id = ?, delta_size = ?, full_size = ?
+WHERE campaign_id = ? AND device_id = ?;`,
+		mode,
+		deltaID,
+		deltaSize,
+		fullSize,
+		campaignID,
+		deviceID,
+	)
+	if err != nil {
+		return fmt.Errorf("registry set ota device download campaign=%s deviceId=%s: %w", campaignID, deviceID, err)
+	}
+	return nil
+}
+
+// OTATransferStats — сводка трафика по успешно обновлённым устройствам кампании.
+type OTATransferStats struct {
+	DeltaJobs int
+	FullJobs  int
+	BytesFull int64 // сколько ушло бы полными образами
+	BytesSent int64 // сколько ушло фактически
+}
+
+func (s *SQLiteStore) OTACampaignTransfer(ctx context.Context, campaignID string) (OTATransferStats, error) {
+	var st OTATransferStats
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT
+  COALESCE(SUM(CASE WHEN download_mode = ? THEN 1 ELSE 0 END), 0),
+  COALESCE(SUM(CASE WHEN download_mode = ? THEN 0 ELSE 1 END), 0),
+  COALESCE(SUM(full_size), 0),
+  COALESCE(SUM(CASE WHEN download_mode = ? THEN delta_size ELSE full_size END), 0)
+FROM ota_campaign_devices
+WHERE campaign_id = ? AND status = ?;`,
+		OTADownloadDelta,
+		OTADownloadDelta,
+		OTADownloadDelta,
+		campaignID,
+		OTADeviceSuccess,
+	).Scan(&st.DeltaJobs, &st.FullJobs, &st.BytesFull, &st.BytesSent)
+	if err != nil {
+		return st, fmt.Errorf("registry ota campaign transfer id=%s: %w", campaignID, err)
+	}
+	return st, nil
+}
+
+// TouchOTADevice обновляет updated_at_ts (прогресс без смены статуса — сдвигает таймаут job).
+func (s *SQLiteStore) TouchOTADevice(ctx context.Context, campaignID, deviceID string, nowMillis int64) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`UPDATE ota_campaign_devices SET updated_at_ts = ? WHERE campaign_id = ? AND device_id = ?;`,
+		nowMillis,
+		campaignID,
+		deviceID,
+	)
+	if err != nil {
+		return fmt.Errorf("registry touch ota device campaign=%s deviceId=%s: %w", campaignID, deviceID, err)
+	}
+	return nil
+}
+
+// AbortOTACampaignDevices переводит все незавершённые устройства кампании в aborted.
+func (s *SQLiteStore) AbortOTACampaignDevices(ctx context.Context, campaignID string, nowMillis int64) (int, error) {
+	res, err := s.db.ExecContext(
+		ctx,
+		`UPDATE ota_campaign_devices SET status = ?, updated_at_ts = ?
+WHERE campaign_id = ? AND status IN (?, ?, ?, ?);`,
+		OTADeviceAborted,
+		nowMillis,
+		campaignID,
+		OTADevicePending,
+		OTADeviceSent,
+		OTADeviceDownloading,
+		OTADeviceInstalling,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("registry abort ota campaign devices id=%s: %w", campaignID, err)
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
+
+// FindOTAJob — job устройства в активной (running/paused) кампании, который сейчас выполняется (sent/downloading/installing).
+// jobID пустой — любой такой job устройства.
+func (s *SQLiteStore) FindOTAJob(ctx context.Context, deviceID, jobID string) (*OTAJob, error) {
+	row := s.db.QueryRowContext(
+		ctx,
+		`SELECT `+prefixColumns("d.", otaDeviceColumns)+`, c.target_version
+FROM ota_campaign_devices d
+JOIN ota_campaigns c ON c.id = d.campaign_id
+WHERE d.device_id = ? AND (? = '' OR d.job_id = ?)
+  AND c.status IN (?, ?)
+  AND d.status IN (?, ?, ?)
+ORDER BY d.updated_at_ts DESC
+LIMIT 1;`,
+		deviceID,
+		jobID,
+		jobID,
+		OTACampaignRunning,
+		OTACampaignPaused,
+		OTADeviceSent,
+		OTADeviceDownloading,
+		OTADeviceInstalling,
+	)
+	var job OTAJob
+	d, err := scanOTADevice(row, &job.TargetVersion)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("registry find ota job: %w", err)
+	}
+	job.OTACampaignDevice = *d
+	return &job, nil
+}
+
+// ListOTABusyDevices — устройства с незавершённым job в активных кампаниях: deviceId -> campaignId.
+func (s *SQLiteStore) ListOTABusyDevices(ctx context.Context) (map[string]string, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT d.device_id, d.campaign_id
+FROM ota_campaign_devices d
+JOIN ota_campaigns c ON c.id = d.campaign_id
+WHERE c.status IN (?, ?) AND d.status IN (?, ?, ?, ?);`,
+		OTACampaignRunning,
+		OTACampaignPaused,
+		OTADevicePending,
+		OTADeviceSent,
+		OTADeviceDownloading,
+		OTADeviceInstalling,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("registry list ota busy devices: %w", err)
+	}
+	defer rows.Close()
+
+	out := map[string]string{}
+	for rows.Next() {
+		var deviceID, campaignID string
+		if err := rows.Scan(&deviceID, &campaignID); err != nil {
+			return nil, fmt.Errorf("registry scan ota busy devices: %w", err)
+		}
+		out[deviceID] = campaignID
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("registry list ota busy devices rows: %w", err)
+	}
+	return out, nil
+}
+
+func scanOTACampaign(row rowScanner) (*OTACampaignRecord, error) {
+	var rec OTACampaignRecord
+	var selector, waves string
+	if err := row.Scan(
+		&rec.ID,
+		&rec.Name,
+		&rec.FirmwareID,
+		&rec.TargetVersion,
+		&rec.HWModel,
+		&selector,
+		&rec.FWPredicate,
+		&waves,
+		&rec.FailureThreshold,
+		&rec.MinSamples,
+		&rec.WaveIntervalMs,
+		&rec.JobTimeoutMs,
+		&rec.Status,
+		&rec.Wave,
+		&rec.WaveStartedMs,
+		&rec.PauseReason,
+		&rec.BaselineDone,
+		&rec.BaselineFailed,
+		&rec.CreatedBy,
+		&rec.CreatedMillis,
+		&rec.UpdatedMillis,
+		&rec.FinishedMillis,
+	); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(selector), &rec.Selector); err != nil {
+		return nil, fmt.Errorf("selector_json: %w", err)
+	}
+	if err := json.Unmarshal([]byte(waves), &rec.Waves); err != nil {
+		return nil, fmt.Errorf("waves_json: %w", err)
+	}
+	return &rec, nil
+}
+
+func scanOTADevice(row rowScanner, extra ...any) (*OTACampaignDevice, error) {
+	var d OTACampaignDevice
+	dest := []any{
+		&d.CampaignID,
+		&d.DeviceID,
+		&d.JobID,
+		&d.Wave,
+		&d.Status,
+		&d.FromFW,
+		&d.Error,
+		&d.SentMillis,
+		&d.UpdatedMillis,
+		&d.DownloadMode,
+		&d.DeltaID,
+		&d.DeltaSize,
+		&d.FullSize,
+	}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func placeholders(n int) string {
+	if n <= 0 {
+		return "NULL"
+	}
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func prefixColumns(prefix, columns string) string {
+	parts := strings.Split(columns, ",")
+	for i, p := range parts {
+		parts[i] = prefix + strings.TrimSpace(p)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -11,4 +11,8 @@ type Store interface {
 	Touch(ctx context.Context, deviceID string, tsMillis int64, source string) error
 	UpdateState(ctx context.Context, deviceID string, status string, link *string, fw *string, tsMillis int64) error
 	MarkOffline(ctx context.Context, deviceID string, tsMillis int64, reason string) error
+	// UpdateCfgState — версии конфигурации, о которых сообщило устройство (state.cfg).
+	UpdateCfgState(ctx context.Context, deviceID string, active *int64, pending *int64, tsMillis int64) error
+	// RecordCfgStatus — отчёт v1/dev/{id}/cfg/status: текущее состояние + запись в историю.
+	RecordCfgStatus(ctx context.Context, rec CfgStatusRecord) error
 }
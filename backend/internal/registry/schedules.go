@@ -0,0 +1,441 @@
+package registry
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Статусы запусков расписаний.
+const (
+	ScheduleRunRunning = "running"
+	ScheduleRunDone    = "done"
+	ScheduleRunFailed  = "failed"
+)
+
+// TargetSelector — на какие устройства рассылать команду.
+// Поля объединяются: All, или Group, или явный список DeviceIDs (OR).
+type TargetSelector struct {
+	DeviceIDs  []string `json:"deviceIds,omitempty"`
+	Group      string   `json:"group,omitempty"`
+	All        bool     `json:"all,omitempty"`
+	OnlineOnly bool     `json:"onlineOnly,omitempty"`
+}
+
+func (t TargetSelector) Empty() bool {
+	return !t.All && t.Group == "" && len(t.DeviceIDs) == 0
+}
+
+type ScheduleRecord struct {
+	ID            string
+	Name          string
+	Cron          string
+	TZ            string
+	CmdType       string
+	Params        map[string]any
+	Selector      TargetSelector
+	TimeoutMs     int
+	Enabled       bool
+	NextRunMillis sql.NullInt64
+	LastRunMillis sql.NullInt64
+	CreatedMillis int64
+	UpdatedMillis int64
+}
+
+type ScheduleRunRecord struct {
+	ID             string
+	ScheduleID     string
+	Status         string
+	Targets        int
+	OkCount        int
+	FailCount      int
+	Error          sql.NullString
+	StartedMillis  int64
+	FinishedMillis sql.NullInt64
+}
+
+type ScheduleRunItem struct {
+	RunID     string
+	DeviceID  string
+	CommandID string
+	Ok        bool
+	Code      string
+	TsMillis  int64
+}
+
+const scheduleColumns = `id, name, cron, tz, cmd_type, params_json, selector_json, timeout_ms, enabled,
+  next_run_ts, last_run_ts, created_at_ts, updated_at_ts`
+
+func (s *SQLiteStore) CreateSchedule(ctx context.Context, rec ScheduleRecord) error {
+	params, selector, err := marshalSchedule(rec)
+	if err != nil {
+		return fmt.Errorf("registry create schedule: %w", err)
+	}
+	_, err = s.db.ExecContext(
+		ctx,
+		`INSERT INTO schedules(`+scheduleColumns+`)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		rec.ID,
+		rec.Name,
+		rec.Cron,
+		rec.TZ,
+		rec.CmdType,
+		params,
+		selector,
+		rec.TimeoutMs,
+		boolToInt(rec.Enabled),
+		rec.NextRunMillis,
+		rec.LastRunMillis,
+		rec.CreatedMillis,
+		rec.UpdatedMillis,
+	)
+	if err != nil {
+		return fmt.Errorf("registry create schedule: %w", err)
+	}
+	return nil
+}
+
+// UpdateSchedule перезаписывает редактируемые поля (включая enabled и next_run_ts).
+func (s *SQLiteStore) UpdateSchedule(ctx context.Context, rec ScheduleRecord) error {
+	params, selector, err := marshalSchedule(rec)
+	if err != nil {
+		return fmt.Errorf("registry update schedule id=%s: %w", rec.ID, err)
+	}
+	_, err = s.db.ExecContext(
+		ctx,
+		`UPDATE schedules SET
+  name = ?, cron = ?, tz = ?, cmd_type = ?, params_json = ?, selector_json = ?,
+  timeout_ms = ?, enabled = ?, next_run_ts = ?, updated_at_ts = ?
+WHERE id = ?;`,
+		rec.Name,
+		rec.Cron,
+		rec.TZ,
+		rec.CmdType,
+		params,
+		selector,
+		rec.TimeoutMs,
+		boolToInt(rec.Enabled),
+		rec.NextRunMillis,
+		rec.UpdatedMillis,
+		rec.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("registry update schedule id=%s: %w", rec.ID, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) DeleteSchedule(ctx context.Context, id string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM schedules WHERE id = ?;`, id); err != nil {
+		return fmt.Errorf("registry delete schedule id=%s: %w", id, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) GetSchedule(ctx context.Context, id string) (*ScheduleRecord, error) {
+	if id == "" {
+		return nil, nil
+	}
+	row := s.db.QueryRowContext(ctx, `SELECT `+scheduleColumns+` FROM schedules WHERE id = ?;`, id)
+	rec, err := scanSchedule(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("registry get schedule: %w", err)
+	}
+	return rec, nil
+}
+
+func (s *SQLiteStore) ListSchedules(ctx context.Context) ([]ScheduleRecord, error) {
+	return s.querySchedules(ctx, `SELECT `+scheduleColumns+` FROM schedules ORDER BY name, id;`)
+}
+
+// ListDueSchedules — включённые расписания, у которых next_run_ts <= nowMillis.
+func (s *SQLiteStore) ListDueSchedules(ctx context.Context, nowMillis int64) ([]ScheduleRecord, error) {
+	return s.querySchedules(
+		ctx,
+		`SELECT `+scheduleColumns+` FROM schedules
+WHERE enabled = 1 AND next_run_ts IS NOT NULL AND next_run_ts <= ?
+ORDER BY next_run_ts;`,
+		nowMillis,
+	)
+}
+
+// SetScheduleRun сдвигает расписание: next_run_ts (NULL если nextMillis<=0) и last_run_ts.
+func (s *SQLiteStore) SetScheduleRun(ctx context.Context, id string, nextMillis int64, lastMillis int64) error {
+	var next sql.NullInt64
+	if nextMillis > 0 {
+		next = sql.NullInt64{Int64: nextMillis, Valid: true}
+	}
+	_, err := s.db.ExecContext(
+		ctx,
+		`UPDATE schedules SET next_run_ts = ?, last_run_ts = ?, updated_at_ts = ? WHERE id = ?;`,
+		next,
+		lastMillis,
+		time.Now().UnixMilli(),
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("registry set schedule run id=%s: %w", id, err)
+	}
+	return nil
+}
+
+// DisableSchedule выключает расписание и сбрасывает next_run_ts (битое cron или запусков больше не будет).
+func (s *SQLiteStore) DisableSchedule(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`UPDATE schedules SET enabled = 0, next_run_ts = NULL, updated_at_ts = ? WHERE id = ?;`,
+		time.Now().UnixMilli(),
+		id,
+	)
+	if err != nil {
+		return fmt.Errorf("registry disable schedule id=%s: %w", id, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) InsertScheduleRun(ctx context.Context, run ScheduleRunRecord) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO schedule_runs(id, schedule_id, status, targets, ok_count, fail_count, error, started_at_ts, finished_at_ts)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?);`,
+		run.ID,
+		run.ScheduleID,
+		run.Status,
+		run.Targets,
+		run.OkCount,
+		run.FailCount,
+		run.Error,
+		run.StartedMillis,
+		run.FinishedMillis,
+	)
+	if err != nil {
+		return fmt.Errorf("registry insert schedule run: %w", err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) FinishScheduleRun(ctx context.Context, run ScheduleRunRecord) error {
+	_, err := s.db.ExecContext(
+		ctx,
+		`UPDATE schedule_runs SET status = ?, targets = ?, ok_count = ?, fail_count = ?, error = ?, finished_at_ts = ?
+WHERE id = ?;`,
+		run.Status,
+		run.Targets,
+		run.OkCount,
+		run.FailCount,
+		run.Error,
+		run.FinishedMillis,
+		run.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("registry finish schedule run id=%s: %w", run.ID, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) InsertScheduleRunItem(ctx context.Context, item ScheduleRunItem) error {
+	var cmdID sql.NullString
+	if item.CommandID != "" {
+		cmdID = sql.NullString{String: item.CommandID, Valid: true}
+	}
+	_, err := s.db.ExecContext(
+		ctx,
+		`INSERT OR REPLACE INTO schedule_run_items(run_id, device_id, command_id, ok, code, ts)
+VALUES (?, ?, ?, ?, ?, ?);`,
+		item.RunID,
+		item.DeviceID,
+		cmdID,
+		boolToInt(item.Ok),
+		item.Code,
+		item.TsMillis,
+	)
+	if err != nil {
+		return fmt.Errorf("registry insert schedule run item: %w", err)
+	}
+	return nil
+}
+
+// GetScheduleRun — запуск расписания по id; nil, если такого запуска у расписания нет.
+func (s *SQLiteStore) GetScheduleRun(ctx context.Context, scheduleID, runID string) (*ScheduleRunRecord, error) {
+	var r ScheduleRunRecord
+	err := s.db.QueryRowContext(
+		ctx,
+		`SELECT id, schedule_id, status, targets, ok_count, fail_count, error, started_at_ts, finished_at_ts
+FROM schedule_runs
+WHERE id = ? AND schedule_id = ?;`,
+		runID,
+		scheduleID,
+	).Scan(
+		&r.ID,
+		&r.ScheduleID,
+		&r.Status,
+		&r.Targets,
+		&r.OkCount,
+		&r.FailCount,
+		&r.Error,
+		&r.StartedMillis,
+		&r.FinishedMillis,
+	)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("registry get schedule run id=%s: %w", runID, err)
+	}
+	return &r, nil
+}
+
+func (s *SQLiteStore) ListScheduleRuns(ctx context.Context, scheduleID string, limit int) ([]ScheduleRunRecord, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT id, schedule_id, status, targets, ok_count, fail_count, error, started_at_ts, finished_at_ts
+FROM schedule_runs
+WHERE schedule_id = ?
+ORDER BY started_at_ts DESC
+LIMIT ?;`,
+		scheduleID,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("registry list schedule runs: %w", err)
+	}
+	defer rows.Close()
+
+	out := []ScheduleRunRecord{}
+	for rows.Next() {
+		var r ScheduleRunRecord
+		if err := rows.Scan(
+			&r.ID,
+			&r.ScheduleID,
+			&r.Status,
+			&r.Targets,
+			&r.OkCount,
+			&r.FailCount,
+			&r.Error,
+			&r.StartedMillis,
+			&r.FinishedMillis,
+		); err != nil {
+			return nil, fmt.Errorf("registry scan schedule runs: %w", err)
+		}
+		out = append(out, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("registry list schedule runs rows: %w", err)
+	}
+	return out, nil
+}
+
+func (s *SQLiteStore) ListScheduleRunItems(ctx context.Context, runID string) ([]ScheduleRunItem, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT run_id, device_id, command_id, ok, code, ts
+FROM schedule_run_items
+WHERE run_id = ?
+ORDER BY device_id;`,
+		runID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("registry list schedule run items: %w", err)
+	}
+	defer rows.Close()
+
+	out := []ScheduleRunItem{}
+	for rows.Next() {
+		var it ScheduleRunItem
+		var cmdID, code sql.NullString
+		var ok int
+		if err := rows.Scan(&it.RunID, &it.DeviceID, &cmdID, &ok, &code, &it.TsMillis); err != nil {
+			return nil, fmt.Errorf("registry scan schedule run items: %w", err)
+		}
+		it.CommandID = cmdID.String
+		it.Code = code.String
+		it.Ok = ok != 0
+		out = append(out, it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("registry list schedule run items rows: %w", err)
+	}
+	return out, nil
+}
+
+func (s *SQLiteStore) querySchedules(ctx context.Context, q string, args ...any) ([]ScheduleRecord, error) {
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("registry list schedules: %w", err)
+	}
+	defer rows.Close()
+
+	out := []ScheduleRecord{}
+	for rows.Next() {
+		rec, err := scanSchedule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("registry scan schedules: %w", err)
+		}
+		out = append(out, *rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("registry list schedules rows: %w", err)
+	}
+	return out, nil
+}
+
+func scanSchedule(row rowScanner) (*ScheduleRecord, error) {
+	var rec ScheduleRecord
+	var params sql.NullString
+	var selector string
+	var enabled int
+	if err := row.Scan(
+		&rec.ID,
+		&rec.Name,
+		&rec.Cron,
+		&rec.TZ,
+		&rec.CmdType,
+		&params,
+		&selector,
+		&rec.TimeoutMs,
+		&enabled,
+		&rec.NextRunMillis,
+		&rec.LastRunMillis,
+		&rec.CreatedMillis,
+		&rec.UpdatedMillis,
+	); err != nil {
+		return nil, err
+	}
+	rec.Enabled = enabled != 0
+	if params.Valid && params.String != "" {
+		_ = json.Unmarshal([]byte(params.String), &rec.Params)
+	}
+	_ = json.Unmarshal([]byte(selector), &rec.Selector)
+	return &rec, nil
+}
+
+func marshalSchedule(rec ScheduleRecord) (sql.NullString, string, error) {
+	var params sql.NullString
+	if len(rec.Params) > 0 {
+		b, err := json.Marshal(rec.Params)
+		if err != nil {
+			return params, "", fmt.Errorf("marshal params: %w", err)
+		}
+		params = sql.NullString{String: string(b), Valid: true}
+	}
+	b, err := json.Marshal(rec.Selector)
+	if err != nil {
+		return params, "", fmt.Errorf("marshal selector: %w", err)
+	}
+	return params, string(b), nil
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,231 @@
+package registry
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DocCipher шифрует секретные поля doc_json при записи и расшифровывает при чтении (реализует secrets.Cipher).
+type DocCipher interface {
+	SealDoc(doc map[string]any) (map[string]any, error)
+	OpenDoc(doc map[string]any) (map[string]any, error)
+	ResealDoc(doc map[string]any) (map[string]any, bool, error)
+}
+
+// Действия в журнале доступа к секретам.
+const (
+	SecretAuditReveal = "reveal"
+	SecretAuditDenied = "denied"
+	SecretAuditRotate = "rotate"
+)
+
+type SecretAuditRecord struct {
+	ID       int64    `json:"id"`
+	TsMillis int64    `json:"ts"`
+	Actor    string   `json:"actor"`
+	Action   string   `json:"action"`
+	DeviceID string   `json:"deviceId,omitempty"`
+	Version  *int64   `json:"version,omitempty"`
+	Paths    []string `json:"paths,omitempty"`
+	Reason   string   `json:"reason,omitempty"`
+}
+
+// SetDocCipher включает шифрование doc_json (конфиги, шаблоны, override). Без него документы пишутся как есть.
+func (s *SQLiteStore) SetDocCipher(c DocCipher) {
+	s.cipher = c
+}
+
+func (s *SQLiteStore) encodeDoc(doc map[string]any) (string, error) {
+	if s.cipher != nil {
+		sealed, err := s.cipher.SealDoc(doc)
+		if err != nil {
+			return "", fmt.Errorf("seal: %w", err)
+		}
+		doc = sealed
+	}
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return "", fmt.Errorf("marshal: %w", err)
+	}
+	return string(b), nil
+}
+
+func (s *SQLiteStore) decodeDoc(raw string) (map[string]any, error) {
+	var doc map[string]any
+	if err := json.Unmarshal([]byte(raw), &doc); err != nil {
+		return nil, err
+	}
+	if s.cipher == nil {
+		return doc, nil
+	}
+	return s.cipher.OpenDoc(doc)
+}
+
+// ResealConfigDocs шифрует секреты, сохранённые открытым текстом, и перешифровывает
+// конверты под неактивными ключами (после ротации). Возвращает число обновлённых документов.
+func (s *SQLiteStore) ResealConfigDocs(ctx context.Context) (int, error) {
+	if s.cipher == nil {
+		return 0, nil
+	}
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("registry reseal config docs: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	total := 0
+	for _, t := range []struct{ table, key string }{
+		{"device_configs", "device_id || '/' || version"},
+		{"config_templates", "name"},
+		{"device_config_overrides", "device_id"},
+	} {
+		n, err := s.resealTable(ctx, tx, t.table, t.key)
+		if err != nil {
+			return 0, fmt.Errorf("registry reseal %s: %w", t.table, err)
+		}
+		total += n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("registry reseal config docs: %w", err)
+	}
+	return total, nil
+}
+
+func (s *SQLiteStore) resealTable(ctx context.Context, tx *sql.Tx, table, key string) (int, error) {
+	rows, err := tx.QueryContext(ctx, `SELECT rowid, `+key+`, doc_json FROM `+table+`;`)
+	if err != nil {
+		return 0, err
+	}
+	type update struct {
+		rowid int64
+		doc   string
+	}
+	var updates []update
+	for rows.Next() {
+		var rowid int64
+		var id, raw string
+		if err := rows.Scan(&rowid, &id, &raw); err != nil {
+			_ = rows.Close()
+			return 0, err
+		}
+		var doc map[string]any
+		if err := json.Unmarshal([]byte(raw), &doc); err != nil {
+			_ = rows.Close()
+			return 0, fmt.Errorf("%s: bad doc_json: %w", id, err)
+		}
+		sealed, changed, err := s.cipher.ResealDoc(doc)
+		if err != nil {
+			_ = rows.Close()
+			return 0, fmt.Errorf("%s: %w", id, err)
+		}
+		if !changed {
+			continue
+		}
+		b, err := json.Marshal(sealed)
+		if err != nil {
+			_ = rows.Close()
+			return 0, fmt.Errorf("%s: marshal: %w", id, err)
+		}
+		updates = append(updates, update{rowid: rowid, doc: string(b)})
+	}
+	if err := rows.Close(); err != nil {
+		return 0, err
+	}
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, u := range updates {
+		if _, err := tx.ExecContext(ctx, `UPDATE `+table+` SET doc_json = ? WHERE rowid = ?;`, u.doc, u.rowid); err != nil {
+			return 0, err
+		}
+	}
+	return len(updates), nil
+}
+
+func (s *SQLiteStore) InsertSecretAudit(ctx context.Context, rec SecretAuditRecord) error {
+	if rec.TsMillis <= 0 {
+		rec.TsMillis = time.Now().UnixMilli()
+	}
+	var paths, deviceID, reason sql.NullString
+	if len(rec.Paths) > 0 {
+		b, err := json.Marshal(rec.Paths)
+		if err != nil {
+			return fmt.Errorf("registry insert secret audit: marshal paths: %w", err)
+		}
+		paths = sql.NullString{String: string(b), Valid: true}
+	}
+	if rec.DeviceID != "" {
+		deviceID = sql.NullString{String: rec.DeviceID, Valid: true}
+	}
+	if rec.Reason != "" {
+		reason = sql.NullString{String: rec.Reason, Valid: true}
+	}
+	_, err := s.db.ExecContext(
+		ctx,
+		`INSERT INTO config_secret_audit(ts, actor, action, device_id, version, paths_json, reason)
+VALUES (?, ?, ?, ?, ?, ?, ?);`,
+		rec.TsMillis,
+		rec.Actor,
+		rec.Action,
+		deviceID,
+		rec.Version,
+		paths,
+		reason,
+	)
+	if err != nil {
+		return fmt.Errorf("registry insert secret audit: %w", err)
+	}
+	return nil
+}
+
+// ListSecretAudit — журнал доступа к секретам, новые первыми; deviceID пустой — по всем устройствам.
+func (s *SQLiteStore) ListSecretAudit(ctx context.Context, deviceID string, limit int) ([]SecretAuditRecord, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT id, ts, actor, action, device_id, version, paths_json, reason
+FROM config_secret_audit
+WHERE (? = '' OR device_id = ?)
+ORDER BY ts DESC, id DESC
+LIMIT ?;`,
+		deviceID,
+		deviceID,
+		limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("registry list secret audit: %w", err)
+	}
+	defer rows.Close()
+
+	out := []SecretAuditRecord{}
+	for rows.Next() {
+		var rec SecretAuditRecord
+		var device, paths, reason sql.NullString
+		var version sql.NullInt64
+		if err := rows.Scan(&rec.ID, &rec.TsMillis, &rec.Actor, &rec.Action, &device, &version, &paths, &reason); err != nil {
+			return nil, fmt.Errorf("registry scan secret audit: %w", err)
+		}
+		rec.DeviceID = device.String
+		rec.Reason = reason.String
+		if version.Valid {
+			rec.Version = &version.Int64
+		}
+		if paths.Valid {
+			if err := json.Unmarshal([]byte(paths.String), &rec.Paths); err != nil {
+				return nil, fmt.Errorf("registry secret audit id=%d: bad paths_json: %w", rec.ID, err)
+			}
+		}
+		out = append(out, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("registry list secret audit rows: %w", err)
+	}
+	return out, nil
+}
@@ -12,7 +12,8 @@ import (
 )
 
 type SQLiteStore struct {
-	db *sql.DB
+	db     *sql.DB
+	cipher DocCipher // шифрование секретных полей doc_json (nil — выключено)
 }
 
 type SQLiteConfig struct {
@@ -98,6 +99,8 @@ CREATE TABLE IF NOT EXISTS devices (
   last_state_ts     INTEGER DEFAULT NULL,
   last_telemetry_ts INTEGER DEFAULT NULL,
 
+  encoding          TEXT DEFAULT NULL,   -- json/msgpack/cbor: в чём устройство присылает сообщения
+
   updated_at_ts     INTEGER NOT NULL
 );
 
@@ -126,11 +129,371 @@ CREATE TABLE IF NOT EXISTS sessions (
 CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions(user_id);
 CREATE INDEX IF NOT EXISTS idx_sessions_expires_at ON sessions(expires_at);
 CREATE UNIQUE INDEX IF NOT EXISTS idx_sessions_refresh_hash ON sessions(refresh_hash);
+
+-- История команд cloud→device (stage 2.4+)
+CREATE TABLE IF NOT EXISTS commands (
+  id          TEXT PRIMARY KEY,          -- cmdId (uuid), совпадает с id в payload
+  device_id   TEXT NOT NULL,
+  type        TEXT NOT NULL,
+  params_json TEXT DEFAULT NULL,
+
+  status      TEXT NOT NULL,             -- sent/acked/failed/timeout/acked_late/publish_failed/aborted/cancelled
+  attempts    INTEGER NOT NULL DEFAULT 0,
+  ack_json    TEXT DEFAULT NULL,
+
+  created_at_ts INTEGER NOT NULL,
+  updated_at_ts INTEGER NOT NULL,
+  acked_at_ts   INTEGER DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_commands_device_created ON commands(device_id, created_at_ts);
+
+-- Idempotency-Key для POST /api/v1/dev/{id}/cmd: повтор запроса возвращает исходный результат
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+  user_id       TEXT NOT NULL,
+  key           TEXT NOT NULL,
+  request_hash  TEXT NOT NULL,
+  command_id    TEXT NOT NULL,
+  status_code   INTEGER DEFAULT NULL,   -- NULL = запрос ещё выполняется
+  response_json TEXT DEFAULT NULL,
+  created_at_ts INTEGER NOT NULL,
+  reserved_until_ts INTEGER NOT NULL DEFAULT 0, -- до когда команда может выполняться; позже ключ без результата брошен
+  expires_at_ts INTEGER NOT NULL,
+  PRIMARY KEY (user_id, key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_expires ON idempotency_keys(expires_at_ts);
+
+-- Desired-конфигурации устройств: каждая версия хранится (cfgVersion монотонно растёт)
+CREATE TABLE IF NOT EXISTS device_configs (
+  device_id     TEXT NOT NULL,
+  version       INTEGER NOT NULL,
+  doc_json      TEXT NOT NULL,
+  created_by    TEXT DEFAULT NULL,   -- userId / "system"
+  created_at_ts INTEGER NOT NULL,
+  published_at_ts INTEGER DEFAULT NULL,
+  rollback_of   INTEGER DEFAULT NULL,  -- версия, содержимое которой переиздано
+  PRIMARY KEY (device_id, version)
+);
+
+-- Что устройство сообщает о своей конфигурации (state.cfg + cfg/status)
+CREATE TABLE IF NOT EXISTS device_cfg_state (
+  device_id       TEXT PRIMARY KEY,
+  active_version  INTEGER DEFAULT NULL,
+  pending_version INTEGER DEFAULT NULL,
+  reported_at_ts  INTEGER NOT NULL,
+
+  cfg_status         TEXT DEFAULT NULL,   -- pending/applied/rejected/rolled_back
+  last_apply_version INTEGER DEFAULT NULL,
+  last_apply_ok      INTEGER DEFAULT NULL,
+  last_apply_error   TEXT DEFAULT NULL,
+  last_apply_ts      INTEGER DEFAULT NULL
+);
+
+-- Теги устройств (для привязки шаблонов конфигурации)
+CREATE TABLE IF NOT EXISTS device_tags (
+  device_id TEXT NOT NULL,
+  tag       TEXT NOT NULL,
+  PRIMARY KEY (device_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_tags_tag ON device_tags(tag);
+
+-- Шаблоны конфигурации (частичные документы)
+CREATE TABLE IF NOT EXISTS config_templates (
+  name          TEXT PRIMARY KEY,
+  doc_json      TEXT NOT NULL,
+  revision      INTEGER NOT NULL DEFAULT 1,
+  updated_by    TEXT DEFAULT NULL,
+  created_at_ts INTEGER NOT NULL,
+  updated_at_ts INTEGER NOT NULL
+);
+
+-- Привязки шаблонов к группам/тегам; больший priority накладывается позже
+CREATE TABLE IF NOT EXISTS config_template_bindings (
+  template_name TEXT NOT NULL,
+  target_kind   TEXT NOT NULL,   -- group/tag
+  target        TEXT NOT NULL,
+  priority      INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (template_name, target_kind, target)
+);
+
+-- Per-device override поверх шаблонов
+CREATE TABLE IF NOT EXISTS device_config_overrides (
+  device_id     TEXT PRIMARY KEY,
+  doc_json      TEXT NOT NULL,
+  updated_by    TEXT DEFAULT NULL,
+  updated_at_ts INTEGER NOT NULL
+);
+
+-- Состояние reconciler'а: повторная доставка desired-конфига
+CREATE TABLE IF NOT EXISTS device_cfg_drift (
+  device_id        TEXT PRIMARY KEY,
+  desired_version  INTEGER NOT NULL,
+  attempts         INTEGER NOT NULL DEFAULT 0,   -- повторные отправки
+  rollbacks        INTEGER NOT NULL DEFAULT 0,   -- неудачные применения desired-версии
+  last_sent_ts     INTEGER DEFAULT NULL,
+  next_attempt_ts  INTEGER DEFAULT NULL,
+  counted_apply_ts INTEGER DEFAULT NULL,         -- last_apply_ts, уже учтённый в rollbacks
+  stuck            INTEGER NOT NULL DEFAULT 0,
+  stuck_at_ts      INTEGER DEFAULT NULL,
+  updated_at_ts    INTEGER NOT NULL
+);
+
+-- История отчётов cfg/status
+CREATE TABLE IF NOT EXISTS cfg_status_history (
+  id                 INTEGER PRIMARY KEY AUTOINCREMENT,
+  device_id          TEXT NOT NULL,
+  ts                 INTEGER NOT NULL,
+  cfg_status         TEXT NOT NULL,
+  active_version     INTEGER DEFAULT NULL,
+  pending_version    INTEGER DEFAULT NULL,
+  apply_version      INTEGER DEFAULT NULL,
+  apply_ok           INTEGER DEFAULT NULL,
+  apply_error        TEXT DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_cfg_status_history_device ON cfg_status_history(device_id, ts);
+
+-- Блокировка устройства операцией (cmd/cfg/ota): OTA и CFG не применяются параллельно
+CREATE TABLE IF NOT EXISTS device_locks (
+  device_id      TEXT PRIMARY KEY,
+  kind           TEXT NOT NULL,            -- cmd/cfg/ota
+  ref            TEXT NOT NULL,            -- cmdId / cfgVersion / id OTA
+  holder         TEXT NOT NULL,
+  acquired_at_ts INTEGER NOT NULL,
+  expires_at_ts  INTEGER NOT NULL
+);
+
+-- Репозиторий прошивок: файлы на диске (FIRMWARE_DIR), здесь метаданные
+CREATE TABLE IF NOT EXISTS firmware_artifacts (
+  id                TEXT PRIMARY KEY,
+  version           TEXT NOT NULL,         -- semver
+  hw_model          TEXT NOT NULL,
+  notes             TEXT NOT NULL DEFAULT '',
+  sha256            TEXT NOT NULL,
+  size_bytes        INTEGER NOT NULL,
+  file_name         TEXT NOT NULL,
+  uploaded_by       TEXT NOT NULL DEFAULT '',
+  created_at_ts     INTEGER NOT NULL,
+  deprecated        INTEGER NOT NULL DEFAULT 0,
+  deprecated_at_ts  INTEGER DEFAULT NULL,
+  deprecated_by     TEXT NOT NULL DEFAULT '',
+  deprecated_reason TEXT NOT NULL DEFAULT '',
+  min_hw_rev        INTEGER NOT NULL DEFAULT 0  -- минимальная ревизия платы, попадает в подписанный манифест
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_firmware_model_version ON firmware_artifacts(hw_model, version);
+
+-- Бинарные дельты (bsdiff) от распространённых в парке версий к артефакту
+CREATE TABLE IF NOT EXISTS firmware_deltas (
+  id               TEXT PRIMARY KEY,
+  firmware_id      TEXT NOT NULL,        -- целевой артефакт
+  from_firmware_id TEXT NOT NULL,
+  from_version     TEXT NOT NULL,
+  from_sha256      TEXT NOT NULL,
+  sha256           TEXT NOT NULL,        -- патча
+  size_bytes       INTEGER NOT NULL,
+  file_name        TEXT NOT NULL,
+  created_at_ts    INTEGER NOT NULL
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_firmware_deltas_pair ON firmware_deltas(firmware_id, from_version);
+
+-- Политики прошивки: минимальная версия, версии с известными ошибками, целевая версия
+CREATE TABLE IF NOT EXISTS firmware_policies (
+  name           TEXT PRIMARY KEY,
+  group_name     TEXT NOT NULL DEFAULT '',   -- пусто — весь парк
+  min_version    TEXT NOT NULL DEFAULT '',
+  known_bad_json TEXT NOT NULL DEFAULT '[]',
+  target_version TEXT NOT NULL DEFAULT '',
+  auto_enroll    INTEGER NOT NULL DEFAULT 0,
+  updated_by     TEXT NOT NULL DEFAULT '',
+  created_at_ts  INTEGER NOT NULL,
+  updated_at_ts  INTEGER NOT NULL
+);
+
+-- Последнее вычисленное соответствие устройства политикам (для событий при выходе из соответствия)
+CREATE TABLE IF NOT EXISTS device_fw_compliance (
+  device_id     TEXT PRIMARY KEY,
+  status        TEXT NOT NULL,              -- compliant/non_compliant/unknown
+  reasons_json  TEXT NOT NULL DEFAULT '[]',
+  fw            TEXT NOT NULL DEFAULT '',
+  changed_at_ts INTEGER NOT NULL,
+  updated_at_ts INTEGER NOT NULL
+);
+
+-- OTA-кампании: волны раскатки прошивки на группу / по предикату версии
+CREATE TABLE IF NOT EXISTS ota_campaigns (
+  id                TEXT PRIMARY KEY,
+  name              TEXT NOT NULL,
+  firmware_id       TEXT NOT NULL,
+  target_version    TEXT NOT NULL,
+  hw_model          TEXT NOT NULL,
+  selector_json     TEXT NOT NULL,
+  fw_predicate      TEXT NOT NULL DEFAULT '',
+  waves_json        TEXT NOT NULL,         -- накопительные проценты [1,10,100]
+  failure_threshold REAL NOT NULL,
+  min_samples       INTEGER NOT NULL,
+  wave_interval_ms  INTEGER NOT NULL DEFAULT 0,
+  job_timeout_ms    INTEGER NOT NULL,
+  status            TEXT NOT NULL,         -- running/paused/completed/aborted
+  wave              INTEGER NOT NULL DEFAULT 0,
+  wave_started_ts   INTEGER NOT NULL,
+  pause_reason      TEXT NOT NULL DEFAULT '',
+  baseline_done     INTEGER NOT NULL DEFAULT 0,
+  baseline_failed   INTEGER NOT NULL DEFAULT 0,
+  created_by        TEXT NOT NULL DEFAULT '',
+  created_at_ts     INTEGER NOT NULL,
+  updated_at_ts     INTEGER NOT NULL,
+  finished_at_ts    INTEGER DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_ota_campaigns_status ON ota_campaigns(status);
+
+CREATE TABLE IF NOT EXISTS ota_campaign_devices (
+  campaign_id   TEXT NOT NULL,
+  device_id     TEXT NOT NULL,
+  job_id        TEXT NOT NULL UNIQUE,      -- id в payload ota и ack
+  wave          INTEGER NOT NULL,
+  status        TEXT NOT NULL,             -- pending/sent/downloading/installing/success/failed/skipped/aborted
+  from_fw       TEXT NOT NULL DEFAULT '',
+  error         TEXT NOT NULL DEFAULT '',
+  sent_at_ts    INTEGER DEFAULT NULL,
+  updated_at_ts INTEGER NOT NULL,
+  download_mode TEXT NOT NULL DEFAULT '',  -- delta/full: чем устройство качает образ
+  delta_id      TEXT NOT NULL DEFAULT '',
+  delta_size    INTEGER NOT NULL DEFAULT 0,
+  full_size     INTEGER NOT NULL DEFAULT 0,
+  PRIMARY KEY (campaign_id, device_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_ota_campaign_devices_device ON ota_campaign_devices(device_id, status);
+
+-- Журнал доступа к секретным полям конфигураций (reveal, ротация ключа)
+CREATE TABLE IF NOT EXISTS config_secret_audit (
+  id         INTEGER PRIMARY KEY AUTOINCREMENT,
+  ts         INTEGER NOT NULL,
+  actor      TEXT NOT NULL,
+  action     TEXT NOT NULL,             -- reveal/denied/rotate
+  device_id  TEXT DEFAULT NULL,
+  version    INTEGER DEFAULT NULL,
+  paths_json TEXT DEFAULT NULL,
+  reason     TEXT DEFAULT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_config_secret_audit_device ON config_secret_audit(device_id, ts);
+
+-- Группы устройств (для селекторов расписаний и т.п.)
+CREATE TABLE IF NOT EXISTS device_groups (
+  group_name TEXT NOT NULL,
+  device_id  TEXT NOT NULL,
+  added_at_ts INTEGER NOT NULL,
+  PRIMARY KEY (group_name, device_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_device_groups_device ON device_groups(device_id);
+
+-- Расписания команд (cron + timezone)
+CREATE TABLE IF NOT EXISTS schedules (
+  id            TEXT PRIMARY KEY,
+  name          TEXT NOT NULL,
+  cron          TEXT NOT NULL,
+  tz            TEXT NOT NULL,
+  cmd_type      TEXT NOT NULL,
+  params_json   TEXT DEFAULT NULL,
+  selector_json TEXT NOT NULL,
+  timeout_ms    INTEGER NOT NULL DEFAULT 0,
+  enabled       INTEGER NOT NULL DEFAULT 1,
+
+  next_run_ts   INTEGER DEFAULT NULL,
+  last_run_ts   INTEGER DEFAULT NULL,
+
+  created_at_ts INTEGER NOT NULL,
+  updated_at_ts INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_schedules_next_run ON schedules(enabled, next_run_ts);
+
+CREATE TABLE IF NOT EXISTS schedule_runs (
+  id            TEXT PRIMARY KEY,
+  schedule_id   TEXT NOT NULL,
+  status        TEXT NOT NULL,           -- running/done/failed
+  targets       INTEGER NOT NULL DEFAULT 0,
+  ok_count      INTEGER NOT NULL DEFAULT 0,
+  fail_count    INTEGER NOT NULL DEFAULT 0,
+  error         TEXT DEFAULT NULL,
+  started_at_ts INTEGER NOT NULL,
+  finished_at_ts INTEGER DEFAULT NULL,
+  FOREIGN KEY(schedule_id) REFERENCES schedules(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_schedule_runs_schedule ON schedule_runs(schedule_id, started_at_ts);
+
+-- Результат по каждому устройству; command_id ссылается на commands.id
+CREATE TABLE IF NOT EXISTS schedule_run_items (
+  run_id     TEXT NOT NULL,
+  device_id  TEXT NOT NULL,
+  command_id TEXT DEFAULT NULL,
+  ok         INTEGER NOT NULL DEFAULT 0,
+  code       TEXT DEFAULT NULL,
+  ts         INTEGER NOT NULL,
+  PRIMARY KEY (run_id, device_id),
+  FOREIGN KEY(run_id) REFERENCES schedule_runs(id) ON DELETE CASCADE
+);
 `
 	_, err := s.db.Exec(ddl)
 	if err != nil {
 		return fmt.Errorf("registry migrate: %w", err)
 	}
+
+	for _, c := range addedColumns {
+		if err := s.ensureColumn(c.table, c.column, c.decl); err != nil {
+			return fmt.Errorf("registry migrate: %w", err)
+		}
+	}
+	return nil
+}
+
+// addedColumns — колонки, добавленные в уже существующие таблицы: CREATE IF NOT EXISTS их не добавит.
+// Новая колонка старой таблицы всегда попадает и в DDL, и сюда.
+var addedColumns = []struct{ table, column, decl string }{
+	{"device_cfg_state", "cfg_status", "TEXT DEFAULT NULL"},
+	{"device_cfg_state", "last_apply_version", "INTEGER DEFAULT NULL"},
+	{"device_cfg_state", "last_apply_ok", "INTEGER DEFAULT NULL"},
+	{"device_cfg_state", "last_apply_error", "TEXT DEFAULT NULL"},
+	{"device_cfg_state", "last_apply_ts", "INTEGER DEFAULT NULL"},
+	{"device_configs", "rollback_of", "INTEGER DEFAULT NULL"},
+	{"firmware_artifacts", "min_hw_rev", "INTEGER NOT NULL DEFAULT 0"},
+	{"ota_campaign_devices", "download_mode", "TEXT NOT NULL DEFAULT ''"},
+	{"ota_campaign_devices", "delta_id", "TEXT NOT NULL DEFAULT ''"},
+	{"ota_campaign_devices", "delta_size", "INTEGER NOT NULL DEFAULT 0"},
+	{"ota_campaign_devices", "full_size", "INTEGER NOT NULL DEFAULT 0"},
+	{"devices", "encoding", "TEXT DEFAULT NULL"},
+	{"idempotency_keys", "reserved_until_ts", "INTEGER NOT NULL DEFAULT 0"},
+}
+
+func (s *SQLiteStore) ensureColumn(table, column, decl string) error {
+	rows, err := s.db.Query(`SELECT name FROM pragma_table_info(?);`, table)
+	if err != nil {
+		return fmt.Errorf("table info %s: %w", table, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return fmt.Errorf("table info %s: %w", table, err)
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("table info %s: %w", table, err)
+	}
+	if _, err := s.db.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s;`, table, column, decl)); err != nil {
+		return fmt.Errorf("add column %s.%s: %w", table, column, err)
+	}
 	return nil
 }
 
@@ -249,7 +612,7 @@ type DeviceRecord struct {
 func (s *SQLiteStore) ListDevices(ctx context.Context) ([]DeviceRecord, error) {
 	rows, err := s.db.QueryContext(
 		ctx,
-		`SELECT device_id, status, last_seen_ts, last_telemetry_ts, fw
+		`SELECT device_id, COALESCE(status, ''), last_seen_ts, last_telemetry_ts, fw
 FROM devices
 ORDER BY last_seen_ts DESC;`,
 	)
@@ -285,7 +648,7 @@ func (s *SQLiteStore) GetDevice(ctx context.Context, deviceID string) (*DeviceRe
 
 	row := s.db.QueryRowContext(
 		ctx,
-		`SELECT device_id, status, last_seen_ts, last_telemetry_ts, fw
+		`SELECT device_id, COALESCE(status, ''), last_seen_ts, last_telemetry_ts, fw
 FROM devices
 WHERE device_id = ?;`,
 		deviceID,
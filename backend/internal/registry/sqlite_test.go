@@ -0,0 +1,89 @@
+package registry
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	_ "modernc.org/sqlite"
+)
+
+func tableColumns(t *testing.T, db *sql.DB, table string) map[string]bool {
+	t.Helper()
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?);`, table)
+	if err != nil {
+		t.Fatalf("table info %s: %v", table, err)
+	}
+	defer rows.Close()
+	cols := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		cols[name] = true
+	}
+	return cols
+}
+
+// БД со схемой device_cfg_state до отчётов cfg/status: колонки отчёта добавляет миграция.
+func TestMigrateCfgStateFromOldSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "old.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE TABLE device_cfg_state (
+  device_id       TEXT PRIMARY KEY,
+  active_version  INTEGER DEFAULT NULL,
+  pending_version INTEGER DEFAULT NULL,
+  reported_at_ts  INTEGER NOT NULL
+);
+INSERT INTO device_cfg_state(device_id, active_version, reported_at_ts) VALUES ('dev-1', 3, 1);`); err != nil {
+		t.Fatal(err)
+	}
+	_ = db.Close()
+
+	s, err := NewSQLite(SQLiteConfig{Path: path})
+	if err != nil {
+		t.Fatalf("migrate old schema: %v", err)
+	}
+	defer s.Close()
+
+	cols := tableColumns(t, s.DB(), "device_cfg_state")
+	for _, c := range []string{"cfg_status", "last_apply_version", "last_apply_ok", "last_apply_error", "last_apply_ts"} {
+		if !cols[c] {
+			t.Errorf("device_cfg_state.%s not added", c)
+		}
+	}
+	var active int
+	if err := s.DB().QueryRow(`SELECT active_version FROM device_cfg_state WHERE device_id = 'dev-1';`).Scan(&active); err != nil || active != 3 {
+		t.Errorf("existing row lost: active=%d err=%v", active, err)
+	}
+}
+
+// Каждая колонка из addedColumns возвращается миграцией, если её нет в существующей таблице.
+func TestMigrateAddsMissingColumns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reg.db")
+	s, err := NewSQLite(SQLiteConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range addedColumns {
+		if _, err := s.DB().Exec(`ALTER TABLE ` + c.table + ` DROP COLUMN ` + c.column + `;`); err != nil {
+			t.Fatalf("drop %s.%s: %v", c.table, c.column, err)
+		}
+	}
+	_ = s.Close()
+
+	s, err = NewSQLite(SQLiteConfig{Path: path})
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	defer s.Close()
+	for _, c := range addedColumns {
+		if !tableColumns(t, s.DB(), c.table)[c.column] {
+			t.Errorf("%s.%s not re-added", c.table, c.column)
+		}
+	}
+}
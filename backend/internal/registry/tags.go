@@ -0,0 +1,70 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+)
+
+func (s *SQLiteStore) ListDeviceTags(ctx context.Context, deviceID string) ([]string, error) {
+	return s.listStrings(ctx, "device tags", `SELECT tag FROM device_tags WHERE device_id = ? ORDER BY tag;`, deviceID)
+}
+
+func (s *SQLiteStore) ListTagDevices(ctx context.Context, tag string) ([]string, error) {
+	return s.listStrings(ctx, "tag devices", `SELECT device_id FROM device_tags WHERE tag = ? ORDER BY device_id;`, tag)
+}
+
+func (s *SQLiteStore) ListDeviceGroups(ctx context.Context, deviceID string) ([]string, error) {
+	return s.listStrings(ctx, "device groups", `SELECT group_name FROM device_groups WHERE device_id = ? ORDER BY group_name;`, deviceID)
+}
+
+// SetDeviceTags заменяет теги устройства целиком.
+func (s *SQLiteStore) SetDeviceTags(ctx context.Context, deviceID string, tags []string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("registry set tags deviceId=%s: %w", deviceID, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM device_tags WHERE device_id = ?;`, deviceID); err != nil {
+		return fmt.Errorf("registry set tags deviceId=%s: %w", deviceID, err)
+	}
+	for _, tag := range tags {
+		if tag == "" {
+			continue
+		}
+		if _, err := tx.ExecContext(
+			ctx,
+			`INSERT OR IGNORE INTO device_tags(device_id, tag) VALUES (?, ?);`,
+			deviceID,
+			tag,
+		); err != nil {
+			return fmt.Errorf("registry set tags deviceId=%s: %w", deviceID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("registry set tags deviceId=%s: %w", deviceID, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) listStrings(ctx context.Context, what, q string, args ...any) ([]string, error) {
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return nil, fmt.Errorf("registry list %s: %w", what, err)
+	}
+	defer rows.Close()
+
+	out := []string{}
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, fmt.Errorf("registry scan %s: %w", what, err)
+		}
+		out = append(out, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("registry list %s rows: %w", what, err)
+	}
+	return out, nil
+}
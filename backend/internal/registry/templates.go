@@ -0,0 +1,364 @@
+package registry
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Виды целей привязки шаблона.
+const (
+	BindingGroup = "group"
+	BindingTag   = "tag"
+)
+
+type TemplateBinding struct {
+	Kind     string `json:"kind"`
+	Target   string `json:"target"`
+	Priority int    `json:"priority"`
+}
+
+type ConfigTemplateRecord struct {
+	Name          string
+	Doc           map[string]any
+	Revision      int64
+	UpdatedBy     string
+	CreatedMillis int64
+	UpdatedMillis int64
+	Bindings      []TemplateBinding
+}
+
+// DeviceTemplate — шаблон, применимый к устройству, с итоговым приоритетом.
+type DeviceTemplate struct {
+	Name     string
+	Doc      map[string]any
+	Revision int64
+	Priority int
+}
+
+type ConfigOverrideRecord struct {
+	DeviceID      string
+	Doc           map[string]any
+	UpdatedBy     string
+	UpdatedMillis int64
+}
+
+func (s *SQLiteStore) ListConfigTemplates(ctx context.Context) ([]ConfigTemplateRecord, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT name, doc_json, revision, updated_by, created_at_ts, updated_at_ts
+FROM config_templates
+ORDER BY name;`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("registry list templates: %w", err)
+	}
+	defer rows.Close()
+
+	out := []ConfigTemplateRecord{}
+	for rows.Next() {
+		rec, err := s.scanConfigTemplate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("registry scan templates: %w", err)
+		}
+		out = append(out, *rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("registry list templates rows: %w", err)
+	}
+
+	for i := range out {
+		bindings, err := s.ListTemplateBindings(ctx, out[i].Name)
+		if err != nil {
+			return nil, err
+		}
+		out[i].Bindings = bindings
+	}
+	return out, nil
+}
+
+func (s *SQLiteStore) GetConfigTemplate(ctx context.Context, name string) (*ConfigTemplateRecord, error) {
+	row := s.db.QueryRowContext(
+		ctx,
+		`SELECT name, doc_json, revision, updated_by, created_at_ts, updated_at_ts
+FROM config_templates
+WHERE name = ?;`,
+		name,
+	)
+	rec, err := s.scanConfigTemplate(row)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("registry get template: %w", err)
+	}
+	bindings, err := s.ListTemplateBindings(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	rec.Bindings = bindings
+	return rec, nil
+}
+
+// UpsertConfigTemplate создаёт шаблон или заменяет его документ, увеличивая revision.
+func (s *SQLiteStore) UpsertConfigTemplate(ctx context.Context, name string, doc map[string]any, actor string) error {
+	docJSON, err := s.encodeDoc(doc)
+	if err != nil {
+		return fmt.Errorf("registry upsert template %s: %w", name, err)
+	}
+	var updatedBy sql.NullString
+	if actor != "" {
+		updatedBy = sql.NullString{String: actor, Valid: true}
+	}
+	now := time.Now().UnixMilli()
+	_, err = s.db.ExecContext(
+		ctx,
+		`INSERT INTO config_templates(name, doc_json, revision, updated_by, created_at_ts, updated_at_ts)
+VALUES (?, ?, 1, ?, ?, ?)
+ON CONFLICT(name) DO UPDATE SET
+  doc_json = excluded.doc_json,
+  revision = revision + 1,
+  updated_by = excluded.updated_by,
+  updated_at_ts = excluded.updated_at_ts;`,
+		name,
+		docJSON,
+		updatedBy,
+		now,
+		now,
+	)
+	if err != nil {
+		return fmt.Errorf("registry upsert template %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) DeleteConfigTemplate(ctx context.Context, name string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("registry delete template %s: %w", name, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM config_template_bindings WHERE template_name = ?;`, name); err != nil {
+		return fmt.Errorf("registry delete template %s: %w", name, err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM config_templates WHERE name = ?;`, name); err != nil {
+		return fmt.Errorf("registry delete template %s: %w", name, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("registry delete template %s: %w", name, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) ListTemplateBindings(ctx context.Context, name string) ([]TemplateBinding, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT target_kind, target, priority
+FROM config_template_bindings
+WHERE template_name = ?
+ORDER BY priority, target_kind, target;`,
+		name,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("registry list template bindings: %w", err)
+	}
+	defer rows.Close()
+
+	out := []TemplateBinding{}
+	for rows.Next() {
+		var b TemplateBinding
+		if err := rows.Scan(&b.Kind, &b.Target, &b.Priority); err != nil {
+			return nil, fmt.Errorf("registry scan template bindings: %w", err)
+		}
+		out = append(out, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("registry list template bindings rows: %w", err)
+	}
+	return out, nil
+}
+
+// SetTemplateBindings заменяет привязки шаблона целиком.
+func (s *SQLiteStore) SetTemplateBindings(ctx context.Context, name string, bindings []TemplateBinding) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("registry set template bindings %s: %w", name, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM config_template_bindings WHERE template_name = ?;`, name); err != nil {
+		return fmt.Errorf("registry set template bindings %s: %w", name, err)
+	}
+	for _, b := range bindings {
+		if _, err := tx.ExecContext(
+			ctx,
+			`INSERT OR REPLACE INTO config_template_bindings(template_name, target_kind, target, priority)
+VALUES (?, ?, ?, ?);`,
+			name,
+			b.Kind,
+			b.Target,
+			b.Priority,
+		); err != nil {
+			return fmt.Errorf("registry set template bindings %s: %w", name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("registry set template bindings %s: %w", name, err)
+	}
+	return nil
+}
+
+// ListDeviceTemplates — шаблоны, привязанные к группам/тегам устройства, по возрастанию приоритета.
+// Если шаблон попал через несколько привязок, берётся наибольший приоритет.
+func (s *SQLiteStore) ListDeviceTemplates(ctx context.Context, deviceID string) ([]DeviceTemplate, error) {
+	rows, err := s.db.QueryContext(
+		ctx,
+		`SELECT t.name, t.doc_json, t.revision, MAX(b.priority) AS prio
+FROM config_template_bindings b
+JOIN config_templates t ON t.name = b.template_name
+WHERE (b.target_kind = 'group' AND b.target IN (SELECT group_name FROM device_groups WHERE device_id = ?))
+   OR (b.target_kind = 'tag' AND b.target IN (SELECT tag FROM device_tags WHERE device_id = ?))
+GROUP BY t.name
+ORDER BY prio, t.name;`,
+		deviceID,
+		deviceID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("registry list device templates: %w", err)
+	}
+	defer rows.Close()
+
+	out := []DeviceTemplate{}
+	for rows.Next() {
+		var t DeviceTemplate
+		var docJSON string
+		if err := rows.Scan(&t.Name, &docJSON, &t.Revision, &t.Priority); err != nil {
+			return nil, fmt.Errorf("registry scan device templates: %w", err)
+		}
+		if t.Doc, err = s.decodeDoc(docJSON); err != nil {
+			return nil, fmt.Errorf("registry device template %s: bad doc_json: %w", t.Name, err)
+		}
+		out = append(out, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("registry list device templates rows: %w", err)
+	}
+	return out, nil
+}
+
+// ListBindingDevices — устройства, попадающие под привязки (без повторов, по возрастанию id).
+func (s *SQLiteStore) ListBindingDevices(ctx context.Context, bindings []TemplateBinding) ([]string, error) {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, b := range bindings {
+		var ids []string
+		var err error
+		switch b.Kind {
+		case BindingGroup:
+			ids, err = s.ListGroupDevices(ctx, b.Target)
+		case BindingTag:
+			ids, err = s.ListTagDevices(ctx, b.Target)
+		default:
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			if !seen[id] {
+				seen[id] = true
+				out = append(out, id)
+			}
+		}
+	}
+	sort.Strings(out)
+	return out, nil
+}
+
+func (s *SQLiteStore) GetConfigOverride(ctx context.Context, deviceID string) (*ConfigOverrideRecord, error) {
+	row := s.db.QueryRowContext(
+		ctx,
+		`SELECT device_id, doc_json, updated_by, updated_at_ts
+FROM device_config_overrides
+WHERE device_id = ?;`,
+		deviceID,
+	)
+	var rec ConfigOverrideRecord
+	var docJSON string
+	var updatedBy sql.NullString
+	if err := row.Scan(&rec.DeviceID, &docJSON, &updatedBy, &rec.UpdatedMillis); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("registry get config override: %w", err)
+	}
+	doc, err := s.decodeDoc(docJSON)
+	if err != nil {
+		return nil, fmt.Errorf("registry config override deviceId=%s: bad doc_json: %w", deviceID, err)
+	}
+	rec.Doc = doc
+	rec.UpdatedBy = updatedBy.String
+	return &rec, nil
+}
+
+func (s *SQLiteStore) SetConfigOverride(ctx context.Context, deviceID string, doc map[string]any, actor string) error {
+	docJSON, err := s.encodeDoc(doc)
+	if err != nil {
+		return fmt.Errorf("registry set config override deviceId=%s: %w", deviceID, err)
+	}
+	var updatedBy sql.NullString
+	if actor != "" {
+		updatedBy = sql.NullString{String: actor, Valid: true}
+	}
+	_, err = s.db.ExecContext(
+		ctx,
+		`INSERT INTO device_config_overrides(device_id, doc_json, updated_by, updated_at_ts)
+VALUES (?, ?, ?, ?)
+ON CONFLICT(device_id) DO UPDATE SET
+  doc_json = excluded.doc_json,
+  updated_by = excluded.updated_by,
+  updated_at_ts = excluded.updated_at_ts;`,
+		deviceID,
+		docJSON,
+		updatedBy,
+		time.Now().UnixMilli(),
+	)
+	if err != nil {
+		return fmt.Errorf("registry set config override deviceId=%s: %w", deviceID, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) DeleteConfigOverride(ctx context.Context, deviceID string) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM device_config_overrides WHERE device_id = ?;`, deviceID); err != nil {
+		return fmt.Errorf("registry delete config override deviceId=%s: %w", deviceID, err)
+	}
+	return nil
+}
+
+func (s *SQLiteStore) scanConfigTemplate(row rowScanner) (*ConfigTemplateRecord, error) {
+	var rec ConfigTemplateRecord
+	var docJSON string
+	var updatedBy sql.NullString
+	if err := row.Scan(
+		&rec.Name,
+		&docJSON,
+		&rec.Revision,
+		&updatedBy,
+		&rec.CreatedMillis,
+		&rec.UpdatedMillis,
+	); err != nil {
+		return nil, err
+	}
+	doc, err := s.decodeDoc(docJSON)
+	if err != nil {
+		return nil, fmt.Errorf("template %s: bad doc_json: %w", rec.Name, err)
+	}
+	rec.Doc = doc
+	rec.UpdatedBy = updatedBy.String
+	return &rec, nil
+}
@@ -0,0 +1,286 @@
+package scheduler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "time/tzdata" // IANA-зоны даже в контейнере без /usr/share/zoneinfo
+)
+
+// Spec — разобранное cron-выражение (5 полей: минута час день месяц день_недели)
+// в конкретной временной зоне.
+type Spec struct {
+	minute, hour, dom, month, dow uint64
+	domStar, dowStar              bool
+	loc                           *time.Location
+}
+
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	fMinute = field{name: "minute", min: 0, max: 59}
+	fHour   = field{name: "hour", min: 0, max: 23}
+	fDom    = field{name: "day-of-month", min: 1, max: 31}
+	fMonth  = field{name: "month", min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// 7 допускается как воскресенье и сворачивается в 0
+	fDow = field{name: "day-of-week", min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var macros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Parse разбирает cron-выражение; tz — имя IANA-зоны ("" = UTC).
+func Parse(expr string, tz string) (*Spec, error) {
+	loc := time.UTC
+	if tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tz %q: %w", tz, err)
+		}
+		loc = l
+	}
+
+	expr = strings.TrimSpace(expr)
+	if m, ok := macros[strings.ToLower(expr)]; ok {
+		expr = m
+	}
+	parts := strings.Fields(expr)
+	if len(parts) != 5 {
+		return nil, fmt.Errorf("cron: expected 5 fields, got %d", len(parts))
+	}
+
+	s := &Spec{loc: loc}
+	var err error
+	if s.minute, err = parseField(parts[0], fMinute); err != nil {
+		return nil, err
+	}
+	if s.hour, err = parseField(parts[1], fHour); err != nil {
+		return nil, err
+	}
+	if s.dom, err = parseField(parts[2], fDom); err != nil {
+		return nil, err
+	}
+	if s.month, err = parseField(parts[3], fMonth); err != nil {
+		return nil, err
+	}
+	if s.dow, err = parseField(parts[4], fDow); err != nil {
+		return nil, err
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow = (s.dow &^ (1 << 7)) | 1
+	}
+	s.domStar = parts[2] == "*" || parts[2] == "?"
+	s.dowStar = parts[4] == "*" || parts[4] == "?"
+	return s, nil
+}
+
+func parseField(expr string, f field) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(expr, ",") {
+		b, err := parseRange(part, f)
+		if err != nil {
+			return 0, err
+		}
+		bits |= b
+	}
+	return bits, nil
+}
+
+// parseRange: "*", "N", "N-M", любое из них с "/step".
+func parseRange(expr string, f field) (uint64, error) {
+	rangePart, stepPart, hasStep := strings.Cut(expr, "/")
+
+	lo, hi := f.min, f.max
+	switch {
+	case rangePart == "*" || rangePart == "?":
+	case strings.Contains(rangePart, "-"):
+		a, b, _ := strings.Cut(rangePart, "-")
+		var err error
+		if lo, err = parseValue(a, f); err != nil {
+			return 0, err
+		}
+		if hi, err = parseValue(b, f); err != nil {
+			return 0, err
+		}
+	default:
+		v, err := parseValue(rangePart, f)
+		if err != nil {
+			return 0, err
+		}
+		lo = v
+		if !hasStep {
+			hi = v
+		}
+	}
+	if lo > hi {
+		return 0, fmt.Errorf("cron: %s range %q is empty", f.name, expr)
+	}
+
+	step := 1
+	if hasStep {
+		n, err := strconv.Atoi(stepPart)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("cron: %s step %q is invalid", f.name, stepPart)
+		}
+		step = n
+	}
+
+	var bits uint64
+	for v := lo; v <= hi; v += step {
+		bits |= 1 << uint(v)
+	}
+	return bits, nil
+}
+
+func parseValue(s string, f field) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("cron: %s value %q is invalid", f.name, s)
+	}
+	if n < f.min || n > f.max {
+		return 0, fmt.Errorf("cron: %s value %d out of range [%d..%d]", f.name, n, f.min, f.max)
+	}
+	return n, nil
+}
+
+// Location — зона, в которой интерпретируется выражение.
+func (s *Spec) Location() *time.Location {
+	return s.loc
+}
+
+// Next — ближайший момент строго после `after`. Нулевое время, если за 5 лет совпадений нет
+// (например "0 0 30 2 *").
+//
+// Переход на летнее/зимнее время: если час ограничен ("30 2 * * *"), выражение сопоставляется
+// со временем на часах — время из пропущенного часа сдвигается вперёд на величину перехода
+// (02:30 → 03:30), а повторённый час срабатывает один раз, по первому вхождению.
+// Если час "*", перебираются реальные моменты: "30 * * * *" срабатывает раз в настоящий час.
+func (s *Spec) Next(after time.Time) time.Time {
+	if s.hour == allHours {
+		return s.next(after, s.loc)
+	}
+	a := after.In(s.loc)
+	wall := time.Date(a.Year(), a.Month(), a.Day(), a.Hour(), a.Minute(), 0, 0, time.UTC)
+	for {
+		wall = s.next(wall, time.UTC)
+		if wall.IsZero() {
+			return wall
+		}
+		if t := atWall(wall, s.loc); t.After(after) {
+			return t
+		}
+	}
+}
+
+// atWall — момент, когда на часах в loc время wall (wall — в UTC, без зоны). time.Date для
+// повторённого и пропущенного часа выбирает вхождение как попало, поэтому выбираем сами:
+// из двух вхождений — первое, пропущенное время — по смещению до перехода, т.е. вперёд.
+func atWall(wall time.Time, loc *time.Location) time.Time {
+	guess := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), 0, 0, loc)
+	_, before := guess.Add(-12 * time.Hour).Zone()
+	_, after := guess.Add(12 * time.Hour).Zone()
+
+	var best time.Time
+	for _, off := range []int{before, after} {
+		t := wall.Add(-time.Duration(off) * time.Second).In(loc)
+		if t.Hour() == wall.Hour() && t.Minute() == wall.Minute() && t.Day() == wall.Day() && (best.IsZero() || t.Before(best)) {
+			best = t
+		}
+	}
+	if best.IsZero() {
+		best = wall.Add(-time.Duration(before) * time.Second).In(loc)
+	}
+	return best
+}
+
+const allHours = 1<<24 - 1
+
+// next — поиск по моментам в зоне loc (в UTC — то же самое, что по времени на часах).
+func (s *Spec) next(after time.Time, loc *time.Location) time.Time {
+	t := after.In(loc).Truncate(time.Minute).Add(time.Minute)
+	yearLimit := t.Year() + 5
+
+wrap:
+	if t.Year() > yearLimit {
+		return time.Time{}
+	}
+
+	for s.month&(1<<uint(t.Month())) == 0 {
+		t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		if t.Month() == time.January {
+			goto wrap
+		}
+	}
+
+	for !s.dayMatches(t) {
+		t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		if t.Day() == 1 {
+			goto wrap
+		}
+	}
+
+	for s.hour&(1<<uint(t.Hour())) == 0 {
+		t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		if t.Hour() == 0 {
+			goto wrap
+		}
+	}
+
+	for s.minute&(1<<uint(t.Minute())) == 0 {
+		t = t.Add(time.Minute)
+		if t.Minute() == 0 {
+			goto wrap
+		}
+	}
+
+	return t
+}
+
+// dayMatches — классическая семантика cron: если оба поля дня ограничены, достаточно любого.
+func (s *Spec) dayMatches(t time.Time) bool {
+	domOK := s.dom&(1<<uint(t.Day())) != 0
+	dowOK := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return domOK && dowOK
+	}
+	return domOK || dowOK
+}
+
+// NextRuns — превью ближайших n запусков после from.
+func NextRuns(expr, tz string, from time.Time, n int) ([]time.Time, error) {
+	spec, err := Parse(expr, tz)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]time.Time, 0, n)
+	t := from
+	for i := 0; i < n; i++ {
+		t = spec.Next(t)
+		if t.IsZero() {
+			break
+		}
+		out = append(out, t)
+	}
+	return out, nil
+}
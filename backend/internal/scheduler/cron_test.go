@@ -0,0 +1,186 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func mustLoc(t *testing.T, name string) *time.Location {
+	t.Helper()
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("load %s: %v", name, err)
+	}
+	return loc
+}
+
+func TestNext(t *testing.T) {
+	// 2026-03-02 — понедельник
+	from := time.Date(2026, 3, 2, 10, 7, 30, 0, time.UTC)
+	cases := []struct {
+		name string
+		expr string
+		want []string
+	}{
+		{"every 15 min", "*/15 * * * *", []string{"2026-03-02 10:15", "2026-03-02 10:30", "2026-03-02 10:45", "2026-03-02 11:00"}},
+		{"step from value", "5/20 * * * *", []string{"2026-03-02 10:25", "2026-03-02 10:45", "2026-03-02 11:05"}},
+		{"range", "0 9-11 * * *", []string{"2026-03-02 11:00", "2026-03-03 09:00", "2026-03-03 10:00"}},
+		{"range with step", "0 8-20/6 * * *", []string{"2026-03-02 14:00", "2026-03-02 20:00", "2026-03-03 08:00"}},
+		{"list", "0,30 12,18 * * *", []string{"2026-03-02 12:00", "2026-03-02 12:30", "2026-03-02 18:00", "2026-03-02 18:30"}},
+		{"names", "0 6 * jan,mar mon-wed", []string{"2026-03-03 06:00", "2026-03-04 06:00", "2026-03-09 06:00"}},
+		{"dow 7 is sunday", "0 0 * * 7", []string{"2026-03-08 00:00", "2026-03-15 00:00"}},
+		{"dom only", "0 0 15 * *", []string{"2026-03-15 00:00", "2026-04-15 00:00"}},
+		// оба поля дня ограничены — достаточно любого (1-е число ИЛИ пятница)
+		{"dom or dow", "0 0 1 * fri", []string{"2026-03-06 00:00", "2026-03-13 00:00", "2026-03-20 00:00", "2026-03-27 00:00", "2026-04-01 00:00", "2026-04-03 00:00"}},
+		// одно из полей "*" — нужны оба
+		{"dom star and dow", "0 0 * * fri", []string{"2026-03-06 00:00", "2026-03-13 00:00"}},
+		{"leap day", "0 0 29 2 *", []string{"2028-02-29 00:00", "2032-02-29 00:00"}},
+		{"macro", "@monthly", []string{"2026-04-01 00:00", "2026-05-01 00:00"}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NextRuns(tc.expr, "", from, len(tc.want))
+			if err != nil {
+				t.Fatalf("parse %q: %v", tc.expr, err)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("%q: got %d runs, want %d", tc.expr, len(got), len(tc.want))
+			}
+			for i, w := range tc.want {
+				if s := got[i].Format("2006-01-02 15:04"); s != w {
+					t.Errorf("%q run %d = %s, want %s", tc.expr, i, s, w)
+				}
+			}
+		})
+	}
+}
+
+func TestNextNoMatch(t *testing.T) {
+	spec, err := Parse("0 0 30 2 *", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := spec.Next(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)); !n.IsZero() {
+		t.Fatalf("Feb 30: got %v, want zero time", n)
+	}
+}
+
+func TestNextDST(t *testing.T) {
+	ny := mustLoc(t, "America/New_York")
+	msk := mustLoc(t, "Europe/Moscow")
+	cases := []struct {
+		name string
+		expr string
+		tz   string
+		from time.Time
+		want []time.Time // моменты в UTC
+	}{
+		// 2026-03-08 02:00 EST → 03:00 EDT: 02:30 не существует, сдвигается на 03:30 EDT
+		{
+			"NY spring-forward fixed time", "30 2 * * *", "America/New_York",
+			time.Date(2026, 3, 7, 12, 0, 0, 0, ny),
+			[]time.Time{
+				time.Date(2026, 3, 8, 7, 30, 0, 0, time.UTC), // 03:30 EDT
+				time.Date(2026, 3, 9, 6, 30, 0, 0, time.UTC), // 02:30 EDT
+			},
+		},
+		// ежечасная: пропущенного часа просто нет, интервалы по часу реального времени
+		{
+			"NY spring-forward hourly", "30 * * * *", "America/New_York",
+			time.Date(2026, 3, 8, 1, 0, 0, 0, ny),
+			[]time.Time{
+				time.Date(2026, 3, 8, 6, 30, 0, 0, time.UTC), // 01:30 EST
+				time.Date(2026, 3, 8, 7, 30, 0, 0, time.UTC), // 03:30 EDT
+			},
+		},
+		// 2026-11-01 02:00 EDT → 01:00 EST: 01:30 бывает дважды, срабатывает один раз
+		{
+			"NY fall-back fixed time", "30 1 * * *", "America/New_York",
+			time.Date(2026, 10, 31, 12, 0, 0, 0, ny),
+			[]time.Time{
+				time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC), // 01:30 EDT
+				time.Date(2026, 11, 2, 6, 30, 0, 0, time.UTC), // 01:30 EST следующего дня
+			},
+		},
+		{
+			"NY fall-back hourly", "30 * * * *", "America/New_York",
+			time.Date(2026, 11, 1, 0, 45, 0, 0, ny),
+			[]time.Time{
+				time.Date(2026, 11, 1, 5, 30, 0, 0, time.UTC), // 01:30 EDT
+				time.Date(2026, 11, 1, 6, 30, 0, 0, time.UTC), // 01:30 EST
+				time.Date(2026, 11, 1, 7, 30, 0, 0, time.UTC), // 02:30 EST
+			},
+		},
+		// Москва без переходов с 2014: сегодня локальное время = UTC+3 круглый год
+		{
+			"Moscow no DST", "0 3 * * *", "Europe/Moscow",
+			time.Date(2026, 3, 28, 12, 0, 0, 0, msk),
+			[]time.Time{
+				time.Date(2026, 3, 29, 0, 0, 0, 0, time.UTC),
+				time.Date(2026, 3, 30, 0, 0, 0, 0, time.UTC),
+			},
+		},
+		// 2010-03-28 02:00 MSK → 03:00 MSD
+		{
+			"Moscow 2010 spring-forward", "30 2 * * *", "Europe/Moscow",
+			time.Date(2010, 3, 27, 12, 0, 0, 0, msk),
+			[]time.Time{
+				time.Date(2010, 3, 27, 23, 30, 0, 0, time.UTC), // 03:30 MSD
+				time.Date(2010, 3, 28, 22, 30, 0, 0, time.UTC), // 02:30 MSD
+			},
+		},
+		// 2010-10-31 03:00 MSD → 02:00 MSK: 02:30 бывает дважды
+		{
+			"Moscow 2010 fall-back", "30 2 * * *", "Europe/Moscow",
+			time.Date(2010, 10, 30, 12, 0, 0, 0, msk),
+			[]time.Time{
+				time.Date(2010, 10, 30, 22, 30, 0, 0, time.UTC), // 02:30 MSD
+				time.Date(2010, 10, 31, 23, 30, 0, 0, time.UTC), // 02:30 MSK следующего дня
+			},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NextRuns(tc.expr, tc.tz, tc.from, len(tc.want))
+			if err != nil {
+				t.Fatalf("parse %q: %v", tc.expr, err)
+			}
+			if len(got) != len(tc.want) {
+				t.Fatalf("%q: got %d runs, want %d", tc.expr, len(got), len(tc.want))
+			}
+			for i, w := range tc.want {
+				if !got[i].Equal(w) {
+					t.Errorf("%q run %d = %s, want %s", tc.expr, i, got[i].UTC(), w.UTC())
+				}
+			}
+		})
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	cases := []struct {
+		expr, tz string
+	}{
+		{"", ""},
+		{"* * * *", ""},
+		{"* * * * * *", ""},
+		{"60 * * * *", ""},
+		{"* 24 * * *", ""},
+		{"* * 0 * *", ""},
+		{"* * * 13 *", ""},
+		{"* * * * 8", ""},
+		{"10-5 * * * *", ""},
+		{"*/0 * * * *", ""},
+		{"*/x * * * *", ""},
+		{"a * * * *", ""},
+		{"* * * foo *", ""},
+		{"1,,2 * * * *", ""},
+		{"@often", ""},
+		{"* * * * *", "Mars/Olympus"},
+	}
+	for _, tc := range cases {
+		if _, err := Parse(tc.expr, tc.tz); err == nil {
+			t.Errorf("Parse(%q, %q): expected error", tc.expr, tc.tz)
+		}
+	}
+}
@@ -0,0 +1,311 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/perm1ss10n/vexora/backend/internal/commands"
+	"github.com/perm1ss10n/vexora/backend/internal/model"
+	"github.com/perm1ss10n/vexora/backend/internal/oplock"
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+)
+
+// TargetStore — то, что нужно для разрешения селектора в список устройств.
+type TargetStore interface {
+	ListDevices(ctx context.Context) ([]registry.DeviceRecord, error)
+	ListGroupDevices(ctx context.Context, group string) ([]string, error)
+}
+
+// Store — персистентность расписаний (реализует registry.SQLiteStore).
+type Store interface {
+	TargetStore
+	ListDueSchedules(ctx context.Context, nowMillis int64) ([]registry.ScheduleRecord, error)
+	SetScheduleRun(ctx context.Context, id string, nextMillis int64, lastMillis int64) error
+	DisableSchedule(ctx context.Context, id string) error
+	InsertScheduleRun(ctx context.Context, run registry.ScheduleRunRecord) error
+	FinishScheduleRun(ctx context.Context, run registry.ScheduleRunRecord) error
+	InsertScheduleRunItem(ctx context.Context, item registry.ScheduleRunItem) error
+}
+
+// Sender — отправка команды (commands.Manager). id задаёт планировщик: элемент запуска
+// ссылается на историю команд и тогда, когда Send вернул ошибку.
+type Sender interface {
+	SendWithID(ctx context.Context, cmdID string, deviceID string, cmdType string, params map[string]any, timeout time.Duration) (model.AckPayload, error)
+}
+
+type Config struct {
+	Tick     time.Duration // как часто смотреть due-расписания
+	Parallel int           // сколько команд одного запуска отправлять одновременно
+}
+
+func LoadConfigFromEnv() Config {
+	cfg := Config{Tick: 15 * time.Second, Parallel: 8}
+	if n := getenvInt("SCHEDULER_TICK_MS", 0); n > 0 {
+		cfg.Tick = time.Duration(n) * time.Millisecond
+	}
+	if n := getenvInt("SCHEDULER_PARALLEL", 0); n > 0 {
+		cfg.Parallel = n
+	}
+	return cfg
+}
+
+type Scheduler struct {
+	store Store
+	cmd   Sender
+	cfg   Config
+
+	mu      sync.Mutex
+	running map[string]bool // scheduleId -> запуск ещё идёт
+}
+
+func New(store Store, cmd Sender, cfg Config) *Scheduler {
+	if cfg.Tick <= 0 {
+		cfg.Tick = 15 * time.Second
+	}
+	if cfg.Parallel <= 0 {
+		cfg.Parallel = 1
+	}
+	return &Scheduler{
+		store:   store,
+		cmd:     cmd,
+		cfg:     cfg,
+		running: make(map[string]bool),
+	}
+}
+
+// Start запускает фоновый цикл. Пропущенные (пока backend был выключен) запуски
+// выполняются один раз при первом тике, дальше — по расписанию от текущего времени.
+func (s *Scheduler) Start(ctx context.Context) {
+	go func() {
+		t := time.NewTicker(s.cfg.Tick)
+		defer t.Stop()
+
+		s.tick(ctx)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.C:
+				s.tick(ctx)
+			}
+		}
+	}()
+}
+
+func (s *Scheduler) tick(ctx context.Context) {
+	now := time.Now()
+	due, err := s.store.ListDueSchedules(ctx, now.UnixMilli())
+	if err != nil {
+		log.Printf("[SCHED] list_due_failed err=%v", err)
+		return
+	}
+
+	for _, rec := range due {
+		s.mu.Lock()
+		busy := s.running[rec.ID]
+		if !busy {
+			s.running[rec.ID] = true
+		}
+		s.mu.Unlock()
+		if busy {
+			log.Printf("[SCHED] skip id=%s name=%q reason=previous_run_active", rec.ID, rec.Name)
+			continue
+		}
+
+		// next_run сдвигаем до выполнения, чтобы запуск не повторился на следующем тике
+		spec, err := Parse(rec.Cron, rec.TZ)
+		if err != nil {
+			// битое выражение (или пропавшая tz) не запускаем и выключаем, а не оставляем enabled без next_run
+			log.Printf("[SCHED] bad_cron id=%s cron=%q tz=%s err=%v", rec.ID, rec.Cron, rec.TZ, err)
+			if err := s.store.DisableSchedule(ctx, rec.ID); err != nil {
+				log.Printf("[SCHED] disable_failed id=%s err=%v", rec.ID, err)
+			}
+			s.done(rec.ID)
+			continue
+		}
+		next := spec.Next(now)
+		if next.IsZero() {
+			// следующего запуска нет (например, 30 февраля): этот выполняем, расписание выключаем
+			log.Printf("[SCHED] no_next_run id=%s cron=%q tz=%s", rec.ID, rec.Cron, rec.TZ)
+			if err := s.store.DisableSchedule(ctx, rec.ID); err != nil {
+				log.Printf("[SCHED] disable_failed id=%s err=%v", rec.ID, err)
+				s.done(rec.ID)
+				continue
+			}
+		}
+		if err := s.store.SetScheduleRun(ctx, rec.ID, unixMilliOrZero(next), now.UnixMilli()); err != nil {
+			log.Printf("[SCHED] set_next_failed id=%s err=%v", rec.ID, err)
+			s.done(rec.ID)
+			continue
+		}
+
+		go func(rec registry.ScheduleRecord) {
+			defer s.done(rec.ID)
+			s.execute(ctx, rec)
+		}(rec)
+	}
+}
+
+func unixMilliOrZero(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMilli()
+}
+
+func (s *Scheduler) done(id string) {
+	s.mu.Lock()
+	delete(s.running, id)
+	s.mu.Unlock()
+}
+
+func (s *Scheduler) execute(ctx context.Context, rec registry.ScheduleRecord) {
+	run := registry.ScheduleRunRecord{
+		ID:            uuid.NewString(),
+		ScheduleID:    rec.ID,
+		Status:        registry.ScheduleRunRunning,
+		StartedMillis: time.Now().UnixMilli(),
+	}
+
+	targets, err := ResolveTargets(ctx, s.store, rec.Selector)
+	run.Targets = len(targets)
+	if err := s.store.InsertScheduleRun(ctx, run); err != nil {
+		log.Printf("[SCHED] insert_run_failed id=%s err=%v", rec.ID, err)
+		return
+	}
+	if err != nil {
+		run.Status = registry.ScheduleRunFailed
+		run.Error = sql.NullString{String: err.Error(), Valid: true}
+		s.finish(ctx, run)
+		return
+	}
+
+	log.Printf("[SCHED] run_start id=%s name=%q run=%s type=%s targets=%d", rec.ID, rec.Name, run.ID, rec.CmdType, len(targets))
+
+	timeout := time.Duration(rec.TimeoutMs) * time.Millisecond
+	sem := make(chan struct{}, s.cfg.Parallel)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, deviceID := range targets {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(deviceID string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			cmdID := uuid.NewString()
+			ack, err := s.cmd.SendWithID(ctx, cmdID, deviceID, rec.CmdType, rec.Params, timeout)
+			item := registry.ScheduleRunItem{
+				RunID:     run.ID,
+				DeviceID:  deviceID,
+				CommandID: cmdID,
+				Ok:        err == nil && ack.Ok,
+				Code:      resultCode(ack, err),
+				TsMillis:  time.Now().UnixMilli(),
+			}
+			if err := s.store.InsertScheduleRunItem(ctx, item); err != nil {
+				log.Printf("[SCHED] insert_item_failed run=%s deviceId=%s err=%v", run.ID, deviceID, err)
+			}
+
+			mu.Lock()
+			if item.Ok {
+				run.OkCount++
+			} else {
+				run.FailCount++
+			}
+			mu.Unlock()
+		}(deviceID)
+	}
+	wg.Wait()
+
+	run.Status = registry.ScheduleRunDone
+	s.finish(ctx, run)
+	log.Printf("[SCHED] run_done id=%s run=%s ok=%d fail=%d", rec.ID, run.ID, run.OkCount, run.FailCount)
+}
+
+func (s *Scheduler) finish(ctx context.Context, run registry.ScheduleRunRecord) {
+	run.FinishedMillis = sql.NullInt64{Int64: time.Now().UnixMilli(), Valid: true}
+	if err := s.store.FinishScheduleRun(ctx, run); err != nil {
+		log.Printf("[SCHED] finish_run_failed run=%s err=%v", run.ID, err)
+	}
+}
+
+func resultCode(ack model.AckPayload, err error) string {
+	switch {
+	case err == nil:
+		return ack.Code
+	case errors.Is(err, commands.ErrTimeout):
+		return "TIMEOUT"
+	case errors.Is(err, commands.ErrPublish):
+		return "PUBLISH_FAILED"
+	case errors.Is(err, oplock.ErrLocked):
+		return "LOCKED"
+	default:
+		return "ERROR"
+	}
+}
+
+// ResolveTargets разворачивает селектор в список известных registry устройств.
+func ResolveTargets(ctx context.Context, store TargetStore, sel registry.TargetSelector) ([]string, error) {
+	devices, err := store.ListDevices(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	known := make(map[string]registry.DeviceRecord, len(devices))
+	for _, d := range devices {
+		known[d.DeviceID] = d
+	}
+
+	want := map[string]bool{}
+	if sel.All {
+		for id := range known {
+			want[id] = true
+		}
+	}
+	if sel.Group != "" {
+		ids, err := store.ListGroupDevices(ctx, sel.Group)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			want[id] = true
+		}
+	}
+	for _, id := range sel.DeviceIDs {
+		want[id] = true
+	}
+
+	out := make([]string, 0, len(want))
+	for _, d := range devices { // порядок как в registry (last_seen DESC)
+		if !want[d.DeviceID] {
+			continue
+		}
+		if sel.OnlineOnly && d.Status != "online" {
+			continue
+		}
+		out = append(out, d.DeviceID)
+	}
+	return out, nil
+}
+
+func getenvInt(k string, def int) int {
+	v := os.Getenv(k)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return def
+	}
+	return n
+}
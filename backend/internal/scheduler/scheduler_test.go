@@ -0,0 +1,188 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/perm1ss10n/vexora/backend/internal/commands"
+	"github.com/perm1ss10n/vexora/backend/internal/model"
+	"github.com/perm1ss10n/vexora/backend/internal/oplock"
+	"github.com/perm1ss10n/vexora/backend/internal/registry"
+)
+
+type fakeStore struct {
+	mu       sync.Mutex
+	due      []registry.ScheduleRecord
+	next     map[string]int64
+	disabled map[string]bool
+	runs     int
+	devices  []registry.DeviceRecord
+	items    []registry.ScheduleRunItem
+}
+
+func newFakeStore(due ...registry.ScheduleRecord) *fakeStore {
+	return &fakeStore{due: due, next: map[string]int64{}, disabled: map[string]bool{}}
+}
+
+func (f *fakeStore) ListDevices(context.Context) ([]registry.DeviceRecord, error) {
+	return f.devices, nil
+}
+func (f *fakeStore) ListGroupDevices(context.Context, string) ([]string, error) { return nil, nil }
+func (f *fakeStore) ListDueSchedules(context.Context, int64) ([]registry.ScheduleRecord, error) {
+	return f.due, nil
+}
+
+func (f *fakeStore) SetScheduleRun(_ context.Context, id string, nextMillis int64, _ int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.next[id] = nextMillis
+	return nil
+}
+
+func (f *fakeStore) DisableSchedule(_ context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.disabled[id] = true
+	return nil
+}
+
+func (f *fakeStore) InsertScheduleRun(context.Context, registry.ScheduleRunRecord) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.runs++
+	return nil
+}
+
+func (f *fakeStore) FinishScheduleRun(context.Context, registry.ScheduleRunRecord) error { return nil }
+func (f *fakeStore) InsertScheduleRunItem(_ context.Context, item registry.ScheduleRunItem) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.items = append(f.items, item)
+	return nil
+}
+
+// fakeSender отвечает по deviceId: ошибка из errs или успешный ack.
+type fakeSender struct {
+	mu   sync.Mutex
+	ids  map[string]string // deviceId -> id команды
+	errs map[string]error
+}
+
+func (f *fakeSender) SendWithID(_ context.Context, cmdID, deviceID, _ string, _ map[string]any, _ time.Duration) (model.AckPayload, error) {
+	f.mu.Lock()
+	f.ids[deviceID] = cmdID
+	f.mu.Unlock()
+	if err := f.errs[deviceID]; err != nil {
+		return model.AckPayload{}, err
+	}
+	return model.AckPayload{ID: cmdID, Ok: true}, nil
+}
+
+func TestTickBadCronDisables(t *testing.T) {
+	store := newFakeStore(
+		registry.ScheduleRecord{ID: "bad", Cron: "61 * * * *", Enabled: true},
+		registry.ScheduleRecord{ID: "badtz", Cron: "* * * * *", TZ: "Nowhere/Void", Enabled: true},
+	)
+	s := New(store, nil, Config{})
+	s.tick(context.Background())
+
+	for _, id := range []string{"bad", "badtz"} {
+		if !store.disabled[id] {
+			t.Errorf("%s: expected schedule to be disabled", id)
+		}
+		if _, ok := store.next[id]; ok {
+			t.Errorf("%s: next_run must not be written for a bad spec", id)
+		}
+		if s.running[id] {
+			t.Errorf("%s: left marked as running", id)
+		}
+	}
+	if store.runs != 0 {
+		t.Errorf("bad spec executed %d times", store.runs)
+	}
+}
+
+func TestTickNoNextRunDisablesAfterRun(t *testing.T) {
+	store := newFakeStore(registry.ScheduleRecord{ID: "feb30", Cron: "0 0 30 2 *", Enabled: true})
+	s := New(store, nil, Config{})
+	s.tick(context.Background())
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		store.mu.Lock()
+		runs := store.runs
+		store.mu.Unlock()
+		if runs == 1 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	if store.runs != 1 {
+		t.Fatalf("due run executed %d times, want 1", store.runs)
+	}
+	if !store.disabled["feb30"] {
+		t.Error("expected schedule without further runs to be disabled")
+	}
+	if n := store.next["feb30"]; n != 0 {
+		t.Errorf("next_run = %d, want 0 (NULL)", n)
+	}
+}
+
+func TestTickSetsNextRun(t *testing.T) {
+	store := newFakeStore(registry.ScheduleRecord{ID: "hourly", Cron: "0 * * * *", Enabled: true})
+	s := New(store, nil, Config{})
+	before := time.Now().UTC()
+	s.tick(context.Background())
+
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	want := time.Date(before.Year(), before.Month(), before.Day(), before.Hour(), 0, 0, 0, time.UTC).Add(time.Hour)
+	if n := store.next["hourly"]; n != want.UnixMilli() && n != want.Add(time.Hour).UnixMilli() {
+		t.Errorf("next_run = %d, want %d", n, want.UnixMilli())
+	}
+	if store.disabled["hourly"] {
+		t.Error("valid schedule disabled")
+	}
+}
+
+// Элемент запуска ссылается на команду и тогда, когда отправка не удалась.
+func TestExecuteRecordsCommandIDOnError(t *testing.T) {
+	store := newFakeStore()
+	for _, id := range []string{"ok", "timeout", "publish", "locked"} {
+		store.devices = append(store.devices, registry.DeviceRecord{DeviceID: id})
+	}
+	sender := &fakeSender{ids: map[string]string{}, errs: map[string]error{
+		"timeout": commands.ErrTimeout,
+		"publish": fmt.Errorf("%w: broker down", commands.ErrPublish),
+		"locked":  &oplock.LockedError{},
+	}}
+	s := New(store, sender, Config{Parallel: 2})
+	s.execute(context.Background(), registry.ScheduleRecord{
+		ID: "s1", CmdType: "reboot", TimeoutMs: 1000,
+		Selector: registry.TargetSelector{All: true},
+	})
+
+	sort.Slice(store.items, func(i, j int) bool { return store.items[i].DeviceID < store.items[j].DeviceID })
+	want := map[string]string{"locked": "LOCKED", "ok": "", "publish": "PUBLISH_FAILED", "timeout": "TIMEOUT"}
+	if len(store.items) != len(want) {
+		t.Fatalf("items = %d, want %d", len(store.items), len(want))
+	}
+	for _, it := range store.items {
+		if it.CommandID == "" || it.CommandID != sender.ids[it.DeviceID] {
+			t.Errorf("%s: commandId = %q, sent as %q", it.DeviceID, it.CommandID, sender.ids[it.DeviceID])
+		}
+		if it.Code != want[it.DeviceID] {
+			t.Errorf("%s: code = %q, want %q", it.DeviceID, it.Code, want[it.DeviceID])
+		}
+		if it.Ok != (it.DeviceID == "ok") {
+			t.Errorf("%s: ok = %v", it.DeviceID, it.Ok)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package secrets
+
+import (
+	"os"
+	"strings"
+)
+
+// DefaultPaths — секретные поля конфигурации (путь через точку, как в FieldError).
+var DefaultPaths = []string{
+	"network.wifi.password",
+	"network.gsm.user",
+	"network.gsm.password",
+	"mqtt.username",
+	"mqtt.password",
+}
+
+// LoadPathsFromEnv — CFG_SECRET_PATHS (через запятую) или DefaultPaths.
+func LoadPathsFromEnv() []string {
+	v := strings.TrimSpace(os.Getenv("CFG_SECRET_PATHS"))
+	if v == "" {
+		return DefaultPaths
+	}
+	out := []string{}
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// Cipher шифрует секретные поля документов конфигурации (реализует registry.DocCipher).
+type Cipher struct {
+	ring  *Keyring
+	paths []string
+}
+
+func NewCipher(ring *Keyring, paths []string) *Cipher {
+	return &Cipher{ring: ring, paths: paths}
+}
+
+func (c *Cipher) Paths() []string {
+	return c.paths
+}
+
+func (c *Cipher) Keyring() *Keyring {
+	return c.ring
+}
+
+// SealDoc — копия документа с зашифрованными секретными полями (для записи в БД).
+func (c *Cipher) SealDoc(doc map[string]any) (map[string]any, error) {
+	out, _, err := c.ResealDoc(doc)
+	return out, err
+}
+
+// ResealDoc шифрует открытые значения в секретных полях и перешифровывает конверты под старыми ключами.
+// changed=false — документ уже в актуальном виде.
+func (c *Cipher) ResealDoc(doc map[string]any) (map[string]any, bool, error) {
+	if doc == nil {
+		return nil, false, nil
+	}
+	out := clone(doc)
+	changed := false
+	for _, p := range c.paths {
+		parent, key, ok := lookup(out, p)
+		if !ok {
+			continue
+		}
+		s, ok := parent[key].(string)
+		if !ok || s == "" {
+			continue
+		}
+		env, err := c.ring.seal(p, s)
+		if err != nil {
+			return nil, false, err
+		}
+		parent[key] = env
+		changed = true
+	}
+
+	err := walk(out, "", func(parent map[string]any, key, path string, env map[string]any) error {
+		next, rewrapped, err := c.ring.rewrap(env)
+		if err != nil {
+			return err
+		}
+		if rewrapped {
+			parent[key] = next
+			changed = true
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return out, changed, nil
+}
+
+// OpenDoc — копия документа с расшифрованными конвертами (где бы они ни лежали).
+func (c *Cipher) OpenDoc(doc map[string]any) (map[string]any, error) {
+	if doc == nil {
+		return nil, nil
+	}
+	out := clone(doc)
+	err := walk(out, "", func(parent map[string]any, key, path string, env map[string]any) error {
+		plain, err := c.ring.open(path, env)
+		if err != nil {
+			return err
+		}
+		parent[key] = plain
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// walk вызывает fn для каждого конверта в документе.
+func walk(m map[string]any, prefix string, fn func(parent map[string]any, key, path string, env map[string]any) error) error {
+	for k, v := range m {
+		path := k
+		if prefix != "" {
+			path = prefix + "." + k
+		}
+		if env, ok := isEnvelope(v); ok {
+			if err := fn(m, k, path, env); err != nil {
+				return err
+			}
+			continue
+		}
+		if child, ok := v.(map[string]any); ok {
+			if err := walk(child, path, fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lookup — объект-родитель и ключ поля по пути; ok=false, если поля нет.
+func lookup(doc map[string]any, path string) (map[string]any, string, bool) {
+	parts := strings.Split(path, ".")
+	cur := doc
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := cur[p].(map[string]any)
+		if !ok {
+			return nil, "", false
+		}
+		cur = next
+	}
+	key := parts[len(parts)-1]
+	if _, ok := cur[key]; !ok {
+		return nil, "", false
+	}
+	return cur, key, true
+}
+
+func clone(m map[string]any) map[string]any {
+	if m == nil {
+		return nil
+	}
+	out := make(map[string]any, len(m))
+	for k, v := range m {
+		out[k] = cloneValue(v)
+	}
+	return out
+}
+
+func cloneValue(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		return clone(t)
+	case []any:
+		out := make([]any, len(t))
+		for i, e := range t {
+			out[i] = cloneValue(e)
+		}
+		return out
+	default:
+		return v
+	}
+}
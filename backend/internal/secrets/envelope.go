@@ -0,0 +1,153 @@
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+)
+
+// Зашифрованное значение хранится в doc_json вместо строки:
+//
+//	{"$secret":"v1","kid":"<KEK>","dek":"<base64 nonce|DEK под KEK>","ct":"<base64 nonce|значение под DEK>"}
+//
+// У каждого значения свой ключ данных (DEK); ротация KEK перешифровывает только DEK.
+const (
+	envelopeMarker  = "$secret"
+	envelopeVersion = "v1"
+)
+
+var ErrUnknownKey = errors.New("secret key not found in key file")
+
+func (k *Keyring) seal(path, plain string) (map[string]any, error) {
+	kid, kek := k.activeKey()
+	dek := make([]byte, keySize)
+	if _, err := rand.Read(dek); err != nil {
+		return nil, fmt.Errorf("generate data key: %w", err)
+	}
+	ct, err := gcmSeal(dek, []byte(plain), []byte(path))
+	if err != nil {
+		return nil, err
+	}
+	wrapped, err := gcmSeal(kek, dek, []byte(kid))
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{
+		envelopeMarker: envelopeVersion,
+		"kid":          kid,
+		"dek":          base64.StdEncoding.EncodeToString(wrapped),
+		"ct":           base64.StdEncoding.EncodeToString(ct),
+	}, nil
+}
+
+func (k *Keyring) open(path string, env map[string]any) (string, error) {
+	dek, err := k.unwrap(env)
+	if err != nil {
+		return "", err
+	}
+	ct, err := envelopeBytes(env, "ct")
+	if err != nil {
+		return "", err
+	}
+	plain, err := gcmOpen(dek, ct, []byte(path))
+	if err != nil {
+		return "", fmt.Errorf("decrypt %s: %w", path, err)
+	}
+	return string(plain), nil
+}
+
+// rewrap перешифровывает DEK активным ключом; changed=false, если конверт уже под active.
+func (k *Keyring) rewrap(env map[string]any) (map[string]any, bool, error) {
+	kid, kek := k.activeKey()
+	if env["kid"] == kid {
+		return env, false, nil
+	}
+	dek, err := k.unwrap(env)
+	if err != nil {
+		return nil, false, err
+	}
+	wrapped, err := gcmSeal(kek, dek, []byte(kid))
+	if err != nil {
+		return nil, false, err
+	}
+	return map[string]any{
+		envelopeMarker: envelopeVersion,
+		"kid":          kid,
+		"dek":          base64.StdEncoding.EncodeToString(wrapped),
+		"ct":           env["ct"],
+	}, true, nil
+}
+
+func (k *Keyring) unwrap(env map[string]any) ([]byte, error) {
+	kid, _ := env["kid"].(string)
+	kek, ok := k.key(kid)
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, kid)
+	}
+	wrapped, err := envelopeBytes(env, "dek")
+	if err != nil {
+		return nil, err
+	}
+	dek, err := gcmOpen(kek, wrapped, []byte(kid))
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key kid=%s: %w", kid, err)
+	}
+	return dek, nil
+}
+
+// isEnvelope — значение является зашифрованным конвертом.
+func isEnvelope(v any) (map[string]any, bool) {
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, false
+	}
+	if m[envelopeMarker] != envelopeVersion {
+		return nil, false
+	}
+	return m, true
+}
+
+func envelopeBytes(env map[string]any, field string) ([]byte, error) {
+	s, _ := env[field].(string)
+	b, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || s == "" {
+		return nil, fmt.Errorf("secret envelope: bad %s", field)
+	}
+	return b, nil
+}
+
+// gcmSeal — AES-GCM, nonce в начале результата.
+func gcmSeal(key, plain, aad []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plain, aad), nil
+}
+
+func gcmOpen(key, data, aad []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ct := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, ct, aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("aes: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,267 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func testCipher(t *testing.T) (*Cipher, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "secrets.key")
+	ring, err := OpenKeyring(path)
+	if err != nil {
+		t.Fatalf("open keyring: %v", err)
+	}
+	return NewCipher(ring, DefaultPaths), path
+}
+
+func testDoc() map[string]any {
+	return map[string]any{
+		"version": float64(3),
+		"network": map[string]any{
+			"wifi": map[string]any{"ssid": "plant-4", "password": "hunter2"},
+		},
+		"mqtt": map[string]any{"username": "dev-1", "password": ""},
+	}
+}
+
+func envelopeAt(t *testing.T, doc map[string]any, path string) map[string]any {
+	t.Helper()
+	parent, key, ok := lookup(doc, path)
+	if !ok {
+		t.Fatalf("%s missing", path)
+	}
+	env, ok := isEnvelope(parent[key])
+	if !ok {
+		t.Fatalf("%s is not an envelope: %#v", path, parent[key])
+	}
+	return env
+}
+
+func TestSealOpen(t *testing.T) {
+	c, _ := testCipher(t)
+	doc := testDoc()
+
+	sealed, err := c.SealDoc(doc)
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	b, _ := json.Marshal(sealed)
+	if strings.Contains(string(b), "hunter2") || strings.Contains(string(b), `"dev-1"`) {
+		t.Fatalf("plaintext leaked into sealed doc: %s", b)
+	}
+	if env := envelopeAt(t, sealed, "network.wifi.password"); env["kid"] != c.Keyring().Active() {
+		t.Errorf("kid = %v, want active %s", env["kid"], c.Keyring().Active())
+	}
+	// пустое значение не шифруется: "не задано" остаётся видно
+	if v := sealed["mqtt"].(map[string]any)["password"]; v != "" {
+		t.Errorf("empty secret sealed: %#v", v)
+	}
+	if !reflect.DeepEqual(doc, testDoc()) {
+		t.Error("SealDoc modified its input")
+	}
+
+	opened, err := c.OpenDoc(sealed)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	if !reflect.DeepEqual(opened, testDoc()) {
+		t.Errorf("round trip mismatch:\n got %#v\nwant %#v", opened, testDoc())
+	}
+}
+
+func TestOpenAfterRotation(t *testing.T) {
+	c, keyPath := testCipher(t)
+	oldKid := c.Keyring().Active()
+	sealed, err := c.SealDoc(testDoc())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newKid, err := c.Keyring().Rotate()
+	if err != nil {
+		t.Fatalf("rotate: %v", err)
+	}
+	if newKid == oldKid {
+		t.Fatal("rotate kept the same kid")
+	}
+
+	// старый ключ остаётся в файле — конверты до перешифрования читаются
+	if opened, err := c.OpenDoc(sealed); err != nil || !reflect.DeepEqual(opened, testDoc()) {
+		t.Fatalf("open under old key after rotation: %v", err)
+	}
+
+	resealed, changed, err := c.ResealDoc(sealed)
+	if err != nil || !changed {
+		t.Fatalf("reseal: changed=%v err=%v", changed, err)
+	}
+	env := envelopeAt(t, resealed, "network.wifi.password")
+	if env["kid"] != newKid {
+		t.Errorf("kid after reseal = %v, want %s", env["kid"], newKid)
+	}
+	// перешифровывается только DEK, сам шифртекст значения прежний
+	if env["ct"] != envelopeAt(t, sealed, "network.wifi.password")["ct"] {
+		t.Error("reseal re-encrypted the value instead of the data key")
+	}
+	if _, changed, _ := c.ResealDoc(resealed); changed {
+		t.Error("second reseal reported changes")
+	}
+
+	// новый процесс читает ключи из файла
+	ring, err := OpenKeyring(keyPath)
+	if err != nil {
+		t.Fatalf("reopen keyring: %v", err)
+	}
+	if ring.Active() != newKid {
+		t.Errorf("reopened active = %s, want %s", ring.Active(), newKid)
+	}
+	c2 := NewCipher(ring, DefaultPaths)
+	for _, doc := range []map[string]any{sealed, resealed} {
+		if opened, err := c2.OpenDoc(doc); err != nil || !reflect.DeepEqual(opened, testDoc()) {
+			t.Errorf("open with reopened keyring: %v", err)
+		}
+	}
+}
+
+func TestOpenTampered(t *testing.T) {
+	c, _ := testCipher(t)
+	sealed, err := c.SealDoc(testDoc())
+	if err != nil {
+		t.Fatal(err)
+	}
+	const path = "network.wifi.password"
+
+	flip := func(field string) func(env map[string]any) {
+		return func(env map[string]any) {
+			b, _ := base64.StdEncoding.DecodeString(env[field].(string))
+			b[len(b)-1] ^= 0x01
+			env[field] = base64.StdEncoding.EncodeToString(b)
+		}
+	}
+	cases := []struct {
+		name   string
+		mutate func(env map[string]any)
+		want   error
+	}{
+		{"ciphertext", flip("ct"), nil},
+		{"wrapped key", flip("dek"), nil},
+		{"truncated ciphertext", func(env map[string]any) { env["ct"] = base64.StdEncoding.EncodeToString([]byte{1, 2, 3}) }, nil},
+		{"not base64", func(env map[string]any) { env["ct"] = "%%%" }, nil},
+		{"unknown kid", func(env map[string]any) { env["kid"] = "nope" }, ErrUnknownKey},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			doc := clone(sealed)
+			tc.mutate(envelopeAt(t, doc, path))
+			_, err := c.OpenDoc(doc)
+			if err == nil {
+				t.Fatal("tampered envelope opened")
+			}
+			if tc.want != nil && !errors.Is(err, tc.want) {
+				t.Errorf("err = %v, want %v", err, tc.want)
+			}
+		})
+	}
+
+	// AAD значения — его путь: конверт, перенесённый в другое поле, не открывается
+	t.Run("moved to another path", func(t *testing.T) {
+		doc := clone(sealed)
+		doc["mqtt"].(map[string]any)["password"] = envelopeAt(t, doc, path)
+		if _, err := c.OpenDoc(doc); err == nil {
+			t.Fatal("envelope opened under a different path")
+		}
+	})
+
+	// AAD DEK — kid: подмена kid на другой существующий ключ тоже не проходит
+	t.Run("kid swapped", func(t *testing.T) {
+		if _, err := c.Keyring().Rotate(); err != nil {
+			t.Fatal(err)
+		}
+		doc := clone(sealed)
+		envelopeAt(t, doc, path)["kid"] = c.Keyring().Active()
+		if _, err := c.OpenDoc(doc); err == nil {
+			t.Fatal("envelope opened with a swapped kid")
+		}
+	})
+}
+
+func TestRestore(t *testing.T) {
+	prev := map[string]any{
+		"network": map[string]any{"wifi": map[string]any{"ssid": "old", "password": "hunter2"}},
+	}
+	doc := map[string]any{
+		"network": map[string]any{"wifi": map[string]any{"ssid": "new", "password": Mask}},
+		"mqtt":    map[string]any{"username": "dev-1", "password": Mask},
+	}
+
+	out := Restore(doc, prev, DefaultPaths)
+	wifi := out["network"].(map[string]any)["wifi"].(map[string]any)
+	if wifi["password"] != "hunter2" {
+		t.Errorf("wifi password = %#v, want previous value", wifi["password"])
+	}
+	if wifi["ssid"] != "new" {
+		t.Errorf("non-secret field changed: %#v", wifi["ssid"])
+	}
+	// в предыдущей версии поля не было — Mask устройству не уходит, поле удаляется
+	mqtt := out["mqtt"].(map[string]any)
+	if _, ok := mqtt["password"]; ok {
+		t.Errorf("mqtt.password = %#v, want removed", mqtt["password"])
+	}
+	if mqtt["username"] != "dev-1" {
+		t.Errorf("explicit value replaced: %#v", mqtt["username"])
+	}
+	if doc["mqtt"].(map[string]any)["password"] != Mask {
+		t.Error("Restore modified its input")
+	}
+
+	// без предыдущей версии вообще
+	out = Restore(doc, nil, DefaultPaths)
+	if _, ok := out["network"].(map[string]any)["wifi"].(map[string]any)["password"]; ok {
+		t.Error("Mask kept without previous version")
+	}
+}
+
+func TestRedactValue(t *testing.T) {
+	subtree := map[string]any{
+		"wifi": map[string]any{"ssid": "plant-4", "password": "hunter2"},
+		"gsm":  map[string]any{"apn": "internet", "user": ""},
+	}
+
+	got := RedactValue("network", subtree, DefaultPaths).(map[string]any)
+	wifi := got["wifi"].(map[string]any)
+	if wifi["password"] != Mask {
+		t.Errorf("nested secret = %#v, want Mask", wifi["password"])
+	}
+	if wifi["ssid"] != "plant-4" {
+		t.Errorf("non-secret field masked: %#v", wifi["ssid"])
+	}
+	if u := got["gsm"].(map[string]any)["user"]; u != "" {
+		t.Errorf("unset secret = %#v, want empty", u)
+	}
+	if subtree["wifi"].(map[string]any)["password"] != "hunter2" {
+		t.Error("RedactValue modified its input")
+	}
+
+	cases := []struct {
+		path string
+		in   any
+		want any
+	}{
+		{"network.wifi.password", "hunter2", Mask},
+		{"network.wifi.password", "", ""},
+		{"network.wifi.password", nil, nil},
+		{"network.wifi.ssid", "plant-4", "plant-4"},
+		{"mqtt", "not-a-map", "not-a-map"},
+		{"net", map[string]any{"wifi": map[string]any{"password": "x"}}, map[string]any{"wifi": map[string]any{"password": "x"}}},
+	}
+	for _, tc := range cases {
+		if got := RedactValue(tc.path, tc.in, DefaultPaths); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("RedactValue(%s, %#v) = %#v, want %#v", tc.path, tc.in, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package secrets
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const keySize = 32 // AES-256
+
+// Keyring — ключи шифрования ключей (KEK) из локального файла.
+// active шифрует новые значения, остальные ключи нужны только для расшифровки до перешифрования.
+type Keyring struct {
+	mu     sync.RWMutex
+	path   string
+	active string
+	keys   map[string][]byte
+}
+
+// keyFile — формат файла ключей: {"active":"k1","keys":{"k1":"<base64 32 байта>"}}.
+type keyFile struct {
+	Active string            `json:"active"`
+	Keys   map[string]string `json:"keys"`
+}
+
+func LoadKeyringFromEnv() (*Keyring, error) {
+	// По умолчанию рядом с БД: backend/.data/config-secrets.key
+	p := os.Getenv("CFG_SECRETS_KEY_FILE")
+	if p == "" {
+		p = "./.data/config-secrets.key"
+	}
+	return OpenKeyring(p)
+}
+
+// OpenKeyring читает файл ключей; если файла нет — создаёт его с одним новым ключом.
+func OpenKeyring(path string) (*Keyring, error) {
+	if path == "" {
+		return nil, errors.New("secrets key file path is empty")
+	}
+	k := &Keyring{path: path, keys: map[string][]byte{}}
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if _, err := k.Rotate(); err != nil {
+			return nil, err
+		}
+		return k, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read key file %s: %w", path, err)
+	}
+
+	var f keyFile
+	if err := json.Unmarshal(b, &f); err != nil {
+		return nil, fmt.Errorf("parse key file %s: %w", path, err)
+	}
+	for kid, enc := range f.Keys {
+		key, err := base64.StdEncoding.DecodeString(enc)
+		if err != nil || len(key) != keySize {
+			return nil, fmt.Errorf("key file %s: key %q must be base64 of %d bytes", path, kid, keySize)
+		}
+		k.keys[kid] = key
+	}
+	if _, ok := k.keys[f.Active]; !ok {
+		return nil, fmt.Errorf("key file %s: active key %q not found", path, f.Active)
+	}
+	k.active = f.Active
+	return k, nil
+}
+
+// Active — идентификатор ключа, которым шифруются новые значения.
+func (k *Keyring) Active() string {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active
+}
+
+// Rotate добавляет новый ключ, делает его active и сохраняет файл.
+// Старые ключи остаются в файле: ими расшифровываются ещё не перешифрованные значения.
+func (k *Keyring) Rotate() (string, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("generate key: %w", err)
+	}
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("generate key id: %w", err)
+	}
+	kid := time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(suffix)
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	keys := make(map[string][]byte, len(k.keys)+1)
+	for id, v := range k.keys {
+		keys[id] = v
+	}
+	keys[kid] = key
+	if err := writeKeyFile(k.path, kid, keys); err != nil {
+		return "", err
+	}
+	k.keys = keys
+	k.active = kid
+	return kid, nil
+}
+
+func (k *Keyring) key(kid string) ([]byte, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	key, ok := k.keys[kid]
+	return key, ok
+}
+
+func (k *Keyring) activeKey() (string, []byte) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return k.active, k.keys[k.active]
+}
+
+// writeKeyFile пишет файл атомарно (tmp + rename) с правами 0600.
+func writeKeyFile(path, active string, keys map[string][]byte) error {
+	f := keyFile{Active: active, Keys: make(map[string]string, len(keys))}
+	for kid, key := range keys {
+		f.Keys[kid] = base64.StdEncoding.EncodeToString(key)
+	}
+	b, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal key file: %w", err)
+	}
+
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("mkdir %s: %w", dir, err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o600); err != nil {
+		return fmt.Errorf("write key file %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("replace key file %s: %w", path, err)
+	}
+	return nil
+}
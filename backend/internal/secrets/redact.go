@@ -0,0 +1,107 @@
+package secrets
+
+import "strings"
+
+// Mask — значение секретного поля в ответах API. Если клиент присылает Mask обратно,
+// поле сохраняет прежнее значение (см. Restore).
+const Mask = "********"
+
+// Field — индикатор секретного поля: задано ли значение.
+type Field struct {
+	Path string `json:"path"`
+	Set  bool   `json:"set"`
+}
+
+// Redact — копия документа, где заданные секретные поля заменены на Mask, и индикаторы set/unset.
+func Redact(doc map[string]any, paths []string) (map[string]any, []Field) {
+	if doc == nil {
+		return nil, nil
+	}
+	out := clone(doc)
+	fields := make([]Field, 0, len(paths))
+	for _, p := range paths {
+		set := false
+		if parent, key, ok := lookup(out, p); ok && isSet(parent[key]) {
+			parent[key] = Mask
+			set = true
+		}
+		fields = append(fields, Field{Path: p, Set: set})
+	}
+	return out, fields
+}
+
+// RedactValue скрывает секреты в значении по пути path (например, from/to в diff).
+func RedactValue(path string, v any, paths []string) any {
+	for _, p := range paths {
+		if p == path {
+			if isSet(v) {
+				return Mask
+			}
+			return v
+		}
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return v
+	}
+	var nested []string
+	for _, p := range paths {
+		if rest, ok := strings.CutPrefix(p, path+"."); ok {
+			nested = append(nested, rest)
+		}
+	}
+	if len(nested) == 0 {
+		return v
+	}
+	out, _ := Redact(m, nested)
+	return out
+}
+
+// Restore подставляет вместо Mask значение из prev (предыдущей версии документа).
+// Если в prev поля нет — поле удаляется: выдать Mask устройству нельзя.
+func Restore(doc, prev map[string]any, paths []string) map[string]any {
+	if doc == nil {
+		return nil
+	}
+	out := clone(doc)
+	for _, p := range paths {
+		parent, key, ok := lookup(out, p)
+		if !ok || parent[key] != Mask {
+			continue
+		}
+		if prevParent, prevKey, ok := lookup(prev, p); ok {
+			if s, ok := prevParent[prevKey].(string); ok {
+				parent[key] = s
+				continue
+			}
+		}
+		delete(parent, key)
+	}
+	return out
+}
+
+// Extract — открытые значения заданных секретных полей (для reveal).
+func Extract(doc map[string]any, paths []string) map[string]string {
+	out := map[string]string{}
+	for _, p := range paths {
+		parent, key, ok := lookup(doc, p)
+		if !ok {
+			continue
+		}
+		if s, ok := parent[key].(string); ok && s != "" {
+			out[p] = s
+		}
+	}
+	return out
+}
+
+func isSet(v any) bool {
+	switch t := v.(type) {
+	case nil:
+		return false
+	case string:
+		return t != ""
+	default:
+		return true
+	}
+}
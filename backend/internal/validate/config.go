@@ -0,0 +1,279 @@
+package validate
+
+import (
+	"math"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// FieldError — ошибка валидации конкретного поля (путь через точку: network.wifi.ssid).
+type FieldError struct {
+	Field string `json:"field"`
+	Msg   string `json:"msg"`
+}
+
+// ConfigErrors — все найденные ошибки конфигурации.
+type ConfigErrors []FieldError
+
+func (e ConfigErrors) Error() string {
+	parts := make([]string, 0, len(e))
+	for _, fe := range e {
+		if fe.Field == "" {
+			parts = append(parts, fe.Msg)
+			continue
+		}
+		parts = append(parts, fe.Field+": "+fe.Msg)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// ConfigOptions — контекст устройства, для которого пишется конфигурация.
+type ConfigOptions struct {
+	DeviceID      string
+	ActiveVersion *int64 // последняя active, о которой сообщило устройство (nil — неизвестна)
+}
+
+const (
+	MinIntervalSec = 1
+	MaxIntervalSec = 86400
+)
+
+var hostnameRe = regexp.MustCompile(`^([a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+// Config проверяет документ по правилам docs/device-config.md (разделы 3, 4, 7).
+// Возвращает nil или ConfigErrors со всеми найденными ошибками.
+func Config(doc map[string]any, opts ConfigOptions) error {
+	if doc == nil {
+		return ConfigErrors{{Msg: "config is empty"}}
+	}
+	v := &configValidator{}
+
+	// version выдаёт backend; если уже проставлена — должна быть больше active
+	if raw, ok := doc["version"]; ok {
+		if n, ok := v.integer("version", raw); ok {
+			if n < 1 {
+				v.add("version", "must be >= 1")
+			} else if opts.ActiveVersion != nil && n <= *opts.ActiveVersion {
+				v.add("version", "must be greater than active version")
+			}
+		}
+	}
+
+	// §7: deviceId и provisioning credentials конфигурацией не меняются
+	if raw, ok := doc["deviceId"]; ok {
+		if s, _ := raw.(string); s == "" || s != opts.DeviceID {
+			v.add("deviceId", "must not change deviceId")
+		}
+	}
+	if _, ok := doc["provisioning"]; ok {
+		v.add("provisioning", "provisioning credentials cannot be changed by config")
+	}
+
+	v.network(doc)
+	v.mqtt(doc)
+	v.telemetry(doc)
+	v.device(doc, opts)
+
+	if len(v.errs) == 0 {
+		return nil
+	}
+	return v.errs
+}
+
+type configValidator struct {
+	errs ConfigErrors
+}
+
+func (v *configValidator) add(field, msg string) {
+	v.errs = append(v.errs, FieldError{Field: field, Msg: msg})
+}
+
+func (v *configValidator) network(doc map[string]any) {
+	network, ok := v.object(doc, "network", "network", true)
+	if !ok {
+		return
+	}
+
+	wifi, hasWifi := v.object(network, "wifi", "network.wifi", false)
+	gsm, hasGsm := v.object(network, "gsm", "network.gsm", false)
+
+	wifiOn := hasWifi && v.boolean(wifi, "enabled", "network.wifi.enabled")
+	gsmOn := hasGsm && v.boolean(gsm, "enabled", "network.gsm.enabled")
+	if !wifiOn && !gsmOn {
+		v.add("network", "at least one of wifi.enabled or gsm.enabled must be true")
+	}
+
+	if hasWifi {
+		ssid, _ := v.str(wifi, "ssid", "network.wifi.ssid")
+		if wifiOn && strings.TrimSpace(ssid) == "" {
+			v.add("network.wifi.ssid", "required when wifi is enabled")
+		}
+		v.str(wifi, "password", "network.wifi.password")
+	}
+	if hasGsm {
+		apn, _ := v.str(gsm, "apn", "network.gsm.apn")
+		if gsmOn && strings.TrimSpace(apn) == "" {
+			v.add("network.gsm.apn", "required when gsm is enabled")
+		}
+		v.str(gsm, "user", "network.gsm.user")
+		v.str(gsm, "password", "network.gsm.password")
+	}
+}
+
+func (v *configValidator) mqtt(doc map[string]any) {
+	mqtt, ok := v.object(doc, "mqtt", "mqtt", true)
+	if !ok {
+		return
+	}
+
+	broker, ok := v.str(mqtt, "broker", "mqtt.broker")
+	switch {
+	case !ok:
+	case strings.TrimSpace(broker) == "":
+		v.add("mqtt.broker", "required")
+	case !validBroker(broker):
+		v.add("mqtt.broker", "must be a hostname, IP or broker URL")
+	}
+
+	if raw, ok := mqtt["port"]; ok && raw != nil {
+		if n, ok := v.integer("mqtt.port", raw); ok && (n < 1 || n > 65535) {
+			v.add("mqtt.port", "must be in [1..65535]")
+		}
+	}
+	if _, ok := mqtt["tls"]; ok {
+		v.boolean(mqtt, "tls", "mqtt.tls")
+	}
+	v.nullableStr(mqtt, "clientId", "mqtt.clientId")
+	v.str(mqtt, "username", "mqtt.username")
+	v.str(mqtt, "password", "mqtt.password")
+}
+
+func (v *configValidator) telemetry(doc map[string]any) {
+	telemetry, ok := v.object(doc, "telemetry", "telemetry", true)
+	if !ok {
+		return
+	}
+
+	raw, ok := telemetry["intervalSec"]
+	if !ok {
+		v.add("telemetry.intervalSec", "required")
+	} else if n, ok := v.integer("telemetry.intervalSec", raw); ok && (n < MinIntervalSec || n > MaxIntervalSec) {
+		v.add("telemetry.intervalSec", "must be in [1..86400]")
+	}
+
+	if _, ok := telemetry["bufferEnabled"]; ok {
+		v.boolean(telemetry, "bufferEnabled", "telemetry.bufferEnabled")
+	}
+	if raw, ok := telemetry["bufferLimit"]; ok {
+		if n, ok := v.integer("telemetry.bufferLimit", raw); ok && n < 0 {
+			v.add("telemetry.bufferLimit", "must be >= 0")
+		}
+	}
+}
+
+func (v *configValidator) device(doc map[string]any, opts ConfigOptions) {
+	device, ok := v.object(doc, "device", "device", false)
+	if !ok {
+		return
+	}
+	if raw, ok := device["deviceId"]; ok {
+		if s, _ := raw.(string); s == "" || s != opts.DeviceID {
+			v.add("device.deviceId", "must not change deviceId")
+		}
+	}
+	v.str(device, "name", "device.name")
+	v.nullableStr(device, "location", "device.location")
+}
+
+// object — вложенный объект; отсутствие — ошибка только для required.
+func (v *configValidator) object(m map[string]any, key, field string, required bool) (map[string]any, bool) {
+	raw, ok := m[key]
+	if !ok || raw == nil {
+		if required {
+			v.add(field, "required")
+		}
+		return nil, false
+	}
+	obj, ok := raw.(map[string]any)
+	if !ok {
+		v.add(field, "must be an object")
+		return nil, false
+	}
+	return obj, true
+}
+
+func (v *configValidator) boolean(m map[string]any, key, field string) bool {
+	raw, ok := m[key]
+	if !ok {
+		return false
+	}
+	b, ok := raw.(bool)
+	if !ok {
+		v.add(field, "must be a boolean")
+	}
+	return b
+}
+
+// str — необязательная строка; ok=false, если поле есть, но не строка.
+func (v *configValidator) str(m map[string]any, key, field string) (string, bool) {
+	raw, ok := m[key]
+	if !ok {
+		return "", true
+	}
+	s, ok := raw.(string)
+	if !ok {
+		v.add(field, "must be a string")
+		return "", false
+	}
+	return s, true
+}
+
+func (v *configValidator) nullableStr(m map[string]any, key, field string) {
+	if raw, ok := m[key]; ok && raw != nil {
+		if _, ok := raw.(string); !ok {
+			v.add(field, "must be a string or null")
+		}
+	}
+}
+
+// integer — JSON-число без дробной части.
+func (v *configValidator) integer(field string, raw any) (int64, bool) {
+	var f float64
+	switch n := raw.(type) {
+	case float64:
+		f = n
+	case int:
+		f = float64(n)
+	case int64:
+		f = float64(n)
+	default:
+		v.add(field, "must be an integer")
+		return 0, false
+	}
+	if f != math.Trunc(f) || math.IsInf(f, 0) {
+		v.add(field, "must be an integer")
+		return 0, false
+	}
+	return int64(f), true
+}
+
+func validBroker(s string) bool {
+	if strings.Contains(s, "://") {
+		u, err := url.Parse(s)
+		if err != nil || u.Hostname() == "" {
+			return false
+		}
+		switch u.Scheme {
+		case "tcp", "ssl", "tls", "mqtt", "mqtts", "ws", "wss":
+		default:
+			return false
+		}
+		s = u.Hostname()
+	}
+	if net.ParseIP(s) != nil {
+		return true
+	}
+	return len(s) <= 253 && hostnameRe.MatchString(s)
+}
@@ -0,0 +1,8 @@
+package validate
+
+import _ "embed"
+
+// ConfigSchema — JSON Schema конфигурации устройства (отдаётся по GET /api/v1/config-schema).
+//
+//go:embed device-config.schema.json
+var ConfigSchema []byte
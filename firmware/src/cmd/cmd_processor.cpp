@@ -14,11 +14,63 @@
 
 const char *CommandProcessor::g_deviceId = nullptr;
 
+// ===== dedupe =====
+// Backend повторяет cmd с тем же id (attempt++), если не дождался ACK.
+// Помним последние выполненные id и отвечаем dup-ACK без повторного выполнения.
+// RTC_NOINIT переживает ESP.restart(), поэтому повтор reboot не перезагрузит ещё раз.
+
+static constexpr uint32_t kRecentMagic = 0x56584344; // "VXCD"
+static constexpr size_t kRecentSlots = 8;
+
+struct RecentCmd
+{
+    char id[40];
+    bool ok;
+    char code[24];
+};
+
+RTC_NOINIT_ATTR static uint32_t g_recentMagic;
+RTC_NOINIT_ATTR static uint8_t g_recentHead;
+RTC_NOINIT_ATTR static RecentCmd g_recent[kRecentSlots];
+
+static const RecentCmd *findRecent(const char *id)
+{
+    if (!id || id[0] == '\0')
+        return nullptr;
+
+    for (size_t i = 0; i < kRecentSlots; i++)
+    {
+        if (strcmp(g_recent[i].id, id) == 0)
+            return &g_recent[i];
+    }
+    return nullptr;
+}
+
+static void rememberRecent(const char *id, bool ok, const char *code)
+{
+    if (!id || id[0] == '\0' || findRecent(id))
+        return;
+
+    RecentCmd &r = g_recent[g_recentHead % kRecentSlots];
+    strlcpy(r.id, id, sizeof(r.id));
+    r.ok = ok;
+    strlcpy(r.code, code ? code : "", sizeof(r.code));
+    g_recentHead = (uint8_t)((g_recentHead + 1) % kRecentSlots);
+}
+
 // ===== init =====
 
 void CommandProcessor::init(const char *deviceId)
 {
     g_deviceId = deviceId;
+
+    if (g_recentMagic != kRecentMagic)
+    {
+        memset(g_recent, 0, sizeof(g_recent));
+        g_recentHead = 0;
+        g_recentMagic = kRecentMagic;
+    }
+
     LOGI("CMD", "init()");
 }
 
@@ -98,8 +150,32 @@ bool CommandProcessor::handleCmd(const uint8_t *payload, size_t len)
         return false;
     }
 
+    // повтор уже выполненной команды (attempt > 1) — не выполняем второй раз
+    const RecentCmd *seen = findRecent(id);
+    if (seen)
+    {
+        LOGIF("CMD", "duplicate id=%s attempt=%d", id, (int)(doc["attempt"] | 0));
+        sendAck(id, seen->ok, seen->code, "duplicate", true);
+        return true;
+    }
+
     // ===== MVP commands =====
 
+    // backend отменил команду: помечаем её id, чтобы (повторная) доставка не выполнялась
+    if (strcmp(type, "cancel") == 0)
+    {
+        const char *target = doc["params"]["id"] | "";
+        if (target[0] == '\0')
+        {
+            sendAck(id, false, "BAD_CMD", "missing params.id");
+            return false;
+        }
+        const bool alreadyDone = findRecent(target) != nullptr;
+        rememberRecent(target, false, "CANCELLED");
+        sendAck(id, true, "OK", alreadyDone ? "already executed" : "cancelled");
+        return true;
+    }
+
     if (strcmp(type, "ping") == 0)
     {
         sendAck(id, true, "OK", "");
@@ -156,11 +232,14 @@ bool CommandProcessor::handleCmd(const uint8_t *payload, size_t len)
 
 // ===== ACK / EVENT =====
 
-void CommandProcessor::sendAck(const char *id, bool ok, const char *code, const char *msg)
+void CommandProcessor::sendAck(const char *id, bool ok, const char *code, const char *msg, bool dup)
 {
     if (!g_deviceId)
         return;
 
+    if (!dup)
+        rememberRecent(id, ok, code);
+
     char topic[96];
     if (!vx_build_topic(topic, sizeof(topic), g_deviceId, VX_T_ACK))
         return;
@@ -170,13 +249,14 @@ void CommandProcessor::sendAck(const char *id, bool ok, const char *code, const
 
     snprintf(payload, sizeof(payload),
              "{\"v\":1,\"id\":\"%s\",\"deviceId\":\"%s\",\"ts\":%llu,"
-             "\"ok\":%s,\"code\":\"%s\",\"msg\":\"%s\"}",
+             "\"ok\":%s,\"code\":\"%s\",\"msg\":\"%s\"%s}",
              id ? id : "",
              g_deviceId,
              (unsigned long long)ts,
              ok ? "true" : "false",
              code ? code : "",
-             msg ? msg : "");
+             msg ? msg : "",
+             dup ? ",\"dup\":true" : "");
 
     (void)MqttClient::publish(topic, payload, false);
 }
@@ -13,7 +13,7 @@ public:
 private:
     static bool handleCmd(const uint8_t* payload, size_t len);
 
-    static void sendAck(const char* id, bool ok, const char* code, const char* msg);
+    static void sendAck(const char* id, bool ok, const char* code, const char* msg, bool dup = false);
     static void sendEvent(const char* code, const char* msg);
 
     static const char* g_deviceId;
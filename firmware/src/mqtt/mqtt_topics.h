@@ -12,7 +12,9 @@ enum VxTopicKind : uint8_t {
     VX_T_LWT,
     VX_T_CMD,
     VX_T_CFG,
-    VX_T_OTA
+    VX_T_OTA,
+    VX_T_REQ,
+    VX_T_RESP
 };
 
 inline const char* vx_topic_suffix(VxTopicKind k) {
@@ -26,6 +28,8 @@ inline const char* vx_topic_suffix(VxTopicKind k) {
         case VX_T_CMD:        return "cmd";
         case VX_T_CFG:        return "cfg";
         case VX_T_OTA:        return "ota";
+        case VX_T_REQ:        return "req";
+        case VX_T_RESP:       return "resp";
         default:              return "";
     }
 }
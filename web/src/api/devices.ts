@@ -1,5 +1,13 @@
 import { apiRequestWithAuth } from './client';
-import { Device, DeviceRuntimeState, DeviceSettings, DeviceTelemetrySnapshot } from './types';
+import {
+  Device,
+  DeviceConfigView,
+  DeviceLock,
+  DeviceRuntimeState,
+  DeviceSettings,
+  DeviceTelemetrySnapshot,
+  PayloadEncoding,
+} from './types';
 
 export const getDevices = async (
   accessToken: string,
@@ -22,6 +30,9 @@ export interface DeviceDetailResponse {
   lastTelemetry: DeviceTelemetrySnapshot | null;
   settings: DeviceSettings;
   settingsSource?: string;
+  config?: DeviceConfigView;
+  lock?: DeviceLock;
+  encoding?: PayloadEncoding;
 }
 
 export const getDeviceDetail = async (
@@ -30,6 +30,386 @@ export interface DeviceSettings {
   cfgStatus: CfgStatus;
 }
 
+/** Секретное поле конфигурации: значение в ответах заменено на SECRET_MASK. */
+export interface SecretField {
+  path: string;
+  set: boolean;
+}
+
+export const SECRET_MASK = '********';
+
+export interface DeviceConfigView {
+  desiredVersion: number | null;
+  desired?: Record<string, unknown>;
+  desiredSecrets?: SecretField[];
+  desiredAt?: number;
+  desiredBy?: string;
+  publishedAt?: number;
+  reportedActiveVersion: number | null;
+  reportedPendingVersion: number | null;
+  reportedAt?: number;
+  reportedStatus?: CfgStatus;
+  lastApply?: CfgApplyResult;
+  inSync: boolean;
+}
+
+export interface CfgApplyResult {
+  cfgVersion: number;
+  ok: boolean;
+  error: string | null;
+  at?: number;
+}
+
+export interface CfgStatusEntry {
+  ts: number;
+  status: CfgStatus;
+  activeVersion: number | null;
+  pendingVersion: number | null;
+  applyVersion?: number;
+  applyOk?: boolean;
+  applyError?: string;
+}
+
+export interface ConfigFieldError {
+  field: string;
+  msg: string;
+}
+
+export interface ConfigErrorResponse {
+  error: string;
+  fields?: ConfigFieldError[];
+}
+
+export interface ConfigVersion {
+  version: number;
+  createdBy?: string;
+  createdAt: number;
+  publishedAt: number | null;
+  rollbackOf?: number;
+  desired: boolean;
+  active: boolean;
+  outcome: { status: CfgStatus; ok: boolean | null; error: string | null; at: number } | null;
+  doc?: Record<string, unknown>;
+  secrets?: SecretField[];
+}
+
+export interface ConfigChange {
+  path: string;
+  op: 'added' | 'removed' | 'changed';
+  from?: unknown;
+  to?: unknown;
+}
+
+export interface ConfigDiff {
+  deviceId: string;
+  from: number;
+  to: number;
+  changes: ConfigChange[];
+}
+
+export interface TemplateBinding {
+  kind: 'group' | 'tag';
+  target: string;
+  priority: number;
+}
+
+export interface ConfigTemplate {
+  name: string;
+  doc: Record<string, unknown>;
+  secrets?: SecretField[];
+  revision: number;
+  updatedBy?: string;
+  createdAt: number;
+  updatedAt: number;
+  bindings: TemplateBinding[];
+}
+
+export type RolloutStatus = 'minted' | 'unchanged' | 'no_sources' | 'invalid' | 'error';
+
+export interface RolloutItem {
+  deviceId: string;
+  status: RolloutStatus;
+  cfgVersion?: number;
+  error?: string;
+  fields?: ConfigFieldError[];
+}
+
+export interface EffectiveConfig {
+  deviceId: string;
+  config: Record<string, unknown> | null;
+  secrets?: SecretField[];
+  sources: { kind: 'template' | 'override'; name?: string; revision?: number; priority?: number }[];
+  valid: boolean;
+  error?: string;
+  fields?: ConfigFieldError[];
+}
+
+export interface RevealedSecrets {
+  deviceId: string;
+  version: number;
+  secrets: Record<string, string>;
+}
+
+export interface SecretAuditEntry {
+  id: number;
+  ts: number;
+  actor: string;
+  action: 'reveal' | 'denied' | 'rotate';
+  deviceId?: string;
+  version?: number;
+  paths?: string[];
+  reason?: string;
+}
+
+export interface DeviceLock {
+  deviceId: string;
+  kind: 'cmd' | 'cfg' | 'ota';
+  ref: string;
+  holder: string;
+  acquiredAt: number;
+  expiresAt: number;
+}
+
+export interface LockConflict {
+  error: string;
+  lock: DeviceLock;
+}
+
+export interface FirmwareArtifact {
+  id: string;
+  version: string;
+  hwModel: string;
+  minHwRev: number;
+  notes: string;
+  sha256: string;
+  size: number;
+  uploadedBy?: string;
+  createdAt: number;
+  deprecated: boolean;
+  deprecatedAt?: number;
+  deprecatedBy?: string;
+  deprecatedReason?: string;
+}
+
+export interface FirmwareDownloadUrl {
+  url: string;
+  expiresAt: number;
+  sha256: string;
+  size: number;
+}
+
+export interface FirmwareDelta {
+  id: string;
+  fromVersion: string;
+  fromFirmwareId: string;
+  fromSha256: string;
+  sha256: string;
+  size: number;
+  ratio: number;
+  createdAt: number;
+}
+
+export interface OTASigningKey {
+  kid: string;
+  alg: 'Ed25519';
+  publicKey: string;
+  publicKeyHex: string;
+}
+
+export type OTACampaignStatus = 'running' | 'paused' | 'completed' | 'aborted';
+
+export type OTADeviceStatus =
+  | 'pending'
+  | 'sent'
+  | 'downloading'
+  | 'installing'
+  | 'success'
+  | 'failed'
+  | 'skipped'
+  | 'aborted';
+
+export interface OTAWaveProgress {
+  wave: number;
+  percent: number;
+  devices: number;
+  counts: Partial<Record<OTADeviceStatus, number>>;
+}
+
+export interface OTACampaign {
+  id: string;
+  name: string;
+  firmwareId: string;
+  targetVersion: string;
+  hwModel: string;
+  target: { deviceIds?: string[]; group?: string; all?: boolean };
+  fwPredicate?: string;
+  waves: number[];
+  failureThreshold: number;
+  minSamples: number;
+  waveIntervalSec: number;
+  jobTimeoutSec: number;
+  status: OTACampaignStatus;
+  wave: number;
+  pauseReason?: string;
+  createdBy?: string;
+  createdAt: number;
+  updatedAt: number;
+  finishedAt: number | null;
+  totals: Partial<Record<OTADeviceStatus, number>>;
+  waveProgress: OTAWaveProgress[];
+  transfer: OTATransfer;
+}
+
+export interface OTATransfer {
+  deltaJobs: number;
+  fullJobs: number;
+  bytesFull: number;
+  bytesSent: number;
+  bytesSaved: number;
+}
+
+export interface OTACampaignDevice {
+  deviceId: string;
+  jobId: string;
+  wave: number;
+  status: OTADeviceStatus;
+  fromFw?: string;
+  error?: string;
+  sentAt: number | null;
+  updatedAt: number;
+  download?: 'delta' | 'full';
+  deltaSize?: number;
+  fullSize?: number;
+}
+
+export interface FirmwarePolicy {
+  name: string;
+  group?: string;
+  minVersion?: string;
+  knownBad: string[];
+  targetVersion?: string;
+  autoEnroll: boolean;
+  updatedBy?: string;
+  createdAt: number;
+  updatedAt: number;
+}
+
+export type FirmwareComplianceStatus = 'compliant' | 'non_compliant' | 'unknown';
+
+export interface FirmwareComplianceDevice {
+  deviceId: string;
+  status: FirmwareComplianceStatus;
+  fw?: string;
+  reasons: string[];
+  policies: string[];
+  targetVersion?: string;
+  onTarget: boolean;
+  since?: number;
+  lastSeenAt: number;
+}
+
+export interface FirmwareComplianceReport {
+  generatedAt: number;
+  group?: string;
+  summary: { total: number; compliant: number; nonCompliant: number; unknown: number; onTarget: number };
+  versions: { version: string; devices: number; nonCompliant: number }[];
+  devices: FirmwareComplianceDevice[];
+}
+
+export interface IngestKindStats {
+  received: number;
+  processed: number;
+  dropped: number;
+  blocked: number;
+}
+
+export type IngestRejectReason =
+  | 'bad_topic'
+  | 'invalid_compression'
+  | 'unsupported_compression'
+  | 'too_large'
+  | 'invalid_encoding'
+  | 'invalid_json'
+  | 'invalid_envelope'
+  | 'device_mismatch';
+
+export interface IngestStats {
+  workers: number;
+  queueSize: number;
+  policy: 'block' | 'drop';
+  depth: number;
+  shardDepths: number[];
+  maxDepth: number;
+  dropped: number;
+  kinds: Record<string, IngestKindStats>;
+  rejected: Record<IngestRejectReason, number>;
+}
+
+export interface TelemetryDelivery {
+  deviceId: string;
+  lastSeq: number;
+  received: number;
+  duplicates: number;
+  buffered: number;
+  gaps: number;
+  missing: number;
+  recovered: number;
+  resets: number;
+  completeness: number;
+  lastGapAt?: number;
+  updatedAt: number;
+}
+
+export type PayloadEncoding = 'json' | 'msgpack' | 'cbor';
+
+export interface CompressionStats {
+  deviceId: string;
+  messages: number;
+  compressed: number;
+  wireBytes: number;
+  rawBytes: number;
+  ratio: number;
+  lastAlg?: 'deflate' | 'zstd';
+  lastDictId?: number;
+  updatedAt?: number;
+}
+
+export interface CompressionDictionary {
+  id: number;
+  size: number;
+  sha256: string;
+  url: string;
+}
+
+export type DriftState = 'in_sync' | 'pending' | 'drifting' | 'offline' | 'stuck';
+
+export interface DriftItem {
+  deviceId: string;
+  state: DriftState;
+  desiredVersion: number;
+  activeVersion: number | null;
+  pendingVersion: number | null;
+  cfgStatus?: CfgStatus;
+  deviceStatus?: string;
+  attempts: number;
+  rollbacks: number;
+  lastSentAt?: number;
+  nextAttemptAt?: number;
+  stuckAt?: number;
+}
+
+export interface DriftReport {
+  generatedAt: number;
+  total: number;
+  counts: Record<DriftState, number>;
+  items: DriftItem[];
+}
+
+export interface CfgStatusHistoryResponse {
+  deviceId: string;
+  items: CfgStatusEntry[];
+}
+
 export interface TelemetryPoint {
   ts: number;
   value: number;
@@ -60,4 +440,28 @@ export interface CommandAck {
   code?: string;
   msg?: string;
   data?: Record<string, unknown>;
+  dup?: boolean;
+  attempts?: number;
+}
+
+export type CommandStatus =
+  | 'sent'
+  | 'acked'
+  | 'failed'
+  | 'timeout'
+  | 'acked_late'
+  | 'publish_failed'
+  | 'aborted';
+
+export interface CommandRecord {
+  id: string;
+  deviceId: string;
+  type: CommandType;
+  params?: Record<string, unknown>;
+  status: CommandStatus;
+  attempts: number;
+  ack?: CommandAck;
+  createdAt: number;
+  updatedAt: number;
+  ackedAt?: number;
 }